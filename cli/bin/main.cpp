@@ -16,11 +16,18 @@
 // along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
 
 #include <atomic>
+#include <chrono>
+#include <ctime>
 #include <filesystem>
+#include <iomanip>
 #include <iostream>
 #include <optional>
+#include <random>
+#include <sstream>
 #include <string>
+#include <thread>
 #include <type_traits>
+#include <vector>
 
 #if defined(_WIN32)
 #include <fcntl.h>
@@ -49,6 +56,8 @@
 
 constexpr int kNumInputRetries = 3;
 constexpr const char* kReportTag = "cli";
+constexpr int kDefaultLogMaxSizeMB = 50;
+constexpr int kDefaultLogMaxFiles = 0;
 static std::atomic_bool gShouldQuit = std::atomic_bool(false);
 static std::atomic_bool gConnectionActive = std::atomic_bool(true);
 
@@ -212,13 +221,75 @@ std::string readOperation(std::string_view label) {
         if (result == "r" || result == restoreStr) {
             return "restore";
         }
+        if (result == retryFailedStr) {
+            return retryFailedStr;
+        }
+        if (result == labelMapTemplateStr) {
+            return labelMapTemplateStr;
+        }
+        if (result == decryptStr) {
+            return decryptStr;
+        }
+        if (result == searchStr) {
+            return searchStr;
+        }
+        if (result == rebuildCatalogStr) {
+            return rebuildCatalogStr;
+        }
+        if (result == serveIMAPStr) {
+            return serveIMAPStr;
+        }
 
-        std::cerr << "Value must be one of: b, B, Backup, backup, R, r, Restore, restore" << std::endl;
+        std::cerr << "Value must be one of: b, B, Backup, backup, R, r, Restore, restore, retry-failed, label-map-template, decrypt, "
+                     "search, rebuild-catalog, serve-imap"
+                  << std::endl;
     }
 
     throw ReadInputException(fmt::format("Failed read value for '{}'", label));
 }
 
+// readBackupFolders asks which of the given backup sub-folders to restore. Returns the comma separated names of the
+// selected folders, or an empty string to restore all of them.
+std::string readBackupFolders(std::vector<std::string> const& folders) {
+    std::cout << "The backup folder contains several backups, from oldest to most recent:" << std::endl;
+    for (size_t i = 0; i < folders.size(); i++) {
+        std::cout << "  " << (i + 1) << ") " << folders[i] << std::endl;
+    }
+
+    for (int i = 0; i < kNumInputRetries; i++) {
+        std::string result = readLine(std::cin, "Backups to restore (comma separated numbers, empty or 'all' for every backup)");
+        if (result.empty() || result == "all") {
+            return {};
+        }
+
+        std::string selected;
+        bool valid = true;
+        std::istringstream stream(result);
+        for (std::string item; std::getline(stream, item, ',');) {
+            size_t index = 0;
+            try {
+                index = std::stoul(item);
+            } catch (const std::exception&) {
+                index = 0;
+            }
+
+            if (index == 0 || index > folders.size()) {
+                std::cerr << "'" << item << "' is not the number of a backup" << std::endl;
+                valid = false;
+                break;
+            }
+
+            selected += (selected.empty() ? "" : ",") + folders[index - 1];
+        }
+
+        if (valid) {
+            return selected;
+        }
+    }
+
+    throw ReadInputException("Failed read value for 'Backups to restore'");
+}
+
 void waitForEnter(std::string_view label) {
     std::string result;
     std::cout << label << ": " << std::flush;
@@ -522,18 +593,212 @@ std::string getFilterOption(cxxopts::ParseResult const& argParseResult, const ch
     return "";
 }
 
-int performBackup(etcpp::Session& session, cxxopts::ParseResult const& argParseResult, CLIAppState const& appState) {
-    bool pathCameFromArgs = false;
-    bool usingDefaultBackupPath = true;
-    std::filesystem::path const backupPath = getBackupPath(argParseResult, session.getEmail(), pathCameFromArgs, usingDefaultBackupPath);
-    if (backupPath.empty()) {
-        return EXIT_FAILURE;
+bool continueOnFailure(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("continue-on-failure")) {
+        return argParseResult["continue-on-failure"].as<bool>();
     }
 
-    // Telemetry - we'd like to know whether the user overwrote the default export path
-    session.setUsingDefaultExportPath(!pathCameFromArgs && usingDefaultBackupPath);
+    const auto envVar = std::getenv("ET_CONTINUE_ON_FAILURE");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+bool exportKeys(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("export-keys")) {
+        return argParseResult["export-keys"].as<bool>();
+    }
+
+    const auto envVar = std::getenv("ET_EXPORT_KEYS");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+bool exportSettings(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("export-settings")) {
+        return argParseResult["export-settings"].as<bool>();
+    }
+
+    const auto envVar = std::getenv("ET_EXPORT_SETTINGS");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+bool exportContacts(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("export-contacts")) {
+        return argParseResult["export-contacts"].as<bool>();
+    }
+
+    const auto envVar = std::getenv("ET_EXPORT_CONTACTS");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+bool searchIndex(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("search-index")) {
+        return argParseResult["search-index"].as<bool>();
+    }
+
+    const auto envVar = std::getenv("ET_SEARCH_INDEX");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+bool writeCatalog(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("catalog")) {
+        return argParseResult["catalog"].as<bool>();
+    }
+
+    const auto envVar = std::getenv("ET_CATALOG");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+bool rebuildIndex(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("rebuild-index")) {
+        return argParseResult["rebuild-index"].as<bool>();
+    }
+
+    const auto envVar = std::getenv("ET_REBUILD_INDEX");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+bool restoreSettings(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("restore-settings")) {
+        return argParseResult["restore-settings"].as<bool>();
+    }
+
+    const auto envVar = std::getenv("ET_RESTORE_SETTINGS");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+bool noDedupe(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("no-dedupe")) {
+        return argParseResult["no-dedupe"].as<bool>();
+    }
+
+    const auto envVar = std::getenv("ET_NO_DEDUPE");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+bool isDryRun(cxxopts::ParseResult const& argParseResult) {
+    if (argParseResult.count("dry-run")) {
+        return argParseResult["dry-run"].as<bool>();
+    }
+
+    const auto envVar = std::getenv("ET_DRY_RUN");
+    return envVar != nullptr && std::strlen(envVar) != 0;
+}
+
+etcpp::Backup::LowDiskSpacePolicy getLowDiskSpacePolicy(cxxopts::ParseResult const& argParseResult) {
+    std::string value;
+    if (argParseResult.count("on-low-disk-space")) {
+        value = argParseResult["on-low-disk-space"].as<std::string>();
+    } else if (const auto envVar = std::getenv("ET_ON_LOW_DISK_SPACE"); envVar != nullptr) {
+        value = envVar;
+    }
+
+    if (value == "pause") {
+        return etcpp::Backup::LowDiskSpacePolicy::Pause;
+    }
+
+    if (!value.empty() && value != "abort") {
+        std::cerr << "Unknown low disk space policy '" << value << "', the export will be aborted if the disk runs full" << std::endl;
+    }
+
+    return etcpp::Backup::LowDiskSpacePolicy::Abort;
+}
+
+std::optional<etcpp::Restore::SourceFormat> getSourceFormat(cxxopts::ParseResult const& argParseResult) {
+    const auto value = getFilterOption(argParseResult, "import-format", "ET_IMPORT_FORMAT");
+    if (value.empty() || value == "backup") {
+        return etcpp::Restore::SourceFormat::Backup;
+    }
+
+    if (value == "mbox") {
+        return etcpp::Restore::SourceFormat::Mbox;
+    }
+
+    if (value == "maildir") {
+        return etcpp::Restore::SourceFormat::Maildir;
+    }
+
+    if (value == "eml") {
+        return etcpp::Restore::SourceFormat::EML;
+    }
+
+    std::cerr << "Unknown import format '" << value << "', expected backup, mbox, maildir or eml" << std::endl;
+    return std::nullopt;
+}
+
+std::optional<etcpp::Restore::ImportLabelMode> getImportLabelMode(cxxopts::ParseResult const& argParseResult) {
+    const auto value = getFilterOption(argParseResult, "import-label", "ET_IMPORT_LABEL");
+    if (value.empty() || value == "create") {
+        return etcpp::Restore::ImportLabelMode::Create;
+    }
+
+    if (value == "existing") {
+        return etcpp::Restore::ImportLabelMode::Existing;
+    }
+
+    if (value == "none") {
+        return etcpp::Restore::ImportLabelMode::None;
+    }
+
+    std::cerr << "Unknown import label mode '" << value << "', expected create, existing or none" << std::endl;
+    return std::nullopt;
+}
+
+void applyLogOptions(etcpp::GlobalScope& globalScope, cxxopts::ParseResult const& argParseResult) {
+    const auto formatStr = getFilterOption(argParseResult, "log-format", "ET_LOG_FORMAT");
+    const auto levelStr = getFilterOption(argParseResult, "log-level", "ET_LOG_LEVEL");
+    const auto maxSizeStr = getFilterOption(argParseResult, "log-max-size", "ET_LOG_MAX_SIZE");
+    const auto maxFilesStr = getFilterOption(argParseResult, "log-max-files", "ET_LOG_MAX_FILES");
+    if (formatStr.empty() && levelStr.empty() && maxSizeStr.empty() && maxFilesStr.empty()) {
+        return;
+    }
+
+    auto format = etcpp::GlobalScope::LogFormat::Text;
+    if (formatStr == "json") {
+        format = etcpp::GlobalScope::LogFormat::JSON;
+    } else if (!formatStr.empty() && formatStr != "text") {
+        std::cerr << "Unknown log format '" << formatStr << "', using text" << std::endl;
+    }
+
+    auto level = etcpp::GlobalScope::LogLevel::Debug;
+    if (levelStr == "error") {
+        level = etcpp::GlobalScope::LogLevel::Error;
+    } else if (levelStr == "warn") {
+        level = etcpp::GlobalScope::LogLevel::Warn;
+    } else if (levelStr == "info") {
+        level = etcpp::GlobalScope::LogLevel::Info;
+    } else if (!levelStr.empty() && levelStr != "debug") {
+        std::cerr << "Unknown log level '" << levelStr << "', using debug" << std::endl;
+    }
+
+    try {
+        const int maxSizeMB = maxSizeStr.empty() ? kDefaultLogMaxSizeMB : std::stoi(maxSizeStr);
+        const int maxFiles = maxFilesStr.empty() ? kDefaultLogMaxFiles : std::stoi(maxFilesStr);
+        globalScope.setLogOptions(format, level, maxSizeMB, maxFiles);
+    } catch (const std::exception& e) {
+        std::cerr << "Failed to apply log options: " << e.what() << std::endl;
+    }
+}
+
+void printBackupSummary(BackupTask const& task) {
+    try {
+        std::cout << '\n' << task.getSummary() << std::endl;
+    } catch (const etcpp::BackupException& e) {
+        etcpp::logError("Failed to get export summary: {}", e.what());
+    }
+}
+
+void printFailedMessages(BackupTask const& task) {
+    const auto failedCount = task.getFailedMessageCount();
+    if (failedCount == 0) {
+        return;
+    }
+
+    std::cout << failedCount << " message(s) could not be exported and were recorded in failures.json." << std::endl
+              << "Run the tool again with '--operation " << retryFailedStr << " --dir " << task.getExportPath()
+              << "' to retry them." << std::endl;
+}
 
-    // Get all filter options
+// getFilterOptions reads the filter options of a backup or restore and prints the active filters.
+FilterOptions getFilterOptions(cxxopts::ParseResult const& argParseResult) {
     FilterOptions filterOptions;
     
     // Handle backward compatibility: --filter/-f maps to --label
@@ -584,18 +849,34 @@ int performBackup(etcpp::Session& session, cxxopts::ParseResult const& argParseR
         std::cout << std::endl;
     }
 
-    std::filesystem::space_info spaceInfo{};
-    try {
-        spaceInfo = std::filesystem::space(backupPath);
-    } catch (const std::exception& e) {
-        etcpp::logError("Failed to get free space info: {}", e.what());
-        std::cerr << "Failed to get free space info: " << e.what() << std::endl;
+    return filterOptions;
+}
+
+int performBackup(etcpp::Session& session, cxxopts::ParseResult const& argParseResult, CLIAppState const& appState) {
+    bool pathCameFromArgs = false;
+    bool usingDefaultBackupPath = true;
+    std::filesystem::path const backupPath = getBackupPath(argParseResult, session.getEmail(), pathCameFromArgs, usingDefaultBackupPath);
+    if (backupPath.empty()) {
         return EXIT_FAILURE;
     }
 
+    // Telemetry - we'd like to know whether the user overwrote the default export path
+    session.setUsingDefaultExportPath(!pathCameFromArgs && usingDefaultBackupPath);
+
+    const FilterOptions filterOptions = getFilterOptions(argParseResult);
+
     std::unique_ptr<BackupTask> backupTask;
     try {
         backupTask = std::make_unique<BackupTask>(session, backupPath, filterOptions);
+        if (continueOnFailure(argParseResult)) {
+            backupTask->setFailurePolicy(etcpp::Backup::FailurePolicy::Continue);
+        }
+        backupTask->setLowDiskSpacePolicy(getLowDiskSpacePolicy(argParseResult));
+        backupTask->setKeyExport(exportKeys(argParseResult));
+        backupTask->setSettingsExport(exportSettings(argParseResult));
+        backupTask->setContactsExport(exportContacts(argParseResult));
+        backupTask->setSearchIndex(searchIndex(argParseResult));
+        backupTask->setCatalog(writeCatalog(argParseResult));
     } catch (const etcpp::SessionException& e) {
         etLogError("Failed to create export task: {}", e.what());
         std::cerr << "Failed to create export task: " << e.what() << std::endl;
@@ -603,22 +884,27 @@ int performBackup(etcpp::Session& session, cxxopts::ParseResult const& argParseR
     }
 
     uint64_t expectedSpace = 0;
+    uint64_t availableSpace = 0;
     try {
         expectedSpace = backupTask->getExpectedDiskUsage();
+        availableSpace = backupTask->getAvailableDiskSpace();
     } catch (const etcpp::BackupException& e) {
         std::cerr << "Could not get expected disk usage: " << e.what() << std::endl;
         return EXIT_FAILURE;
     }
 
-    if (expectedSpace > spaceInfo.available) {
+    if (expectedSpace > availableSpace) {
         std::cout << "\nThis operation requires at least " << toMB(expectedSpace) << " MB of free space, but the destination volume only has "
-                  << toMB(spaceInfo.available) << " MB available. " << std::endl
+                  << toMB(availableSpace) << " MB available. " << std::endl
                   << "Type 'Yes' to continue or 'No' to abort in the prompt below.\n"
                   << std::endl;
 
         if (!readYesNo("Do you wish to proceed?")) {
             return EXIT_SUCCESS;
         }
+
+        // The user accepted the risk, the write stage watchdog still stops the export before the disk is full.
+        backupTask->setDiskSpaceCheck(false);
     }
 
     std::cout << "Starting Export - Path=" << backupTask->getExportPath() << std::endl;
@@ -627,9 +913,50 @@ int performBackup(etcpp::Session& session, cxxopts::ParseResult const& argParseR
     } catch (const etcpp::BackupException& e) {
         etcpp::logError("Failed to export : {}", e.what());
         std::cerr << "Failed to export: " << e.what() << std::endl;
+        printFailedMessages(*backupTask);
         return EXIT_FAILURE;
     }
     std::cout << "Export Finished" << std::endl;
+    printBackupSummary(*backupTask);
+    printFailedMessages(*backupTask);
+    return EXIT_SUCCESS;
+}
+
+int performRetryFailed(etcpp::Session& session, cxxopts::ParseResult const& argParseResult, CLIAppState const& appState) {
+    std::filesystem::path backupPath;
+    bool pathCameFromArgs = false;
+    try {
+        backupPath = getRestorePath(argParseResult, pathCameFromArgs);
+    } catch (std::exception const& e) {
+        etcpp::logError("Failed to access backup directory '{}': {}", backupPath.u8string(), e.what());
+        std::cerr << "Failed to access backup directory '" << backupPath << "': " << e.what() << std::endl;
+        if (pathCameFromArgs) {
+            return EXIT_FAILURE;
+        }
+    }
+
+    std::unique_ptr<BackupTask> backupTask;
+    try {
+        backupTask = std::make_unique<BackupTask>(session, backupPath, RetryFailedBackup{});
+        backupTask->setLowDiskSpacePolicy(getLowDiskSpacePolicy(argParseResult));
+    } catch (const etcpp::SessionException& e) {
+        etLogError("Failed to create retry task: {}", e.what());
+        std::cerr << "Failed to create retry task: " << e.what() << std::endl;
+        return EXIT_FAILURE;
+    }
+
+    std::cout << "Retrying Failed Messages - Path=" << backupTask->getExportPath() << std::endl;
+    try {
+        runTaskWithProgress(appState, *backupTask);
+    } catch (const etcpp::BackupException& e) {
+        etcpp::logError("Failed to retry failed messages : {}", e.what());
+        std::cerr << "Failed to retry failed messages: " << e.what() << std::endl;
+        printFailedMessages(*backupTask);
+        return EXIT_FAILURE;
+    }
+    std::cout << "Retry Finished" << std::endl;
+    printBackupSummary(*backupTask);
+    printFailedMessages(*backupTask);
     return EXIT_SUCCESS;
 }
 
@@ -638,6 +965,240 @@ void printRestoreStats(RestoreTask const& task) {
     std::cout << "Successful imports: " << task.getImportedCount() << std::endl;
     std::cout << "Failed imports: " << task.getFailedCount() << std::endl;
     std::cout << "Skipped imports: " << task.getSkippedCount() << std::endl;
+    std::cout << "Already on the account: " << task.getDuplicateCount() << std::endl;
+    std::cout << "Still encrypted: " << task.getEncryptedCount() << std::endl;
+}
+
+int performLabelMapTemplate(etcpp::Session& session, cxxopts::ParseResult const& argParseResult) {
+    std::filesystem::path backupPath;
+    bool pathCameFromArgs = false;
+    try {
+        backupPath = getRestorePath(argParseResult, pathCameFromArgs);
+    } catch (std::exception const& e) {
+        etcpp::logError("Failed to access backup directory '{}': {}", backupPath.u8string(), e.what());
+        std::cerr << "Failed to access backup directory '" << backupPath << "': " << e.what() << std::endl;
+        if (pathCameFromArgs) {
+            return EXIT_FAILURE;
+        }
+    }
+
+    const auto format = getSourceFormat(argParseResult);
+    if (!format) {
+        return EXIT_FAILURE;
+    }
+
+    std::filesystem::path templatePath;
+    if (const auto labelMap = getFilterOption(argParseResult, "label-map", "ET_LABEL_MAP"); !labelMap.empty()) {
+        templatePath = etcpp::expandCLIPath(std::filesystem::u8path(labelMap));
+    }
+
+    try {
+        RestoreTask restoreTask(session, backupPath);
+        restoreTask.setSourceFormat(*format);
+
+        const auto writtenPath = restoreTask.writeLabelMappingTemplate(templatePath);
+        std::cout << "Label mapping template written to " << writtenPath << std::endl;
+        std::cout << "Edit it, then restore with '--label-map " << writtenPath.u8string() << "'" << std::endl;
+    } catch (const etcpp::SessionException& e) {
+        etLogError("Failed to create restore task: {}", e.what());
+        std::cerr << "Failed to create restore task: " << e.what() << std::endl;
+        return EXIT_FAILURE;
+    } catch (const etcpp::RestoreException& e) {
+        etcpp::logError("Failed to write label mapping template: {}", e.what());
+        std::cerr << "Failed to write label mapping template: " << e.what() << std::endl;
+        return EXIT_FAILURE;
+    }
+
+    return EXIT_SUCCESS;
+}
+
+int performDecrypt(etcpp::Session& session, cxxopts::ParseResult const& argParseResult) {
+    std::filesystem::path backupPath;
+    bool pathCameFromArgs = false;
+    try {
+        backupPath = getRestorePath(argParseResult, pathCameFromArgs);
+    } catch (std::exception const& e) {
+        etcpp::logError("Failed to access backup directory '{}': {}", backupPath.u8string(), e.what());
+        std::cerr << "Failed to access backup directory '" << backupPath << "': " << e.what() << std::endl;
+        if (pathCameFromArgs) {
+            return EXIT_FAILURE;
+        }
+    }
+
+    std::string privateKeyPath;
+    if (const auto privateKey = getFilterOption(argParseResult, "private-key", "ET_PRIVATE_KEY"); !privateKey.empty()) {
+        privateKeyPath = etcpp::expandCLIPath(std::filesystem::u8path(privateKey)).u8string();
+    }
+
+    auto password = getFilterOption(argParseResult, "private-key-password", "ET_PRIVATE_KEY_PASSWORD");
+
+    std::cout << "Decrypting Backup - Path=" << backupPath << std::endl;
+    try {
+        etcpp::Session::DecryptResult result;
+        try {
+            result = session.decryptBackup(backupPath.u8string().c_str(), privateKeyPath.c_str(), password);
+        } catch (const etcpp::SessionException&) {
+            // The private key may be protected by a password which was not given.
+            if (privateKeyPath.empty() || !password.empty()) {
+                throw;
+            }
+
+            password = readSecret("Private key password");
+            result = session.decryptBackup(backupPath.u8string().c_str(), privateKeyPath.c_str(), password);
+        }
+
+        std::cout << "Decrypted emails: " << result.decryptedCount << std::endl;
+        std::cout << "Still encrypted: " << result.failedCount << std::endl;
+    } catch (const etcpp::SessionException& e) {
+        etcpp::logError("Failed to decrypt backup: {}", e.what());
+        std::cerr << "Failed to decrypt backup: " << e.what() << std::endl;
+        return EXIT_FAILURE;
+    }
+
+    return EXIT_SUCCESS;
+}
+
+int performSearch(etcpp::Session& session, cxxopts::ParseResult const& argParseResult) {
+    std::filesystem::path backupPath;
+    bool pathCameFromArgs = false;
+    try {
+        backupPath = getRestorePath(argParseResult, pathCameFromArgs);
+    } catch (std::exception const& e) {
+        etcpp::logError("Failed to access backup directory '{}': {}", backupPath.u8string(), e.what());
+        std::cerr << "Failed to access backup directory '" << backupPath << "': " << e.what() << std::endl;
+        if (pathCameFromArgs) {
+            return EXIT_FAILURE;
+        }
+    }
+
+    auto query = getFilterOption(argParseResult, "query", "ET_SEARCH_QUERY");
+    if (query.empty()) {
+        query = readLine(std::cin, "Search query");
+    }
+
+    try {
+        const auto results = session.searchBackup(backupPath.u8string().c_str(), query.c_str(), rebuildIndex(argParseResult));
+
+        std::cout << "Found " << results.size() << " message(s) matching '" << query << "'" << std::endl;
+        for (const auto& result : results) {
+            std::string date = "unknown date";
+            if (result.date != 0) {
+                const auto time = static_cast<std::time_t>(result.date);
+                std::ostringstream dateStream;
+                dateStream << std::put_time(std::localtime(&time), "%Y-%m-%d");
+                date = dateStream.str();
+            }
+
+            std::cout << "\n[" << date << "] " << result.subject << " - " << result.from << std::endl;
+            std::cout << "  ID:   " << result.id << std::endl;
+            std::cout << "  Path: " << (backupPath / std::filesystem::u8path(result.path)).u8string() << std::endl;
+        }
+    } catch (const etcpp::SessionException& e) {
+        etcpp::logError("Failed to search backup: {}", e.what());
+        std::cerr << "Failed to search backup: " << e.what() << std::endl;
+        return EXIT_FAILURE;
+    }
+
+    return EXIT_SUCCESS;
+}
+
+int performRebuildCatalog(etcpp::Session& session, cxxopts::ParseResult const& argParseResult) {
+    std::filesystem::path backupPath;
+    bool pathCameFromArgs = false;
+    try {
+        backupPath = getRestorePath(argParseResult, pathCameFromArgs);
+    } catch (std::exception const& e) {
+        etcpp::logError("Failed to access backup directory '{}': {}", backupPath.u8string(), e.what());
+        std::cerr << "Failed to access backup directory '" << backupPath << "': " << e.what() << std::endl;
+        if (pathCameFromArgs) {
+            return EXIT_FAILURE;
+        }
+    }
+
+    std::cout << "Rebuilding Catalog - Path=" << backupPath << std::endl;
+    try {
+        const auto count = session.rebuildCatalog(backupPath.u8string().c_str());
+        std::cout << "Cataloged emails: " << count << std::endl;
+    } catch (const etcpp::SessionException& e) {
+        etcpp::logError("Failed to rebuild catalog: {}", e.what());
+        std::cerr << "Failed to rebuild catalog: " << e.what() << std::endl;
+        return EXIT_FAILURE;
+    }
+
+    return EXIT_SUCCESS;
+}
+
+std::string generateIMAPPassword() {
+    constexpr std::string_view chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789";
+    std::random_device device;
+    std::uniform_int_distribution<size_t> distribution(0, chars.size() - 1);
+
+    std::string password;
+    for (int i = 0; i < 16; i++) {
+        password += chars[distribution(device)];
+    }
+
+    return password;
+}
+
+int performServeIMAP(etcpp::Session& session, cxxopts::ParseResult const& argParseResult) {
+    std::filesystem::path backupPath;
+    bool pathCameFromArgs = false;
+    try {
+        backupPath = getRestorePath(argParseResult, pathCameFromArgs);
+    } catch (std::exception const& e) {
+        etcpp::logError("Failed to access backup directory '{}': {}", backupPath.u8string(), e.what());
+        std::cerr << "Failed to access backup directory '" << backupPath << "': " << e.what() << std::endl;
+        if (pathCameFromArgs) {
+            return EXIT_FAILURE;
+        }
+    }
+
+    auto addr = getFilterOption(argParseResult, "imap-addr", "ET_IMAP_ADDR");
+    if (addr.empty()) {
+        addr = "127.0.0.1:1143";
+    }
+
+    auto username = getFilterOption(argParseResult, "imap-user", "ET_IMAP_USER");
+    if (username.empty()) {
+        username = "backup";
+    }
+
+    auto password = getFilterOption(argParseResult, "imap-password", "ET_IMAP_PASSWORD");
+    if (password.empty()) {
+        password = generateIMAPPassword();
+    }
+
+    std::cout << "Loading Backup - Path=" << backupPath << std::endl;
+    try {
+        const auto info = session.startIMAPServer(backupPath.u8string().c_str(), addr.c_str(), username.c_str(), password.c_str());
+
+        std::cout << "Serving " << info.messageCount << " message(s) over IMAP, read-only" << std::endl;
+        if (info.skippedCount != 0) {
+            std::cout << info.skippedCount << " message(s) saved in parts are not served, run the decrypt operation first" << std::endl;
+        }
+
+        std::cout << "\n  Address:  " << info.addr << " (no TLS)\n"
+                  << "  User:     " << username << "\n"
+                  << "  Password: " << password << "\n\n"
+                  << "Press Ctrl+C to stop the server" << std::endl;
+    } catch (const etcpp::SessionException& e) {
+        etcpp::logError("Failed to start IMAP server: {}", e.what());
+        std::cerr << "Failed to start IMAP server: " << e.what() << std::endl;
+        return EXIT_FAILURE;
+    }
+
+    while (!gShouldQuit) {
+        std::this_thread::sleep_for(std::chrono::milliseconds(200));
+    }
+
+    try {
+        session.stopIMAPServer();
+    } catch (const etcpp::SessionException& e) {
+        etcpp::logError("Failed to stop IMAP server: {}", e.what());
+    }
+
+    return EXIT_SUCCESS;
 }
 
 int performRestore(etcpp::Session& session, cxxopts::ParseResult const& argParseResult, CLIAppState const& appState) {
@@ -653,6 +1214,16 @@ int performRestore(etcpp::Session& session, cxxopts::ParseResult const& argParse
         }
     }
 
+    const auto importLabelMode = getImportLabelMode(argParseResult);
+    if (!importLabelMode) {
+        return EXIT_FAILURE;
+    }
+
+    const auto importLabelName = getFilterOption(argParseResult, "import-label-name", "ET_IMPORT_LABEL_NAME");
+    const auto importLabelColor = getFilterOption(argParseResult, "import-label-color", "ET_IMPORT_LABEL_COLOR");
+
+    const FilterOptions filterOptions = getFilterOptions(argParseResult);
+
     std::unique_ptr<RestoreTask> restoreTask;
     try {
         restoreTask = std::make_unique<RestoreTask>(session, backupPath);
@@ -662,7 +1233,78 @@ int performRestore(etcpp::Session& session, cxxopts::ParseResult const& argParse
         return EXIT_FAILURE;
     }
 
-    std::cout << "Starting Restore - Path=" << restoreTask->getExportPath() << std::endl;
+    try {
+        restoreTask->setFilter(filterOptions);
+    } catch (const etcpp::RestoreException& e) {
+        std::cerr << "Invalid filter: " << e.what() << std::endl;
+        return EXIT_FAILURE;
+    }
+
+    try {
+        restoreTask->setImportLabel(*importLabelMode, importLabelName, importLabelColor);
+    } catch (const etcpp::RestoreException& e) {
+        std::cerr << "Invalid import label options: " << e.what() << std::endl;
+        return EXIT_FAILURE;
+    }
+
+    if (const auto workers = getFilterOption(argParseResult, "import-workers", "ET_IMPORT_WORKERS"); !workers.empty()) {
+        try {
+            restoreTask->setParallelImports(std::stoi(workers));
+        } catch (const std::exception& e) {
+            std::cerr << "Invalid number of import workers '" << workers << "': " << e.what() << std::endl;
+            return EXIT_FAILURE;
+        }
+    }
+
+    const auto format = getSourceFormat(argParseResult);
+    if (!format) {
+        return EXIT_FAILURE;
+    }
+
+    restoreTask->setSourceFormat(*format);
+
+    if (const auto folders = getFilterOption(argParseResult, "backup-folders", "ET_BACKUP_FOLDERS"); !folders.empty()) {
+        if (folders != "all") {
+            restoreTask->setBackupFolders(folders);
+        }
+    } else if (!pathCameFromArgs && *format == etcpp::Restore::SourceFormat::Backup) {
+        try {
+            if (const auto available = restoreTask->getBackupFolders(); available.size() > 1) {
+                restoreTask->setBackupFolders(readBackupFolders(available));
+            }
+        } catch (const etcpp::RestoreException& e) {
+            std::cerr << "Failed to list the backups of '" << backupPath << "': " << e.what() << std::endl;
+            return EXIT_FAILURE;
+        }
+    }
+
+    if (const auto labelMap = getFilterOption(argParseResult, "label-map", "ET_LABEL_MAP"); !labelMap.empty()) {
+        restoreTask->setLabelMappingFile(etcpp::expandCLIPath(std::filesystem::u8path(labelMap)));
+    }
+
+    if (const auto target = getFilterOption(argParseResult, "target-address", "ET_TARGET_ADDRESS"); !target.empty()) {
+        restoreTask->setTargetAddress(target);
+    }
+
+    if (const auto mapping = getFilterOption(argParseResult, "address-map", "ET_ADDRESS_MAP"); !mapping.empty()) {
+        try {
+            restoreTask->setAddressMapping(mapping);
+        } catch (const etcpp::RestoreException& e) {
+            std::cerr << "Invalid address mapping '" << mapping << "': " << e.what() << std::endl;
+            return EXIT_FAILURE;
+        }
+    }
+
+    restoreTask->setSettingsRestore(restoreSettings(argParseResult));
+    restoreTask->setDedupe(!noDedupe(argParseResult));
+
+    const bool dryRun = isDryRun(argParseResult);
+    if (dryRun) {
+        restoreTask->setDryRun(true);
+        std::cout << "Starting Restore Dry-Run - Path=" << restoreTask->getExportPath() << std::endl;
+    } else {
+        std::cout << "Starting Restore - Path=" << restoreTask->getExportPath() << std::endl;
+    }
 
     try {
         runTaskWithProgress(appState, *restoreTask);
@@ -671,6 +1313,13 @@ int performRestore(etcpp::Session& session, cxxopts::ParseResult const& argParse
         std::cerr << "Failed to restore: " << e.what() << std::endl;
         return EXIT_FAILURE;
     }
+
+    if (dryRun) {
+        std::cout << "Restore Dry-Run Finished, the account was not modified" << std::endl;
+        std::cout << '\n' << restoreTask->getDryRunReport() << std::endl;
+        return EXIT_SUCCESS;
+    }
+
     std::cout << "Restore Finished" << std::endl;
     printRestoreStats(*restoreTask);
     return EXIT_SUCCESS;
@@ -716,7 +1365,8 @@ int main(int argc, const char** argv) {
 
         cxxopts::Options options("proton-mail-export-cli");
 
-        options.add_options()("o,operation", "operation to perform, backup or restore (can also be set with env var ET_OPERATION)",
+        options.add_options()("o,operation", "operation to perform, backup, restore, retry-failed, label-map-template, decrypt, search, rebuild-catalog or serve-imap (can also be set with env var "
+                              "ET_OPERATION)",
                               cxxopts::value<std::string>())("d,dir", "Backup/restore directory (can also be set with env var ET_DIR)",
                                                              cxxopts::value<std::string>())(
             "p,password", "User's password (can also be set with env var ET_USER_PASSWORD)", cxxopts::value<std::string>())(
@@ -737,6 +1387,123 @@ int main(int argc, const char** argv) {
             "l,list-labels", "List available folder/label IDs for filtering (requires login)", cxxopts::value<bool>());
 
         options.add_options()(
+            "continue-on-failure",
+            "Skip messages which fail to export and record them for retry-failed (can also be set with env var ET_CONTINUE_ON_FAILURE)",
+            cxxopts::value<bool>())(
+            "export-keys",
+            "Write the password protected private keys of the account and their public keys to the backup (can also be set with env "
+            "var ET_EXPORT_KEYS)",
+            cxxopts::value<bool>())(
+            "export-settings",
+            "Write the mail settings of the account and the settings of its addresses to the backup (can also be set with env var "
+            "ET_EXPORT_SETTINGS)",
+            cxxopts::value<bool>())(
+            "export-contacts",
+            "Write the contacts of the account to the backup as vCard files (can also be set with env var ET_EXPORT_CONTACTS)",
+            cxxopts::value<bool>())(
+            "search-index",
+            "Build a full-text search index of the messages while they are written, for the search operation (can also be set "
+            "with env var ET_SEARCH_INDEX)",
+            cxxopts::value<bool>())(
+            "catalog",
+            "Write an SQLite catalog of the exported messages to catalog.sqlite, see also the rebuild-catalog operation (can also "
+            "be set with env var ET_CATALOG)",
+            cxxopts::value<bool>())(
+            "query",
+            "Query of the search operation, e.g. 'from:alice subject:report after:2024-01-01' (can also be set with env var "
+            "ET_SEARCH_QUERY)",
+            cxxopts::value<std::string>())(
+            "rebuild-index",
+            "Rebuild the search index of the backup before running the search operation (can also be set with env var "
+            "ET_REBUILD_INDEX)",
+            cxxopts::value<bool>())(
+            "restore-settings",
+            "Apply the mail settings saved in the backup to the account (can also be set with env var ET_RESTORE_SETTINGS)",
+            cxxopts::value<bool>())(
+            "no-dedupe",
+            "Import every message without listing the account to skip the messages already present (can also be set with env "
+            "var ET_NO_DEDUPE)",
+            cxxopts::value<bool>())(
+            "dry-run",
+            "Validate the backup and report what a restore would change without modifying the account (can also be set with env var "
+            "ET_DRY_RUN)",
+            cxxopts::value<bool>())(
+            "import-workers",
+            "Number of message batches imported concurrently during a restore (can also be set with env var ET_IMPORT_WORKERS)",
+            cxxopts::value<std::string>())(
+            "import-format",
+            "Layout of the folder to restore from: backup (made by this tool), mbox (e.g. Gmail Takeout or Thunderbird), maildir "
+            "or eml (can also be set with env var ET_IMPORT_FORMAT)",
+            cxxopts::value<std::string>())(
+            "label-map",
+            "Label mapping file applied by the restore, or where the label-map-template operation writes it (can also be set with env "
+            "var ET_LABEL_MAP)",
+            cxxopts::value<std::string>())(
+            "target-address",
+            "Restore every message into this address of the account instead of the address it was delivered to (can also be set "
+            "with env var ET_TARGET_ADDRESS)",
+            cxxopts::value<std::string>())(
+            "address-map",
+            "Map the addresses of a backup from another account to addresses of this account, as backup=account pairs "
+            "separated by commas or a file with one pair per line (can also be set with env var ET_ADDRESS_MAP)",
+            cxxopts::value<std::string>())(
+            "backup-folders",
+            "Backup sub-folders restored when the backup folder contains several backups, as comma separated folder names, or "
+            "all to merge every backup (can also be set with env var ET_BACKUP_FOLDERS)",
+            cxxopts::value<std::string>())(
+            "import-label",
+            "Label added to every restored message: create a new 'Import' label, reuse an existing label with the same name, or "
+            "none (can also be set with env var ET_IMPORT_LABEL)",
+            cxxopts::value<std::string>())(
+            "import-label-name",
+            "Name of the label added to restored messages, {date} and {time} are replaced by the start of the restore (can also "
+            "be set with env var ET_IMPORT_LABEL_NAME)",
+            cxxopts::value<std::string>())(
+            "import-label-color",
+            "Colour of the label added to restored messages, as #RGB or #RRGGBB (can also be set with env var "
+            "ET_IMPORT_LABEL_COLOR)",
+            cxxopts::value<std::string>())(
+            "imap-addr",
+            "Loopback address the serve-imap operation listens on, 127.0.0.1:1143 by default (can also be set with env var "
+            "ET_IMAP_ADDR)",
+            cxxopts::value<std::string>())(
+            "imap-user",
+            "User name of the IMAP account served by the serve-imap operation, backup by default (can also be set with env var "
+            "ET_IMAP_USER)",
+            cxxopts::value<std::string>())(
+            "imap-password",
+            "Password of the IMAP account served by the serve-imap operation, generated if not set (can also be set with env var "
+            "ET_IMAP_PASSWORD)",
+            cxxopts::value<std::string>())(
+            "private-key",
+            "Armored address private key used by the decrypt operation instead of logging in (can also be set with env var "
+            "ET_PRIVATE_KEY)",
+            cxxopts::value<std::string>())(
+            "private-key-password",
+            "Password of the private key used by the decrypt operation (can also be set with env var ET_PRIVATE_KEY_PASSWORD)",
+            cxxopts::value<std::string>())(
+            "on-low-disk-space",
+            "What to do when the export volume runs out of space: abort or pause (can also be set with env var ET_ON_LOW_DISK_SPACE)",
+            cxxopts::value<std::string>())(
+            "metrics-addr",
+            "Serve export metrics in the Prometheus format on this loopback address, e.g. 127.0.0.1:9090 (can also be set with env var "
+            "ET_METRICS_ADDR)",
+            cxxopts::value<std::string>())(
+            "otlp-endpoint",
+            "Export OpenTelemetry traces to this OTLP/HTTP endpoint, e.g. http://localhost:4318 (can also be set with env var "
+            "ET_OTLP_ENDPOINT)",
+            cxxopts::value<std::string>())(
+            "trace-file",
+            "Write OpenTelemetry traces as JSON to this file (can also be set with env var ET_TRACE_FILE)",
+            cxxopts::value<std::string>())(
+            "log-format", "Log file format: text or json (can also be set with env var ET_LOG_FORMAT)", cxxopts::value<std::string>())(
+            "log-level", "Log level: error, warn, info or debug (can also be set with env var ET_LOG_LEVEL)", cxxopts::value<std::string>())(
+            "log-max-size", "Start a new log file after this many MB (can also be set with env var ET_LOG_MAX_SIZE)",
+            cxxopts::value<std::string>())(
+            "log-max-files",
+            "Number of log files to keep in the logs folder, 0 keeps every file (can also be set with env var "
+            "ET_LOG_MAX_FILES)",
+            cxxopts::value<std::string>())(
             "k, telemetry", "Disable anonymous telemetry statistics (can also be set with env var ET_TELEMETRY_OFF)", cxxopts::value<bool>())(
             "h,help", "Show help");
 
@@ -763,6 +1530,18 @@ int main(int argc, const char** argv) {
         } catch (const std::exception&) {
         }
 
+        applyLogOptions(globalScope, argParseResult);
+
+        const auto otlpEndpoint = getFilterOption(argParseResult, "otlp-endpoint", "ET_OTLP_ENDPOINT");
+        const auto traceFile = getFilterOption(argParseResult, "trace-file", "ET_TRACE_FILE");
+        if (!otlpEndpoint.empty() || !traceFile.empty()) {
+            try {
+                globalScope.initTracing(otlpEndpoint.c_str(), traceFile.c_str());
+            } catch (const etcpp::Exception& e) {
+                std::cerr << "Failed to enable tracing: " << e.what() << std::endl;
+            }
+        }
+
         if (const auto& logPath = globalScope.getLogPath(); logPath) {
             std::cout << "\nSession Log: " << *logPath << '\n' << std::endl;
         }
@@ -771,6 +1550,15 @@ int main(int argc, const char** argv) {
 
         etcpp::Session session = etcpp::Session(et::DEFAULT_API_URL, telemetryDisabled, std::make_shared<SessionCallback>());
 
+        if (const auto metricsAddr = getFilterOption(argParseResult, "metrics-addr", "ET_METRICS_ADDR"); !metricsAddr.empty()) {
+            try {
+                const auto listenAddr = session.startMetricsServer(metricsAddr.c_str());
+                std::cout << "Metrics: http://" << listenAddr << "/metrics\n" << std::endl;
+            } catch (const etcpp::SessionException& e) {
+                std::cerr << "Failed to start metrics server: " << e.what() << std::endl;
+            }
+        }
+
         // Unauth telemetry
         session.sendProcessStartTelemetry(argParseResult.count("operation") || (std::getenv("ET_OPERATION") != nullptr),
                                           argParseResult.count("dir") || (std::getenv("ET_DIR") != nullptr),
@@ -780,6 +1568,27 @@ int main(int argc, const char** argv) {
                                           argParseResult.count("user") || (std::getenv("ET_USER_EMAIL") != nullptr));
 
 
+        // Decrypting a backup with a private key is done offline, without logging in.
+        if (stringToOperation(getFilterOption(argParseResult, "operation", "ET_OPERATION")) == EOperation::Decrypt &&
+            !getFilterOption(argParseResult, "private-key", "ET_PRIVATE_KEY").empty()) {
+            return performDecrypt(session, argParseResult);
+        }
+
+        // Searching a backup is done offline, without logging in.
+        if (stringToOperation(getFilterOption(argParseResult, "operation", "ET_OPERATION")) == EOperation::Search) {
+            return performSearch(session, argParseResult);
+        }
+
+        // The catalog is rebuilt from the files of the backup, offline.
+        if (stringToOperation(getFilterOption(argParseResult, "operation", "ET_OPERATION")) == EOperation::RebuildCatalog) {
+            return performRebuildCatalog(session, argParseResult);
+        }
+
+        // Serving a backup over IMAP is done offline, without logging in.
+        if (stringToOperation(getFilterOption(argParseResult, "operation", "ET_OPERATION")) == EOperation::ServeIMAP) {
+            return performServeIMAP(session, argParseResult);
+        }
+
         std::optional<int> exitCode = performLogin(session, argParseResult, appState);
         if (exitCode.has_value()) {
             return *exitCode;
@@ -817,6 +1626,24 @@ int main(int argc, const char** argv) {
         case EOperation::Restore:
             return performRestore(session, argParseResult, appState);
             break;
+        case EOperation::RetryFailed:
+            return performRetryFailed(session, argParseResult, appState);
+            break;
+        case EOperation::LabelMapTemplate:
+            return performLabelMapTemplate(session, argParseResult);
+            break;
+        case EOperation::Decrypt:
+            return performDecrypt(session, argParseResult);
+            break;
+        case EOperation::Search:
+            return performSearch(session, argParseResult);
+            break;
+        case EOperation::RebuildCatalog:
+            return performRebuildCatalog(session, argParseResult);
+            break;
+        case EOperation::ServeIMAP:
+            return performServeIMAP(session, argParseResult);
+            break;
         default:
             throw etcpp::Exception("Could not determine operation to perform (" + operationStr + ")");
         }
@@ -19,6 +19,12 @@
 
 std::string backupStr = "backup";
 std::string restoreStr = "restore";
+std::string retryFailedStr = "retry-failed";
+std::string labelMapTemplateStr = "label-map-template";
+std::string decryptStr = "decrypt";
+std::string searchStr = "search";
+std::string rebuildCatalogStr = "rebuild-catalog";
+std::string serveIMAPStr = "serve-imap";
 
 //****************************************************************************************************************************************************
 /// \param[in] operationStr The string representing the operation.
@@ -33,5 +39,29 @@ EOperation stringToOperation(std::string_view const operationStr) {
         return EOperation::Restore;
     }
 
+    if (operationStr == retryFailedStr) {
+        return EOperation::RetryFailed;
+    }
+
+    if (operationStr == labelMapTemplateStr) {
+        return EOperation::LabelMapTemplate;
+    }
+
+    if (operationStr == decryptStr) {
+        return EOperation::Decrypt;
+    }
+
+    if (operationStr == searchStr) {
+        return EOperation::Search;
+    }
+
+    if (operationStr == rebuildCatalogStr) {
+        return EOperation::RebuildCatalog;
+    }
+
+    if (operationStr == serveIMAPStr) {
+        return EOperation::ServeIMAP;
+    }
+
     return EOperation::Unknown;
 }
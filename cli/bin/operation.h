@@ -23,6 +23,12 @@
 
 extern std::string backupStr;
 extern std::string restoreStr;
+extern std::string retryFailedStr;
+extern std::string labelMapTemplateStr;
+extern std::string decryptStr;
+extern std::string searchStr;
+extern std::string rebuildCatalogStr;
+extern std::string serveIMAPStr;
 
 //****************************************************************************************************************************************************
 /// \brief Enumeration for the operation to perform.
@@ -30,7 +36,13 @@ extern std::string restoreStr;
 enum class EOperation {
     Backup = 0,
     Restore = 1,
-    Unknown = 2,
+    RetryFailed = 2,
+    LabelMapTemplate = 3,
+    Decrypt = 4,
+    Search = 5,
+    RebuildCatalog = 6,
+    ServeIMAP = 7,
+    Unknown = 8,
 };
 
 EOperation stringToOperation(std::string_view operationString); ///< Converts a string to an operation.
@@ -35,6 +35,9 @@ BackupTask::BackupTask(etcpp::Session& session, const std::filesystem::path& bac
 BackupTask::BackupTask(etcpp::Session& session, const std::filesystem::path& backupPath, const char* labelIDs) :
     mBackup(session.newBackup(backupPath.u8string().c_str(), labelIDs)) {}
 
+BackupTask::BackupTask(etcpp::Session& session, const std::filesystem::path& backupPath, RetryFailedBackup) :
+    mBackup(session.newRetryFailedBackup(backupPath.u8string().c_str())) {}
+
 void BackupTask::onProgress(float progress) {
     updateProgress(progress);
 }
@@ -21,21 +21,12 @@
 #include <filesystem>
 #include <string>
 
+#include "tasks/filter_options.hpp"
 #include "tasks/task.hpp"
 #include "tui_util.hpp"
 
-// FilterOptions encapsulates all filter parameters for export
-struct FilterOptions {
-    std::string labelIDs;
-    std::string sender;
-    std::string recipient;
-    std::string domain;
-    std::string after;
-    std::string before;
-    std::string subject;
-
-    FilterOptions() = default;
-};
+// RetryFailedBackup selects the BackupTask constructor which retries the failed messages of an existing backup.
+struct RetryFailedBackup {};
 
 class BackupTask final : public TaskWithProgress<void>, etcpp::BackupCallback {
 private:
@@ -46,6 +37,7 @@ public:
     BackupTask(etcpp::Session& session, const std::filesystem::path& backupPath, const FilterOptions& filterOptions = FilterOptions());
     // Backward compatibility constructor
     BackupTask(etcpp::Session& session, const std::filesystem::path& backupPath, const char* labelIDs);
+    BackupTask(etcpp::Session& session, const std::filesystem::path& backupPath, RetryFailedBackup);
     ~BackupTask() override = default;
     BackupTask(const BackupTask&) = delete;
     BackupTask(BackupTask&&) = delete;
@@ -62,6 +54,28 @@ public:
 
     inline uint64_t getExpectedDiskUsage() const { return mBackup.getExpectedDiskUsage(); }
 
+    inline uint64_t getAvailableDiskSpace() const { return mBackup.getAvailableDiskSpace(); }
+
+    inline void setDiskSpaceCheck(bool enabled) { mBackup.setDiskSpaceCheck(enabled); }
+
+    inline void setLowDiskSpacePolicy(etcpp::Backup::LowDiskSpacePolicy policy) { mBackup.setLowDiskSpacePolicy(policy); }
+
+    inline void setKeyExport(bool enabled) { mBackup.setKeyExport(enabled); }
+
+    inline void setSettingsExport(bool enabled) { mBackup.setSettingsExport(enabled); }
+
+    inline void setContactsExport(bool enabled) { mBackup.setContactsExport(enabled); }
+
+    inline void setSearchIndex(bool enabled) { mBackup.setSearchIndex(enabled); }
+
+    inline void setCatalog(bool enabled) { mBackup.setCatalog(enabled); }
+
+    inline void setFailurePolicy(etcpp::Backup::FailurePolicy policy) { mBackup.setFailurePolicy(policy); }
+
+    inline uint64_t getFailedMessageCount() const { return mBackup.getFailedMessageCount(); }
+
+    inline std::string getSummary() const { return mBackup.getSummary(etcpp::Backup::SummaryFormat::Text); }
+
 private:
     void onProgress(float progress) override;
 };
@@ -0,0 +1,33 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+#pragma once
+
+#include <string>
+
+// FilterOptions encapsulates all filter parameters for export and restore
+struct FilterOptions {
+    std::string labelIDs;
+    std::string sender;
+    std::string recipient;
+    std::string domain;
+    std::string after;
+    std::string before;
+    std::string subject;
+
+    FilterOptions() = default;
+};
@@ -22,6 +22,16 @@
 RestoreTask::RestoreTask(etcpp::Session& session, const std::filesystem::path& exportPath) :
     mRestore(session.newRestore(exportPath.u8string().c_str())) {}
 
+void RestoreTask::setFilter(const FilterOptions& filterOptions) {
+    mRestore.setFilterLabelIDs(filterOptions.labelIDs.c_str());
+    mRestore.setFilterSender(filterOptions.sender.c_str());
+    mRestore.setFilterRecipient(filterOptions.recipient.c_str());
+    mRestore.setFilterDomain(filterOptions.domain.c_str());
+    mRestore.setFilterAfter(filterOptions.after.c_str());
+    mRestore.setFilterBefore(filterOptions.before.c_str());
+    mRestore.setFilterSubject(filterOptions.subject.c_str());
+}
+
 void RestoreTask::onProgress(float progress) {
     updateProgress(progress);
 }
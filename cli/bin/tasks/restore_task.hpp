@@ -20,6 +20,7 @@
 #include <etrestore.hpp>
 #include <filesystem>
 
+#include "tasks/filter_options.hpp"
 #include "tasks/task.hpp"
 #include "tui_util.hpp"
 
@@ -47,6 +48,25 @@ public:
     uint64_t getImportedCount() const { return mRestore.getImportedCount(); }
     uint64_t getFailedCount() const { return mRestore.getFailedCount(); }
     uint64_t getSkippedCount() const { return mRestore.getSkippedCount(); }
+    uint64_t getDuplicateCount() const { return mRestore.getDuplicateCount(); }
+    uint64_t getEncryptedCount() const { return mRestore.getEncryptedCount(); }
+
+    void setDryRun(bool dryRun) { mRestore.setDryRun(dryRun); }
+    void setFilter(const FilterOptions& filterOptions);
+    void setImportLabel(etcpp::Restore::ImportLabelMode mode, const std::string& name, const std::string& color) {
+        mRestore.setImportLabel(mode, name.c_str(), color.c_str());
+    }
+    void setSettingsRestore(bool enabled) { mRestore.setSettingsRestore(enabled); }
+    void setDedupe(bool enabled) { mRestore.setDedupe(enabled); }
+    void setParallelImports(int parallelImports) { mRestore.setParallelImports(parallelImports); }
+    void setSourceFormat(etcpp::Restore::SourceFormat format) { mRestore.setSourceFormat(format); }
+    void setLabelMappingFile(const std::filesystem::path& path) { mRestore.setLabelMappingFile(path); }
+    std::filesystem::path writeLabelMappingTemplate(const std::filesystem::path& path) const { return mRestore.writeLabelMappingTemplate(path); }
+    void setTargetAddress(const std::string& email) { mRestore.setTargetAddress(email.c_str()); }
+    void setAddressMapping(const std::string& mapping) { mRestore.setAddressMapping(mapping.c_str()); }
+    void setBackupFolders(const std::string& folders) { mRestore.setBackupFolders(folders.c_str()); }
+    std::vector<std::string> getBackupFolders() const { return mRestore.getBackupFolders(); }
+    std::string getDryRunReport() const { return mRestore.getDryRunReport(etcpp::Restore::ReportFormat::Text); }
 
 private:
     void onProgress(float progress) override;
@@ -29,6 +29,21 @@ typedef enum etBackupStatus {
 	ET_BACKUP_STATUS_CANCELLED,
 } etBackupStatus;
 
+typedef enum etBackupFailurePolicy {
+	ET_BACKUP_FAILURE_POLICY_ABORT,
+	ET_BACKUP_FAILURE_POLICY_CONTINUE,
+} etBackupFailurePolicy;
+
+typedef enum etBackupLowDiskSpacePolicy {
+	ET_BACKUP_LOW_DISK_SPACE_POLICY_ABORT,
+	ET_BACKUP_LOW_DISK_SPACE_POLICY_PAUSE,
+} etBackupLowDiskSpacePolicy;
+
+typedef enum etBackupSummaryFormat {
+	ET_BACKUP_SUMMARY_FORMAT_JSON,
+	ET_BACKUP_SUMMARY_FORMAT_TEXT,
+} etBackupSummaryFormat;
+
 typedef enum etBackupMessageType {
 	ET_BACKUP_MESSAGE_TYPE_PROGRESS,
 } etBackupMessageType;
@@ -36,6 +51,7 @@ typedef enum etBackupMessageType {
 typedef struct etBackupCallbacks {
     void* ptr;
     void (*onProgress)(void* ptr, float progress);
+    void (*onPauseStateChanged)(void* ptr, int paused);
 } etBackupCallbacks;
 
 #endif // ET_BACKUP_H
@@ -26,6 +26,12 @@ inline void etBackupCallbackOnProgress(etBackupCallbacks* cb, float progress) {
     cb->onProgress(cb->ptr, progress);
 }
 
+inline void etBackupCallbackOnPauseStateChanged(etBackupCallbacks* cb, int paused) {
+    if (cb->onPauseStateChanged != NULL) {
+        cb->onPauseStateChanged(cb->ptr, paused);
+    }
+}
+
 #endif // ET_CGO
 
 #endif // ET_BACKUP_IMPL_H
@@ -22,4 +22,16 @@
 typedef const char cchar_t;
 typedef void(*etOnRecoverFn)();
 
+typedef enum etLogFormat {
+	ET_LOG_FORMAT_TEXT,
+	ET_LOG_FORMAT_JSON,
+} etLogFormat;
+
+typedef enum etLogLevel {
+	ET_LOG_LEVEL_ERROR,
+	ET_LOG_LEVEL_WARN,
+	ET_LOG_LEVEL_INFO,
+	ET_LOG_LEVEL_DEBUG,
+} etLogLevel;
+
 #endif // ET_GLOBAL_H
@@ -30,6 +30,24 @@ typedef enum etRestoreStatus {
 	ET_RESTORE_STATUS_CANCELLED,
 } etRestoreStatus;
 
+typedef enum etRestoreReportFormat {
+	ET_RESTORE_REPORT_FORMAT_JSON,
+	ET_RESTORE_REPORT_FORMAT_TEXT,
+} etRestoreReportFormat;
+
+typedef enum etRestoreImportLabelMode {
+	ET_RESTORE_IMPORT_LABEL_MODE_CREATE,
+	ET_RESTORE_IMPORT_LABEL_MODE_EXISTING,
+	ET_RESTORE_IMPORT_LABEL_MODE_NONE,
+} etRestoreImportLabelMode;
+
+typedef enum etRestoreSourceFormat {
+	ET_RESTORE_SOURCE_FORMAT_BACKUP,
+	ET_RESTORE_SOURCE_FORMAT_MBOX,
+	ET_RESTORE_SOURCE_FORMAT_MAILDIR,
+	ET_RESTORE_SOURCE_FORMAT_EML,
+} etRestoreSourceFormat;
+
 typedef enum etRestoreMessageType {
 	ET_RESTORE_MESSAGE_TYPE_PROGRESS,
 } etRestoreMessageType;
@@ -37,6 +55,7 @@ typedef enum etRestoreMessageType {
 typedef struct etRestoreCallbacks {
     void* ptr;
     void (*onProgress)(void* ptr, float progress);
+    void (*onPauseStateChanged)(void* ptr, int paused);
 } etRestoreCallbacks;
 
 #endif // ET_RESTORE_H
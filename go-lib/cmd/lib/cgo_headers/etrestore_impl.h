@@ -26,6 +26,12 @@ inline void etRestoreCallbackOnProgress(etRestoreCallbacks* cb, float progress)
     cb->onProgress(cb->ptr, progress);
 }
 
+inline void etRestoreCallbackOnPauseStateChanged(etRestoreCallbacks* cb, int paused) {
+    if (cb->onPauseStateChanged != NULL) {
+        cb->onPauseStateChanged(cb->ptr, paused);
+    }
+}
+
 #endif // ET_CGO
 
 #endif // ET_RESTORE_IMPL_H
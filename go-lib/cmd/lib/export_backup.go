@@ -28,7 +28,6 @@ import (
 	"errors"
 	"path/filepath"
 	"runtime/cgo"
-	"strings"
 	"sync/atomic"
 	"time"
 	"unsafe"
@@ -105,6 +104,45 @@ func etSessionNewBackup(
 	return C.ET_SESSION_STATUS_OK
 }
 
+//export etSessionNewRetryFailedBackup
+func etSessionNewRetryFailedBackup(
+	sessionPtr *C.etSession,
+	cBackupPath *C.cchar_t,
+	outBackup **C.etBackup,
+) C.etSessionStatus {
+	cSession, ok := resolveSession(sessionPtr)
+	if !ok {
+		return C.ET_SESSION_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(cSession.s.GetPanicHandler())
+
+	if cSession.s.LoginState() != session.LoginStateLoggedIn {
+		cSession.setLastError(session.ErrInvalidLoginState)
+		return C.ET_SESSION_STATUS_ERROR
+	}
+
+	mailExport, err := mail.NewRetryFailedExportTask(cSession.ctx, C.GoString(cBackupPath), cSession.s)
+	if err != nil {
+		cSession.setLastError(err)
+		return C.ET_SESSION_STATUS_ERROR
+	}
+
+	// Retrying is only useful if the remaining messages are attempted even if some fail again.
+	mailExport.SetFailurePolicy(mail.FailurePolicyContinue)
+
+	h := internal.NewHandle(&cBackup{
+		csession: cSession,
+		exporter: mailExport,
+	})
+
+	// Intentional misuse of unsafe pointer.
+	//goland:noinspection GoVetUnsafePointer
+	*outBackup = (*C.etBackup)(unsafe.Pointer(h)) //nolint:govet
+
+	return C.ET_SESSION_STATUS_OK
+}
+
 // safeGoString safely converts a C string to Go string, handling nil pointers.
 func safeGoString(cStr *C.cchar_t) string {
 	if cStr == nil {
@@ -190,6 +228,120 @@ func etBackupCancel(ptr *C.etBackup) C.etBackupStatus {
 	return C.ET_BACKUP_STATUS_OK
 }
 
+//export etBackupPause
+func etBackupPause(ptr *C.etBackup) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.exporter.Pause()
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupResume
+func etBackupResume(ptr *C.etBackup) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.exporter.Resume()
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupIsPaused
+func etBackupIsPaused(ptr *C.etBackup, outPaused *C.int) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	if ce.exporter.IsPaused() {
+		*outPaused = 1
+	} else {
+		*outPaused = 0
+	}
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupSetFailurePolicy
+func etBackupSetFailurePolicy(ptr *C.etBackup, policy C.etBackupFailurePolicy) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	switch policy {
+	case C.ET_BACKUP_FAILURE_POLICY_ABORT:
+		ce.exporter.SetFailurePolicy(mail.FailurePolicyAbort)
+	case C.ET_BACKUP_FAILURE_POLICY_CONTINUE:
+		ce.exporter.SetFailurePolicy(mail.FailurePolicyContinue)
+	default:
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupGetFailedMessageCount
+func etBackupGetFailedMessageCount(ptr *C.etBackup, outCount *C.uint64_t) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	*outCount = C.uint64_t(ce.exporter.GetFailedMessageCount())
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupGetSummary
+func etBackupGetSummary(ptr *C.etBackup, format C.etBackupSummaryFormat, outSummary **C.char) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	summary := ce.exporter.GetSummary()
+	if summary == nil {
+		ce.lastError.Set(mail.ErrNoExportSummary)
+		return C.ET_BACKUP_STATUS_ERROR
+	}
+
+	switch format {
+	case C.ET_BACKUP_SUMMARY_FORMAT_JSON:
+		data, err := summary.ToJSON()
+		if err != nil {
+			ce.lastError.Set(internal.MapError(err))
+			return C.ET_BACKUP_STATUS_ERROR
+		}
+
+		*outSummary = C.CString(string(data))
+	case C.ET_BACKUP_SUMMARY_FORMAT_TEXT:
+		*outSummary = C.CString(summary.ToText())
+	default:
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
 //export etBackupGetLastError
 func etBackupGetLastError(ptr *C.etBackup) *C.cchar_t {
 	ce, ok := resolveBackup(ptr)
@@ -220,6 +372,131 @@ func etBackupGetRequiredDiskSpaceEstimate(ptr *C.etBackup, outSpace *C.uint64_t)
 	return C.ET_BACKUP_STATUS_OK
 }
 
+//export etBackupGetAvailableDiskSpace
+func etBackupGetAvailableDiskSpace(ptr *C.etBackup, outSpace *C.uint64_t) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	space, err := ce.exporter.GetAvailableDiskSpace()
+	if err != nil {
+		ce.lastError.Set(internal.MapError(err))
+		return C.ET_BACKUP_STATUS_ERROR
+	}
+
+	*outSpace = C.uint64_t(space)
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupSetKeyExport
+func etBackupSetKeyExport(ptr *C.etBackup, enabled C.int) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.exporter.SetKeyExport(enabled != 0)
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupSetSettingsExport
+func etBackupSetSettingsExport(ptr *C.etBackup, enabled C.int) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.exporter.SetSettingsExport(enabled != 0)
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupSetContactsExport
+func etBackupSetContactsExport(ptr *C.etBackup, enabled C.int) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.exporter.SetContactsExport(enabled != 0)
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupSetSearchIndex
+func etBackupSetSearchIndex(ptr *C.etBackup, enabled C.int) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.exporter.SetSearchIndex(enabled != 0)
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupSetCatalog
+func etBackupSetCatalog(ptr *C.etBackup, enabled C.int) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.exporter.SetCatalog(enabled != 0)
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupSetDiskSpaceCheck
+func etBackupSetDiskSpaceCheck(ptr *C.etBackup, enabled C.int) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.exporter.SetDiskSpaceCheck(enabled != 0)
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
+//export etBackupSetLowDiskSpacePolicy
+func etBackupSetLowDiskSpacePolicy(ptr *C.etBackup, policy C.etBackupLowDiskSpacePolicy) C.etBackupStatus {
+	ce, ok := resolveBackup(ptr)
+	if !ok {
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	switch policy {
+	case C.ET_BACKUP_LOW_DISK_SPACE_POLICY_ABORT:
+		ce.exporter.SetLowDiskSpacePolicy(mail.LowDiskSpacePolicyAbort)
+	case C.ET_BACKUP_LOW_DISK_SPACE_POLICY_PAUSE:
+		ce.exporter.SetLowDiskSpacePolicy(mail.LowDiskSpacePolicyPause)
+	default:
+		return C.ET_BACKUP_STATUS_INVALID
+	}
+
+	return C.ET_BACKUP_STATUS_OK
+}
+
 //export etBackupGetExportPath
 func etBackupGetExportPath(ptr *C.etBackup, outPath **C.char) C.etBackupStatus {
 	ce, ok := resolveBackup(ptr)
@@ -287,6 +564,15 @@ func (m *backupReporter) OnProgress(delta int) {
 	C.etBackupCallbackOnProgress(m.callbacks, C.float(progress))
 }
 
+func (m *backupReporter) OnPauseStateChanged(paused bool) {
+	var cPaused C.int
+	if paused {
+		cPaused = 1
+	}
+
+	C.etBackupCallbackOnPauseStateChanged(m.callbacks, cPaused)
+}
+
 func (m *backupReporter) GetTotalMessageCount() uint64 {
 	return m.totalMessageCount.Load()
 }
@@ -24,14 +24,17 @@ package main
 */
 import "C"
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
-	"path/filepath"
 	"sync"
 	"unsafe"
 
 	"github.com/ProtonMail/export-tool/internal"
 	"github.com/ProtonMail/export-tool/internal/reporter"
 	"github.com/ProtonMail/export-tool/internal/sentry"
+	"github.com/ProtonMail/export-tool/internal/tracing"
 	"github.com/ProtonMail/export-tool/internal/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -50,24 +53,15 @@ func etInit(filePath *C.cchar_t, onRecover C.etOnRecoverFn) C.int {
 		return -1
 	}
 
-	path := C.GoString(filePath)
-
-	if err := os.MkdirAll(path, 0o700); err != nil {
-		etGlobalState.lastError.Set(err)
-		return -1
-	}
-
-	path = filepath.Join(path, internal.NewLogFileName())
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	file, err := internal.InitLogging(C.GoString(filePath))
 	if err != nil {
 		etGlobalState.lastError.Set(err)
 		return -1
 	}
 
-	etGlobalState.clogPath = C.CString(path)
+	etGlobalState.file = file
+	etGlobalState.clogPath = C.CString(file.Path())
 
-	logrus.SetOutput(file)
-	logrus.SetFormatter(internal.NewLogFormatter())
 	internal.LogPrelude()
 
 	if onRecover != nil {
@@ -85,6 +79,79 @@ func etInit(filePath *C.cchar_t, onRecover C.etOnRecoverFn) C.int {
 	return 0
 }
 
+//export etSetLogOptions
+func etSetLogOptions(format C.etLogFormat, level C.etLogLevel, maxFileSizeMB C.int, maxFiles C.int) C.int {
+	etGlobalState.mutex.Lock()
+	defer etGlobalState.mutex.Unlock()
+
+	if etGlobalState.file == nil {
+		etGlobalState.lastError.Set(errors.New("logging has not been initialized"))
+		return -1
+	}
+
+	opts := internal.LogOptions{
+		Format:      internal.LogFormatText,
+		Level:       logrus.DebugLevel,
+		MaxFileSize: int64(maxFileSizeMB) * 1024 * 1024,
+		MaxFiles:    int(maxFiles),
+	}
+
+	switch format {
+	case C.ET_LOG_FORMAT_TEXT:
+		opts.Format = internal.LogFormatText
+	case C.ET_LOG_FORMAT_JSON:
+		opts.Format = internal.LogFormatJSON
+	default:
+		etGlobalState.lastError.Set(fmt.Errorf("invalid log format: %v", format))
+		return -1
+	}
+
+	switch level {
+	case C.ET_LOG_LEVEL_ERROR:
+		opts.Level = logrus.ErrorLevel
+	case C.ET_LOG_LEVEL_WARN:
+		opts.Level = logrus.WarnLevel
+	case C.ET_LOG_LEVEL_INFO:
+		opts.Level = logrus.InfoLevel
+	case C.ET_LOG_LEVEL_DEBUG:
+		opts.Level = logrus.DebugLevel
+	default:
+		etGlobalState.lastError.Set(fmt.Errorf("invalid log level: %v", level))
+		return -1
+	}
+
+	if err := internal.ApplyLogOptions(etGlobalState.file, opts); err != nil {
+		etGlobalState.lastError.Set(err)
+		return -1
+	}
+
+	return 0
+}
+
+//export etInitTracing
+func etInitTracing(endpoint *C.cchar_t, filePath *C.cchar_t) C.int {
+	etGlobalState.mutex.Lock()
+	defer etGlobalState.mutex.Unlock()
+
+	if etGlobalState.tracingShutdown != nil {
+		etGlobalState.lastError.Set(errors.New("tracing has already been initialized"))
+		return -1
+	}
+
+	shutdown, err := tracing.Init(context.Background(), tracing.Config{
+		Endpoint: C.GoString(endpoint),
+		File:     C.GoString(filePath),
+	})
+	if err != nil {
+		etGlobalState.lastError.Set(err)
+		return -1
+	}
+
+	etGlobalState.tracingShutdown = shutdown
+
+	return 0
+}
+
 //export etGetLastError
 func etGetLastError() *C.cchar_t {
 	etGlobalState.mutex.Lock()
@@ -129,6 +196,14 @@ func etClose() {
 	etGlobalState.mutex.Lock()
 	defer etGlobalState.mutex.Unlock()
 
+	if etGlobalState.tracingShutdown != nil {
+		if err := etGlobalState.tracingShutdown(context.Background()); err != nil {
+			logrus.WithError(err).Error("Failed to flush traces")
+		}
+
+		etGlobalState.tracingShutdown = nil
+	}
+
 	if etGlobalState.file != nil {
 		logrus.SetOutput(os.Stdout)
 		if err := etGlobalState.file.Close(); err != nil {
@@ -147,11 +222,13 @@ func etClose() {
 
 type globalState struct {
 	mutex       sync.Mutex
-	file        *os.File
+	file        *internal.LogFile
 	lastError   utils.CLastError
 	clogPath    *C.char
 	onRecoverCB func()
 	reporter    reporter.Reporter
+
+	tracingShutdown tracing.ShutdownFn
 }
 
 func GetGlobalReporter() reporter.Reporter {
@@ -23,6 +23,8 @@ package main
 */
 import "C"
 import (
+	"unsafe"
+
 	"github.com/sirupsen/logrus"
 )
 
@@ -51,5 +53,18 @@ func etLogGetPath() *C.cchar_t {
 	etGlobalState.mutex.Lock()
 	defer etGlobalState.mutex.Unlock()
 
+	if etGlobalState.file == nil {
+		return etGlobalState.clogPath
+	}
+
+	// The log file changes on rotation, the previous string is only released once the path differs.
+	if path := etGlobalState.file.Path(); etGlobalState.clogPath == nil || C.GoString(etGlobalState.clogPath) != path {
+		if etGlobalState.clogPath != nil {
+			C.free(unsafe.Pointer(etGlobalState.clogPath))
+		}
+
+		etGlobalState.clogPath = C.CString(path)
+	}
+
 	return etGlobalState.clogPath
 }
@@ -27,6 +27,7 @@ import (
 	"context"
 	"errors"
 	"runtime/cgo"
+	"strings"
 	"sync/atomic"
 	"time"
 	"unsafe"
@@ -104,19 +105,26 @@ func etRestoreStart(ptr *C.etRestore, callbacks *C.etRestoreCallbacks) C.etResto
 		callbacks: callbacks,
 	}
 
-	ce.csession.s.GetTelemetryService().SendRestoreStart()
+	// A dry-run does not touch the account, there is no restore to report.
+	sendTelemetry := !ce.restorer.IsDryRun()
+
+	if sendTelemetry {
+		ce.csession.s.GetTelemetryService().SendRestoreStart()
+	}
 	startTime := time.Now()
 
 	err := ce.restorer.Run(reporter)
 
-	ce.csession.s.GetTelemetryService().SendRestoreFinished(
-		ce.restorer.GetOperationCancelledByUser(),
-		err != nil,
-		int(time.Since(startTime).Seconds()),
-		int(ce.restorer.GetImportableCount()),
-		int(ce.restorer.GetFailedCount()),
-		int(ce.restorer.GetImportedCount()),
-	)
+	if sendTelemetry {
+		ce.csession.s.GetTelemetryService().SendRestoreFinished(
+			ce.restorer.GetOperationCancelledByUser(),
+			err != nil,
+			int(time.Since(startTime).Seconds()),
+			int(ce.restorer.GetImportableCount()),
+			int(ce.restorer.GetFailedCount()),
+			int(ce.restorer.GetImportedCount()),
+		)
+	}
 
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
@@ -130,6 +138,331 @@ func etRestoreStart(ptr *C.etRestore, callbacks *C.etRestoreCallbacks) C.etResto
 	return C.ET_RESTORE_STATUS_OK
 }
 
+//export etRestoreSetDryRun
+func etRestoreSetDryRun(ptr *C.etRestore, dryRun C.int) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.restorer.SetDryRun(dryRun != 0)
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetSettingsRestore
+func etRestoreSetSettingsRestore(ptr *C.etRestore, enabled C.int) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.restorer.SetSettingsRestore(enabled != 0)
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetImportLabel
+func etRestoreSetImportLabel(
+	ptr *C.etRestore,
+	importLabelMode C.etRestoreImportLabelMode,
+	cImportLabelName *C.cchar_t,
+	cImportLabelColor *C.cchar_t,
+) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	var mode mail.RestoreImportLabelMode
+
+	switch importLabelMode {
+	case C.ET_RESTORE_IMPORT_LABEL_MODE_CREATE:
+		mode = mail.RestoreImportLabelCreate
+	case C.ET_RESTORE_IMPORT_LABEL_MODE_EXISTING:
+		mode = mail.RestoreImportLabelExisting
+	case C.ET_RESTORE_IMPORT_LABEL_MODE_NONE:
+		mode = mail.RestoreImportLabelNone
+	default:
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	if err := ce.restorer.SetImportLabelOptions(mail.RestoreImportLabelOptions{
+		Mode:         mode,
+		NameTemplate: safeGoString(cImportLabelName),
+		Color:        safeGoString(cImportLabelColor),
+	}); err != nil {
+		ce.lastError.Set(err)
+		return C.ET_RESTORE_STATUS_ERROR
+	}
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetFilterLabelIDs
+func etRestoreSetFilterLabelIDs(ptr *C.etRestore, cLabelIDs *C.cchar_t) C.etRestoreStatus {
+	return setRestoreFilterField(ptr, func(fields *restoreFilterFields) { fields.labelIDs = safeGoString(cLabelIDs) })
+}
+
+//export etRestoreSetFilterSender
+func etRestoreSetFilterSender(ptr *C.etRestore, cSender *C.cchar_t) C.etRestoreStatus {
+	return setRestoreFilterField(ptr, func(fields *restoreFilterFields) { fields.sender = safeGoString(cSender) })
+}
+
+//export etRestoreSetFilterRecipient
+func etRestoreSetFilterRecipient(ptr *C.etRestore, cRecipient *C.cchar_t) C.etRestoreStatus {
+	return setRestoreFilterField(ptr, func(fields *restoreFilterFields) { fields.recipient = safeGoString(cRecipient) })
+}
+
+//export etRestoreSetFilterDomain
+func etRestoreSetFilterDomain(ptr *C.etRestore, cDomain *C.cchar_t) C.etRestoreStatus {
+	return setRestoreFilterField(ptr, func(fields *restoreFilterFields) { fields.domain = safeGoString(cDomain) })
+}
+
+//export etRestoreSetFilterAfter
+func etRestoreSetFilterAfter(ptr *C.etRestore, cAfter *C.cchar_t) C.etRestoreStatus {
+	return setRestoreFilterField(ptr, func(fields *restoreFilterFields) { fields.after = safeGoString(cAfter) })
+}
+
+//export etRestoreSetFilterBefore
+func etRestoreSetFilterBefore(ptr *C.etRestore, cBefore *C.cchar_t) C.etRestoreStatus {
+	return setRestoreFilterField(ptr, func(fields *restoreFilterFields) { fields.before = safeGoString(cBefore) })
+}
+
+//export etRestoreSetFilterSubject
+func etRestoreSetFilterSubject(ptr *C.etRestore, cSubject *C.cchar_t) C.etRestoreStatus {
+	return setRestoreFilterField(ptr, func(fields *restoreFilterFields) { fields.subject = safeGoString(cSubject) })
+}
+
+// setRestoreFilterField changes a field of the filter of the restore. The filter is parsed again from all its fields,
+// and left unchanged if the new value is invalid.
+func setRestoreFilterField(ptr *C.etRestore, update func(fields *restoreFilterFields)) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	fields := ce.filterFields
+	update(&fields)
+
+	filter, err := mail.ParseFilterFromStrings(
+		fields.labelIDs,
+		fields.sender,
+		fields.recipient,
+		fields.domain,
+		fields.after,
+		fields.before,
+		fields.subject,
+	)
+	if err != nil {
+		ce.lastError.Set(err)
+		return C.ET_RESTORE_STATUS_ERROR
+	}
+
+	ce.filterFields = fields
+	ce.restorer.SetFilter(filter)
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetDedupe
+func etRestoreSetDedupe(ptr *C.etRestore, enabled C.int) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.restorer.SetDedupe(enabled != 0)
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetParallelImports
+func etRestoreSetParallelImports(ptr *C.etRestore, parallelImports C.int) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.restorer.SetParallelImports(int(parallelImports))
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetSourceFormat
+func etRestoreSetSourceFormat(ptr *C.etRestore, format C.etRestoreSourceFormat) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	switch format {
+	case C.ET_RESTORE_SOURCE_FORMAT_BACKUP:
+		ce.restorer.SetSourceFormat(mail.RestoreSourceBackup)
+	case C.ET_RESTORE_SOURCE_FORMAT_MBOX:
+		ce.restorer.SetSourceFormat(mail.RestoreSourceMbox)
+	case C.ET_RESTORE_SOURCE_FORMAT_MAILDIR:
+		ce.restorer.SetSourceFormat(mail.RestoreSourceMaildir)
+	case C.ET_RESTORE_SOURCE_FORMAT_EML:
+		ce.restorer.SetSourceFormat(mail.RestoreSourceEML)
+	default:
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetTargetAddress
+func etRestoreSetTargetAddress(ptr *C.etRestore, cEmail *C.cchar_t) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.restorer.SetTargetAddress(C.GoString(cEmail))
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetAddressMapping
+func etRestoreSetAddressMapping(ptr *C.etRestore, cMapping *C.cchar_t) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	mapping, err := mail.LoadAddressMapping(C.GoString(cMapping))
+	if err != nil {
+		ce.lastError.Set(err)
+		return C.ET_RESTORE_STATUS_ERROR
+	}
+
+	ce.restorer.SetAddressMapping(mapping)
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetLabelMappingFile
+func etRestoreSetLabelMappingFile(ptr *C.etRestore, cPath *C.cchar_t) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.restorer.SetLabelMappingFile(C.GoString(cPath))
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreSetBackupFolders
+func etRestoreSetBackupFolders(ptr *C.etRestore, cFolders *C.cchar_t) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.restorer.SetBackupFolders(mail.FilterParser{}.ParseCommaSeparated(C.GoString(cFolders)))
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+// etRestoreGetBackupFolders returns the names of the backup sub-folders, oldest first, separated by new lines.
+//
+//export etRestoreGetBackupFolders
+func etRestoreGetBackupFolders(ptr *C.etRestore, outFolders **C.char) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	folders, err := ce.restorer.ListBackupFolders()
+	if err != nil {
+		ce.lastError.Set(internal.MapError(err))
+		return C.ET_RESTORE_STATUS_ERROR
+	}
+
+	*outFolders = C.CString(strings.Join(folders, "\n"))
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreWriteLabelMappingTemplate
+func etRestoreWriteLabelMappingTemplate(ptr *C.etRestore, cPath *C.cchar_t, outPath **C.char) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	path, err := ce.restorer.WriteLabelMappingTemplate(C.GoString(cPath))
+	if err != nil {
+		ce.lastError.Set(internal.MapError(err))
+		return C.ET_RESTORE_STATUS_ERROR
+	}
+
+	*outPath = C.CString(path)
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreGetDryRunReport
+func etRestoreGetDryRunReport(ptr *C.etRestore, format C.etRestoreReportFormat, outReport **C.char) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	report := ce.restorer.GetDryRunReport()
+	if report == nil {
+		ce.lastError.Set(mail.ErrNoDryRunReport)
+		return C.ET_RESTORE_STATUS_ERROR
+	}
+
+	switch format {
+	case C.ET_RESTORE_REPORT_FORMAT_JSON:
+		data, err := report.ToJSON()
+		if err != nil {
+			ce.lastError.Set(internal.MapError(err))
+			return C.ET_RESTORE_STATUS_ERROR
+		}
+
+		*outReport = C.CString(string(data))
+	case C.ET_RESTORE_REPORT_FORMAT_TEXT:
+		*outReport = C.CString(report.ToText())
+	default:
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
 //export etRestoreCancel
 func etRestoreCancel(ptr *C.etRestore) C.etRestoreStatus {
 	ce, ok := resolveRestore(ptr)
@@ -144,6 +477,52 @@ func etRestoreCancel(ptr *C.etRestore) C.etRestoreStatus {
 	return C.ET_RESTORE_STATUS_OK
 }
 
+//export etRestorePause
+func etRestorePause(ptr *C.etRestore) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.restorer.Pause()
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreResume
+func etRestoreResume(ptr *C.etRestore) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	ce.restorer.Resume()
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreIsPaused
+func etRestoreIsPaused(ptr *C.etRestore, outPaused *C.int) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	if ce.restorer.IsPaused() {
+		*outPaused = 1
+	} else {
+		*outPaused = 0
+	}
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
 //export etRestoreGetLastError
 func etRestoreGetLastError(ptr *C.etRestore) *C.cchar_t {
 	ce, ok := resolveRestore(ptr)
@@ -210,6 +589,34 @@ func etRestoreGetFailedCount(ptr *C.etRestore, count *C.int64_t) C.etRestoreStat
 	return C.ET_RESTORE_STATUS_OK
 }
 
+//export etRestoreGetDuplicateCount
+func etRestoreGetDuplicateCount(ptr *C.etRestore, count *C.int64_t) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	*count = C.int64_t(ce.restorer.GetDuplicateCount())
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
+//export etRestoreGetEncryptedCount
+func etRestoreGetEncryptedCount(ptr *C.etRestore, count *C.int64_t) C.etRestoreStatus {
+	ce, ok := resolveRestore(ptr)
+	if !ok {
+		return C.ET_RESTORE_STATUS_INVALID
+	}
+
+	defer async.HandlePanic(ce.csession.s.GetPanicHandler())
+
+	*count = C.int64_t(ce.restorer.GetEncryptedCount())
+
+	return C.ET_RESTORE_STATUS_OK
+}
+
 //export etRestoreGetSkippedCount
 func etRestoreGetSkippedCount(ptr *C.etRestore, count *C.int64_t) C.etRestoreStatus {
 	ce, ok := resolveRestore(ptr)
@@ -225,9 +632,21 @@ func etRestoreGetSkippedCount(ptr *C.etRestore, count *C.int64_t) C.etRestoreSta
 }
 
 type cRestore struct {
-	csession  *csession
-	restorer  *mail.RestoreTask
-	lastError utils.CLastError
+	csession     *csession
+	restorer     *mail.RestoreTask
+	lastError    utils.CLastError
+	filterFields restoreFilterFields
+}
+
+// restoreFilterFields holds the filter of a restore as set through the C API.
+type restoreFilterFields struct {
+	labelIDs  string
+	sender    string
+	recipient string
+	domain    string
+	after     string
+	before    string
+	subject   string
 }
 
 type RestoreHandle struct {
@@ -276,3 +695,12 @@ func (m *restoreReporter) OnProgress(delta int) {
 
 	C.etRestoreCallbackOnProgress(m.callbacks, C.float(progress))
 }
+
+func (m *restoreReporter) OnPauseStateChanged(paused bool) {
+	var cPaused C.int
+	if paused {
+		cPaused = 1
+	}
+
+	C.etRestoreCallbackOnPauseStateChanged(m.callbacks, cPaused)
+}
@@ -26,12 +26,17 @@ import "C"
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
 	"runtime/cgo"
+	"strconv"
+	"strings"
 	"sync"
 	"unsafe"
 
 	"github.com/ProtonMail/export-tool/internal"
 	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/mail"
 	"github.com/ProtonMail/export-tool/internal/sentry"
 	"github.com/ProtonMail/export-tool/internal/session"
 	"github.com/ProtonMail/export-tool/internal/telemetry"
@@ -269,6 +274,213 @@ func etSessionGetLabels(ptr *C.etSession, outLabelsText **C.char) C.etSessionSta
 	})
 }
 
+//export etSessionStartMetricsServer
+func etSessionStartMetricsServer(ptr *C.etSession, addr *C.cchar_t, outAddr **C.char) C.etSessionStatus {
+	return withSession(ptr, func(_ context.Context, session *session.Session) error {
+		listenAddr, err := session.StartMetricsServer(C.GoString(addr))
+		if err != nil {
+			return err
+		}
+
+		*outAddr = C.CString(listenAddr)
+		return nil
+	})
+}
+
+//export etSessionStopMetricsServer
+func etSessionStopMetricsServer(ptr *C.etSession) C.etSessionStatus {
+	return withSession(ptr, func(_ context.Context, session *session.Session) error {
+		session.StopMetricsServer()
+		return nil
+	})
+}
+
+//export etSessionDecryptBackup
+func etSessionDecryptBackup(
+	ptr *C.etSession,
+	cBackupPath *C.cchar_t,
+	cPrivateKeyPath *C.cchar_t,
+	keyPassword *C.cchar_t,
+	keyPasswordLen C.int,
+	outDecrypted *C.int64_t,
+	outFailed *C.int64_t,
+) C.etSessionStatus {
+	return withSession(ptr, func(ctx context.Context, s *session.Session) error {
+		var keys mail.BackupDecryptKeys
+
+		// Without a private key, the keys of the logged in account are used.
+		if privateKeyPath := safeGoString(cPrivateKeyPath); len(privateKeyPath) != 0 {
+			armored, err := os.ReadFile(privateKeyPath) //nolint:gosec
+			if err != nil {
+				return fmt.Errorf("failed to read private key: %w", err)
+			}
+
+			var password []byte
+			if keyPassword != nil {
+				password = C.GoBytes(unsafe.Pointer(keyPassword), keyPasswordLen)
+			}
+
+			if keys, err = mail.NewPrivateKeyDecryptKeys(string(armored), password); err != nil {
+				return err
+			}
+		} else {
+			var err error
+			if keys, err = mail.NewSessionDecryptKeys(ctx, s); err != nil {
+				return err
+			}
+		}
+		defer keys.Close()
+
+		task := mail.NewBackupDecryptTask(ctx, C.GoString(cBackupPath), keys)
+		if err := task.Run(); err != nil {
+			return err
+		}
+
+		*outDecrypted = C.int64_t(task.GetDecryptedCount())
+		*outFailed = C.int64_t(task.GetFailedCount())
+
+		return nil
+	})
+}
+
+//export etSessionSearchBackup
+func etSessionSearchBackup(
+	ptr *C.etSession,
+	cBackupPath *C.cchar_t,
+	cQuery *C.cchar_t,
+	rebuild C.int,
+	outResults **C.char,
+) C.etSessionStatus {
+	return withSession(ptr, func(ctx context.Context, _ *session.Session) error {
+		query, err := mail.ParseSearchQuery(C.GoString(cQuery))
+		if err != nil {
+			return err
+		}
+
+		backupPath := C.GoString(cBackupPath)
+
+		// A missing index is saved through a temporary folder of the backup, which is removed once done.
+		tmpDir, err := os.MkdirTemp(backupPath, "temp_")
+		if err != nil {
+			return fmt.Errorf("failed to create temp directory: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(tmpDir) }()
+
+		index, err := mail.OpenSearchIndex(ctx, backupPath, tmpDir, rebuild != 0)
+		if err != nil {
+			return err
+		}
+
+		// One result per line, fields separated by tabs: id, path, date, from and subject.
+		var output strings.Builder
+		for _, result := range index.Search(query) {
+			output.WriteString(strings.Join([]string{
+				sanitizeSearchField(result.ID),
+				sanitizeSearchField(result.Path),
+				strconv.FormatInt(result.Date, 10),
+				sanitizeSearchField(result.From),
+				sanitizeSearchField(result.Subject),
+			}, "\t"))
+			output.WriteString("\n")
+		}
+
+		*outResults = C.CString(output.String())
+
+		return nil
+	})
+}
+
+// sanitizeSearchField replaces the separators of the search result output.
+func sanitizeSearchField(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+
+		return r
+	}, value)
+}
+
+//export etSessionRebuildCatalog
+func etSessionRebuildCatalog(ptr *C.etSession, cBackupPath *C.cchar_t, outCount *C.int64_t) C.etSessionStatus {
+	return withSession(ptr, func(ctx context.Context, _ *session.Session) error {
+		count, err := mail.RebuildCatalog(ctx, C.GoString(cBackupPath))
+		if err != nil {
+			return err
+		}
+
+		*outCount = C.int64_t(count)
+
+		return nil
+	})
+}
+
+//export etSessionStartIMAPServer
+func etSessionStartIMAPServer(
+	ptr *C.etSession,
+	cBackupPath *C.cchar_t,
+	cAddr *C.cchar_t,
+	cUsername *C.cchar_t,
+	cPassword *C.cchar_t,
+	outAddr **C.char,
+	outMessageCount *C.int64_t,
+	outSkippedCount *C.int64_t,
+) C.etSessionStatus {
+	cs, ok := resolveSession(ptr)
+	if !ok {
+		return C.ET_SESSION_STATUS_INVALID
+	}
+
+	return withSession(ptr, func(ctx context.Context, s *session.Session) error {
+		cs.imapLock.Lock()
+		defer cs.imapLock.Unlock()
+
+		if cs.imapServer != nil {
+			return errors.New("the IMAP server is already running")
+		}
+
+		server, err := mail.NewBackupIMAPServer(
+			ctx,
+			C.GoString(cBackupPath),
+			C.GoString(cUsername),
+			[]byte(C.GoString(cPassword)),
+			s.GetPanicHandler(),
+		)
+		if err != nil {
+			return err
+		}
+
+		listenAddr, err := server.Serve(ctx, C.GoString(cAddr))
+		if err != nil {
+			if err := server.Close(ctx); err != nil {
+				logrus.WithError(err).Error("Failed to close IMAP server")
+			}
+
+			return err
+		}
+
+		cs.imapServer = server
+
+		*outAddr = C.CString(listenAddr.String())
+		*outMessageCount = C.int64_t(server.GetMessageCount())
+		*outSkippedCount = C.int64_t(server.GetSkippedCount())
+
+		return nil
+	})
+}
+
+//export etSessionStopIMAPServer
+func etSessionStopIMAPServer(ptr *C.etSession) C.etSessionStatus {
+	cs, ok := resolveSession(ptr)
+	if !ok {
+		return C.ET_SESSION_STATUS_INVALID
+	}
+
+	return withSession(ptr, func(_ context.Context, _ *session.Session) error {
+		return cs.stopIMAPServer()
+	})
+}
+
 //export etFree
 func etFree(ptr *C.void) {
 	C.free(unsafe.Pointer(ptr))
@@ -318,6 +530,8 @@ type csession struct {
 	cancelOnce sync.Once
 	ctxCancel  func()
 	lastError  utils.CLastError
+	imapLock   sync.Mutex
+	imapServer *mail.BackupIMAPServer
 }
 
 func newCSession(apiURL string, telemetryDisabled bool, cb C.etSessionCallbacks) (*csession, error) {
@@ -349,11 +563,29 @@ func newCSession(apiURL string, telemetryDisabled bool, cb C.etSessionCallbacks)
 func (c *csession) close() {
 	defer async.HandlePanic(c.s.GetPanicHandler())
 
+	if err := c.stopIMAPServer(); err != nil {
+		logrus.WithError(err).Error("Failed to close IMAP server")
+	}
+
 	c.s.Close(c.ctx)
 	c.cancel()
 	c.lastError.Close()
 }
 
+func (c *csession) stopIMAPServer() error {
+	c.imapLock.Lock()
+	defer c.imapLock.Unlock()
+
+	if c.imapServer == nil {
+		return nil
+	}
+
+	err := c.imapServer.Close(context.Background())
+	c.imapServer = nil
+
+	return err
+}
+
 func (c *csession) cancel() {
 	defer async.HandlePanic(c.s.GetPanicHandler())
 	c.cancelOnce.Do(c.ctxCancel)
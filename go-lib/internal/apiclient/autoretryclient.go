@@ -25,10 +25,12 @@ import (
 	"net"
 	"time"
 
+	"github.com/ProtonMail/export-tool/internal/tracing"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/bradenaw/juniper/stream"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type AutoRetryClientBuilder struct {
@@ -76,32 +78,45 @@ func (a *AutoRetryClientBuilder) Close() {
 type AutoRetryClient struct {
 	client               Client
 	retryStrategyBuilder RetryStrategyBuilder
+	observer             RequestObserver
+}
+
+// RequestObserver is notified of every request attempt performed by the AutoRetryClient. Route is the name of the
+// Client method being called.
+type RequestObserver interface {
+	OnRequest(route string, duration time.Duration, err error)
+	OnRetry(route string, err error)
 }
 
 func NewAutoRetryClient(client Client, builder RetryStrategyBuilder) *AutoRetryClient {
 	return &AutoRetryClient{client: client, retryStrategyBuilder: builder}
 }
 
+// SetRequestObserver must be called before the client is used.
+func (arc *AutoRetryClient) SetRequestObserver(observer RequestObserver) {
+	arc.observer = observer
+}
+
 func (arc *AutoRetryClient) Auth2FA(ctx context.Context, req proton.Auth2FAReq) error {
-	return arc.repeatRequest(ctx, func(ctx context.Context, client Client) error {
+	return arc.repeatRequest(ctx, "Auth2FA", func(ctx context.Context, client Client) error {
 		return client.Auth2FA(ctx, req)
 	})
 }
 
 func (arc *AutoRetryClient) AuthDelete(ctx context.Context) error {
-	return arc.repeatRequest(ctx, func(ctx context.Context, client Client) error {
+	return arc.repeatRequest(ctx, "AuthDelete", func(ctx context.Context, client Client) error {
 		return client.AuthDelete(ctx)
 	})
 }
 
 func (arc *AutoRetryClient) GetUserWithHV(ctx context.Context, hv *proton.APIHVDetails) (proton.User, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) (proton.User, error) {
+	return repeatRequestTyped(ctx, arc, "GetUserWithHV", func(ctx context.Context, client Client) (proton.User, error) {
 		return client.GetUserWithHV(ctx, hv)
 	})
 }
 
 func (arc *AutoRetryClient) GetSalts(ctx context.Context) (proton.Salts, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) (proton.Salts, error) {
+	return repeatRequestTyped(ctx, arc, "GetSalts", func(ctx context.Context, client Client) (proton.Salts, error) {
 		return client.GetSalts(ctx)
 	})
 }
@@ -111,49 +126,49 @@ func (arc *AutoRetryClient) Close() {
 }
 
 func (arc *AutoRetryClient) GetLabels(ctx context.Context, labelTypes ...proton.LabelType) ([]proton.Label, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) ([]proton.Label, error) {
+	return repeatRequestTyped(ctx, arc, "GetLabels", func(ctx context.Context, client Client) ([]proton.Label, error) {
 		return client.GetLabels(ctx, labelTypes...)
 	})
 }
 
 func (arc *AutoRetryClient) CreateLabel(ctx context.Context, req proton.CreateLabelReq) (proton.Label, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) (proton.Label, error) {
+	return repeatRequestTyped(ctx, arc, "CreateLabel", func(ctx context.Context, client Client) (proton.Label, error) {
 		return client.CreateLabel(ctx, req)
 	})
 }
 
 func (arc *AutoRetryClient) GetAddresses(ctx context.Context) ([]proton.Address, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) ([]proton.Address, error) {
+	return repeatRequestTyped(ctx, arc, "GetAddresses", func(ctx context.Context, client Client) ([]proton.Address, error) {
 		return client.GetAddresses(ctx)
 	})
 }
 
 func (arc *AutoRetryClient) GetGroupedMessageCount(ctx context.Context) ([]proton.MessageGroupCount, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) ([]proton.MessageGroupCount, error) {
+	return repeatRequestTyped(ctx, arc, "GetGroupedMessageCount", func(ctx context.Context, client Client) ([]proton.MessageGroupCount, error) {
 		return client.GetGroupedMessageCount(ctx)
 	})
 }
 
 func (arc *AutoRetryClient) GetMessage(ctx context.Context, messageID string) (proton.Message, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) (proton.Message, error) {
+	return repeatRequestTyped(ctx, arc, "GetMessage", func(ctx context.Context, client Client) (proton.Message, error) {
 		return client.GetMessage(ctx, messageID)
 	})
 }
 
 func (arc *AutoRetryClient) GetUserSettings(ctx context.Context) (proton.UserSettings, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) (proton.UserSettings, error) {
+	return repeatRequestTyped(ctx, arc, "GetUserSettings", func(ctx context.Context, client Client) (proton.UserSettings, error) {
 		return client.GetUserSettings(ctx)
 	})
 }
 
 func (arc *AutoRetryClient) SendDataEvent(ctx context.Context, req proton.SendStatsReq) error {
-	return arc.repeatRequest(ctx, func(ctx context.Context, client Client) error {
+	return arc.repeatRequest(ctx, "SendDataEvent", func(ctx context.Context, client Client) error {
 		return client.SendDataEvent(ctx, req)
 	})
 }
 
 func (arc *AutoRetryClient) GetOrganizationData(ctx context.Context) (proton.OrganizationResponse, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) (proton.OrganizationResponse, error) {
+	return repeatRequestTyped(ctx, arc, "GetOrganizationData", func(ctx context.Context, client Client) (proton.OrganizationResponse, error) {
 		return client.GetOrganizationData(ctx)
 	})
 }
@@ -163,13 +178,13 @@ func (arc *AutoRetryClient) GetMessageMetadataPage(
 	page, pageSize int,
 	filter proton.MessageFilter,
 ) ([]proton.MessageMetadata, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) ([]proton.MessageMetadata, error) {
+	return repeatRequestTyped(ctx, arc, "GetMessageMetadataPage", func(ctx context.Context, client Client) ([]proton.MessageMetadata, error) {
 		return client.GetMessageMetadataPage(ctx, page, pageSize, filter)
 	})
 }
 
 func (arc *AutoRetryClient) GetAttachmentInto(ctx context.Context, attachmentID string, reader io.ReaderFrom) error {
-	return arc.repeatRequest(ctx, func(ctx context.Context, client Client) error {
+	return arc.repeatRequest(ctx, "GetAttachmentInto", func(ctx context.Context, client Client) error {
 		return client.GetAttachmentInto(ctx, attachmentID, reader)
 	})
 }
@@ -180,32 +195,127 @@ func (arc *AutoRetryClient) ImportMessages(
 	workers, buffer int,
 	req ...proton.ImportReq,
 ) (proton.ImportResStream, error) {
-	return repeatRequestTyped(ctx, arc, func(ctx context.Context, client Client) (stream.Stream[proton.ImportRes], error) {
+	return repeatRequestTyped(ctx, arc, "ImportMessages", func(ctx context.Context, client Client) (stream.Stream[proton.ImportRes], error) {
 		return client.ImportMessages(ctx, addrKR, workers, buffer, req...)
 	})
 }
 
-func (arc *AutoRetryClient) repeatRequest(ctx context.Context, req func(ctx context.Context, client Client) error) error {
+func (arc *AutoRetryClient) GetContacts(ctx context.Context, page, pageSize int) ([]proton.Contact, error) {
+	return repeatRequestTyped(ctx, arc, "GetContacts", func(ctx context.Context, client Client) ([]proton.Contact, error) {
+		return client.GetContacts(ctx, page, pageSize)
+	})
+}
+
+func (arc *AutoRetryClient) GetContact(ctx context.Context, contactID string) (proton.Contact, error) {
+	return repeatRequestTyped(ctx, arc, "GetContact", func(ctx context.Context, client Client) (proton.Contact, error) {
+		return client.GetContact(ctx, contactID)
+	})
+}
+
+func (arc *AutoRetryClient) GetMailSettings(ctx context.Context) (proton.MailSettings, error) {
+	return repeatRequestTyped(ctx, arc, "GetMailSettings", func(ctx context.Context, client Client) (proton.MailSettings, error) {
+		return client.GetMailSettings(ctx)
+	})
+}
+
+func (arc *AutoRetryClient) SetDisplayName(ctx context.Context, req proton.SetDisplayNameReq) (proton.MailSettings, error) {
+	return repeatRequestTyped(ctx, arc, "SetDisplayName", func(ctx context.Context, client Client) (proton.MailSettings, error) {
+		return client.SetDisplayName(ctx, req)
+	})
+}
+
+func (arc *AutoRetryClient) SetSignature(ctx context.Context, req proton.SetSignatureReq) (proton.MailSettings, error) {
+	return repeatRequestTyped(ctx, arc, "SetSignature", func(ctx context.Context, client Client) (proton.MailSettings, error) {
+		return client.SetSignature(ctx, req)
+	})
+}
+
+func (arc *AutoRetryClient) SetDraftMIMEType(ctx context.Context, req proton.SetDraftMIMETypeReq) (proton.MailSettings, error) {
+	return repeatRequestTyped(ctx, arc, "SetDraftMIMEType", func(ctx context.Context, client Client) (proton.MailSettings, error) {
+		return client.SetDraftMIMEType(ctx, req)
+	})
+}
+
+func (arc *AutoRetryClient) SetAttachPublicKey(ctx context.Context, req proton.SetAttachPublicKeyReq) (proton.MailSettings, error) {
+	return repeatRequestTyped(ctx, arc, "SetAttachPublicKey", func(ctx context.Context, client Client) (proton.MailSettings, error) {
+		return client.SetAttachPublicKey(ctx, req)
+	})
+}
+
+func (arc *AutoRetryClient) SetSignExternalMessages(ctx context.Context, req proton.SetSignExternalMessagesReq) (proton.MailSettings, error) {
+	return repeatRequestTyped(ctx, arc, "SetSignExternalMessages", func(ctx context.Context, client Client) (proton.MailSettings, error) {
+		return client.SetSignExternalMessages(ctx, req)
+	})
+}
+
+func (arc *AutoRetryClient) SetDefaultPGPScheme(ctx context.Context, req proton.SetDefaultPGPSchemeReq) (proton.MailSettings, error) {
+	return repeatRequestTyped(ctx, arc, "SetDefaultPGPScheme", func(ctx context.Context, client Client) (proton.MailSettings, error) {
+		return client.SetDefaultPGPScheme(ctx, req)
+	})
+}
+
+func (arc *AutoRetryClient) GetMailFilters(ctx context.Context) ([]MailFilter, error) {
+	return repeatRequestTyped(ctx, arc, "GetMailFilters", func(ctx context.Context, client Client) ([]MailFilter, error) {
+		return client.GetMailFilters(ctx)
+	})
+}
+
+func (arc *AutoRetryClient) GetAutoResponder(ctx context.Context) (AutoResponder, error) {
+	return repeatRequestTyped(ctx, arc, "GetAutoResponder", func(ctx context.Context, client Client) (AutoResponder, error) {
+		return client.GetAutoResponder(ctx)
+	})
+}
+
+func (arc *AutoRetryClient) GetAddressSignatures(ctx context.Context) (map[string]string, error) {
+	return repeatRequestTyped(ctx, arc, "GetAddressSignatures", func(ctx context.Context, client Client) (map[string]string, error) {
+		return client.GetAddressSignatures(ctx)
+	})
+}
+
+func (arc *AutoRetryClient) repeatRequest(ctx context.Context, route string, req func(ctx context.Context, client Client) error) (err error) {
+	ctx, span := tracing.Start(ctx, "api."+route, attribute.String("api.route", route))
+	defer func() { tracing.End(span, err) }()
+
 	retryStrategy := arc.retryStrategyBuilder.NewRetryStrategy()
-	for {
-		err := req(ctx, arc.client)
+	for attempt := 1; ; attempt++ {
+		attemptCtx, attemptSpan := tracing.Start(ctx, "api.attempt", attribute.Int("api.attempt", attempt))
+
+		start := time.Now()
+		err = req(attemptCtx, arc.client)
+		tracing.End(attemptSpan, err)
+
+		if arc.observer != nil {
+			arc.observer.OnRequest(route, time.Since(start), err)
+		}
+
 		if err != nil {
 			if !isRetrieableError(err) {
 				return err
 			}
 
+			if arc.observer != nil {
+				arc.observer.OnRetry(route, err)
+			}
+
 			retryStrategy.HandleRetry(ctx)
 			continue
 		}
 
+		span.SetAttributes(attribute.Int("api.attempts", attempt))
+
 		return nil
 	}
 }
 
-func repeatRequestTyped[T any](ctx context.Context, arc *AutoRetryClient, req func(ctx context.Context, client Client) (T, error)) (T, error) {
+func repeatRequestTyped[T any](
+	ctx context.Context,
+	arc *AutoRetryClient,
+	route string,
+	req func(ctx context.Context, client Client) (T, error),
+) (T, error) {
 	var result T
 	var err error
-	err = arc.repeatRequest(ctx, func(ctx context.Context, client Client) error {
+	err = arc.repeatRequest(ctx, route, func(ctx context.Context, client Client) error {
 		result, err = req(ctx, client)
 
 		return err
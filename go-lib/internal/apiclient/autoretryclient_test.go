@@ -26,6 +26,11 @@ import (
 
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/mock/gomock"
 )
 
@@ -116,6 +121,45 @@ func TestAutoRetryClientRepetition(t *testing.T) {
 	}
 }
 
+func TestAutoRetryClientTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prevProvider)
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	strategy := NewMockRetryStrategy(mockCtrl)
+	mockClient := NewMockClient(mockCtrl)
+
+	client := NewAutoRetryClient(mockClient, &mockRetryStrategyBuilder{s: strategy})
+
+	call1 := mockClient.EXPECT().GetMessage(gomock.Any(), gomock.Any()).Times(1).Return(proton.Message{}, &proton.APIError{Status: 429})
+	strategy.EXPECT().HandleRetry(gomock.Any()).Times(1)
+	mockClient.EXPECT().GetMessage(gomock.Any(), gomock.Any()).Times(1).After(call1).Return(proton.Message{}, nil)
+
+	_, err := client.GetMessage(context.Background(), "msgid")
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	call := spans[2]
+	require.Equal(t, "api.GetMessage", call.Name())
+	require.Equal(t, codes.Unset, call.Status().Code)
+	require.Contains(t, call.Attributes(), attribute.Int("api.attempts", 2))
+
+	for i, attempt := range spans[:2] {
+		require.Equal(t, "api.attempt", attempt.Name())
+		require.Equal(t, call.SpanContext().SpanID(), attempt.Parent().SpanID())
+		require.Contains(t, attempt.Attributes(), attribute.Int("api.attempt", i+1))
+	}
+
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
 type mockRetryStrategyBuilder struct {
 	s *MockRetryStrategy
 }
@@ -48,6 +48,20 @@ type Client interface {
 	GetAttachmentInto(ctx context.Context, attachmentID string, reader io.ReaderFrom) error
 	ImportMessages(ctx context.Context, addrKR *crypto.KeyRing, workers, buffer int, req ...proton.ImportReq) (proton.ImportResStream, error)
 
+	GetContacts(ctx context.Context, page, pageSize int) ([]proton.Contact, error)
+	GetContact(ctx context.Context, contactID string) (proton.Contact, error)
+
+	GetMailSettings(ctx context.Context) (proton.MailSettings, error)
+	SetDisplayName(ctx context.Context, req proton.SetDisplayNameReq) (proton.MailSettings, error)
+	SetSignature(ctx context.Context, req proton.SetSignatureReq) (proton.MailSettings, error)
+	SetDraftMIMEType(ctx context.Context, req proton.SetDraftMIMETypeReq) (proton.MailSettings, error)
+	SetAttachPublicKey(ctx context.Context, req proton.SetAttachPublicKeyReq) (proton.MailSettings, error)
+	SetSignExternalMessages(ctx context.Context, req proton.SetSignExternalMessagesReq) (proton.MailSettings, error)
+	SetDefaultPGPScheme(ctx context.Context, req proton.SetDefaultPGPSchemeReq) (proton.MailSettings, error)
+	GetMailFilters(ctx context.Context) ([]MailFilter, error)
+	GetAutoResponder(ctx context.Context) (AutoResponder, error)
+	GetAddressSignatures(ctx context.Context) (map[string]string, error)
+
 	// Required for telemetry
 	GetUserSettings(ctx context.Context) (proton.UserSettings, error)
 	SendDataEvent(ctx context.Context, req proton.SendStatsReq) error
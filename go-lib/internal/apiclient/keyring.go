@@ -70,6 +70,10 @@ func (u *UnlockedKeyRing) Close() {
 	u.keyRing.ClearPrivateParams()
 }
 
+func (u *UnlockedKeyRing) GetUserKeyRing() *crypto.KeyRing {
+	return u.keyRing
+}
+
 func (u *UnlockedKeyRing) GetAddrKeyRing(addrID string) (*crypto.KeyRing, bool) {
 	kr, ok := u.addrMap[addrID]
 
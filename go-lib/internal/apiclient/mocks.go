@@ -164,6 +164,21 @@ func (mr *MockClientMockRecorder) CreateLabel(ctx, req any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLabel", reflect.TypeOf((*MockClient)(nil).CreateLabel), ctx, req)
 }
 
+// GetAddressSignatures mocks base method.
+func (m *MockClient) GetAddressSignatures(ctx context.Context) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAddressSignatures", ctx)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAddressSignatures indicates an expected call of GetAddressSignatures.
+func (mr *MockClientMockRecorder) GetAddressSignatures(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAddressSignatures", reflect.TypeOf((*MockClient)(nil).GetAddressSignatures), ctx)
+}
+
 // GetAddresses mocks base method.
 func (m *MockClient) GetAddresses(ctx context.Context) ([]proton.Address, error) {
 	m.ctrl.T.Helper()
@@ -193,6 +208,51 @@ func (mr *MockClientMockRecorder) GetAttachmentInto(ctx, attachmentID, reader an
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachmentInto", reflect.TypeOf((*MockClient)(nil).GetAttachmentInto), ctx, attachmentID, reader)
 }
 
+// GetAutoResponder mocks base method.
+func (m *MockClient) GetAutoResponder(ctx context.Context) (AutoResponder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAutoResponder", ctx)
+	ret0, _ := ret[0].(AutoResponder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAutoResponder indicates an expected call of GetAutoResponder.
+func (mr *MockClientMockRecorder) GetAutoResponder(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAutoResponder", reflect.TypeOf((*MockClient)(nil).GetAutoResponder), ctx)
+}
+
+// GetContact mocks base method.
+func (m *MockClient) GetContact(ctx context.Context, contactID string) (proton.Contact, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetContact", ctx, contactID)
+	ret0, _ := ret[0].(proton.Contact)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetContact indicates an expected call of GetContact.
+func (mr *MockClientMockRecorder) GetContact(ctx, contactID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContact", reflect.TypeOf((*MockClient)(nil).GetContact), ctx, contactID)
+}
+
+// GetContacts mocks base method.
+func (m *MockClient) GetContacts(ctx context.Context, page, pageSize int) ([]proton.Contact, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetContacts", ctx, page, pageSize)
+	ret0, _ := ret[0].([]proton.Contact)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetContacts indicates an expected call of GetContacts.
+func (mr *MockClientMockRecorder) GetContacts(ctx, page, pageSize any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContacts", reflect.TypeOf((*MockClient)(nil).GetContacts), ctx, page, pageSize)
+}
+
 // GetGroupedMessageCount mocks base method.
 func (m *MockClient) GetGroupedMessageCount(ctx context.Context) ([]proton.MessageGroupCount, error) {
 	m.ctrl.T.Helper()
@@ -228,6 +288,36 @@ func (mr *MockClientMockRecorder) GetLabels(ctx any, labelTypes ...any) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLabels", reflect.TypeOf((*MockClient)(nil).GetLabels), varargs...)
 }
 
+// GetMailFilters mocks base method.
+func (m *MockClient) GetMailFilters(ctx context.Context) ([]MailFilter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMailFilters", ctx)
+	ret0, _ := ret[0].([]MailFilter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMailFilters indicates an expected call of GetMailFilters.
+func (mr *MockClientMockRecorder) GetMailFilters(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMailFilters", reflect.TypeOf((*MockClient)(nil).GetMailFilters), ctx)
+}
+
+// GetMailSettings mocks base method.
+func (m *MockClient) GetMailSettings(ctx context.Context) (proton.MailSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMailSettings", ctx)
+	ret0, _ := ret[0].(proton.MailSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMailSettings indicates an expected call of GetMailSettings.
+func (mr *MockClientMockRecorder) GetMailSettings(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMailSettings", reflect.TypeOf((*MockClient)(nil).GetMailSettings), ctx)
+}
+
 // GetMessage mocks base method.
 func (m *MockClient) GetMessage(ctx context.Context, messageID string) (proton.Message, error) {
 	m.ctrl.T.Helper()
@@ -352,6 +442,96 @@ func (mr *MockClientMockRecorder) SendDataEvent(ctx, req any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendDataEvent", reflect.TypeOf((*MockClient)(nil).SendDataEvent), ctx, req)
 }
 
+// SetAttachPublicKey mocks base method.
+func (m *MockClient) SetAttachPublicKey(ctx context.Context, req proton.SetAttachPublicKeyReq) (proton.MailSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAttachPublicKey", ctx, req)
+	ret0, _ := ret[0].(proton.MailSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetAttachPublicKey indicates an expected call of SetAttachPublicKey.
+func (mr *MockClientMockRecorder) SetAttachPublicKey(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAttachPublicKey", reflect.TypeOf((*MockClient)(nil).SetAttachPublicKey), ctx, req)
+}
+
+// SetDefaultPGPScheme mocks base method.
+func (m *MockClient) SetDefaultPGPScheme(ctx context.Context, req proton.SetDefaultPGPSchemeReq) (proton.MailSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDefaultPGPScheme", ctx, req)
+	ret0, _ := ret[0].(proton.MailSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetDefaultPGPScheme indicates an expected call of SetDefaultPGPScheme.
+func (mr *MockClientMockRecorder) SetDefaultPGPScheme(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDefaultPGPScheme", reflect.TypeOf((*MockClient)(nil).SetDefaultPGPScheme), ctx, req)
+}
+
+// SetDisplayName mocks base method.
+func (m *MockClient) SetDisplayName(ctx context.Context, req proton.SetDisplayNameReq) (proton.MailSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDisplayName", ctx, req)
+	ret0, _ := ret[0].(proton.MailSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetDisplayName indicates an expected call of SetDisplayName.
+func (mr *MockClientMockRecorder) SetDisplayName(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDisplayName", reflect.TypeOf((*MockClient)(nil).SetDisplayName), ctx, req)
+}
+
+// SetDraftMIMEType mocks base method.
+func (m *MockClient) SetDraftMIMEType(ctx context.Context, req proton.SetDraftMIMETypeReq) (proton.MailSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDraftMIMEType", ctx, req)
+	ret0, _ := ret[0].(proton.MailSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetDraftMIMEType indicates an expected call of SetDraftMIMEType.
+func (mr *MockClientMockRecorder) SetDraftMIMEType(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDraftMIMEType", reflect.TypeOf((*MockClient)(nil).SetDraftMIMEType), ctx, req)
+}
+
+// SetSignExternalMessages mocks base method.
+func (m *MockClient) SetSignExternalMessages(ctx context.Context, req proton.SetSignExternalMessagesReq) (proton.MailSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetSignExternalMessages", ctx, req)
+	ret0, _ := ret[0].(proton.MailSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetSignExternalMessages indicates an expected call of SetSignExternalMessages.
+func (mr *MockClientMockRecorder) SetSignExternalMessages(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSignExternalMessages", reflect.TypeOf((*MockClient)(nil).SetSignExternalMessages), ctx, req)
+}
+
+// SetSignature mocks base method.
+func (m *MockClient) SetSignature(ctx context.Context, req proton.SetSignatureReq) (proton.MailSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetSignature", ctx, req)
+	ret0, _ := ret[0].(proton.MailSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetSignature indicates an expected call of SetSignature.
+func (mr *MockClientMockRecorder) SetSignature(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSignature", reflect.TypeOf((*MockClient)(nil).SetSignature), ctx, req)
+}
+
 // MockRetryStrategy is a mock of RetryStrategy interface.
 type MockRetryStrategy struct {
 	ctrl     *gomock.Controller
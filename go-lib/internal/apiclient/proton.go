@@ -43,6 +43,7 @@ type ProtonCallbacks interface {
 
 type ProtonAPIClientBuilder struct {
 	manager  *proton.Manager
+	rc       *resty.Client
 	callback ProtonCallbacks
 }
 
@@ -60,6 +61,10 @@ func NewProtonAPIClientBuilder(apiURL string, panicHandler async.PanicHandler, c
 			proton.WithPanicHandler(panicHandler),
 			proton.WithCookieJar(cookieJar),
 		),
+		rc: resty.New().
+			SetBaseURL(apiURL).
+			SetCookieJar(cookieJar).
+			SetHeader("x-pm-appversion", internal.ETAppIdentifier),
 		callback: callbacks,
 	}
 
@@ -96,7 +101,12 @@ func NewProtonAPIClientBuilder(apiURL string, panicHandler async.PanicHandler, c
 }
 
 func (p *ProtonAPIClientBuilder) NewClient(ctx context.Context, username string, password []byte, hvToken *proton.APIHVDetails) (Client, proton.Auth, error) {
-	return p.manager.NewClientWithLoginWithHVToken(ctx, username, password, hvToken)
+	client, auth, err := p.manager.NewClientWithLoginWithHVToken(ctx, username, password, hvToken)
+	if err != nil {
+		return nil, auth, err
+	}
+
+	return newProtonClient(client, p.rc, auth), auth, nil
 }
 
 func (p *ProtonAPIClientBuilder) Close() {
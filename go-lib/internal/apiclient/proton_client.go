@@ -0,0 +1,165 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/go-resty/resty/v2"
+)
+
+// MailFilter is a Sieve filter of the account.
+type MailFilter struct {
+	ID       string
+	Name     string
+	Status   int
+	Priority int
+	Version  int
+	Sieve    string
+}
+
+// AutoResponder is the auto-reply configuration of the account.
+type AutoResponder struct {
+	IsEnabled    bool
+	StartTime    int64
+	EndTime      int64
+	Repeat       int
+	DaysSelected []int
+	Subject      string
+	Message      string
+	Zone         string
+}
+
+// protonClient is a proton.Client which also gives access to the routes go-proton-api has no method for. Those are
+// requested with the auth of the proton client, which is kept up to date through its auth handler.
+type protonClient struct {
+	*proton.Client
+
+	rc *resty.Client
+
+	uid      string
+	acc      string
+	authLock sync.RWMutex
+}
+
+func newProtonClient(client *proton.Client, rc *resty.Client, auth proton.Auth) *protonClient {
+	c := &protonClient{Client: client, rc: rc, uid: auth.UID, acc: auth.AccessToken}
+
+	client.AddAuthHandler(func(auth proton.Auth) {
+		c.authLock.Lock()
+		defer c.authLock.Unlock()
+
+		c.uid = auth.UID
+		c.acc = auth.AccessToken
+	})
+
+	return c
+}
+
+func (c *protonClient) GetMailFilters(ctx context.Context) ([]MailFilter, error) {
+	var res struct {
+		Filters []MailFilter
+	}
+
+	if err := c.get(ctx, "/mail/v4/filters", &res); err != nil {
+		return nil, err
+	}
+
+	return res.Filters, nil
+}
+
+func (c *protonClient) GetAutoResponder(ctx context.Context) (AutoResponder, error) {
+	var res struct {
+		MailSettings struct {
+			AutoResponder AutoResponder
+		}
+	}
+
+	if err := c.get(ctx, "/mail/v4/settings", &res); err != nil {
+		return AutoResponder{}, err
+	}
+
+	return res.MailSettings.AutoResponder, nil
+}
+
+// GetAddressSignatures returns the signature of each address of the account, by address ID.
+func (c *protonClient) GetAddressSignatures(ctx context.Context) (map[string]string, error) {
+	var res struct {
+		Addresses []struct {
+			ID        string
+			Signature string
+		}
+	}
+
+	if err := c.get(ctx, "/core/v4/addresses", &res); err != nil {
+		return nil, err
+	}
+
+	signatures := make(map[string]string, len(res.Addresses))
+	for _, address := range res.Addresses {
+		signatures[address.ID] = address.Signature
+	}
+
+	return signatures, nil
+}
+
+// get only uses the auth of the proton client, which alone can refresh it: on a 401 the proton client is made to
+// refresh it with a request of its own and the request is sent again.
+func (c *protonClient) get(ctx context.Context, route string, result any) error {
+	res, err := c.exec(ctx, route, result)
+	if err == nil && res.StatusCode() == http.StatusUnauthorized {
+		if _, err := c.Client.GetUserSettings(ctx); err != nil {
+			return err
+		}
+
+		res, err = c.exec(ctx, route, result)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if res.IsError() {
+		apiErr, ok := res.Error().(*proton.APIError)
+		if !ok {
+			return &proton.APIError{Status: res.StatusCode(), Message: res.Status()}
+		}
+
+		apiErr.Status = res.StatusCode()
+
+		return apiErr
+	}
+
+	return nil
+}
+
+func (c *protonClient) exec(ctx context.Context, route string, result any) (*resty.Response, error) {
+	c.authLock.RLock()
+	defer c.authLock.RUnlock()
+
+	return c.rc.R().
+		SetContext(ctx).
+		SetHeader("x-pm-uid", c.uid).
+		SetAuthToken(c.acc).
+		SetResult(result).
+		SetError(&proton.APIError{}).
+		Get(route)
+}
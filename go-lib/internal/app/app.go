@@ -2,11 +2,17 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/ProtonMail/export-tool/internal"
 	"github.com/ProtonMail/export-tool/internal/apiclient"
@@ -14,6 +20,7 @@ import (
 	"github.com/ProtonMail/export-tool/internal/reporter"
 	"github.com/ProtonMail/export-tool/internal/sentry"
 	"github.com/ProtonMail/export-tool/internal/session"
+	"github.com/ProtonMail/export-tool/internal/tracing"
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/sirupsen/logrus"
@@ -53,6 +60,184 @@ var (
 		Aliases: []string{"f"},
 		EnvVars: []string{"ET_DIR"},
 	}
+	flagContinueOnFailure = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "continue-on-failure",
+		Usage:   "skip messages which fail to export and record them for the retry-failed operation",
+		EnvVars: []string{"ET_CONTINUE_ON_FAILURE"},
+	}
+	flagExportKeys = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "export-keys",
+		Usage:   "write the password protected private keys of the account and their public keys to the backup",
+		EnvVars: []string{"ET_EXPORT_KEYS"},
+	}
+	flagExportSettings = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "export-settings",
+		Usage:   "write the mail settings of the account and the settings of its addresses to the backup",
+		EnvVars: []string{"ET_EXPORT_SETTINGS"},
+	}
+	flagExportContacts = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "export-contacts",
+		Usage:   "write the contacts of the account to the backup as vCard files",
+		EnvVars: []string{"ET_EXPORT_CONTACTS"},
+	}
+	flagSearchIndex = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "search-index",
+		Usage:   "build a full-text search index of the messages while they are written, for the " + strSearch + " operation",
+		EnvVars: []string{"ET_SEARCH_INDEX"},
+	}
+	flagCatalog = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "catalog",
+		Usage:   "write an SQLite catalog of the exported messages to catalog.sqlite, see also the " + strRebuildCatalog + " operation",
+		EnvVars: []string{"ET_CATALOG"},
+	}
+	flagRestoreSettings = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "restore-settings",
+		Usage:   "apply the mail settings saved in the backup to the account",
+		EnvVars: []string{"ET_RESTORE_SETTINGS"},
+	}
+	flagNoDedupe = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "no-dedupe",
+		Usage:   "import every message of the backup without listing the account to skip the messages already present",
+		EnvVars: []string{"ET_NO_DEDUPE"},
+	}
+	flagDryRun = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "dry-run",
+		Usage:   "validate the backup and report what a restore would change without modifying the account",
+		EnvVars: []string{"ET_DRY_RUN"},
+	}
+	flagImportWorkers = &cli.IntFlag{ //nolint:gochecknoglobals
+		Name:    "import-workers",
+		Usage:   "number of message batches imported concurrently during a restore",
+		Value:   mail.DefaultParallelImports,
+		EnvVars: []string{"ET_IMPORT_WORKERS"},
+	}
+	flagImportFormat = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "import-format",
+		Usage:   "layout of the folder to restore from: backup (made by this tool), mbox (e.g. Gmail Takeout or Thunderbird), maildir or eml",
+		Value:   string(mail.RestoreSourceBackup),
+		EnvVars: []string{"ET_IMPORT_FORMAT"},
+	}
+	flagLabelMap = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "label-map",
+		Usage:   "label mapping file applied by the restore, or where the " + strLabelMapTemplate + " operation writes it",
+		EnvVars: []string{"ET_LABEL_MAP"},
+	}
+	flagTargetAddress = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "target-address",
+		Usage:   "restore every message into this address of the account instead of the address it was delivered to",
+		EnvVars: []string{"ET_TARGET_ADDRESS"},
+	}
+	flagAddressMap = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "address-map",
+		Usage:   "map the addresses of a backup from another account to addresses of this account, as comma separated backup=account pairs or a file with one pair per line",
+		EnvVars: []string{"ET_ADDRESS_MAP"},
+	}
+	flagBackupFolders = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "backup-folders",
+		Usage:   "backup sub-folders restored when the backup folder contains several backups, as comma separated folder names, or all to merge every backup",
+		Value:   "all",
+		EnvVars: []string{"ET_BACKUP_FOLDERS"},
+	}
+	flagImportLabel = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "import-label",
+		Usage:   "label added to every restored message: create a new 'Import' label, reuse an existing label with the same name, or none",
+		Value:   "create",
+		EnvVars: []string{"ET_IMPORT_LABEL"},
+	}
+	flagImportLabelName = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "import-label-name",
+		Usage:   "name of the label added to restored messages, {date} and {time} are replaced by the start of the restore",
+		Value:   mail.DefaultImportLabelNameTemplate,
+		EnvVars: []string{"ET_IMPORT_LABEL_NAME"},
+	}
+	flagImportLabelColor = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "import-label-color",
+		Usage:   "colour of the label added to restored messages, as #RGB or #RRGGBB",
+		Value:   mail.DefaultImportLabelColor,
+		EnvVars: []string{"ET_IMPORT_LABEL_COLOR"},
+	}
+	flagPrivateKey = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "private-key",
+		Usage:   "armored address private key used by the " + strDecrypt + " operation instead of logging in",
+		EnvVars: []string{"ET_PRIVATE_KEY"},
+	}
+	flagSearchQuery = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "query",
+		Usage:   "query of the " + strSearch + " operation, e.g. 'from:alice subject:report after:2024-01-01'",
+		EnvVars: []string{"ET_SEARCH_QUERY"},
+	}
+	flagRebuildIndex = &cli.BoolFlag{ //nolint:gochecknoglobals
+		Name:    "rebuild-index",
+		Usage:   "rebuild the search index of the folder before running the " + strSearch + " operation",
+		EnvVars: []string{"ET_REBUILD_INDEX"},
+	}
+	flagIMAPAddr = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "imap-addr",
+		Usage:   "loopback address the " + strServeIMAP + " operation listens on",
+		Value:   "127.0.0.1:1143",
+		EnvVars: []string{"ET_IMAP_ADDR"},
+	}
+	flagIMAPUser = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "imap-user",
+		Usage:   "user name of the IMAP account served by the " + strServeIMAP + " operation",
+		Value:   "backup",
+		EnvVars: []string{"ET_IMAP_USER"},
+	}
+	flagIMAPPassword = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "imap-password",
+		Usage:   "password of the IMAP account served by the " + strServeIMAP + " operation, generated if not set",
+		EnvVars: []string{"ET_IMAP_PASSWORD"},
+	}
+	flagPrivateKeyPassword = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "private-key-password",
+		Usage:   "password of the private key used by the " + strDecrypt + " operation",
+		EnvVars: []string{"ET_PRIVATE_KEY_PASSWORD"},
+	}
+	flagLowDiskSpace = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "on-low-disk-space",
+		Usage:   "what to do when the export volume runs out of space: abort or pause",
+		Value:   "abort",
+		EnvVars: []string{"ET_ON_LOW_DISK_SPACE"},
+	}
+	flagMetricsAddr = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "metrics-addr",
+		Usage:   "serve export metrics in the Prometheus format on this loopback address, e.g. 127.0.0.1:9090",
+		EnvVars: []string{"ET_METRICS_ADDR"},
+	}
+	flagLogFormat = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "log-format",
+		Usage:   "log file format: text or json",
+		Value:   "text",
+		EnvVars: []string{"ET_LOG_FORMAT"},
+	}
+	flagLogLevel = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "log-level",
+		Usage:   "log level: error, warn, info or debug",
+		Value:   "debug",
+		EnvVars: []string{"ET_LOG_LEVEL"},
+	}
+	flagLogMaxSize = &cli.IntFlag{ //nolint:gochecknoglobals
+		Name:    "log-max-size",
+		Usage:   "start a new log file after this many MB",
+		Value:   internal.DefaultLogMaxFileSize / mail.MB,
+		EnvVars: []string{"ET_LOG_MAX_SIZE"},
+	}
+	flagLogMaxFiles = &cli.IntFlag{ //nolint:gochecknoglobals
+		Name:    "log-max-files",
+		Usage:   "number of log files to keep in the logs folder, 0 keeps every file",
+		Value:   internal.DefaultLogMaxFiles,
+		EnvVars: []string{"ET_LOG_MAX_FILES"},
+	}
+	flagOTLPEndpoint = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "otlp-endpoint",
+		Usage:   "export OpenTelemetry traces to this OTLP/HTTP endpoint, e.g. http://localhost:4318",
+		EnvVars: []string{"ET_OTLP_ENDPOINT"},
+	}
+	flagTraceFile = &cli.StringFlag{ //nolint:gochecknoglobals
+		Name:    "trace-file",
+		Usage:   "write OpenTelemetry traces as JSON to this file",
+		EnvVars: []string{"ET_TRACE_FILE"},
+	}
 )
 
 func Run() {
@@ -77,6 +262,39 @@ func Run() {
 			flagTOTP,
 			flagOperation,
 			flagFolder,
+			flagContinueOnFailure,
+			flagExportKeys,
+			flagExportSettings,
+			flagExportContacts,
+			flagSearchIndex,
+			flagCatalog,
+			flagRestoreSettings,
+			flagNoDedupe,
+			flagDryRun,
+			flagImportWorkers,
+			flagImportFormat,
+			flagLabelMap,
+			flagTargetAddress,
+			flagAddressMap,
+			flagBackupFolders,
+			flagImportLabel,
+			flagImportLabelName,
+			flagImportLabelColor,
+			flagPrivateKey,
+			flagPrivateKeyPassword,
+			flagSearchQuery,
+			flagRebuildIndex,
+			flagIMAPAddr,
+			flagIMAPUser,
+			flagIMAPPassword,
+			flagLowDiskSpace,
+			flagMetricsAddr,
+			flagOTLPEndpoint,
+			flagTraceFile,
+			flagLogFormat,
+			flagLogLevel,
+			flagLogMaxSize,
+			flagLogMaxFiles,
 		},
 	}
 
@@ -94,21 +312,101 @@ func run(ctx *cli.Context) error {
 	panicHandler := sentry.NewPanicHandler(func() {})
 	defer async.HandlePanic(panicHandler)
 
+	if err := applyLogOptions(ctx); err != nil {
+		return err
+	}
+
 	printHeader()
 	checkForNewVersion()
 
-	fmt.Printf("\nSession log: %v\n\n", filepath.FromSlash(state.logPath))
+	fmt.Printf("\nSession log: %v\n\n", filepath.FromSlash(state.file.Path()))
+
+	if endpoint, file := ctx.String(flagOTLPEndpoint.Name), ctx.String(flagTraceFile.Name); endpoint != "" || file != "" {
+		shutdown, err := tracing.Init(ctx.Context, tracing.Config{Endpoint: endpoint, File: file})
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := shutdown(context.Background()); err != nil {
+				logrus.WithError(err).Error("Failed to flush traces")
+			}
+		}()
+	}
 
 	session, err := newSession(panicHandler)
 	if err != nil {
 		return err
 	}
 
+	if addr := ctx.String(flagMetricsAddr.Name); addr != "" {
+		listenAddr, err := session.StartMetricsServer(addr)
+		if err != nil {
+			return err
+		}
+
+		defer session.StopMetricsServer()
+
+		fmt.Printf("Metrics: http://%v/metrics\n\n", listenAddr)
+	}
+
 	operation, err := getOperation(ctx)
 	if err != nil {
 		return err
 	}
 
+	lowDiskPolicy, err := stringToLowDiskSpacePolicy(ctx.String(flagLowDiskSpace.Name))
+	if err != nil {
+		return err
+	}
+
+	// Decrypting a backup with a private key is done offline.
+	if operation == operationDecrypt && len(ctx.String(flagPrivateKey.Name)) != 0 {
+		dir, err := getTargetFolder(ctx, operation, "")
+		if err != nil {
+			return err
+		}
+
+		return runDecryptWithPrivateKey(ctx, dir)
+	}
+
+	// Searching a backup is done offline.
+	if operation == operationSearch {
+		dir, err := getTargetFolder(ctx, operation, "")
+		if err != nil {
+			return err
+		}
+
+		return runSearch(ctx.Context, dir, ctx.String(flagSearchQuery.Name), ctx.Bool(flagRebuildIndex.Name))
+	}
+
+	// The catalog is rebuilt from the files of the backup, offline.
+	if operation == operationRebuildCatalog {
+		dir, err := getTargetFolder(ctx, operation, "")
+		if err != nil {
+			return err
+		}
+
+		return runRebuildCatalog(ctx.Context, dir)
+	}
+
+	// Serving a backup over IMAP is done offline.
+	if operation == operationServeIMAP {
+		dir, err := getTargetFolder(ctx, operation, "")
+		if err != nil {
+			return err
+		}
+
+		return runServeIMAP(
+			ctx.Context,
+			dir,
+			ctx.String(flagIMAPAddr.Name),
+			ctx.String(flagIMAPUser.Name),
+			ctx.String(flagIMAPPassword.Name),
+			panicHandler,
+		)
+	}
+
 	if err = login(ctx, session); err != nil {
 		return err
 	}
@@ -119,11 +417,72 @@ func run(ctx *cli.Context) error {
 	}
 
 	if operation == operationBackup {
-		return runBackup(ctx.Context, dir, session)
+		return runBackup(ctx.Context, dir, session, backupOptions{
+			continueOnFailure: ctx.Bool(flagContinueOnFailure.Name),
+			exportKeys:        ctx.Bool(flagExportKeys.Name),
+			exportSettings:    ctx.Bool(flagExportSettings.Name),
+			exportContacts:    ctx.Bool(flagExportContacts.Name),
+			searchIndex:       ctx.Bool(flagSearchIndex.Name),
+			catalog:           ctx.Bool(flagCatalog.Name),
+			lowDiskPolicy:     lowDiskPolicy,
+		})
+	}
+
+	if operation == operationRetryFailed {
+		return runRetryFailed(ctx.Context, dir, session, lowDiskPolicy)
+	}
+
+	if operation == operationDecrypt {
+		keys, err := mail.NewSessionDecryptKeys(ctx.Context, session)
+		if err != nil {
+			return err
+		}
+		defer keys.Close()
+
+		return runDecrypt(ctx.Context, dir, keys)
+	}
+
+	if operation == operationLabelMapTemplate {
+		sourceFormat, err := mail.ParseRestoreSourceFormat(ctx.String(flagImportFormat.Name))
+		if err != nil {
+			return err
+		}
+
+		return runLabelMapTemplate(ctx.Context, dir, session, sourceFormat, ctx.String(flagLabelMap.Name))
 	}
 
 	if operation == operationRestore {
-		return runRestore(ctx.Context, dir, session)
+		sourceFormat, err := mail.ParseRestoreSourceFormat(ctx.String(flagImportFormat.Name))
+		if err != nil {
+			return err
+		}
+
+		addressMapping, err := mail.LoadAddressMapping(ctx.String(flagAddressMap.Name))
+		if err != nil {
+			return err
+		}
+
+		importLabelMode, err := mail.ParseRestoreImportLabelMode(ctx.String(flagImportLabel.Name))
+		if err != nil {
+			return err
+		}
+
+		return runRestore(ctx.Context, dir, session, restoreOptions{
+			dryRun:          ctx.Bool(flagDryRun.Name),
+			importWorkers:   ctx.Int(flagImportWorkers.Name),
+			sourceFormat:    sourceFormat,
+			labelMapFile:    ctx.String(flagLabelMap.Name),
+			targetAddress:   ctx.String(flagTargetAddress.Name),
+			addressMapping:  addressMapping,
+			backupFolders:   parseBackupFolders(ctx.String(flagBackupFolders.Name)),
+			restoreSettings: ctx.Bool(flagRestoreSettings.Name),
+			noDedupe:        ctx.Bool(flagNoDedupe.Name),
+			importLabel: mail.RestoreImportLabelOptions{
+				Mode:         importLabelMode,
+				NameTemplate: ctx.String(flagImportLabelName.Name),
+				Color:        ctx.String(flagImportLabelColor.Name),
+			},
+		})
 	}
 
 	return nil
@@ -249,22 +608,301 @@ func login(ctx *cli.Context, s *session.Session) error {
 	}
 }
 
-func runBackup(ctx context.Context, exportPath string, session *session.Session) error {
-	exportTask := mail.NewExportTask(ctx, exportPath, session)
+type backupOptions struct {
+	continueOnFailure bool
+	exportKeys        bool
+	exportSettings    bool
+	exportContacts    bool
+	searchIndex       bool
+	catalog           bool
+	lowDiskPolicy     mail.LowDiskSpacePolicy
+}
+
+func runBackup(ctx context.Context, exportPath string, session *session.Session, options backupOptions) error {
+	exportTask := mail.NewExportTask(ctx, exportPath, session, nil)
+	exportTask.SetLowDiskSpacePolicy(options.lowDiskPolicy)
+	exportTask.SetKeyExport(options.exportKeys)
+	exportTask.SetSettingsExport(options.exportSettings)
+	exportTask.SetContactsExport(options.exportContacts)
+	exportTask.SetSearchIndex(options.searchIndex)
+	exportTask.SetCatalog(options.catalog)
+	if options.continueOnFailure {
+		exportTask.SetFailurePolicy(mail.FailurePolicyContinue)
+	}
+
 	fmt.Printf("Starting backup - Path=\"%v\"\n", filepath.FromSlash(exportTask.GetExportPath()))
 	err := exportTask.Run(ctx, newCliReporter())
 	if err == nil {
 		fmt.Println("Backup finished")
 	}
+	printExportSummary(exportTask)
+	printFailedMessages(exportTask)
 
 	return err
 }
 
-func runRestore(ctx context.Context, backupPath string, session *session.Session) error {
+func runRetryFailed(ctx context.Context, backupPath string, session *session.Session, lowDiskPolicy mail.LowDiskSpacePolicy) error {
+	exportTask, err := mail.NewRetryFailedExportTask(ctx, backupPath, session)
+	if err != nil {
+		return err
+	}
+
+	exportTask.SetLowDiskSpacePolicy(lowDiskPolicy)
+
+	exportTask.SetFailurePolicy(mail.FailurePolicyContinue)
+
+	fmt.Printf("Retrying failed messages - Path=\"%v\"\n", filepath.FromSlash(exportTask.GetExportPath()))
+	err = exportTask.Run(ctx, newCliReporter())
+	if err == nil {
+		fmt.Println("Retry finished")
+	}
+	printExportSummary(exportTask)
+	printFailedMessages(exportTask)
+
+	return err
+}
+
+func printExportSummary(task *mail.ExportTask) {
+	if summary := task.GetSummary(); summary != nil {
+		fmt.Printf("\n%v\n", summary.ToText())
+	}
+}
+
+func printFailedMessages(task *mail.ExportTask) {
+	if count := task.GetFailedMessageCount(); count != 0 {
+		fmt.Printf("%v message(s) could not be exported, use the %v operation to retry them\n", count, strRetry)
+	}
+}
+
+type restoreOptions struct {
+	dryRun          bool
+	importWorkers   int
+	sourceFormat    mail.RestoreSourceFormat
+	labelMapFile    string
+	targetAddress   string
+	addressMapping  map[string]string
+	backupFolders   []string
+	importLabel     mail.RestoreImportLabelOptions
+	restoreSettings bool
+	noDedupe        bool
+}
+
+// parseBackupFolders returns the backup sub-folders selected by the user, nil to restore all of them.
+func parseBackupFolders(value string) []string {
+	if strings.EqualFold(strings.TrimSpace(value), "all") {
+		return nil
+	}
+
+	return mail.FilterParser{}.ParseCommaSeparated(value)
+}
+
+func runLabelMapTemplate(
+	ctx context.Context,
+	backupPath string,
+	session *session.Session,
+	sourceFormat mail.RestoreSourceFormat,
+	templatePath string,
+) error {
 	restoreTask, err := mail.NewRestoreTask(ctx, backupPath, session)
 	if err != nil {
 		return err
 	}
+	defer restoreTask.Close()
+
+	restoreTask.SetSourceFormat(sourceFormat)
+
+	path, err := restoreTask.WriteLabelMappingTemplate(templatePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Label mapping template written to %v\n", path)
+	fmt.Printf("Edit it, then restore with '--%v %v'\n", flagLabelMap.Name, path)
+
+	return nil
+}
+
+func runDecryptWithPrivateKey(ctx *cli.Context, backupPath string) error {
+	armored, err := os.ReadFile(ctx.String(flagPrivateKey.Name))
+	if err != nil {
+		return fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	password := []byte(ctx.String(flagPrivateKeyPassword.Name))
+
+	keys, err := mail.NewPrivateKeyDecryptKeys(string(armored), password)
+	if errors.Is(err, mail.ErrPrivateKeyPassword) && len(password) == 0 {
+		if password, err = readPassword("Enter the password of the private key: "); err != nil {
+			return err
+		}
+
+		keys, err = mail.NewPrivateKeyDecryptKeys(string(armored), password)
+	}
+
+	if err != nil {
+		return err
+	}
+	defer keys.Close()
+
+	return runDecrypt(ctx.Context, backupPath, keys)
+}
+
+func runDecrypt(ctx context.Context, backupPath string, keys mail.BackupDecryptKeys) error {
+	decryptTask := mail.NewBackupDecryptTask(ctx, backupPath, keys)
+
+	fmt.Printf("Decrypting backup '%v'\n", decryptTask.GetBackupPath())
+	if err := decryptTask.Run(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Decrypted emails: %v\n", decryptTask.GetDecryptedCount())
+	fmt.Printf("Still encrypted: %v\n", decryptTask.GetFailedCount())
+
+	return nil
+}
+
+func runSearch(ctx context.Context, dir string, query string, rebuild bool) error {
+	if len(query) == 0 {
+		var err error
+		if query, err = readLine("Enter the search query: "); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := mail.ParseSearchQuery(query)
+	if err != nil {
+		return err
+	}
+
+	// A missing index is saved through a temporary folder of the backup, which is removed once done.
+	tmpDir, err := os.MkdirTemp(dir, "temp_")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	index, err := mail.OpenSearchIndex(ctx, dir, tmpDir, rebuild)
+	if err != nil {
+		return err
+	}
+
+	results := index.Search(parsed)
+
+	fmt.Printf("Found %v message(s) out of %v matching '%v'\n", len(results), index.Len(), query)
+
+	for _, result := range results {
+		date := "unknown date"
+		if result.Date != 0 {
+			date = time.Unix(result.Date, 0).Format(time.DateOnly)
+		}
+
+		fmt.Printf("\n[%v] %v - %v\n", date, result.Subject, result.From)
+		fmt.Printf("  ID:   %v\n", result.ID)
+		fmt.Printf("  Path: %v\n", filepath.Join(dir, filepath.FromSlash(result.Path)))
+	}
+
+	return nil
+}
+
+func runRebuildCatalog(ctx context.Context, dir string) error {
+	fmt.Printf("Rebuilding the catalog of %v\n", dir)
+
+	count, err := mail.RebuildCatalog(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cataloged %v message(s)\n", count)
+
+	return nil
+}
+
+func runServeIMAP(ctx context.Context, dir, addr, username, password string, panicHandler async.PanicHandler) error {
+	if len(password) == 0 {
+		var err error
+		if password, err = generateIMAPPassword(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Loading %v\n", dir)
+
+	server, err := mail.NewBackupIMAPServer(ctx, dir, username, []byte(password), panicHandler)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := server.Close(context.Background()); err != nil {
+			logrus.WithError(err).Error("Failed to close IMAP server")
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listenAddr, err := server.Serve(ctx, addr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Serving %v message(s) over IMAP, read-only\n", server.GetMessageCount())
+	if skipped := server.GetSkippedCount(); skipped != 0 {
+		fmt.Printf("%v message(s) saved in parts are not served, run the %v operation first\n", skipped, strDecrypt)
+	}
+
+	fmt.Printf("\n  Address:  %v (no TLS)\n", listenAddr)
+	fmt.Printf("  User:     %v\n", username)
+	fmt.Printf("  Password: %v\n\n", password)
+	fmt.Println("Press Ctrl+C to stop the server")
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func generateIMAPPassword() (string, error) {
+	password := make([]byte, 12)
+	if _, err := rand.Read(password); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(password), nil
+}
+
+func runRestore(ctx context.Context, backupPath string, session *session.Session, options restoreOptions) error {
+	restoreTask, err := mail.NewRestoreTask(ctx, backupPath, session)
+	if err != nil {
+		return err
+	}
+	defer restoreTask.Close()
+
+	restoreTask.SetParallelImports(options.importWorkers)
+	restoreTask.SetSourceFormat(options.sourceFormat)
+	restoreTask.SetLabelMappingFile(options.labelMapFile)
+	restoreTask.SetTargetAddress(options.targetAddress)
+	restoreTask.SetAddressMapping(options.addressMapping)
+	restoreTask.SetBackupFolders(options.backupFolders)
+	restoreTask.SetSettingsRestore(options.restoreSettings)
+	restoreTask.SetDedupe(!options.noDedupe)
+
+	if err := restoreTask.SetImportLabelOptions(options.importLabel); err != nil {
+		return err
+	}
+
+	if options.dryRun {
+		restoreTask.SetDryRun(true)
+
+		fmt.Println("Starting restore dry-run")
+		if err := restoreTask.Run(newCliReporter()); err != nil {
+			return err
+		}
+
+		fmt.Println("Restore dry-run finished, the account was not modified")
+		fmt.Println()
+		fmt.Print(restoreTask.GetDryRunReport().ToText())
+
+		return nil
+	}
 
 	fmt.Println("Starting restore")
 	err = restoreTask.Run(newCliReporter())
@@ -280,6 +918,8 @@ func printRestoreTaskSummary(task *mail.RestoreTask) {
 	fmt.Printf("Successful imports: %v\n", task.GetImportedCount())
 	fmt.Printf("Failed imports: %v\n", task.GetFailedCount())
 	fmt.Printf("Skipped imports: %v\n", task.GetSkippedCount())
+	fmt.Printf("Already on the account: %v\n", task.GetDuplicateCount())
+	fmt.Printf("Still encrypted: %v\n", task.GetEncryptedCount())
 }
 
 func initApp(defaultOperationPath string, onRecover func()) error {
@@ -298,19 +938,12 @@ func initApp(defaultOperationPath string, onRecover func()) error {
 		return err
 	}
 
-	state.logPath = filepath.Join(defaultOperationPath, internal.NewLogFileName())
-	file, err := os.OpenFile(state.logPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	file, err := internal.InitLogging(defaultOperationPath)
 	if err != nil {
 		return err
 	}
-	logrus.SetOutput(file)
-	logrus.SetFormatter(&logrus.TextFormatter{
-		DisableColors:    true,
-		ForceQuote:       true,
-		FullTimestamp:    true,
-		QuoteEmptyFields: true,
-		TimestampFormat:  "2006-01-02 15:04:05.000",
-	})
+
+	state.file = file
 	internal.LogPrelude()
 
 	if onRecover != nil {
@@ -326,6 +959,28 @@ func initApp(defaultOperationPath string, onRecover func()) error {
 	return nil
 }
 
+func applyLogOptions(ctx *cli.Context) error {
+	format, err := internal.ParseLogFormat(ctx.String(flagLogFormat.Name))
+	if err != nil {
+		return err
+	}
+
+	level, err := logrus.ParseLevel(ctx.String(flagLogLevel.Name))
+	if err != nil {
+		return err
+	}
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	return internal.ApplyLogOptions(state.file, internal.LogOptions{
+		Format:      format,
+		Level:       level,
+		MaxFileSize: int64(ctx.Int(flagLogMaxSize.Name)) * mail.MB,
+		MaxFiles:    ctx.Int(flagLogMaxFiles.Name),
+	})
+}
+
 func closeApp() {
 	state.mutex.Lock()
 	defer state.mutex.Unlock()
@@ -352,8 +1007,7 @@ func printError(err error) {
 
 type globalState struct {
 	mutex     sync.Mutex
-	file      *os.File
-	logPath   string
+	file      *internal.LogFile
 	onRecover func()
 	reporter  reporter.Reporter
 }
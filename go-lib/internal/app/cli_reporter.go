@@ -38,3 +38,11 @@ func (m *cliReporter) OnProgress(delta int) {
 	_ = m.currentMessageCount.Add(uint64(delta)) //nolint:gosec // yet again, we shouldn't overflow.
 	_ = m.progressbar.Add(delta)
 }
+
+func (m *cliReporter) OnPauseStateChanged(paused bool) {
+	if paused {
+		m.progressbar.Describe("Paused")
+	} else {
+		m.progressbar.Describe("")
+	}
+}
@@ -7,13 +7,20 @@ import (
 	"os"
 	"strings"
 
+	"github.com/ProtonMail/export-tool/internal/mail"
 	"github.com/urfave/cli/v2"
 )
 
 const (
-	strBackup  = "backup"
-	strRestore = "restore"
-	strUnknown = "unknown"
+	strBackup           = "backup"
+	strRestore          = "restore"
+	strRetry            = "retry-failed"
+	strLabelMapTemplate = "label-map-template"
+	strDecrypt          = "decrypt"
+	strSearch           = "search"
+	strRebuildCatalog   = "rebuild-catalog"
+	strServeIMAP        = "serve-imap"
+	strUnknown          = "unknown"
 )
 
 type Operation int
@@ -22,6 +29,12 @@ const (
 	operationUnknown Operation = iota
 	operationBackup
 	operationRestore
+	operationRetryFailed
+	operationLabelMapTemplate
+	operationDecrypt
+	operationSearch
+	operationRebuildCatalog
+	operationServeIMAP
 )
 
 func getOperation(ctx *cli.Context) (Operation, error) {
@@ -36,7 +49,7 @@ func getOperation(ctx *cli.Context) (Operation, error) {
 func readOperationFromCLI() (Operation, error) {
 	reader := bufio.NewReader(os.Stdin)
 	for i := 0; i < retryCount; i++ {
-		fmt.Printf("Enter the operation ((B)ackup / (R)restore): ")
+		fmt.Printf("Enter the operation ((B)ackup / (R)restore / retry-failed / label-map-template / decrypt / search / rebuild-catalog / serve-imap): ")
 		input, err := reader.ReadString('\n')
 		if err != nil {
 			return operationUnknown, err
@@ -62,15 +75,63 @@ func stringToOperation(operation string) (Operation, error) {
 		return operationRestore, nil
 	}
 
+	if strings.EqualFold(operation, strRetry) {
+		return operationRetryFailed, nil
+	}
+
+	if strings.EqualFold(operation, strLabelMapTemplate) {
+		return operationLabelMapTemplate, nil
+	}
+
+	if strings.EqualFold(operation, strDecrypt) {
+		return operationDecrypt, nil
+	}
+
+	if strings.EqualFold(operation, strSearch) {
+		return operationSearch, nil
+	}
+
+	if strings.EqualFold(operation, strRebuildCatalog) {
+		return operationRebuildCatalog, nil
+	}
+
+	if strings.EqualFold(operation, strServeIMAP) {
+		return operationServeIMAP, nil
+	}
+
 	return operationUnknown, fmt.Errorf("unknown operation %s", operation)
 }
 
+func stringToLowDiskSpacePolicy(policy string) (mail.LowDiskSpacePolicy, error) {
+	if strings.EqualFold(policy, "abort") {
+		return mail.LowDiskSpacePolicyAbort, nil
+	}
+
+	if strings.EqualFold(policy, "pause") {
+		return mail.LowDiskSpacePolicyPause, nil
+	}
+
+	return mail.LowDiskSpacePolicyAbort, fmt.Errorf("unknown low disk space policy %s", policy)
+}
+
 func operationToString(operation Operation) string {
 	switch operation {
 	case operationBackup:
 		return strBackup
 	case operationRestore:
 		return strRestore
+	case operationRetryFailed:
+		return strRetry
+	case operationLabelMapTemplate:
+		return strLabelMapTemplate
+	case operationDecrypt:
+		return strDecrypt
+	case operationSearch:
+		return strSearch
+	case operationRebuildCatalog:
+		return strRebuildCatalog
+	case operationServeIMAP:
+		return strServeIMAP
 	case operationUnknown:
 		return strUnknown
 	default:
@@ -75,12 +75,16 @@ func validateTargetFolder(operation Operation, path string) (string, error) {
 		}
 	}
 
-	if operation == operationRestore {
+	if operation == operationRestore || operation == operationRetryFailed || operation == operationLabelMapTemplate ||
+		operation == operationDecrypt || operation == operationSearch || operation == operationRebuildCatalog ||
+		operation == operationServeIMAP {
 		stat, err := os.Stat(fullPath)
 		if err != nil {
 			return "", err
 		}
-		if !stat.IsDir() {
+		// A restore can also import a single mbox file.
+		if !stat.IsDir() && (operation == operationRetryFailed || operation == operationDecrypt || operation == operationSearch ||
+			operation == operationRebuildCatalog || operation == operationServeIMAP) {
 			return "", errors.New("target folder is not a directory")
 		}
 	}
@@ -18,12 +18,19 @@
 package hv
 
 import (
+	"os"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestGetSystemLang(t *testing.T) {
+	// The language is read from the environment on Linux, which a bare build environment may not set.
+	if runtime.GOOS == "linux" && os.Getenv("LANG") == "" {
+		t.Setenv("LANG", "en_US.UTF-8")
+	}
+
 	l, err := GetSystemLang()
 	require.NoError(t, err)
 	require.NotEmpty(t, l)
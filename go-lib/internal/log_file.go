@@ -0,0 +1,214 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const logFileSuffix = "_export.log"
+
+// LogFile writes the session log into a folder. Once the current file exceeds the maximum size a new one is started.
+// If a maximum number of files is set, the oldest log files in the folder are removed so that no more are kept.
+type LogFile struct {
+	lock     sync.Mutex
+	dir      string
+	file     *os.File
+	path     string
+	size     int64
+	maxSize  int64
+	maxFiles int
+	sequence int
+
+	rotateFailed bool // Whether the failure to start a new file was already reported.
+}
+
+func NewLogFile(dir string) (*LogFile, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	l := &LogFile{
+		dir:      dir,
+		maxSize:  DefaultLogMaxFileSize,
+		maxFiles: DefaultLogMaxFiles,
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Path returns the path of the log file currently written.
+func (l *LogFile) Path() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.path
+}
+
+// SetLimits changes the rotation limits and removes the log files exceeding maxFiles. A maxFiles of 0 keeps every
+// log file.
+func (l *LogFile) SetLimits(maxSize int64, maxFiles int) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.maxSize = maxSize
+	l.maxFiles = maxFiles
+
+	return l.removeOldFiles()
+}
+
+func (l *LogFile) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	var rotateErr error
+
+	if l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		// Keep writing into the current file if a new one can't be started, rotation is attempted again next time. The
+		// failure is only reported once, until a new file could be started.
+		if err := l.rotate(); err == nil {
+			l.rotateFailed = false
+		} else if !l.rotateFailed {
+			l.rotateFailed = true
+			rotateErr = fmt.Errorf("failed to start a new log file: %w", err)
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+
+	if err != nil {
+		return n, err
+	}
+
+	return n, rotateErr
+}
+
+func (l *LogFile) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+func (l *LogFile) open() error {
+	name := NewLogFileName()
+	if l.sequence != 0 {
+		name = strings.TrimSuffix(name, logFileSuffix) + fmt.Sprintf("_%v", l.sequence) + logFileSuffix
+	}
+
+	path := filepath.Join(l.dir, name)
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	l.file = file
+	l.path = path
+	l.size = 0
+
+	return nil
+}
+
+func (l *LogFile) rotate() error {
+	previous := l.file
+
+	l.sequence++
+
+	// The previous file stays the current one until the new file is open.
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	if err := previous.Close(); err != nil {
+		return err
+	}
+
+	return l.removeOldFiles()
+}
+
+func (l *LogFile) removeOldFiles() error {
+	if l.maxFiles <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(l.dir, "*"+logFileSuffix))
+	if err != nil {
+		return err
+	}
+
+	type logFileInfo struct {
+		path    string
+		modTime time.Time
+	}
+
+	files := make([]logFileInfo, 0, len(matches))
+
+	for _, path := range matches {
+		if path == l.file.Name() {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, logFileInfo{path: path, modTime: info.ModTime()})
+	}
+
+	// The current file always counts towards the limit.
+	excess := len(files) + 1 - l.maxFiles
+	if excess <= 0 {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	for _, f := range files[:excess] {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFile_Rotation(t *testing.T) {
+	dir := t.TempDir()
+
+	file, err := NewLogFile(dir)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, file.Close()) }()
+
+	require.NoError(t, file.SetLimits(10, 2))
+
+	firstPath := file.Path()
+
+	for i := 0; i < 3; i++ {
+		_, err := file.Write([]byte("0123456789"))
+		require.NoError(t, err)
+	}
+
+	require.NotEqual(t, firstPath, file.Path())
+	require.FileExists(t, file.Path())
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+logFileSuffix))
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+
+	for _, m := range matches {
+		data, err := os.ReadFile(m)
+		require.NoError(t, err)
+		require.Equal(t, "0123456789", string(data))
+	}
+}
+
+func TestLogFile_Retention(t *testing.T) {
+	dir := t.TempDir()
+
+	old := []string{"20200101_000000_export.log", "20200102_000000_export.log", "20200103_000000_export.log"}
+	for i, name := range old {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("old"), 0o600))
+
+		modTime := time.Now().Add(-time.Duration(len(old)-i) * time.Hour)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unrelated.txt"), nil, 0o600))
+
+	file, err := NewLogFile(dir)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, file.Close()) }()
+
+	require.NoError(t, file.SetLimits(DefaultLogMaxFileSize, 2))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	require.Len(t, names, 3)
+	require.Contains(t, names, "20200103_000000_export.log")
+	require.Contains(t, names, "unrelated.txt")
+	require.Contains(t, names, filepath.Base(file.Path()))
+	require.True(t, strings.HasSuffix(file.Path(), logFileSuffix))
+}
+
+func TestLogFile_DefaultKeepsExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"20200101_000000_export.log", "20200102_000000_export.log"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("old"), 0o600))
+	}
+
+	file, err := NewLogFile(dir)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, file.Close()) }()
+
+	require.NoError(t, file.SetLimits(10, DefaultLogMaxFiles))
+
+	for i := 0; i < 3; i++ {
+		_, err := file.Write([]byte("0123456789"))
+		require.NoError(t, err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+logFileSuffix))
+	require.NoError(t, err)
+	require.Len(t, matches, 5)
+}
+
+func TestLogFile_RotationFailureKeepsCurrentFile(t *testing.T) {
+	dir := t.TempDir()
+
+	file, err := NewLogFile(dir)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, file.Close()) }()
+
+	require.NoError(t, file.SetLimits(10, 0))
+
+	path := file.Path()
+
+	_, err = file.Write([]byte("0123456789"))
+	require.NoError(t, err)
+
+	// The next file can't be created once the log folder is gone.
+	file.dir = filepath.Join(dir, "missing")
+
+	n, err := file.Write([]byte("abc"))
+	require.Error(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, path, file.Path())
+
+	// The failure is only reported once.
+	n, err = file.Write([]byte("def"))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, path, file.Path())
+
+	data, err := os.ReadFile(path) //nolint:gosec
+	require.NoError(t, err)
+	require.Equal(t, "0123456789abcdef", string(data))
+
+	// Rotation resumes once the folder is back, a later failure is reported again.
+	file.dir = dir
+
+	_, err = file.Write([]byte("ghi"))
+	require.NoError(t, err)
+	require.NotEqual(t, path, file.Path())
+
+	file.dir = filepath.Join(dir, "missing")
+
+	_, err = file.Write([]byte("0123456789"))
+	require.Error(t, err)
+}
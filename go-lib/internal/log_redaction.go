@@ -0,0 +1,110 @@
+// Copyright (c) 2023 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "[redacted]"
+
+//nolint:gochecknoglobals
+var (
+	emailRegexp = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	pgpRegexp   = regexp.MustCompile(`(?s)-----BEGIN PGP [A-Z ]+-----.*?(-----END PGP [A-Z ]+-----|$)`)
+
+	// Field names which are redacted entirely, matched case-insensitively.
+	redactedKeys         = []string{"key", "keys"}
+	redactedKeyFragments = []string{"subject", "salt", "password", "passphrase", "privatekey", "token"}
+)
+
+// RedactionHook scrubs email addresses, message subjects, salts and key material from log entries before they are
+// written. Fields holding structured values, such as the user or its salts, are replaced by their type name since
+// they may embed any of the above.
+type RedactionHook struct{}
+
+func (r *RedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (r *RedactionHook) Fire(entry *logrus.Entry) error {
+	entry.Message = RedactText(entry.Message)
+
+	for k, v := range entry.Data {
+		entry.Data[k] = redactField(k, v)
+	}
+
+	return nil
+}
+
+// RedactText removes email addresses and armored PGP blocks from s.
+func RedactText(s string) string {
+	s = pgpRegexp.ReplaceAllString(s, "[redacted-pgp]")
+	return emailRegexp.ReplaceAllString(s, "[redacted-email]")
+}
+
+func isRedactedKey(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, k := range redactedKeys {
+		if key == k {
+			return true
+		}
+	}
+
+	for _, k := range redactedKeyFragments {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func redactField(key string, value any) any {
+	if value == nil {
+		return nil
+	}
+
+	if isRedactedKey(key) {
+		return redacted
+	}
+
+	switch v := value.(type) {
+	case string:
+		return RedactText(v)
+	case []byte:
+		return redacted
+	case error:
+		return RedactText(v.Error())
+	case fmt.Stringer:
+		return RedactText(v.String())
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(value)).Kind() { //nolint:exhaustive
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Interface:
+		return fmt.Sprintf("[redacted %T]", value)
+	default:
+		return value
+	}
+}
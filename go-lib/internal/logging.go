@@ -18,12 +18,57 @@
 package internal
 
 import (
+	"fmt"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+const timestampFormat = "2006-01-02 15:04:05.000"
+
+type LogFormat int
+
+const (
+	LogFormatText LogFormat = iota
+	LogFormatJSON
+)
+
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "text":
+		return LogFormatText, nil
+	case "json":
+		return LogFormatJSON, nil
+	default:
+		return LogFormatText, fmt.Errorf("unknown log format '%v', expected text or json", s)
+	}
+}
+
+type LogOptions struct {
+	Format LogFormat
+	Level  logrus.Level
+	// MaxFileSize is the size in bytes after which a new log file is started.
+	MaxFileSize int64
+	// MaxFiles is the number of log files kept in the logs folder, including the current one. 0 keeps every file.
+	MaxFiles int
+}
+
+const (
+	DefaultLogMaxFileSize = 50 * 1024 * 1024
+	DefaultLogMaxFiles    = 0
+)
+
+func DefaultLogOptions() LogOptions {
+	return LogOptions{
+		Format:      LogFormatText,
+		Level:       logrus.DebugLevel,
+		MaxFileSize: DefaultLogMaxFileSize,
+		MaxFiles:    DefaultLogMaxFiles,
+	}
+}
+
 func NewLogFileName() string {
 	const format = "20060102_150405"
 	return time.Now().Format(format) + "_export.log"
@@ -35,12 +80,53 @@ func NewLogFormatter() logrus.Formatter {
 		ForceQuote:       true,
 		FullTimestamp:    true,
 		QuoteEmptyFields: true,
-		TimestampFormat:  "2006-01-02 15:04:05.000",
+		TimestampFormat:  timestampFormat,
 	}
 }
 
+func NewJSONLogFormatter() logrus.Formatter {
+	return &logrus.JSONFormatter{
+		TimestampFormat: timestampFormat,
+	}
+}
+
+// InitLogging redirects the global logger to a new log file in dir, installs the RedactionHook and applies the
+// default options.
+func InitLogging(dir string) (*LogFile, error) {
+	file, err := NewLogFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.SetOutput(file)
+	logrus.AddHook(&RedactionHook{})
+
+	if err := ApplyLogOptions(file, DefaultLogOptions()); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// ApplyLogOptions changes the format, level and rotation limits of the global logger writing to file.
+func ApplyLogOptions(file *LogFile, opts LogOptions) error {
+	if opts.MaxFileSize <= 0 || opts.MaxFiles < 0 {
+		return fmt.Errorf("invalid log rotation limits: %v bytes, %v files", opts.MaxFileSize, opts.MaxFiles)
+	}
+
+	switch opts.Format {
+	case LogFormatJSON:
+		logrus.SetFormatter(NewJSONLogFormatter())
+	default:
+		logrus.SetFormatter(NewLogFormatter())
+	}
+
+	logrus.SetLevel(opts.Level)
+
+	return file.SetLimits(opts.MaxFileSize, opts.MaxFiles)
+}
+
 func LogPrelude() {
-	logrus.SetLevel(logrus.DebugLevel)
 	logrus.
 		WithField("appName", "Proton Export").
 		WithField("version", ETVersionString).
@@ -0,0 +1,372 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/session"
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/proton-bridge/v3/pkg/message"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNoDecryptionKey    = errors.New("no key to decrypt the message")
+	ErrPrivateKeyPassword = errors.New("failed to unlock private key")
+)
+
+// BackupDecryptKeys provides the keys used to decrypt the parts of a backup which could not be decrypted during the
+// export.
+type BackupDecryptKeys interface {
+	GetAddrKeyRing(addrID string) (*crypto.KeyRing, bool)
+	Close()
+}
+
+// privateKeyDecryptKeys decrypts the messages of every address with a single private key exported by the user.
+type privateKeyDecryptKeys struct {
+	keyRing *crypto.KeyRing
+}
+
+// NewPrivateKeyDecryptKeys unlocks an armored address private key. The passphrase is ignored if the key is not
+// protected.
+func NewPrivateKeyDecryptKeys(armored string, passphrase []byte) (BackupDecryptKeys, error) {
+	key, err := crypto.NewKeyFromArmored(armored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	if !key.IsPrivate() {
+		return nil, errors.New("key is not a private key")
+	}
+
+	locked, err := key.IsLocked()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	if locked {
+		if key, err = key.Unlock(passphrase); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPrivateKeyPassword, err)
+		}
+	}
+
+	keyRing, err := crypto.NewKeyRing(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key ring: %w", err)
+	}
+
+	return &privateKeyDecryptKeys{keyRing: keyRing}, nil
+}
+
+func (p *privateKeyDecryptKeys) GetAddrKeyRing(string) (*crypto.KeyRing, bool) {
+	return p.keyRing, true
+}
+
+func (p *privateKeyDecryptKeys) Close() {
+	p.keyRing.ClearPrivateParams()
+}
+
+// NewSessionDecryptKeys unlocks the address keys of the account the session is logged into.
+func NewSessionDecryptKeys(ctx context.Context, s *session.Session) (BackupDecryptKeys, error) {
+	if s.LoginState() != session.LoginStateLoggedIn {
+		return nil, errors.New("session is not logged in")
+	}
+
+	user := s.GetUser()
+
+	saltedKeyPass, err := s.GetUserSalts().SaltForKey(s.GetMailboxPassword(), user.Keys.Primary().ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to salt key password: %w", err)
+	}
+
+	addresses, err := s.GetClient().GetAddresses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user addresses: %w", err)
+	}
+
+	keyRing, err := apiclient.NewUnlockedKeyRing(user, addresses, saltedKeyPass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock user keyring:%w", err)
+	}
+
+	return keyRing, nil
+}
+
+// BackupDecryptTask decrypts offline the parts of the messages of a backup which were written encrypted during the
+// export, because the address key was missing or could not decrypt them. The EML file of every message which could be
+// decrypted is rebuilt and its metadata updated, so that it is restored like any other message.
+type BackupDecryptTask struct {
+	ctx       context.Context
+	log       *logrus.Entry
+	backupDir string
+	keys      BackupDecryptKeys
+
+	decryptedCount int64
+	failedCount    int64
+}
+
+func NewBackupDecryptTask(ctx context.Context, backupDir string, keys BackupDecryptKeys) *BackupDecryptTask {
+	return &BackupDecryptTask{
+		ctx:       ctx,
+		log:       logrus.WithField("decrypt", "mail"),
+		backupDir: backupDir,
+		keys:      keys,
+	}
+}
+
+func (t *BackupDecryptTask) GetBackupPath() string {
+	return t.backupDir
+}
+
+// GetDecryptedCount returns the number of messages which were decrypted and rebuilt.
+func (t *BackupDecryptTask) GetDecryptedCount() int64 {
+	return t.decryptedCount
+}
+
+// GetFailedCount returns the number of messages which remain encrypted.
+func (t *BackupDecryptTask) GetFailedCount() int64 {
+	return t.failedCount
+}
+
+func (t *BackupDecryptTask) Run() error {
+	t.log.WithField("backupDir", t.backupDir).Info("Decrypting backup")
+
+	dirs := []string{t.backupDir}
+
+	entries, err := os.ReadDir(t.backupDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && mailFolderRegExp.MatchString(entry.Name()) {
+			dirs = append(dirs, filepath.Join(t.backupDir, entry.Name()))
+		}
+	}
+
+	for _, dir := range dirs {
+		var metadataPaths []string
+
+		if err := walkBackupDir(t.ctx, dir, func(emlPath string) {
+			metadataPaths = append(metadataPaths, emlToMetadataFilename(emlPath))
+		}); err != nil {
+			return err
+		}
+
+		for _, metadataPath := range metadataPaths {
+			if err := t.ctx.Err(); err != nil {
+				return err
+			}
+
+			t.decryptMessage(dir, metadataPath)
+		}
+	}
+
+	t.log.WithFields(logrus.Fields{
+		"decrypted": t.decryptedCount,
+		"failed":    t.failedCount,
+	}).Info("Backup decryption finished")
+
+	return nil
+}
+
+func (t *BackupDecryptTask) decryptMessage(dir, metadataPath string) {
+	metadata, err := loadMetadataFile(metadataPath)
+	if err != nil {
+		t.log.WithField("path", metadataPath).WithError(err).Warn("Could not load metadata file. Skipping.")
+		return
+	}
+
+	if metadata.WriterType == MessageWriterTypeDecryptedAndBuilt {
+		return
+	}
+
+	log := t.log.WithField("messageID", metadata.ID)
+	messageDir := filepath.Join(dir, metadata.ID)
+
+	if parts, err := encryptedParts(messageDir); err != nil {
+		log.WithError(err).Warn("Failed to list the parts of the message")
+		return
+	} else if len(parts) == 0 {
+		return
+	}
+
+	literal, err := t.buildMessage(messageDir, metadata)
+	if err != nil {
+		log.WithError(err).Error("Failed to decrypt message")
+		t.failedCount++
+
+		return
+	}
+
+	if err := writeDecryptedMessage(dir, metadataPath, metadata, literal); err != nil {
+		log.WithError(err).Error("Failed to write decrypted message")
+		t.failedCount++
+
+		return
+	}
+
+	log.Info("Message decrypted")
+	t.decryptedCount++
+}
+
+// buildMessage decrypts the parts of a message which are still encrypted and rebuilds its RFC822 literal.
+func (t *BackupDecryptTask) buildMessage(messageDir string, metadata MessageMetadata) ([]byte, error) {
+	kr, ok := t.keys.GetAddrKeyRing(metadata.AddressID)
+	if !ok {
+		return nil, fmt.Errorf("%w: address %v", ErrNoDecryptionKey, metadata.AddressID)
+	}
+
+	headers, err := parseMessageHeaders(metadata.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message headers: %w", err)
+	}
+
+	decrypted := message.DecryptedMessage{
+		Msg: proton.Message{
+			MessageMetadata: metadata.MessageMetadata,
+			Header:          metadata.Headers,
+			ParsedHeaders:   headers,
+			MIMEType:        metadata.MIMEType,
+			Attachments:     metadata.Attachments,
+		},
+		Attachments: make([]message.DecryptedAttachment, len(metadata.Attachments)),
+	}
+
+	if body, err := os.ReadFile(filepath.Join(messageDir, bodyFileNameEncrypted())); err == nil { //nolint:gosec
+		decrypted.Msg.Body = string(body)
+		if err := decrypted.Msg.DecryptInto(kr, &decrypted.Body); err != nil {
+			return nil, fmt.Errorf("failed to decrypt body: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	} else if body, err := os.ReadFile(filepath.Join(messageDir, bodyFileName())); err != nil { //nolint:gosec
+		return nil, err
+	} else {
+		decrypted.Body.Write(body)
+	}
+
+	for i, attachment := range metadata.Attachments {
+		if err := decryptAttachment(kr, messageDir, attachment, &decrypted.Attachments[i]); err != nil {
+			return nil, fmt.Errorf("failed to decrypt attachment %v: %w", attachment.ID, err)
+		}
+	}
+
+	opts := defaultMessageJobOpts()
+	opts.IgnoreDecryptionErrors = false
+
+	var buffer bytes.Buffer
+	if err := message.BuildRFC822Into(kr, &decrypted, opts, &buffer); err != nil {
+		return nil, fmt.Errorf("failed to build message: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// decryptAttachment reads an attachment of a message, decrypting it with its key packets if it is still encrypted.
+func decryptAttachment(kr *crypto.KeyRing, messageDir string, attachment proton.Attachment, result *message.DecryptedAttachment) error {
+	encrypted, err := os.ReadFile(filepath.Join(messageDir, attachmentFileNameEncrypted(attachment.ID, attachment.Name))) //nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		data, err := os.ReadFile(filepath.Join(messageDir, attachmentFileName(attachment.ID, attachment.Name))) //nolint:gosec
+		if err != nil {
+			return err
+		}
+
+		result.Data.Write(data)
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	keyPackets, err := base64.StdEncoding.DecodeString(attachment.KeyPackets)
+	if err != nil {
+		return fmt.Errorf("invalid key packets: %w", err)
+	}
+
+	result.Packet = keyPackets
+	result.Encrypted = encrypted
+
+	stream, err := kr.DecryptStream(io.MultiReader(bytes.NewReader(keyPackets), bytes.NewReader(encrypted)), nil, crypto.GetUnixTime())
+	if err != nil {
+		return err
+	}
+
+	_, err = result.Data.ReadFrom(stream)
+
+	return err
+}
+
+// parseMessageHeaders converts the raw headers of a message, as stored in its metadata, to parsed headers.
+func parseMessageHeaders(raw string) (proton.Headers, error) {
+	headers := proton.Headers{Values: make(map[string][]string)}
+
+	if len(strings.TrimSpace(raw)) == 0 {
+		return headers, nil
+	}
+
+	header, err := rfc822.NewHeader([]byte(strings.TrimRight(raw, "\r\n") + "\r\n\r\n"))
+	if err != nil {
+		return proton.Headers{}, err
+	}
+
+	header.Entries(func(key, val string) {
+		if _, ok := headers.Values[key]; !ok {
+			headers.Order = append(headers.Order, key)
+		}
+
+		headers.Values[key] = append(headers.Values[key], val)
+	})
+
+	return headers, nil
+}
+
+// writeDecryptedMessage writes the EML file of a decrypted message and marks it as built in its metadata. The folder
+// holding its parts is removed last, so that an interrupted decryption can be run again.
+func writeDecryptedMessage(dir, metadataPath string, metadata MessageMetadata, literal []byte) error {
+	emlPath := filepath.Join(dir, getEMLFileName(metadata.ID))
+	if err := utils.WriteFileSafe(dir, emlPath, literal, &utils.Sha256IntegrityChecker{}); err != nil {
+		return fmt.Errorf("failed to write '%v': %w", emlPath, err)
+	}
+
+	metadata.WriterType = MessageWriterTypeDecryptedAndBuilt
+
+	data, err := metadata.toBytes()
+	if err != nil {
+		return err
+	}
+
+	if err := utils.WriteFileSafe(dir, metadataPath, data, &utils.Sha256IntegrityChecker{}); err != nil {
+		return fmt.Errorf("failed to write '%v': %w", metadataPath, err)
+	}
+
+	return os.RemoveAll(filepath.Join(dir, metadata.ID))
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func writeEncryptedBackupMessage(t *testing.T, dir, id string, kr *crypto.KeyRing) {
+	messageDir := filepath.Join(dir, id)
+	require.NoError(t, os.Mkdir(messageDir, 0o700))
+
+	encryptedBody, err := kr.Encrypt(crypto.NewPlainMessageFromString("hello"), nil)
+	require.NoError(t, err)
+	armoredBody, err := encryptedBody.GetArmored()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(messageDir, bodyFileNameEncrypted()), []byte(armoredBody), 0o600))
+
+	attachment := proton.Attachment{ID: "att", Name: "notes.txt", MIMEType: "text/plain", Disposition: proton.AttachmentDisposition}
+	encryptedAttachment, err := kr.EncryptAttachment(crypto.NewPlainMessageFromString("notes"), attachment.Name)
+	require.NoError(t, err)
+	attachment.KeyPackets = base64.StdEncoding.EncodeToString(encryptedAttachment.GetBinaryKeyPacket())
+	attachment.Size = int64(len(encryptedAttachment.GetBinaryDataPacket()))
+	require.NoError(t, os.WriteFile(filepath.Join(messageDir, attachmentFileNameEncrypted(attachment.ID, attachment.Name)), encryptedAttachment.GetBinaryDataPacket(), 0o600))
+
+	data, err := utils.GenerateVersionedJSON(MessageMetadataVersion, MessageMetadata{
+		MessageMetadata: proton.MessageMetadata{ID: id, AddressID: "address", Subject: "encrypted " + id},
+		Attachments:     []proton.Attachment{attachment},
+		MIMEType:        rfc822.TextPlain,
+		Headers:         "Subject: encrypted " + id + "\r\nFrom: sender@proton.me\r\n",
+		WriterType:      MessageWriterTypeNoAddrKey,
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, getMetadataFileName(id)), data, 0o600))
+}
+
+func TestBackupDecrypt(t *testing.T) {
+	passphrase := []byte("passphrase")
+
+	key, err := crypto.GenerateKey("user", "user@proton.me", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyRing(key)
+	require.NoError(t, err)
+	lockedKey, err := key.Lock(passphrase)
+	require.NoError(t, err)
+	armoredKey, err := lockedKey.Armor()
+	require.NoError(t, err)
+
+	otherKey, err := crypto.GenerateKey("other", "other@proton.me", "x25519", 0)
+	require.NoError(t, err)
+	otherKR, err := crypto.NewKeyRing(otherKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	writeBackupMessage(t, dir, "1", "one")
+	writeEncryptedBackupMessage(t, dir, "2", kr)
+	writeEncryptedBackupMessage(t, dir, "3", otherKR)
+
+	_, err = NewPrivateKeyDecryptKeys(armoredKey, []byte("wrong"))
+	require.ErrorIs(t, err, ErrPrivateKeyPassword)
+
+	keys, err := NewPrivateKeyDecryptKeys(armoredKey, passphrase)
+	require.NoError(t, err)
+	defer keys.Close()
+
+	task := NewBackupDecryptTask(context.Background(), dir, keys)
+	require.NoError(t, task.Run())
+	require.Equal(t, int64(1), task.GetDecryptedCount())
+	require.Equal(t, int64(1), task.GetFailedCount())
+
+	// The decrypted message is rebuilt and its parts removed, the other one is left untouched.
+	metadata, err := loadMetadataFile(filepath.Join(dir, getMetadataFileName("2")))
+	require.NoError(t, err)
+	require.Equal(t, MessageWriterTypeDecryptedAndBuilt, metadata.WriterType)
+	require.NoDirExists(t, filepath.Join(dir, "2"))
+	require.DirExists(t, filepath.Join(dir, "3"))
+
+	literal, err := os.ReadFile(filepath.Join(dir, getEMLFileName("2")))
+	require.NoError(t, err)
+
+	section := rfc822.Parse(literal)
+	header, err := section.ParseHeader()
+	require.NoError(t, err)
+	require.Equal(t, "encrypted 2", header.Get("Subject"))
+
+	children, err := section.Children()
+	require.NoError(t, err)
+	require.Len(t, children, 2)
+
+	body, err := children[0].DecodedBody()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(body))
+
+	attachment, err := children[1].DecodedBody()
+	require.NoError(t, err)
+	require.Equal(t, "notes", string(attachment))
+}
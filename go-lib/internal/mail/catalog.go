@@ -0,0 +1,428 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite" // Registers the sqlite database driver.
+)
+
+// CatalogVersion is the version of the catalog schema, stored as the user_version of the database.
+const CatalogVersion = 1
+
+const (
+	catalogFormatEML   = "eml"   // The message is saved as an EML file.
+	catalogFormatParts = "parts" // The body and attachments of the message are saved in a folder.
+)
+
+// catalogSchema creates the tables of the catalog. The conversation of a message is derived from its References,
+// In-Reply-To and Message-ID headers as the API does not return the conversation IDs of the messages.
+const catalogSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id              TEXT PRIMARY KEY,
+	conversation_id TEXT NOT NULL,
+	address_id      TEXT NOT NULL,
+	external_id     TEXT NOT NULL,
+	subject         TEXT NOT NULL,
+	sender_name     TEXT NOT NULL,
+	sender_address  TEXT NOT NULL,
+	time            INTEGER NOT NULL,
+	size            INTEGER NOT NULL,
+	flags           INTEGER NOT NULL,
+	unread          INTEGER NOT NULL,
+	num_attachments INTEGER NOT NULL,
+	mime_type       TEXT NOT NULL,
+	format          TEXT NOT NULL,
+	path            TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS messages_conversation_id ON messages (conversation_id);
+CREATE INDEX IF NOT EXISTS messages_sender_address ON messages (sender_address);
+CREATE INDEX IF NOT EXISTS messages_time ON messages (time);
+
+CREATE TABLE IF NOT EXISTS recipients (
+	message_id TEXT NOT NULL,
+	type       TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	address    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS recipients_message_id ON recipients (message_id);
+CREATE INDEX IF NOT EXISTS recipients_address ON recipients (address);
+
+CREATE TABLE IF NOT EXISTS labels (
+	id        TEXT PRIMARY KEY,
+	parent_id TEXT NOT NULL,
+	name      TEXT NOT NULL,
+	path      TEXT NOT NULL,
+	color     TEXT NOT NULL,
+	type      INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS message_labels (
+	message_id TEXT NOT NULL,
+	label_id   TEXT NOT NULL,
+	PRIMARY KEY (message_id, label_id)
+);
+CREATE INDEX IF NOT EXISTS message_labels_label_id ON message_labels (label_id);
+
+CREATE TABLE IF NOT EXISTS attachments (
+	id          TEXT NOT NULL,
+	message_id  TEXT NOT NULL,
+	name        TEXT NOT NULL,
+	size        INTEGER NOT NULL,
+	mime_type   TEXT NOT NULL,
+	disposition TEXT NOT NULL,
+	PRIMARY KEY (message_id, id)
+);
+
+CREATE VIEW IF NOT EXISTS conversations AS
+	SELECT conversation_id AS id, COUNT(*) AS message_count, MIN(time) AS first_time, MAX(time) AS last_time
+	FROM messages GROUP BY conversation_id;
+`
+
+// Catalog is an SQLite database describing the messages of an export folder, meant to be queried with SQL.
+type Catalog struct {
+	db *sql.DB
+}
+
+// SetCatalog controls whether the messages are added to the SQLite catalog of the export while they are written.
+func (e *ExportTask) SetCatalog(enabled bool) {
+	e.catalog = enabled
+}
+
+// OpenCatalog opens the catalog of the folder dir, creating it if the folder has none.
+func OpenCatalog(dir string) (*Catalog, error) {
+	db, err := sql.Open("sqlite", filepath.Join(dir, getCatalogFileName()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open catalog: %w", err)
+	}
+
+	// A single connection serializes the writes of the parallel writers, SQLite does not allow concurrent ones.
+	db.SetMaxOpenConns(1)
+
+	catalog := &Catalog{db: db}
+	if err := catalog.init(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+func (c *Catalog) init() error {
+	var version int
+	if err := c.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read catalog version: %w", err)
+	}
+
+	if version != 0 && version != CatalogVersion {
+		return fmt.Errorf("catalog version %v: %w", version, utils.ErrVersionDoesNotMatch)
+	}
+
+	if _, err := c.db.Exec("PRAGMA journal_mode = WAL; PRAGMA synchronous = NORMAL"); err != nil {
+		return fmt.Errorf("failed to configure catalog: %w", err)
+	}
+
+	if _, err := c.db.Exec(catalogSchema); err != nil {
+		return fmt.Errorf("failed to create catalog tables: %w", err)
+	}
+
+	if _, err := c.db.Exec(fmt.Sprintf("PRAGMA user_version = %v", CatalogVersion)); err != nil {
+		return fmt.Errorf("failed to write catalog version: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Catalog) Close() error {
+	return c.db.Close()
+}
+
+// SetLabels replaces the labels of the catalog.
+func (c *Catalog) SetLabels(labels []proton.Label) error {
+	return c.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM labels"); err != nil {
+			return err
+		}
+
+		return insertCatalogLabels(tx, labels)
+	})
+}
+
+// AddMessage adds the message described by metadata, saved at path relative to the folder of the catalog, or replaces
+// it if the catalog already has it.
+func (c *Catalog) AddMessage(metadata MessageMetadata, path string) error {
+	return c.withTx(func(tx *sql.Tx) error {
+		for _, table := range []string{"recipients", "message_labels", "attachments"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE message_id = ?", metadata.ID); err != nil {
+				return err
+			}
+		}
+
+		var senderName, senderAddress string
+		if metadata.Sender != nil {
+			senderName, senderAddress = metadata.Sender.Name, metadata.Sender.Address
+		}
+
+		format := catalogFormatParts
+		if strings.HasSuffix(path, emlExtension) {
+			format = catalogFormatEML
+		}
+
+		if _, err := tx.Exec(
+			"INSERT OR REPLACE INTO messages VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			metadata.ID,
+			getConversationID(metadata),
+			metadata.AddressID,
+			metadata.ExternalID,
+			metadata.Subject,
+			senderName,
+			senderAddress,
+			metadata.Time,
+			metadata.Size,
+			int64(metadata.Flags), //nolint:gosec // flags fit in an int64.
+			bool(metadata.Unread),
+			metadata.NumAttachments,
+			string(metadata.MIMEType),
+			format,
+			path,
+		); err != nil {
+			return err
+		}
+
+		recipients := []struct {
+			kind      string
+			addresses []*mail.Address
+		}{
+			{kind: "to", addresses: metadata.ToList},
+			{kind: "cc", addresses: metadata.CCList},
+			{kind: "bcc", addresses: metadata.BCCList},
+			{kind: "reply-to", addresses: metadata.ReplyTos},
+		}
+
+		for _, recipient := range recipients {
+			for _, address := range recipient.addresses {
+				if address == nil {
+					continue
+				}
+
+				if _, err := tx.Exec(
+					"INSERT INTO recipients VALUES (?, ?, ?, ?)",
+					metadata.ID, recipient.kind, address.Name, address.Address,
+				); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, labelID := range metadata.LabelIDs {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO message_labels VALUES (?, ?)", metadata.ID, labelID); err != nil {
+				return err
+			}
+		}
+
+		for _, attachment := range metadata.Attachments {
+			if _, err := tx.Exec(
+				"INSERT OR REPLACE INTO attachments VALUES (?, ?, ?, ?, ?, ?)",
+				attachment.ID,
+				metadata.ID,
+				attachment.Name,
+				attachment.Size,
+				string(attachment.MIMEType),
+				string(attachment.Disposition),
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (c *Catalog) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertCatalogLabels(tx *sql.Tx, labels []proton.Label) error {
+	for _, label := range labels {
+		if _, err := tx.Exec(
+			"INSERT OR REPLACE INTO labels VALUES (?, ?, ?, ?, ?, ?)",
+			label.ID,
+			label.ParentID,
+			label.Name,
+			strings.Join(label.Path, "/"),
+			label.Color,
+			int(label.Type),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RebuildCatalog replaces the catalog of the folder dir by a new one describing the messages found in the folder and
+// its sub-folders, and returns the number of messages it holds.
+func RebuildCatalog(ctx context.Context, dir string) (int, error) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Remove(filepath.Join(dir, getCatalogFileName()+suffix)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("failed to remove catalog: %w", err)
+		}
+	}
+
+	catalog, err := OpenCatalog(dir)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := catalog.Close(); err != nil {
+			logrus.WithError(err).Error("Failed to close catalog")
+		}
+	}()
+
+	count := 0
+
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Cannot inspect path. Skipping.")
+			return nil
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		if entry.Name() == getLabelFileName() {
+			labels, err := readBackupLabelFile(filepath.Dir(path))
+			if err != nil {
+				logrus.WithError(err).WithField("path", path).Warn("Failed to read labels, they are not cataloged")
+				return nil
+			}
+
+			return catalog.withTx(func(tx *sql.Tx) error { return insertCatalogLabels(tx, labels) })
+		}
+
+		if !strings.HasSuffix(entry.Name(), jsonMetadataExtension) {
+			return nil
+		}
+
+		metadata, err := loadMetadataFile(path)
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Failed to read message metadata, it is not cataloged")
+			return nil
+		}
+
+		messagePath, err := findCatalogMessagePath(dir, filepath.Dir(path), metadata.ID)
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Message not found, it is not cataloged")
+			return nil
+		}
+
+		if err := catalog.AddMessage(metadata, messagePath); err != nil {
+			return fmt.Errorf("failed to add message '%v' to catalog: %w", metadata.ID, err)
+		}
+
+		count++
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// findCatalogMessagePath returns the path, relative to root, of the EML file or of the folder of the message id saved
+// in dir.
+func findCatalogMessagePath(root, dir, id string) (string, error) {
+	for _, name := range []string{getEMLFileName(id), id} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return "", err
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.ToSlash(relPath), nil
+	}
+
+	return "", os.ErrNotExist
+}
+
+// getCatalogMessagePath returns the path, relative to the export folder, where msg is written.
+func getCatalogMessagePath(metadata MessageMetadata) string {
+	if metadata.WriterType == MessageWriterTypeDecryptedAndBuilt {
+		return getEMLFileName(metadata.ID)
+	}
+
+	return metadata.ID
+}
+
+// getConversationID returns the Message-ID of the first message of the thread of the message, from its References,
+// In-Reply-To and Message-ID headers, or the ID of the message if it has none of them.
+func getConversationID(metadata MessageMetadata) string {
+	message, err := mail.ReadMessage(strings.NewReader(strings.TrimRight(metadata.Headers, "\r\n") + "\r\n\r\n"))
+	if err != nil {
+		return metadata.ID
+	}
+
+	for _, key := range []string{"References", "In-Reply-To", "Message-Id"} {
+		if ids := strings.Fields(message.Header.Get(key)); len(ids) != 0 {
+			return strings.Trim(ids[0], "<>")
+		}
+	}
+
+	return metadata.ID
+}
+
+func getCatalogFileName() string {
+	return "catalog.sqlite"
+}
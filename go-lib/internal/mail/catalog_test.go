@@ -0,0 +1,155 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func newCatalogTestMetadata(id string, writerType MessageWriterType, headers string) MessageMetadata {
+	return MessageMetadata{
+		MessageMetadata: proton.MessageMetadata{
+			ID:       id,
+			LabelIDs: []string{proton.InboxLabel, "label-1"},
+			Subject:  "Subject " + id,
+			Sender:   &mail.Address{Name: "Alice", Address: "alice@proton.me"},
+			ToList:   []*mail.Address{{Name: "Bob", Address: "bob@example.com"}},
+			CCList:   []*mail.Address{{Address: "carol@example.com"}},
+			Time:     1705312800,
+			Size:     1024,
+		},
+		Attachments: []proton.Attachment{{ID: "att-" + id, Name: "report.pdf", Size: 512, MIMEType: "application/pdf"}},
+		Headers:     headers,
+		WriterType:  writerType,
+	}
+}
+
+func writeCatalogTestMessage(t *testing.T, dir string, metadata MessageMetadata) {
+	data, err := metadata.toBytes()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, getMetadataFileName(metadata.ID)), data, 0o600))
+
+	if metadata.WriterType == MessageWriterTypeDecryptedAndBuilt {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, getEMLFileName(metadata.ID)), []byte("Subject: test\r\n\r\n"), 0o600))
+	} else {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, metadata.ID), 0o700))
+	}
+}
+
+func catalogTestCount(t *testing.T, catalog *Catalog, query string, args ...any) int {
+	var count int
+	require.NoError(t, catalog.db.QueryRow(query, args...).Scan(&count))
+
+	return count
+}
+
+func TestCatalog_AddMessage(t *testing.T) {
+	catalog, err := OpenCatalog(t.TempDir())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, catalog.Close()) }()
+
+	require.NoError(t, catalog.SetLabels([]proton.Label{{ID: "label-1", Name: "Work", Path: []string{"Work"}, Type: proton.LabelTypeLabel}}))
+
+	metadata := newCatalogTestMetadata("msg-1", MessageWriterTypeDecryptedAndBuilt, "Message-Id: <first@proton.me>\r\n")
+	require.NoError(t, catalog.AddMessage(metadata, getCatalogMessagePath(metadata)))
+
+	// Adding a message again replaces it.
+	metadata.Subject = "Updated"
+	require.NoError(t, catalog.AddMessage(metadata, getCatalogMessagePath(metadata)))
+
+	var subject, conversationID, format, path string
+	require.NoError(t, catalog.db.QueryRow(
+		"SELECT subject, conversation_id, format, path FROM messages WHERE id = ?", "msg-1",
+	).Scan(&subject, &conversationID, &format, &path))
+	require.Equal(t, "Updated", subject)
+	require.Equal(t, "first@proton.me", conversationID)
+	require.Equal(t, catalogFormatEML, format)
+	require.Equal(t, "msg-1.eml", path)
+
+	require.Equal(t, 1, catalogTestCount(t, catalog, "SELECT COUNT(*) FROM messages"))
+	require.Equal(t, 2, catalogTestCount(t, catalog, "SELECT COUNT(*) FROM recipients"))
+	require.Equal(t, 1, catalogTestCount(t, catalog, "SELECT COUNT(*) FROM recipients WHERE type = 'cc'"))
+	require.Equal(t, 2, catalogTestCount(t, catalog, "SELECT COUNT(*) FROM message_labels"))
+	require.Equal(t, 1, catalogTestCount(t, catalog, "SELECT COUNT(*) FROM attachments"))
+	require.Equal(t, 1, catalogTestCount(t, catalog,
+		"SELECT COUNT(*) FROM message_labels JOIN labels ON labels.id = label_id WHERE labels.name = 'Work'"))
+}
+
+func TestCatalog_Version(t *testing.T) {
+	dir := t.TempDir()
+
+	catalog, err := OpenCatalog(dir)
+	require.NoError(t, err)
+	_, err = catalog.db.Exec("PRAGMA user_version = 99")
+	require.NoError(t, err)
+	require.NoError(t, catalog.Close())
+
+	_, err = OpenCatalog(dir)
+	require.ErrorIs(t, err, utils.ErrVersionDoesNotMatch)
+}
+
+func TestRebuildCatalog(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "mail_20240101_120000")
+	require.NoError(t, os.Mkdir(backupDir, 0o700))
+
+	labels, err := utils.GenerateVersionedJSON(LabelMetadataVersion, []proton.Label{{ID: "label-1", Name: "Work", Type: proton.LabelTypeLabel}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(backupDir, getLabelFileName()), labels, 0o600))
+
+	writeCatalogTestMessage(t, backupDir, newCatalogTestMetadata("msg-1", MessageWriterTypeDecryptedAndBuilt,
+		"Message-Id: <first@proton.me>\r\n"))
+	writeCatalogTestMessage(t, backupDir, newCatalogTestMetadata("msg-2", MessageWriterTypeFailedToAssemble,
+		"Message-Id: <second@proton.me>\r\nIn-Reply-To: <first@proton.me>\r\nReferences: <first@proton.me>\r\n"))
+
+	// Metadata without its message is left out.
+	missing := newCatalogTestMetadata("missing", MessageWriterTypeDecryptedAndBuilt, "")
+	data, err := missing.toBytes()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(backupDir, getMetadataFileName("missing")), data, 0o600))
+
+	count, err := RebuildCatalog(context.Background(), dir)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// Rebuilding replaces the previous catalog.
+	count, err = RebuildCatalog(context.Background(), dir)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	catalog, err := OpenCatalog(dir)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, catalog.Close()) }()
+
+	require.Equal(t, 2, catalogTestCount(t, catalog, "SELECT COUNT(*) FROM messages"))
+	require.Equal(t, 1, catalogTestCount(t, catalog, "SELECT COUNT(*) FROM labels"))
+	require.Equal(t, 1, catalogTestCount(t, catalog, "SELECT COUNT(*) FROM conversations"))
+	require.Equal(t, 2, catalogTestCount(t, catalog, "SELECT message_count FROM conversations WHERE id = 'first@proton.me'"))
+	require.Equal(t, 1, catalogTestCount(t, catalog,
+		"SELECT COUNT(*) FROM messages WHERE path = 'mail_20240101_120000/msg-2' AND format = ?", catalogFormatParts))
+	require.Equal(t, 2, catalogTestCount(t, catalog,
+		"SELECT COUNT(*) FROM messages WHERE strftime('%Y', time, 'unixepoch') = '2024'"))
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MinFreeDiskSpace is the amount of free space below which the write stage stops writing messages.
+const MinFreeDiskSpace = 256 * MB
+
+const diskSpacePollInterval = 5 * time.Second
+
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+var ErrLowDiskSpace = errors.New("export volume is running out of disk space")
+
+// LowDiskSpacePolicy determines how the write stage reacts when free space falls below MinFreeDiskSpace.
+type LowDiskSpacePolicy int
+
+const (
+	// LowDiskSpacePolicyAbort stops the export with ErrLowDiskSpace.
+	LowDiskSpacePolicyAbort LowDiskSpacePolicy = iota
+	// LowDiskSpacePolicyPause pauses the export until enough space has been freed.
+	LowDiskSpacePolicyPause
+)
+
+type FreeDiskSpaceFn func(path string) (uint64, error)
+
+// DiskSpaceWatchdog checks the free space of the export volume before the write stage writes a new batch.
+// A nil *DiskSpaceWatchdog is valid and never reports low disk space.
+type DiskSpaceWatchdog struct {
+	path         string
+	minFree      uint64
+	policy       LowDiskSpacePolicy
+	pause        *PauseController
+	log          *logrus.Entry
+	freeSpace    FreeDiskSpaceFn
+	pollInterval time.Duration
+}
+
+func NewDiskSpaceWatchdog(
+	path string,
+	minFree uint64,
+	policy LowDiskSpacePolicy,
+	pause *PauseController,
+	log *logrus.Entry,
+	freeSpace FreeDiskSpaceFn,
+) *DiskSpaceWatchdog {
+	return &DiskSpaceWatchdog{
+		path:         path,
+		minFree:      minFree,
+		policy:       policy,
+		pause:        pause,
+		log:          log.WithField("watchdog", "disk-space"),
+		freeSpace:    freeSpace,
+		pollInterval: diskSpacePollInterval,
+	}
+}
+
+// Check returns nil as long as enough free space is available. With LowDiskSpacePolicyPause, the export is paused
+// and Check blocks until the space is freed, after which the export is resumed. Otherwise ErrLowDiskSpace is returned.
+func (d *DiskSpaceWatchdog) Check(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+
+	pausedByWatchdog := false
+
+	for {
+		free, err := d.freeSpace(d.path)
+		if err != nil {
+			// Not being able to query the volume should not prevent the export from running.
+			d.log.WithError(err).Warn("Failed to query free disk space")
+			return nil
+		}
+
+		if free >= d.minFree {
+			if pausedByWatchdog && d.pause.Resume() {
+				d.log.Info("Enough disk space available again, resuming export")
+			}
+
+			return nil
+		}
+
+		if d.policy != LowDiskSpacePolicyPause || d.pause == nil {
+			d.log.Errorf("Free disk space (%v MB) fell below %v MB, aborting", toMB(free), toMB(d.minFree))
+			return fmt.Errorf("%w: %v MB available, at least %v MB required", ErrLowDiskSpace, toMB(free), toMB(d.minFree))
+		}
+
+		if d.pause.Pause() {
+			pausedByWatchdog = true
+			d.log.Warnf("Free disk space (%v MB) fell below %v MB, pausing export", toMB(free), toMB(d.minFree))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d.pollInterval):
+		}
+	}
+}
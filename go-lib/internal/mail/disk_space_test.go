@@ -0,0 +1,82 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func fixedFreeSpace(v *atomic.Uint64) FreeDiskSpaceFn {
+	return func(string) (uint64, error) {
+		return v.Load(), nil
+	}
+}
+
+func TestDiskSpaceWatchdog_EnoughSpace(t *testing.T) {
+	var free atomic.Uint64
+	free.Store(2 * MinFreeDiskSpace)
+
+	w := NewDiskSpaceWatchdog("", MinFreeDiskSpace, LowDiskSpacePolicyAbort, nil, logrus.WithField("test", "test"), fixedFreeSpace(&free))
+
+	require.NoError(t, w.Check(context.Background()))
+}
+
+func TestDiskSpaceWatchdog_Abort(t *testing.T) {
+	var free atomic.Uint64
+	free.Store(MinFreeDiskSpace - 1)
+
+	w := NewDiskSpaceWatchdog("", MinFreeDiskSpace, LowDiskSpacePolicyAbort, NewPauseController(), logrus.WithField("test", "test"), fixedFreeSpace(&free))
+
+	require.ErrorIs(t, w.Check(context.Background()), ErrLowDiskSpace)
+}
+
+func TestDiskSpaceWatchdog_PauseUntilSpaceFreed(t *testing.T) {
+	var free atomic.Uint64
+	free.Store(MinFreeDiskSpace - 1)
+
+	pause := NewPauseController()
+	w := NewDiskSpaceWatchdog("", MinFreeDiskSpace, LowDiskSpacePolicyPause, pause, logrus.WithField("test", "test"), fixedFreeSpace(&free))
+	w.pollInterval = 10 * time.Millisecond
+
+	checkDone := make(chan error)
+	go func() {
+		checkDone <- w.Check(context.Background())
+	}()
+
+	require.Eventually(t, pause.IsPaused, time.Second, 10*time.Millisecond)
+
+	free.Store(MinFreeDiskSpace)
+
+	require.NoError(t, <-checkDone)
+	require.False(t, pause.IsPaused())
+}
+
+func TestDiskSpaceWatchdog_QueryFailureIgnored(t *testing.T) {
+	w := NewDiskSpaceWatchdog("", MinFreeDiskSpace, LowDiskSpacePolicyAbort, nil, logrus.WithField("test", "test"), func(string) (uint64, error) {
+		return 0, errors.New("failed")
+	})
+
+	require.NoError(t, w.Check(context.Background()))
+}
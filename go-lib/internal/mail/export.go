@@ -28,13 +28,18 @@ import (
 	"time"
 
 	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/metrics"
 	"github.com/ProtonMail/export-tool/internal/session"
+	"github.com/ProtonMail/export-tool/internal/tracing"
 	"github.com/ProtonMail/export-tool/internal/utils"
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/pbnjay/memory"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slices"
 )
 
 const NumParallelDownloads = 10
@@ -51,6 +56,18 @@ const MaxBuildMemMB = 512 * MB
 // <email>
 //  |- mail_yyyy_mm_dd_hh:mm:ss
 //      |- labels.json
+//      |- keys (only present if the key export is enabled)
+//          |- keys.json
+//          |- <fingerprint>.private.asc
+//          |- <fingerprint>.public.asc
+//      |- settings.json (only present if the settings export is enabled)
+//      |- contacts
+//          |- <contact-id>.vcf
+//      |- search_index.json (only present if the search index is enabled)
+//      |- catalog.sqlite (only present if the catalog is enabled)
+//      |- failures.json (only present if messages failed to export)
+//      |- summary.json
+//      |- summary.txt
 //      |- msg-id.eml
 //      |- msg-id.meta.json
 
@@ -64,6 +81,19 @@ type ExportTask struct {
 	log             *logrus.Entry
 	cancelledByUser bool
 	filter          *Filter // Filter for export (nil = export all)
+	pause           *PauseController
+	failurePolicy   FailurePolicy
+	ledger          *FailureLedger
+	retryLedger     *FailureLedger // Failures of a previous run to retry (nil = regular export)
+	labels          []proton.Label
+	summary         *ExportSummary
+	skipDiskCheck   bool
+	lowDiskPolicy   LowDiskSpacePolicy
+	exportKeys      bool
+	exportSettings  bool
+	exportContacts  bool
+	searchIndex     bool
+	catalog         bool
 }
 
 func NewExportTask(
@@ -88,11 +118,61 @@ func NewExportTask(
 		session:   session,
 		log:       logrus.WithField("export", "mail").WithField("userID", session.GetUser().ID),
 		filter:    filter,
+		pause:     NewPauseController(),
+		ledger:    NewFailureLedger(),
 	}
 }
 
+var ErrNoFailedMessages = errors.New("backup has no failed messages to retry")
+var ErrNoExportSummary = errors.New("export summary is not available before the export has run")
+
+// NewRetryFailedExportTask creates a task which downloads again the messages recorded in the failure ledger of an
+// existing backup. backupPath can either be the mail_* folder itself, its parent or the folder passed to the original
+// export, provided it contains a single backup with failures.
+func NewRetryFailedExportTask(
+	ctx context.Context,
+	backupPath string,
+	session *session.Session,
+) (*ExportTask, error) {
+	exportPath, err := findFailedBackupDir(backupPath)
+	if errors.Is(err, ErrNoFailedMessages) {
+		exportPath, err = findFailedBackupDir(filepath.Join(backupPath, session.GetUser().Email))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	previousLedger, err := LoadFailureLedger(exportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The messages which no longer exist on the server are not retried.
+	retryLedger := previousLedger.retryable()
+	if retryLedger.Len() == 0 {
+		return nil, ErrNoFailedMessages
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &ExportTask{
+		ctx:         ctx,
+		ctxCancel:   cancel,
+		group:       async.NewGroup(ctx, session.GetPanicHandler()),
+		tmpDir:      filepath.Join(exportPath, "temp"),
+		exportDir:   exportPath,
+		session:     session,
+		log:         logrus.WithField("export", "mail").WithField("userID", session.GetUser().ID),
+		pause:       NewPauseController(),
+		ledger:      retryLedger.retryable(),
+		retryLedger: retryLedger,
+	}, nil
+}
+
 type Reporter interface {
 	StageProgressReporter
+	PauseStateReporter
 }
 
 func (e *ExportTask) Close() {
@@ -110,16 +190,160 @@ func (e *ExportTask) Cancel() {
 	e.ctxCancel()
 }
 
-func (e *ExportTask) GetRequiredDiskSpaceEstimate(_ context.Context) (uint64, error) {
-	return approximateDiskUsage(e.session.GetUser().ProductUsedSpace.Mail), nil
+// Pause suspends the export once every stage has completed its current chunk. Returns false if already paused.
+func (e *ExportTask) Pause() bool {
+	if !e.pause.Pause() {
+		return false
+	}
+
+	e.log.Info("Export paused")
+
+	return true
 }
 
-func (e *ExportTask) Run(ctx context.Context, reporter Reporter) error {
+// Resume continues a paused export. Returns false if the export was not paused.
+func (e *ExportTask) Resume() bool {
+	if !e.pause.Resume() {
+		return false
+	}
+
+	e.log.Info("Export resumed")
+
+	return true
+}
+
+func (e *ExportTask) IsPaused() bool {
+	return e.pause.IsPaused()
+}
+
+// SetFailurePolicy controls whether the export is aborted or carries on when a message fails to export.
+func (e *ExportTask) SetFailurePolicy(policy FailurePolicy) {
+	e.failurePolicy = policy
+}
+
+// GetFailedMessageCount returns the number of messages recorded in the failure ledger which can be retried.
+func (e *ExportTask) GetFailedMessageCount() int {
+	return e.ledger.retryable().Len()
+}
+
+// GetSummary returns the summary of the last run or nil if the export has not run yet.
+func (e *ExportTask) GetSummary() *ExportSummary {
+	return e.summary
+}
+
+// SetDiskSpaceCheck enables or disables the pre-flight free space check performed at the start of Run.
+func (e *ExportTask) SetDiskSpaceCheck(enabled bool) {
+	e.skipDiskCheck = !enabled
+}
+
+// SetLowDiskSpacePolicy controls what happens when the export volume runs out of space during the export.
+func (e *ExportTask) SetLowDiskSpacePolicy(policy LowDiskSpacePolicy) {
+	e.lowDiskPolicy = policy
+}
+
+// GetRequiredDiskSpaceEstimate returns the expected disk usage of the export. If the export is restricted to some
+// labels or to the failed messages of a previous run, the estimate is scaled down to the share of matching messages.
+func (e *ExportTask) GetRequiredDiskSpaceEstimate(ctx context.Context) (uint64, error) {
+	estimate := approximateDiskUsage(e.session.GetUser().ProductUsedSpace.Mail)
+
+	fraction, err := e.getExportedMessageFraction(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(math.Ceil(float64(estimate) * fraction)), nil
+}
+
+// GetAvailableDiskSpace returns the free space on the export volume.
+func (e *ExportTask) GetAvailableDiskSpace() (uint64, error) {
+	return utils.GetFreeDiskSpace(e.getExistingExportParent())
+}
+
+// CheckDiskSpace compares the required disk space estimate with the free space on the export volume.
+func (e *ExportTask) CheckDiskSpace(ctx context.Context) error {
+	required, err := e.GetRequiredDiskSpaceEstimate(ctx)
+	if err != nil {
+		return err
+	}
+
+	available, err := e.GetAvailableDiskSpace()
+	if err != nil {
+		return err
+	}
+
+	e.log.Infof("Estimated disk usage %v MB, available %v MB", toMB(required), toMB(available))
+
+	if required > available {
+		return fmt.Errorf("%w: %v MB required, %v MB available", ErrInsufficientDiskSpace, toMB(required), toMB(available))
+	}
+
+	return nil
+}
+
+func (e *ExportTask) getExportedMessageFraction(ctx context.Context) (float64, error) {
+	onlyLabels := e.filter != nil && len(e.filter.LabelIDs) != 0 && e.filter.withoutLabels().IsEmpty()
+	if e.retryLedger == nil && !onlyLabels {
+		return 1, nil
+	}
+
+	counts, err := e.session.GetClient().GetGroupedMessageCount(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get message count: %w", err)
+	}
+
+	var total, matching int
+
+	for _, c := range counts {
+		if c.LabelID == proton.AllMailLabel {
+			total = c.Total
+		} else if onlyLabels && slices.Contains(e.filter.LabelIDs, c.LabelID) {
+			matching += c.Total
+		}
+	}
+
+	if e.retryLedger != nil {
+		matching = e.retryLedger.Len()
+	}
+
+	if total == 0 || matching >= total {
+		return 1, nil
+	}
+
+	return float64(matching) / float64(total), nil
+}
+
+// getExistingExportParent returns the closest folder of the export path which already exists.
+func (e *ExportTask) getExistingExportParent() string {
+	path := e.exportDir
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+
+		path = parent
+	}
+}
+
+func (e *ExportTask) Run(ctx context.Context, reporter Reporter) (err error) {
+	ctx, span := tracing.Start(ctx, "export", attribute.Bool("retry-failed", e.retryLedger != nil))
+	defer func() { tracing.End(span, err) }()
+
 	defer e.log.Info("Finished")
 	e.log.WithFields(logrus.Fields{"tmp-dir": e.tmpDir, "export-dir": e.exportDir}).Info("Starting")
 
 	e.log.Debug("Preparing export dir")
 
+	if !e.skipDiskCheck {
+		if err := e.CheckDiskSpace(ctx); err != nil {
+			return err
+		}
+	}
+
 	if err := os.MkdirAll(e.exportDir, 0o700); err != nil {
 		return fmt.Errorf("failed to create export directory: %w", err)
 	}
@@ -130,6 +354,14 @@ func (e *ExportTask) Run(ctx context.Context, reporter Reporter) error {
 
 	reporter.OnProgress(0)
 
+	stats := newExportStats()
+	if e.retryLedger != nil {
+		stats.setAssembleFailedIDs(e.retryLedger.messageIDsForStage(FailureStageBuild))
+	}
+
+	e.pause.setObserver(reporter)
+	defer e.pause.setObserver(nil)
+
 	client := e.session.GetClient()
 
 	user := e.session.GetUser()
@@ -168,34 +400,66 @@ func (e *ExportTask) Run(ctx context.Context, reporter Reporter) error {
 	}
 	defer keyRing.Close()
 
-	// Create required folders
-	if err := e.WriteLabelMetadata(ctx, e.tmpDir, e.exportDir); err != nil {
-		return err
-	}
+	if e.retryLedger != nil {
+		// A retry only completes the messages of an existing backup, the account data is left as originally exported.
+		if err := e.loadLabels(ctx); err != nil {
+			return err
+		}
+	} else {
+		// Create required folders
+		if err := e.WriteLabelMetadata(ctx, e.tmpDir, e.exportDir); err != nil {
+			return err
+		}
 
-	msgCountPerLabel, err := client.GetGroupedMessageCount(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get message count: %w", err)
+		if e.exportSettings {
+			if err := e.WriteAccountSettings(ctx, client, e.tmpDir, e.exportDir, addresses); err != nil {
+				return err
+			}
+		}
+
+		if e.exportContacts {
+			// The contacts are not needed to restore the messages, a failure does not stop the export.
+			if err := e.WriteContacts(ctx, client, e.tmpDir, e.exportDir, keyRing.GetUserKeyRing()); err != nil {
+				e.log.WithError(err).Warn("Failed to write contacts")
+			}
+		}
+
+		if e.exportKeys {
+			if err := e.WriteKeys(e.tmpDir, e.exportDir, user, addresses, *salts); err != nil {
+				return err
+			}
+		}
 	}
 
 	var totalMessageCount uint64
-	var foundAllMailLabel bool
 
-	for _, c := range msgCountPerLabel {
-		if c.LabelID == proton.AllMailLabel {
-			totalMessageCount = uint64(c.Total) //nolint:gosec // we won't overflow.
-			foundAllMailLabel = true
-			break
+	if e.retryLedger != nil {
+		totalMessageCount = uint64(e.retryLedger.Len()) //nolint:gosec // we won't overflow.
+	} else {
+		msgCountPerLabel, err := client.GetGroupedMessageCount(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get message count: %w", err)
+		}
+
+		var foundAllMailLabel bool
+
+		for _, c := range msgCountPerLabel {
+			if c.LabelID == proton.AllMailLabel {
+				totalMessageCount = uint64(c.Total) //nolint:gosec // we won't overflow.
+				foundAllMailLabel = true
+				break
+			}
 		}
-	}
 
-	if !foundAllMailLabel {
-		return fmt.Errorf("failed to determine total message count")
+		if !foundAllMailLabel {
+			return fmt.Errorf("failed to determine total message count")
+		}
 	}
 
 	e.log.Infof("Found %v Messages for download", totalMessageCount)
 
 	reporter.SetMessageTotal(totalMessageCount)
+	stats.setTotalMessages(totalMessageCount)
 
 	totalMemory := memory.TotalMemory()
 
@@ -212,32 +476,83 @@ func (e *ExportTask) Run(ctx context.Context, reporter Reporter) error {
 		downloadMemMb = MinDownloadMemMB
 	}
 
+	stageMetrics := e.session.GetMetrics()
+
 	// Build stages
-	metaStage := NewMetadataStage(client, e.log, MetadataPageSize, NumParallelDownloads, e.filter)
-	downloadStage := NewDownloadStage(client, NumParallelDownloads, e.log, downloadMemMb, e.session.GetPanicHandler())
-	buildStage := NewBuildStage(NumParallelBuilders, e.log, buildMemMB, e.session.GetPanicHandler(), e.session.GetReporter(), user.ID)
-	writeStage := NewWriteStage(e.tmpDir, e.exportDir, NumParallelWriters, e.log, reporter, e.session.GetPanicHandler())
+	metaStage := NewMetadataStage(client, e.log, MetadataPageSize, NumParallelDownloads, e.filter, e.pause, stageMetrics)
+	downloadStage := NewDownloadStage(client, NumParallelDownloads, e.log, downloadMemMb, e.session.GetPanicHandler(), e.pause, stageMetrics)
+	buildStage := NewBuildStage(NumParallelBuilders, e.log, buildMemMB, e.session.GetPanicHandler(), e.session.GetReporter(), user.ID, e.pause, stageMetrics)
+	diskWatchdog := NewDiskSpaceWatchdog(e.exportDir, MinFreeDiskSpace, e.lowDiskPolicy, e.pause, e.log, utils.GetFreeDiskSpace)
+	writeStage := NewWriteStage(e.tmpDir, e.exportDir, NumParallelWriters, e.log, reporter, e.session.GetPanicHandler(), e.pause, stats, diskWatchdog, stageMetrics)
+
+	if e.retryLedger != nil {
+		metaStage.restrictToMessageIDs(e.retryLedger.MessageIDs())
+		// The ledger starts with every message of the retry, they are removed once written so that the messages which
+		// were not attempted stay in the ledger if the retry stops early.
+		writeStage.setFailureLedger(e.ledger)
+	}
+
+	var searchIndex *SearchIndex
+	if e.searchIndex {
+		// A retried export adds its messages to the index of the export it completes.
+		if searchIndex, err = OpenSearchIndex(ctx, e.exportDir, e.tmpDir, false); err != nil {
+			return fmt.Errorf("failed to open search index: %w", err)
+		}
+
+		writeStage.setSearchIndex(searchIndex)
+	}
+
+	if e.catalog {
+		catalog, err := OpenCatalog(e.exportDir)
+		if err != nil {
+			return fmt.Errorf("failed to open catalog: %w", err)
+		}
+		defer func() {
+			if err := catalog.Close(); err != nil {
+				e.log.WithError(err).Error("Failed to close catalog")
+			}
+		}()
+
+		if labels, err := readBackupLabelFile(e.exportDir); err != nil {
+			e.log.WithError(err).Warn("Failed to read labels, they are not cataloged")
+		} else if err := catalog.SetLabels(labels); err != nil {
+			e.log.WithError(err).Warn("Failed to add labels to catalog")
+		}
+
+		writeStage.setCatalog(catalog)
+	}
 
 	e.log.Debug("Starting message download")
 	errReporter := &exportErrReporter{
-		export: e,
-		lock:   sync.Mutex{},
-		errors: nil,
+		export:  e,
+		lock:    sync.Mutex{},
+		errors:  nil,
+		ledger:  e.ledger,
+		policy:  e.failurePolicy,
+		metrics: stageMetrics,
 	}
 
-	// start pipeline.
+	// start pipeline. The stages run in the context of the task group, attach their spans to the export span.
 	e.group.Once(func(ctx context.Context) {
+		ctx = trace.ContextWithSpan(ctx, span)
+		defer stats.timeStage(ExportStageMetadata)()
 		// To enable resume features use re-enable this line and delete the one below.
 		// metaStage.Run(ctx, errReporter, NewFileMetadataFileChecker(e.exportDir), reporter)
 		metaStage.Run(ctx, errReporter, &alwaysMissingMetadataFileChecker{}, reporter)
 	})
 	e.group.Once(func(ctx context.Context) {
+		ctx = trace.ContextWithSpan(ctx, span)
+		defer stats.timeStage(ExportStageDownload)()
 		downloadStage.Run(ctx, metaStage.outputCh, errReporter)
 	})
 	e.group.Once(func(ctx context.Context) {
+		ctx = trace.ContextWithSpan(ctx, span)
+		defer stats.timeStage(ExportStageBuild)()
 		buildStage.Run(ctx, downloadStage.outputCh, keyRing, errReporter)
 	})
 	e.group.Once(func(ctx context.Context) {
+		ctx = trace.ContextWithSpan(ctx, span)
+		defer stats.timeStage(ExportStageWrite)()
 		writeStage.Run(ctx, buildStage.outputCh, errReporter)
 	})
 
@@ -246,6 +561,21 @@ func (e *ExportTask) Run(ctx context.Context, reporter Reporter) error {
 
 	e.log.Debug("Message download finished")
 
+	if err := e.saveFailureLedger(); err != nil {
+		e.log.WithError(err).Error("Failed to save failure ledger")
+	}
+
+	if searchIndex != nil {
+		if err := searchIndex.Save(e.tmpDir, e.exportDir); err != nil {
+			e.log.WithError(err).Error("Failed to write search index")
+		}
+	}
+
+	e.summary = e.buildSummary(stats)
+	if err := e.summary.Write(e.tmpDir, e.exportDir); err != nil {
+		e.log.WithError(err).Error("Failed to write export summary")
+	}
+
 	// collect errors.
 	exportError := errReporter.getErrors()
 	if len(exportError) == 0 {
@@ -264,12 +594,11 @@ const LabelMetadataVersion = 1
 
 func (e *ExportTask) WriteLabelMetadata(ctx context.Context, tmpDir, exportPath string) error {
 	e.log.Debug("Writing root label metadata")
-	apiLabels, err := e.session.GetClient().GetLabels(ctx, proton.LabelTypeSystem, proton.LabelTypeFolder, proton.LabelTypeLabel)
-	if err != nil {
-		return fmt.Errorf("failed to retrieve labels: %w", err)
+	if err := e.loadLabels(ctx); err != nil {
+		return err
 	}
 
-	apiLabels = xslices.Filter(apiLabels, nonSystemLabel)
+	apiLabels := xslices.Filter(e.labels, nonSystemLabel)
 
 	labelData, err := utils.GenerateVersionedJSON(LabelMetadataVersion, apiLabels)
 	if err != nil {
@@ -281,6 +610,18 @@ func (e *ExportTask) WriteLabelMetadata(ctx context.Context, tmpDir, exportPath
 	return utils.WriteFileSafe(tmpDir, labelFile, labelData, &utils.Sha256IntegrityChecker{})
 }
 
+// loadLabels retrieves the labels of the account, they are used to name the labels of the export summary.
+func (e *ExportTask) loadLabels(ctx context.Context) error {
+	apiLabels, err := e.session.GetClient().GetLabels(ctx, proton.LabelTypeSystem, proton.LabelTypeFolder, proton.LabelTypeLabel)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve labels: %w", err)
+	}
+
+	e.labels = apiLabels
+
+	return nil
+}
+
 func (e *ExportTask) GetExportPath() string {
 	return e.exportDir
 }
@@ -293,10 +634,68 @@ func getLabelFileName() string {
 	return "labels.json"
 }
 
+// buildSummary returns the summary of the run. A retry completes the summary of the export it retries.
+func (e *ExportTask) buildSummary(stats *exportStats) *ExportSummary {
+	if e.retryLedger == nil {
+		return stats.summary(e.ledger, e.labels)
+	}
+
+	previous, err := loadExportSummary(e.exportDir)
+	if err != nil {
+		e.log.WithError(err).Warn("Failed to read the export summary, it only describes the retry")
+	}
+
+	if previous == nil {
+		return stats.summary(e.ledger, e.labels)
+	}
+
+	return stats.retrySummary(previous, e.ledger, e.labels)
+}
+
+func (e *ExportTask) saveFailureLedger() error {
+	if n := e.GetFailedMessageCount(); n != 0 {
+		e.log.Warnf("%v messages failed to export", n)
+	}
+
+	return e.ledger.Save(e.tmpDir, e.exportDir)
+}
+
+// findFailedBackupDir returns path if it contains a failure ledger, otherwise looks for a single mail_* sub folder
+// which does.
+func findFailedBackupDir(path string) (string, error) {
+	if _, err := os.Stat(filepath.Join(path, getFailureLedgerFileName())); err == nil {
+		return path, nil
+	}
+
+	candidates, err := filepath.Glob(filepath.Join(path, "mail_*", getFailureLedgerFileName()))
+	if err != nil {
+		return "", fmt.Errorf("failed to look for backups: %w", err)
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", ErrNoFailedMessages
+	case 1:
+		return filepath.Dir(candidates[0]), nil
+	default:
+		return "", fmt.Errorf("found %v backups with failed messages in '%v', please select one", len(candidates), path)
+	}
+}
+
 type exportErrReporter struct {
-	export *ExportTask
-	lock   sync.Mutex
-	errors []error
+	export  *ExportTask
+	lock    sync.Mutex
+	errors  []error
+	ledger  *FailureLedger
+	policy  FailurePolicy
+	metrics *metrics.Metrics
+}
+
+func (e *exportErrReporter) ReportMessageError(msgID string, stage FailureStage, err error) bool {
+	e.ledger.Record(msgID, stage, err)
+	e.metrics.MessageFailed(string(stage))
+
+	return e.policy == FailurePolicyContinue
 }
 
 func (e *exportErrReporter) ReportStageError(err error) {
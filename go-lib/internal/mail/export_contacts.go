@@ -0,0 +1,127 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/emersion/go-vcard"
+)
+
+const contactsPageSize = 100
+
+const vcfExtension = ".vcf"
+
+// SetContactsExport controls whether the contacts of the account are written to the backup.
+func (e *ExportTask) SetContactsExport(enabled bool) {
+	e.exportContacts = enabled
+}
+
+// WriteContacts writes every contact of the account as a vCard file in the contacts folder of the export. The cards
+// of a contact are decrypted and their signature verified with the user keyring, then merged into a single vCard.
+// A contact which cannot be retrieved, decrypted or verified is logged and skipped.
+func (e *ExportTask) WriteContacts(ctx context.Context, client apiclient.Client, tmpDir, exportPath string, userKR *crypto.KeyRing) error {
+	e.log.Debug("Writing contacts")
+
+	contactsDir := filepath.Join(exportPath, getContactsDirName())
+	if err := os.MkdirAll(contactsDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create contacts directory: %w", err)
+	}
+
+	var written, failed int
+
+	for page := 0; ; page++ {
+		contacts, err := client.GetContacts(ctx, page, contactsPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve contacts: %w", err)
+		}
+
+		for _, metadata := range contacts {
+			log := e.log.WithField("contact-id", metadata.ID)
+
+			// The contact list does not always carry the cards, they are fetched one contact at a time.
+			contact, err := client.GetContact(ctx, metadata.ID)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				log.WithError(err).Warn("Failed to retrieve contact, skipping")
+				failed++
+
+				continue
+			}
+
+			data, err := buildContactVCard(contact, userKR)
+			if err != nil {
+				log.WithError(err).Warn("Failed to decrypt or verify contact, skipping")
+				failed++
+
+				continue
+			}
+
+			if err := utils.WriteFileSafe(tmpDir, filepath.Join(contactsDir, getVCFFileName(contact.ID)), data, &utils.Sha256IntegrityChecker{}); err != nil {
+				return fmt.Errorf("failed to write contact %v: %w", contact.ID, err)
+			}
+
+			written++
+		}
+
+		if len(contacts) < contactsPageSize {
+			break
+		}
+	}
+
+	e.log.WithField("written", written).WithField("failed", failed).Info("Contacts written")
+
+	return nil
+}
+
+// buildContactVCard decrypts and verifies the cards of contact and encodes them as a single vCard.
+func buildContactVCard(contact proton.Contact, userKR *crypto.KeyRing) ([]byte, error) {
+	card, err := contact.Cards.Merge(userKR)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every card carries its own version, which the merge appends to its own.
+	card.SetValue(vcard.FieldVersion, "4.0")
+
+	buf := new(bytes.Buffer)
+	if err := vcard.NewEncoder(buf).Encode(card); err != nil {
+		return nil, fmt.Errorf("failed to encode vCard: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func getContactsDirName() string {
+	return "contacts"
+}
+
+func getVCFFileName(id string) string {
+	return id + vcfExtension
+}
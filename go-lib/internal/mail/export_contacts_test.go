@@ -0,0 +1,145 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/go-proton-api/server"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/emersion/go-vcard"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCard(t *testing.T, kr *crypto.KeyRing, cardType proton.CardType, fields map[string]string) *proton.Card {
+	card, err := proton.NewCard(kr, cardType)
+	require.NoError(t, err)
+
+	for key, value := range fields {
+		require.NoError(t, card.Set(kr, key, &vcard.Field{Value: value}))
+	}
+
+	return card
+}
+
+// createTestContact creates a contact on the server and replaces its cards with cards. The server only accepts clear
+// cards on creation.
+func createTestContact(ctx context.Context, t *testing.T, client *proton.Client, name string, cards ...*proton.Card) string {
+	res, err := client.CreateContacts(ctx, proton.CreateContactsReq{
+		Contacts: []proton.ContactCards{{Cards: proton.Cards{
+			newTestCard(t, nil, proton.CardTypeClear, map[string]string{vcard.FieldFormattedName: name}),
+		}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+
+	contactID := res[0].Response.Contact.ID
+
+	_, err = client.UpdateContact(ctx, contactID, proton.UpdateContactReq{Cards: cards})
+	require.NoError(t, err)
+
+	return contactID
+}
+
+// contactsTestClient gives WriteContacts the contacts of a client of the test server.
+type contactsTestClient struct {
+	apiclient.Client
+	client *proton.Client
+}
+
+func (c contactsTestClient) GetContacts(ctx context.Context, page, pageSize int) ([]proton.Contact, error) {
+	return c.client.GetContacts(ctx, page, pageSize)
+}
+
+func (c contactsTestClient) GetContact(ctx context.Context, contactID string) (proton.Contact, error) {
+	return c.client.GetContact(ctx, contactID)
+}
+
+func TestExportTask_WriteContacts(t *testing.T) {
+	ctx := context.Background()
+
+	s := server.New()
+	defer s.Close()
+
+	_, _, err := s.CreateUser("user", []byte("pass"))
+	require.NoError(t, err)
+
+	manager := proton.New(proton.WithHostURL(s.GetHostURL()), proton.WithTransport(proton.InsecureTransport()))
+	defer manager.Close()
+
+	client, _, err := manager.NewClientWithLogin(ctx, "user", []byte("pass"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	user, err := client.GetUser(ctx)
+	require.NoError(t, err)
+	salts, err := client.GetSalts(ctx)
+	require.NoError(t, err)
+	saltedKeyPass, err := salts.SaltForKey([]byte("pass"), user.Keys.Primary().ID)
+	require.NoError(t, err)
+	userKR, err := user.Keys.Unlock(saltedKeyPass, nil)
+	require.NoError(t, err)
+
+	otherKey, err := crypto.GenerateKey("other", "other@proton.me", "x25519", 0)
+	require.NoError(t, err)
+	otherKR, err := crypto.NewKeyRing(otherKey)
+	require.NoError(t, err)
+
+	validID := createTestContact(ctx, t, client, "Alice",
+		newTestCard(t, userKR, proton.CardTypeSigned, map[string]string{
+			vcard.FieldFormattedName: "Alice",
+			vcard.FieldEmail:         "alice@proton.me",
+		}),
+		newTestCard(t, userKR, proton.CardTypeEncrypted|proton.CardTypeSigned, map[string]string{
+			vcard.FieldTelephone: "+41 22 000 00 00",
+		}),
+	)
+
+	forgedID := createTestContact(ctx, t, client, "Mallory",
+		newTestCard(t, otherKR, proton.CardTypeSigned, map[string]string{
+			vcard.FieldFormattedName: "Mallory",
+		}),
+	)
+
+	dir := t.TempDir()
+	task := &ExportTask{log: logrus.WithField("test", "test")}
+	require.NoError(t, task.WriteContacts(ctx, contactsTestClient{client: client}, dir, dir, userKR))
+
+	contactsDir := filepath.Join(dir, getContactsDirName())
+
+	data, err := os.ReadFile(filepath.Join(contactsDir, getVCFFileName(validID)))
+	require.NoError(t, err)
+
+	card, err := vcard.NewDecoder(bytes.NewReader(data)).Decode()
+	require.NoError(t, err)
+	require.Len(t, card[vcard.FieldVersion], 1)
+	require.Equal(t, "4.0", card.Value(vcard.FieldVersion))
+	require.Equal(t, "Alice", card.Value(vcard.FieldFormattedName))
+	require.Equal(t, "alice@proton.me", card.Value(vcard.FieldEmail))
+	require.Equal(t, "+41 22 000 00 00", card.Value(vcard.FieldTelephone))
+
+	// The card signed with another key fails the verification and is not exported.
+	require.NoFileExists(t, filepath.Join(contactsDir, getVCFFileName(forgedID)))
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"golang.org/x/exp/slices"
+)
+
+const KeysMetadataVersion = 1
+
+const (
+	privateKeyExtension = ".private.asc"
+	publicKeyExtension  = ".public.asc"
+)
+
+// ExportedKey describes a key of the account written to the keys folder of a backup. The private key is written as
+// delivered by the API, still protected by its passphrase.
+type ExportedKey struct {
+	ID             string
+	Fingerprint    string
+	Primary        bool
+	Active         bool
+	PrivateKeyFile string
+	PublicKeyFile  string
+
+	// Token and Signature are set for the address keys which are unlocked with a token encrypted to the user key,
+	// rather than with the mailbox password.
+	Token     string `json:",omitempty"`
+	Signature string `json:",omitempty"`
+
+	// KeySalt is set for the user keys, it turns the mailbox password into the passphrase of the key.
+	KeySalt string `json:",omitempty"`
+}
+
+type ExportedAddressKeys struct {
+	AddressID string
+	Email     string
+	Keys      []ExportedKey
+}
+
+// ExportedKeys is the content of the keys.json file of a backup.
+type ExportedKeys struct {
+	UserID      string
+	UserKeys    []ExportedKey
+	AddressKeys []ExportedAddressKeys
+}
+
+// SetKeyExport controls whether the private and public keys of the user and of its addresses are written to the
+// backup, so that the messages which are still encrypted can be decrypted offline later on.
+func (e *ExportTask) SetKeyExport(enabled bool) {
+	e.exportKeys = enabled
+}
+
+// WriteKeys writes the keys of the user and of its addresses to the keys folder of the export.
+func (e *ExportTask) WriteKeys(tmpDir, exportPath string, user *proton.User, addresses []proton.Address, salts proton.Salts) error {
+	e.log.Debug("Writing keys")
+
+	keysDir := filepath.Join(exportPath, getKeysDirName())
+	if err := os.MkdirAll(keysDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create keys directory: %w", err)
+	}
+
+	exported := ExportedKeys{UserID: user.ID}
+
+	for _, key := range user.Keys {
+		exportedKey, err := writeKey(tmpDir, keysDir, key)
+		if err != nil {
+			return err
+		}
+
+		if index := slices.IndexFunc(salts, func(salt proton.Salt) bool { return salt.ID == key.ID }); index >= 0 {
+			exportedKey.KeySalt = salts[index].KeySalt
+		}
+
+		exported.UserKeys = append(exported.UserKeys, exportedKey)
+	}
+
+	for _, address := range addresses {
+		addressKeys := ExportedAddressKeys{AddressID: address.ID, Email: address.Email}
+
+		for _, key := range address.Keys {
+			exportedKey, err := writeKey(tmpDir, keysDir, key)
+			if err != nil {
+				return err
+			}
+
+			exportedKey.Token = key.Token
+			exportedKey.Signature = key.Signature
+			addressKeys.Keys = append(addressKeys.Keys, exportedKey)
+		}
+
+		exported.AddressKeys = append(exported.AddressKeys, addressKeys)
+	}
+
+	data, err := utils.GenerateVersionedJSON(KeysMetadataVersion, exported)
+	if err != nil {
+		return fmt.Errorf("failed to json encode keys: %w", err)
+	}
+
+	return utils.WriteFileSafe(tmpDir, filepath.Join(keysDir, getKeysFileName()), data, &utils.Sha256IntegrityChecker{})
+}
+
+// writeKey writes the armored private and public keys of key, named after its fingerprint.
+func writeKey(tmpDir, keysDir string, key proton.Key) (ExportedKey, error) {
+	privateKey, err := crypto.NewKey(key.PrivateKey)
+	if err != nil {
+		return ExportedKey{}, fmt.Errorf("failed to read key %v: %w", key.ID, err)
+	}
+
+	armoredPrivateKey, err := privateKey.Armor()
+	if err != nil {
+		return ExportedKey{}, fmt.Errorf("failed to armor key %v: %w", key.ID, err)
+	}
+
+	armoredPublicKey, err := privateKey.GetArmoredPublicKey()
+	if err != nil {
+		return ExportedKey{}, fmt.Errorf("failed to armor public key %v: %w", key.ID, err)
+	}
+
+	fingerprint := privateKey.GetFingerprint()
+	exportedKey := ExportedKey{
+		ID:             key.ID,
+		Fingerprint:    fingerprint,
+		Primary:        bool(key.Primary),
+		Active:         bool(key.Active),
+		PrivateKeyFile: fingerprint + privateKeyExtension,
+		PublicKeyFile:  fingerprint + publicKeyExtension,
+	}
+
+	for file, armored := range map[string]string{
+		exportedKey.PrivateKeyFile: armoredPrivateKey,
+		exportedKey.PublicKeyFile:  armoredPublicKey,
+	} {
+		if err := utils.WriteFileSafe(tmpDir, filepath.Join(keysDir, file), []byte(armored), &utils.Sha256IntegrityChecker{}); err != nil {
+			return ExportedKey{}, fmt.Errorf("failed to write key %v: %w", key.ID, err)
+		}
+	}
+
+	return exportedKey, nil
+}
+
+func getKeysDirName() string {
+	return "keys"
+}
+
+func getKeysFileName() string {
+	return "keys.json"
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func newLockedTestKey(t *testing.T, id string, passphrase []byte) (proton.Key, *crypto.Key) {
+	key, err := crypto.GenerateKey(id, id+"@proton.me", "x25519", 0)
+	require.NoError(t, err)
+
+	locked, err := key.Lock(passphrase)
+	require.NoError(t, err)
+
+	serialized, err := locked.Serialize()
+	require.NoError(t, err)
+
+	return proton.Key{ID: id, PrivateKey: serialized, Primary: true, Active: true}, key
+}
+
+func TestExportTask_WriteKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	userKey, userCryptoKey := newLockedTestKey(t, "user-key", []byte("mailbox"))
+	addressKey, addressCryptoKey := newLockedTestKey(t, "address-key", []byte("token"))
+	addressKey.Token = "encrypted token"
+	addressKey.Signature = "token signature"
+
+	user := &proton.User{ID: "user", Keys: proton.Keys{userKey}}
+	addresses := []proton.Address{{ID: "address", Email: "user@proton.me", Keys: proton.Keys{addressKey}}}
+	salts := proton.Salts{{ID: "user-key", KeySalt: "salt"}}
+
+	task := &ExportTask{log: logrus.WithField("test", "test")}
+	require.NoError(t, task.WriteKeys(dir, dir, user, addresses, salts))
+
+	keysDir := filepath.Join(dir, getKeysDirName())
+	data, err := os.ReadFile(filepath.Join(keysDir, getKeysFileName()))
+	require.NoError(t, err)
+
+	exported, err := utils.NewVersionedJSON[ExportedKeys](KeysMetadataVersion, data)
+	require.NoError(t, err)
+	require.Equal(t, "user", exported.Payload.UserID)
+	require.Len(t, exported.Payload.UserKeys, 1)
+	require.Len(t, exported.Payload.AddressKeys, 1)
+
+	exportedUserKey := exported.Payload.UserKeys[0]
+	require.Equal(t, userCryptoKey.GetFingerprint(), exportedUserKey.Fingerprint)
+	require.Equal(t, "salt", exportedUserKey.KeySalt)
+	require.True(t, exportedUserKey.Primary)
+
+	exportedAddressKeys := exported.Payload.AddressKeys[0]
+	require.Equal(t, "user@proton.me", exportedAddressKeys.Email)
+	require.Len(t, exportedAddressKeys.Keys, 1)
+	require.Equal(t, addressCryptoKey.GetFingerprint(), exportedAddressKeys.Keys[0].Fingerprint)
+	require.Equal(t, "encrypted token", exportedAddressKeys.Keys[0].Token)
+	require.Equal(t, "token signature", exportedAddressKeys.Keys[0].Signature)
+
+	// The private key is still locked and unlocks with its passphrase.
+	armored, err := os.ReadFile(filepath.Join(keysDir, exportedUserKey.PrivateKeyFile))
+	require.NoError(t, err)
+	privateKey, err := crypto.NewKeyFromArmored(string(armored))
+	require.NoError(t, err)
+	locked, err := privateKey.IsLocked()
+	require.NoError(t, err)
+	require.True(t, locked)
+	_, err = privateKey.Unlock([]byte("mailbox"))
+	require.NoError(t, err)
+
+	armored, err = os.ReadFile(filepath.Join(keysDir, exportedUserKey.PublicKeyFile))
+	require.NoError(t, err)
+	publicKey, err := crypto.NewKeyFromArmored(string(armored))
+	require.NoError(t, err)
+	require.False(t, publicKey.IsPrivate())
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+)
+
+const AccountSettingsVersion = 1
+
+type ExportedAddressSettings struct {
+	ID          string
+	Email       string
+	DisplayName string
+	Order       int
+	Send        bool
+	Receive     bool
+	Status      proton.AddressStatus
+	Type        proton.AddressType
+	Signature   string
+}
+
+// ExportedAccountSettings is the content of the settings.json file of a backup.
+type ExportedAccountSettings struct {
+	MailSettings  proton.MailSettings
+	Filters       []apiclient.MailFilter
+	AutoResponder apiclient.AutoResponder
+	Addresses     []ExportedAddressSettings
+}
+
+// SetSettingsExport controls whether the mail settings, Sieve filters and auto-responder of the account and the
+// settings of its addresses are written to the backup.
+func (e *ExportTask) SetSettingsExport(enabled bool) {
+	e.exportSettings = enabled
+}
+
+// WriteAccountSettings writes the mail settings, Sieve filters and auto-responder of the account and the settings of
+// its addresses to the settings file of the export.
+func (e *ExportTask) WriteAccountSettings(ctx context.Context, client apiclient.Client, tmpDir, exportPath string, addresses []proton.Address) error {
+	e.log.Debug("Writing account settings")
+
+	mailSettings, err := client.GetMailSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve mail settings: %w", err)
+	}
+
+	filters, err := client.GetMailFilters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve filters: %w", err)
+	}
+
+	autoResponder, err := client.GetAutoResponder(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve auto-responder: %w", err)
+	}
+
+	signatures, err := client.GetAddressSignatures(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve address signatures: %w", err)
+	}
+
+	settings := ExportedAccountSettings{
+		MailSettings:  mailSettings,
+		Filters:       filters,
+		AutoResponder: autoResponder,
+	}
+
+	for _, address := range addresses {
+		settings.Addresses = append(settings.Addresses, ExportedAddressSettings{
+			ID:          address.ID,
+			Email:       address.Email,
+			DisplayName: address.DisplayName,
+			Order:       address.Order,
+			Send:        bool(address.Send),
+			Receive:     bool(address.Receive),
+			Status:      address.Status,
+			Type:        address.Type,
+			Signature:   signatures[address.ID],
+		})
+	}
+
+	data, err := utils.GenerateVersionedJSON(AccountSettingsVersion, settings)
+	if err != nil {
+		return fmt.Errorf("failed to json encode account settings: %w", err)
+	}
+
+	return utils.WriteFileSafe(tmpDir, filepath.Join(exportPath, getAccountSettingsFileName()), data, &utils.Sha256IntegrityChecker{})
+}
+
+func getAccountSettingsFileName() string {
+	return "settings.json"
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAccountSettings_ExportAndRestore(t *testing.T) {
+	ctx := context.Background()
+	mockCtrl := gomock.NewController(t)
+	client := apiclient.NewMockClient(mockCtrl)
+	log := logrus.WithField("test", "test")
+
+	backup := proton.MailSettings{
+		DisplayName:     "Alice",
+		Signature:       "Regards, Alice",
+		DraftMIMEType:   rfc822.TextHTML,
+		AttachPublicKey: true,
+		Sign:            proton.SignExternalMessagesEnabled,
+		PGPScheme:       proton.PGPMIMEScheme,
+	}
+	addresses := []proton.Address{{ID: "address", Email: "alice@proton.me", DisplayName: "Alice Work", Send: true, Receive: true}}
+
+	filters := []apiclient.MailFilter{{ID: "filter", Name: "Newsletters", Status: 1, Version: 2, Sieve: `require "fileinto";`}}
+	autoResponder := apiclient.AutoResponder{IsEnabled: true, Repeat: 1, DaysSelected: []int{1, 2}, Subject: "Away", Message: "Back soon", Zone: "Europe/Zurich"}
+
+	dir := t.TempDir()
+	client.EXPECT().GetMailSettings(gomock.Any()).Return(backup, nil)
+	client.EXPECT().GetMailFilters(gomock.Any()).Return(filters, nil)
+	client.EXPECT().GetAutoResponder(gomock.Any()).Return(autoResponder, nil)
+	client.EXPECT().GetAddressSignatures(gomock.Any()).Return(map[string]string{"address": "Alice, at work"}, nil)
+	task := &ExportTask{log: log}
+	require.NoError(t, task.WriteAccountSettings(ctx, client, dir, dir, addresses))
+
+	settings, err := readBackupAccountSettings(filepath.Join(dir, getAccountSettingsFileName()))
+	require.NoError(t, err)
+	require.Equal(t, backup, settings.MailSettings)
+	require.Equal(t, filters, settings.Filters)
+	require.Equal(t, autoResponder, settings.AutoResponder)
+	require.Equal(t, []ExportedAddressSettings{{
+		ID:          "address",
+		Email:       "alice@proton.me",
+		DisplayName: "Alice Work",
+		Send:        true,
+		Receive:     true,
+		Signature:   "Alice, at work",
+	}}, settings.Addresses)
+
+	// Only the settings which differ are restored, a failing one does not stop the others.
+	current := backup
+	current.Signature = "Cheers"
+	current.PGPScheme = proton.PGPInlineScheme
+	client.EXPECT().GetMailSettings(gomock.Any()).Return(current, nil)
+	client.EXPECT().SetSignature(gomock.Any(), proton.SetSignatureReq{Signature: "Regards, Alice"}).Return(proton.MailSettings{}, errors.New("failed"))
+	client.EXPECT().SetDefaultPGPScheme(gomock.Any(), proton.SetDefaultPGPSchemeReq{PGPScheme: proton.PGPMIMEScheme}).Return(backup, nil)
+	require.NoError(t, restoreMailSettings(ctx, client, settings.MailSettings, log))
+}
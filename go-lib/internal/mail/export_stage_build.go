@@ -22,19 +22,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/metrics"
 	"github.com/ProtonMail/export-tool/internal/reporter"
+	"github.com/ProtonMail/export-tool/internal/tracing"
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/proton-bridge/v3/pkg/message"
 	"github.com/bradenaw/juniper/parallel"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type BuildStageOutput struct {
 	lastMessageID string
 	messages      []MessageWriter
+	span          trace.SpanContext
 }
 
 type BuildStage struct {
@@ -45,6 +52,8 @@ type BuildStage struct {
 	maxBuildMemMB    uint64
 	reporter         reporter.Reporter
 	userID           string
+	pause            *PauseController
+	metrics          *metrics.Metrics
 }
 
 var ErrBuildNoAddrKey = errors.New("no key found for address")
@@ -56,6 +65,8 @@ func NewBuildStage(
 	panicHandler async.PanicHandler,
 	reporter reporter.Reporter,
 	userID string,
+	pause *PauseController,
+	metrics *metrics.Metrics,
 ) *BuildStage {
 	return &BuildStage{
 		panicHandler:     panicHandler,
@@ -65,6 +76,8 @@ func NewBuildStage(
 		maxBuildMemMB:    maxBuildMemMB,
 		reporter:         reporter,
 		userID:           userID,
+		pause:            pause,
+		metrics:          metrics,
 	}
 }
 
@@ -80,44 +93,12 @@ func (b *BuildStage) Run(
 
 	for input := range inputs {
 		for _, chunk := range chunkMemLimitFullMessage(input.messages, b.maxBuildMemMB) {
-			if ctx.Err() != nil {
+			if err := b.pause.Wait(ctx); err != nil {
 				return
 			}
 
-			results := make([]MessageWriter, len(chunk))
-
-			if err := parallel.DoContext(ctx, b.parallelBuilders, len(results), func(_ context.Context, i int) error {
-				addrID := chunk[i].AddressID
-
-				kr, ok := keys.GetAddrKeyRing(addrID)
-				if !ok {
-					b.log.WithField("addrID", addrID).Warn("Address has no key ring")
-					results[i] = &AddrKeyRingMissingMessageWriter{msg: chunk[i]}
-					return nil
-				}
-
-				var buffer bytes.Buffer
-				buffer.Grow(chunk[i].Size)
-
-				decrypted := message.DecryptMessage(kr, chunk[i].Message, chunk[i].AttData)
-
-				if err := message.BuildRFC822Into(kr, &decrypted, defaultMessageJobOpts(), &buffer); err != nil {
-					b.log.WithError(err).WithField("addrID", addrID).Warn("Failed to build message")
-					b.reporter.ReportError(fmt.Errorf("failed to build message: %w", err), reporter.Context{
-						"msgID":  chunk[i].Message.ID,
-						"userID": b.userID,
-					})
-					results[i] = &AssembleFailedMessageWriter{decrypted: decrypted}
-					return nil
-				}
-
-				results[i] = &DecryptedAndBuiltMessageWriter{
-					msg: chunk[i],
-					eml: buffer,
-				}
-
-				return nil
-			}); err != nil {
+			output, err := b.buildChunk(ctx, chunk, input.span, keys, errReporter)
+			if err != nil {
 				errReporter.ReportStageError(err)
 				return
 			}
@@ -125,15 +106,79 @@ func (b *BuildStage) Run(
 			select {
 			case <-ctx.Done():
 				return
-			case b.outputCh <- BuildStageOutput{
-				lastMessageID: chunk[len(chunk)-1].ID,
-				messages:      results,
-			}:
+			case b.outputCh <- output:
 			}
 		}
 	}
 }
 
+// buildChunk builds the messages of chunk. The messages which cannot be built are passed on to be written in parts.
+func (b *BuildStage) buildChunk(
+	ctx context.Context,
+	chunk []proton.FullMessage,
+	link trace.SpanContext,
+	keys *apiclient.UnlockedKeyRing,
+	errReporter StageErrorReporter,
+) (BuildStageOutput, error) {
+	start := time.Now()
+	b.metrics.StageStarted(string(ExportStageBuild), len(chunk))
+	defer b.metrics.StageDone(string(ExportStageBuild), len(chunk))
+
+	_, span := tracing.StartLinked(ctx, "export.build.chunk", link, attribute.Int("messages", len(chunk)))
+
+	results := make([]MessageWriter, len(chunk))
+	var builtBytes atomic.Uint64
+
+	if err := parallel.DoContext(ctx, b.parallelBuilders, len(results), func(_ context.Context, i int) error {
+		addrID := chunk[i].AddressID
+
+		kr, ok := keys.GetAddrKeyRing(addrID)
+		if !ok {
+			b.log.WithField("addrID", addrID).Warn("Address has no key ring")
+			results[i] = &AddrKeyRingMissingMessageWriter{msg: chunk[i]}
+			return nil
+		}
+
+		var buffer bytes.Buffer
+		buffer.Grow(chunk[i].Size)
+
+		decrypted := message.DecryptMessage(kr, chunk[i].Message, chunk[i].AttData)
+
+		if err := message.BuildRFC822Into(kr, &decrypted, defaultMessageJobOpts(), &buffer); err != nil {
+			b.log.WithError(err).WithField("addrID", addrID).Warn("Failed to build message")
+			b.reporter.ReportError(fmt.Errorf("failed to build message: %w", err), reporter.Context{
+				"msgID":  chunk[i].Message.ID,
+				"userID": b.userID,
+			})
+			// The parts of the message are still written, the record only lets a later retry build it again.
+			errReporter.ReportMessageError(chunk[i].Message.ID, FailureStageBuild, err)
+			results[i] = &AssembleFailedMessageWriter{decrypted: decrypted}
+			return nil
+		}
+
+		builtBytes.Add(uint64(buffer.Len())) //nolint:gosec // length is never negative.
+		results[i] = &DecryptedAndBuiltMessageWriter{
+			msg: chunk[i],
+			eml: buffer,
+		}
+
+		return nil
+	}); err != nil {
+		tracing.End(span, err)
+		return BuildStageOutput{}, err
+	}
+
+	span.SetAttributes(attribute.Int64("bytes", int64(builtBytes.Load()))) //nolint:gosec // we won't overflow.
+	tracing.End(span, nil)
+	b.metrics.StageFinished(string(ExportStageBuild), len(chunk), builtBytes.Load(), start)
+
+	return BuildStageOutput{
+		lastMessageID: chunk[len(chunk)-1].ID,
+		messages:      results,
+		span:          span.SpanContext(),
+	}, nil
+}
+
 func defaultMessageJobOpts() message.JobOptions {
 	return message.JobOptions{
 		IgnoreDecryptionErrors: true, // Whether to ignore decryption errors and create a "custom message" instead.
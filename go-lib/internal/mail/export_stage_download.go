@@ -21,17 +21,23 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"time"
 
 	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/metrics"
+	"github.com/ProtonMail/export-tool/internal/tracing"
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/bradenaw/juniper/parallel"
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DownloadStageOutput struct {
 	messages []proton.FullMessage
+	span     trace.SpanContext
 }
 
 type DownloadStage struct {
@@ -41,6 +47,8 @@ type DownloadStage struct {
 	parallelWorkers  int
 	maxDownloadMemMB uint64
 	panicHandler     async.PanicHandler
+	pause            *PauseController
+	metrics          *metrics.Metrics
 }
 
 func NewDownloadStage(
@@ -49,6 +57,8 @@ func NewDownloadStage(
 	log *logrus.Entry,
 	maxDownloadMemMB uint64,
 	panicHandler async.PanicHandler,
+	pause *PauseController,
+	metrics *metrics.Metrics,
 ) *DownloadStage {
 	return &DownloadStage{
 		client:           client,
@@ -57,6 +67,8 @@ func NewDownloadStage(
 		parallelWorkers:  parallelWorkers,
 		panicHandler:     panicHandler,
 		maxDownloadMemMB: maxDownloadMemMB,
+		pause:            pause,
+		metrics:          metrics,
 	}
 }
 
@@ -64,56 +76,108 @@ func (d *DownloadStage) Run(ctx context.Context, input <-chan []proton.MessageMe
 	d.log.Debug("Starting")
 	defer d.log.Debug("Exiting")
 
-	const Failed422ID = "MsgFailed422"
-
 	defer close(d.outputCh)
 	for metadata := range input {
 		memChucked := chunkMemLimitMetadata(metadata, d.maxDownloadMemMB)
 		for _, chunk := range memChucked {
-			if ctx.Err() != nil {
+			if err := d.pause.Wait(ctx); err != nil {
 				return
 			}
 
-			result := DownloadStageOutput{
-				messages: make([]proton.FullMessage, len(chunk)),
+			result, err := d.downloadChunk(ctx, chunk, errReporter)
+			if err != nil {
+				errReporter.ReportStageError(err)
+				return
 			}
 
-			if err := parallel.DoContext(ctx, d.parallelWorkers, len(chunk), func(ctx context.Context, i int) error {
-				defer async.HandlePanic(d.panicHandler)
+			select {
+			case <-ctx.Done():
+				return
+			case d.outputCh <- result:
+			}
+		}
+	}
+}
 
-				msg, err := downloadMessageAndAttachments(ctx, d.client, chunk[i])
-				if err != nil {
-					var apiErr *proton.APIError
-					if errors.As(err, &apiErr) && apiErr.Status == 422 {
-						d.log.WithField("msgID", chunk[i].ID).Warn("Failed to download message due to 422")
-						result.messages[i].ID = Failed422ID
-						return nil
-					}
+// downloadChunk downloads the messages of chunk. The messages which could not be downloaded are left out.
+func (d *DownloadStage) downloadChunk(
+	ctx context.Context,
+	chunk []proton.MessageMetadata,
+	errReporter StageErrorReporter,
+) (DownloadStageOutput, error) {
+	start := time.Now()
+	d.metrics.StageStarted(string(ExportStageDownload), len(chunk))
+	defer d.metrics.StageDone(string(ExportStageDownload), len(chunk))
+
+	chunkCtx, span := tracing.Start(ctx, "export.download.chunk", attribute.Int("messages", len(chunk)))
+
+	result := DownloadStageOutput{
+		messages: make([]proton.FullMessage, len(chunk)),
+		span:     span.SpanContext(),
+	}
 
-					d.log.WithError(err).WithField("msgID", chunk[i].ID).Error("Failed to download message or attachment")
-					return err
-				}
+	if err := parallel.DoContext(chunkCtx, d.parallelWorkers, len(chunk), func(ctx context.Context, i int) error {
+		defer async.HandlePanic(d.panicHandler)
 
-				result.messages[i] = msg
+		msg, err := downloadMessageAndAttachments(ctx, d.client, chunk[i])
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
 
+			var apiErr *proton.APIError
+			if errors.As(err, &apiErr) && apiErr.Status == 422 {
+				d.log.WithField("msgID", chunk[i].ID).Warn("Failed to download message due to 422")
+				errReporter.ReportMessageError(chunk[i].ID, FailureStageDownload, err)
+				result.messages[i].ID = failedDownloadID
 				return nil
-			}); err != nil {
-				errReporter.ReportStageError(err)
-				return
 			}
 
-			// Remove any failed 422 downloads.
-			result.messages = xslices.Filter(result.messages, func(t proton.FullMessage) bool {
-				return t.ID != Failed422ID
-			})
-
-			select {
-			case <-ctx.Done():
-				return
-			case d.outputCh <- result:
+			d.log.WithError(err).WithField("msgID", chunk[i].ID).Error("Failed to download message or attachment")
+			if errReporter.ReportMessageError(chunk[i].ID, FailureStageDownload, err) {
+				result.messages[i].ID = failedDownloadID
+				return nil
 			}
+
+			return err
+		}
+
+		result.messages[i] = msg
+
+		return nil
+	}); err != nil {
+		tracing.End(span, err)
+		return DownloadStageOutput{}, err
+	}
+
+	// Remove any failed downloads.
+	result.messages = xslices.Filter(result.messages, func(t proton.FullMessage) bool {
+		return t.ID != failedDownloadID
+	})
+
+	size := downloadedBytes(result.messages)
+	span.SetAttributes(
+		attribute.Int("failed", len(chunk)-len(result.messages)),
+		attribute.Int64("bytes", int64(size)), //nolint:gosec // we won't overflow.
+	)
+	tracing.End(span, nil)
+	d.metrics.StageFinished(string(ExportStageDownload), len(chunk), size, start)
+
+	return result, nil
+}
+
+const failedDownloadID = "MsgFailedDownload"
+
+func downloadedBytes(messages []proton.FullMessage) uint64 {
+	var size uint64
+	for _, m := range messages {
+		size += uint64(len(m.Body))
+		for _, a := range m.AttData {
+			size += uint64(len(a))
 		}
 	}
+
+	return size
 }
 
 func downloadMessageAndAttachments(ctx context.Context, client apiclient.Client, metadata proton.MessageMetadata) (proton.FullMessage, error) {
@@ -117,7 +117,7 @@ func TestDownloadStage_Run(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	client := apiclient.NewMockClient(mockCtrl)
 	errReporter := NewMockStageErrorReporter(mockCtrl)
-	stage := NewDownloadStage(client, 2, logrus.WithField("test", "test"), MinDownloadMemMB, &async.NoopPanicHandler{})
+	stage := NewDownloadStage(client, 2, logrus.WithField("test", "test"), MinDownloadMemMB, &async.NoopPanicHandler{}, nil, nil)
 
 	input := make(chan []proton.MessageMetadata)
 
@@ -170,6 +170,7 @@ func TestDownloadStage_Run(t *testing.T) {
 	}
 
 	client.EXPECT().GetMessage(gomock.Any(), gomock.Eq(msgID1)).Return(proton.Message{}, msgError)
+	errReporter.EXPECT().ReportMessageError(gomock.Eq(msgID1), gomock.Eq(FailureStageDownload), gomock.Eq(msgError)).Return(false)
 	client.EXPECT().GetMessage(gomock.Any(), gomock.Eq(msgID2)).Return(msgData, nil)
 	client.EXPECT().GetAttachmentInto(gomock.Any(), gomock.Eq(attID1), gomock.Any()).DoAndReturn(func(_ context.Context, _ string, b *bytes.Buffer) error {
 		_, err := b.Write(attData1)
@@ -198,7 +199,7 @@ func TestDownloadStage_RunOtherErrorsReported(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	client := apiclient.NewMockClient(mockCtrl)
 	errReporter := NewMockStageErrorReporter(mockCtrl)
-	stage := NewDownloadStage(client, 2, logrus.WithField("test", "test"), MinDownloadMemMB, &async.NoopPanicHandler{})
+	stage := NewDownloadStage(client, 2, logrus.WithField("test", "test"), MinDownloadMemMB, &async.NoopPanicHandler{}, nil, nil)
 
 	input := make(chan []proton.MessageMetadata)
 
@@ -213,6 +214,7 @@ func TestDownloadStage_RunOtherErrorsReported(t *testing.T) {
 	}
 
 	client.EXPECT().GetMessage(gomock.Any(), gomock.Eq(msgID1)).Return(proton.Message{}, msgError)
+	errReporter.EXPECT().ReportMessageError(gomock.Eq(msgID1), gomock.Eq(FailureStageDownload), gomock.Eq(msgError)).Return(false)
 	errReporter.EXPECT().ReportStageError(gomock.Eq(msgError))
 
 	go func() {
@@ -224,3 +226,47 @@ func TestDownloadStage_RunOtherErrorsReported(t *testing.T) {
 
 	<-stage.outputCh
 }
+
+func TestDownloadStage_RunOtherErrorsSkippedWhenContinuing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	client := apiclient.NewMockClient(mockCtrl)
+	errReporter := NewMockStageErrorReporter(mockCtrl)
+	stage := NewDownloadStage(client, 2, logrus.WithField("test", "test"), MinDownloadMemMB, &async.NoopPanicHandler{}, nil, nil)
+
+	input := make(chan []proton.MessageMetadata)
+
+	const msgID1 = "msgID1"
+	const msgID2 = "msgID2"
+
+	msgError := errors.New("unexpected error")
+
+	msgData := proton.Message{
+		MessageMetadata: proton.MessageMetadata{ID: msgID2},
+		Body:            "MsgBody",
+	}
+
+	inputMetadata := []proton.MessageMetadata{
+		{
+			ID: msgID1,
+		},
+		{
+			ID: msgID2,
+		},
+	}
+
+	client.EXPECT().GetMessage(gomock.Any(), gomock.Eq(msgID1)).Return(proton.Message{}, msgError)
+	client.EXPECT().GetMessage(gomock.Any(), gomock.Eq(msgID2)).Return(msgData, nil)
+	errReporter.EXPECT().ReportMessageError(gomock.Eq(msgID1), gomock.Eq(FailureStageDownload), gomock.Eq(msgError)).Return(true)
+
+	go func() {
+		stage.Run(context.Background(), input, errReporter)
+	}()
+
+	input <- inputMetadata
+	close(input)
+
+	result := <-stage.outputCh
+
+	require.Len(t, result.messages, 1)
+	require.Equal(t, msgID2, result.messages[0].ID)
+}
@@ -19,11 +19,16 @@ package mail
 
 import (
 	"context"
+	"time"
 
 	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/metrics"
+	"github.com/ProtonMail/export-tool/internal/tracing"
 	"github.com/ProtonMail/go-proton-api"
+	"github.com/bradenaw/juniper/xmaps"
 	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type MetadataFileChecker interface {
@@ -37,6 +42,10 @@ type MetadataStage struct {
 	pageSize  int
 	splitSize int
 	filter    *Filter // Filter for messages (nil = no filtering)
+	pause     *PauseController
+	metrics   *metrics.Metrics
+
+	messageIDs []string // Explicit list of messages to fetch (nil = all messages)
 }
 
 func NewMetadataStage(
@@ -45,6 +54,8 @@ func NewMetadataStage(
 	pageSize int,
 	splitSize int,
 	filter *Filter,
+	pause *PauseController,
+	metrics *metrics.Metrics,
 ) *MetadataStage {
 	return &MetadataStage{
 		client:    client,
@@ -53,6 +64,8 @@ func NewMetadataStage(
 		pageSize:  pageSize,
 		splitSize: splitSize,
 		filter:    filter,
+		pause:     pause,
+		metrics:   metrics,
 	}
 }
 
@@ -66,6 +79,11 @@ func (m *MetadataStage) Run(
 	defer m.log.Debug("Exiting")
 	defer close(m.outputCh)
 
+	if m.messageIDs != nil {
+		m.runForMessageIDs(ctx, errReporter, reporter)
+		return
+	}
+
 	client := m.client
 
 	// Determine filter strategy
@@ -87,7 +105,7 @@ func (m *MetadataStage) Run(
 	var lastMessageID string
 
 	for {
-		if ctx.Err() != nil {
+		if err := m.pause.Wait(ctx); err != nil {
 			return
 		}
 
@@ -107,12 +125,20 @@ func (m *MetadataStage) Run(
 			pageFilter.EndID = lastMessageID
 		}
 
-		meta, err := client.GetMessageMetadataPage(ctx, 0, m.pageSize, pageFilter)
+		start := time.Now()
+		pageCtx, span := tracing.Start(ctx, "export.metadata.page")
+
+		meta, err := client.GetMessageMetadataPage(pageCtx, 0, m.pageSize, pageFilter)
 		if err != nil {
+			tracing.End(span, err)
 			errReporter.ReportStageError(err)
 			return
 		}
 
+		span.SetAttributes(attribute.Int("messages", len(meta)))
+		tracing.End(span, nil)
+		m.metrics.StageFinished(string(ExportStageMetadata), len(meta), 0, start)
+
 		// If there's only one message and it matches EndID, skip it (pagination overlap)
 		if lastMessageID != "" && len(meta) != 0 && meta[0].ID == lastMessageID {
 			meta = meta[1:]
@@ -166,6 +192,56 @@ func (m *MetadataStage) Run(
 	}
 }
 
+// restrictToMessageIDs makes the stage only retrieve the metadata of the given messages.
+func (m *MetadataStage) restrictToMessageIDs(ids []string) {
+	m.messageIDs = ids
+}
+
+func (m *MetadataStage) runForMessageIDs(ctx context.Context, errReporter StageErrorReporter, reporter Reporter) {
+	for _, ids := range xslices.Chunk(m.messageIDs, m.pageSize) {
+		if err := m.pause.Wait(ctx); err != nil {
+			return
+		}
+
+		start := time.Now()
+		pageCtx, span := tracing.Start(ctx, "export.metadata.page")
+
+		metadata, err := m.client.GetMessageMetadataPage(pageCtx, 0, len(ids), proton.MessageFilter{ID: ids})
+		if err != nil {
+			tracing.End(span, err)
+			errReporter.ReportStageError(err)
+			return
+		}
+
+		span.SetAttributes(attribute.Int("messages", len(metadata)))
+		tracing.End(span, nil)
+		m.metrics.StageFinished(string(ExportStageMetadata), len(metadata), 0, start)
+
+		if len(metadata) != len(ids) {
+			m.log.Warnf("%v of %v requested messages are no longer available", len(ids)-len(metadata), len(ids))
+
+			found := xmaps.SetFromSlice(xslices.Map(metadata, func(t proton.MessageMetadata) string { return t.ID }))
+
+			for _, id := range ids {
+				if !found.Contains(id) {
+					// The message can't be exported whatever the failure policy, keep it in the ledger for reference.
+					errReporter.ReportMessageError(id, FailureStageMetadata, ErrMessageGone)
+				}
+			}
+
+			reporter.OnProgress(len(ids) - len(metadata))
+		}
+
+		for _, chunk := range xslices.Chunk(metadata, m.splitSize) {
+			select {
+			case <-ctx.Done():
+				return
+			case m.outputCh <- chunk:
+			}
+		}
+	}
+}
+
 type alwaysMissingMetadataFileChecker struct{}
 
 func (a alwaysMissingMetadataFileChecker) HasMessage(string) (bool, error) {
@@ -27,7 +27,7 @@ func TestMetadataStage_Run(t *testing.T) {
 	encodeMetadataExpectations(client, expected, pageSize)
 	fileChecker.EXPECT().HasMessage(gomock.Any()).AnyTimes().Return(false, nil)
 
-	metadata := NewMetadataStage(client, logrus.WithField("test", "test"), pageSize, 1, nil)
+	metadata := NewMetadataStage(client, logrus.WithField("test", "test"), pageSize, 1, nil, nil, nil)
 
 	go func() {
 		metadata.Run(context.Background(), errReporter, fileChecker, reporter)
@@ -66,7 +66,7 @@ func TestMetadataStage_RunWithCached(t *testing.T) {
 		}
 	}
 
-	metadata := NewMetadataStage(client, logrus.WithField("test", "test"), pageSize, 1, nil)
+	metadata := NewMetadataStage(client, logrus.WithField("test", "test"), pageSize, 1, nil, nil, nil)
 
 	go func() {
 		metadata.Run(context.Background(), errReporter, fileChecker, reporter)
@@ -85,6 +85,34 @@ func TestMetadataStage_RunWithCached(t *testing.T) {
 	require.Equal(t, expectedFiltered, result)
 }
 
+func TestMetadataStage_RunForMessageIDsRecordsGoneMessages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	client := apiclient.NewMockClient(mockCtrl)
+	errReporter := NewMockStageErrorReporter(mockCtrl)
+	reporter := NewMockReporter(mockCtrl)
+
+	available := testMetadata(3)
+	ids := []string{available[0].ID, "gone", available[1].ID, available[2].ID}
+
+	client.EXPECT().GetMessageMetadataPage(gomock.Any(), gomock.Eq(0), gomock.Eq(len(ids)), gomock.Eq(proton.MessageFilter{ID: ids})).Return(available, nil)
+	errReporter.EXPECT().ReportMessageError("gone", FailureStageMetadata, ErrMessageGone).Return(false)
+	reporter.EXPECT().OnProgress(1)
+
+	metadata := NewMetadataStage(client, logrus.WithField("test", "test"), 10, 10, nil, nil, nil)
+	metadata.restrictToMessageIDs(ids)
+
+	go func() {
+		metadata.Run(context.Background(), errReporter, &alwaysMissingMetadataFileChecker{}, reporter)
+	}()
+
+	result := make([]proton.MessageMetadata, 0, len(available))
+	for out := range metadata.outputCh {
+		result = append(result, out...)
+	}
+
+	require.Equal(t, available, result)
+}
+
 func testMetadata(count int) []proton.MessageMetadata {
 	result := make([]proton.MessageMetadata, count)
 
@@ -19,12 +19,19 @@ package mail
 
 type StageErrorReporter interface {
 	ReportStageError(err error)
+	// ReportMessageError records an error affecting a single message. Returns true if the stage should skip the
+	// message and carry on, false if the error must be reported as a stage error.
+	ReportMessageError(msgID string, stage FailureStage, err error) bool
 }
 
 type NullErrorReporter struct{}
 
 func (n NullErrorReporter) ReportStageError(_ error) {}
 
+func (n NullErrorReporter) ReportMessageError(_ string, _ FailureStage, _ error) bool {
+	return false
+}
+
 type StageProgressReporter interface {
 	SetMessageProcessed(total uint64)
 	SetMessageTotal(total uint64)
@@ -38,3 +45,9 @@ func (n NullProgressReporter) SetMessageTotal(_ uint64) {}
 func (n NullProgressReporter) SetMessageProcessed(_ uint64) {}
 
 func (n NullProgressReporter) OnProgress(_ int) {}
+
+type PauseStateReporter interface {
+	OnPauseStateChanged(paused bool)
+}
+
+func (n NullProgressReporter) OnPauseStateChanged(_ bool) {}
@@ -24,7 +24,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync/atomic"
+	"time"
 
+	"github.com/ProtonMail/export-tool/internal/metrics"
+	"github.com/ProtonMail/export-tool/internal/tracing"
 	"github.com/ProtonMail/export-tool/internal/utils"
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/gluon/rfc822"
@@ -32,6 +36,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/v3/pkg/message"
 	"github.com/bradenaw/juniper/parallel"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type WriteStage struct {
@@ -41,6 +46,13 @@ type WriteStage struct {
 	log              *logrus.Entry
 	progressReporter StageProgressReporter
 	parallelWriters  int
+	pause            *PauseController
+	stats            *exportStats
+	watchdog         *DiskSpaceWatchdog
+	metrics          *metrics.Metrics
+	searchIndex      *SearchIndex   // Index of the written messages (nil = no index).
+	catalog          *Catalog       // Catalog of the written messages (nil = no catalog).
+	ledger           *FailureLedger // Ledger the written messages are removed from (nil = no ledger).
 }
 
 func NewWriteStage(
@@ -50,6 +62,10 @@ func NewWriteStage(
 	log *logrus.Entry,
 	progressReporter StageProgressReporter,
 	panicHandler async.PanicHandler,
+	pause *PauseController,
+	stats *exportStats,
+	watchdog *DiskSpaceWatchdog,
+	metrics *metrics.Metrics,
 ) *WriteStage {
 	return &WriteStage{
 		tempPath:         tempPath,
@@ -58,43 +74,136 @@ func NewWriteStage(
 		parallelWriters:  parallelWriters,
 		progressReporter: progressReporter,
 		log:              log.WithField("stage", "write"),
+		pause:            pause,
+		stats:            stats,
+		watchdog:         watchdog,
+		metrics:          metrics,
 	}
 }
 
+// setSearchIndex adds every message written as an EML file to index.
+func (w *WriteStage) setSearchIndex(index *SearchIndex) {
+	w.searchIndex = index
+}
+
+// setCatalog adds every written message to catalog.
+func (w *WriteStage) setCatalog(catalog *Catalog) {
+	w.catalog = catalog
+}
+
+// setFailureLedger removes every message written in full from ledger. The messages written in parts keep their record
+// so that they can be built again later.
+func (w *WriteStage) setFailureLedger(ledger *FailureLedger) {
+	w.ledger = ledger
+}
+
 func (w *WriteStage) Run(ctx context.Context, inputs <-chan BuildStageOutput, errReporter StageErrorReporter) {
 	w.log.Debug("Starting")
 	defer w.log.Debug("Exiting")
 
 	for input := range inputs {
-		if ctx.Err() != nil {
+		if err := w.watchdog.Check(ctx); err != nil {
+			if ctx.Err() == nil {
+				errReporter.ReportStageError(err)
+			}
+			return
+		}
+
+		if err := w.pause.Wait(ctx); err != nil {
+			return
+		}
+
+		skipped, err := w.writeChunk(ctx, input, errReporter)
+		if err != nil {
+			errReporter.ReportStageError(err)
 			return
 		}
 
-		if err := parallel.DoContext(ctx, w.parallelWriters, len(input.messages), func(_ context.Context, i int) error {
-			metadata := input.messages[i].GetMetadata()
-			metadataPath := filepath.Join(w.dirPath, getMetadataFileName(metadata.ID))
+		w.progressReporter.OnProgress(len(input.messages) - skipped)
+	}
+}
 
-			integrityChecker := &utils.Sha256IntegrityChecker{}
+// writeChunk writes the messages of input and returns the number of messages which were skipped.
+func (w *WriteStage) writeChunk(ctx context.Context, input BuildStageOutput, errReporter StageErrorReporter) (int, error) {
+	start := time.Now()
+	w.metrics.StageStarted(string(ExportStageWrite), len(input.messages))
+	defer w.metrics.StageDone(string(ExportStageWrite), len(input.messages))
 
-			metadataBytes, err := metadata.toBytes()
-			if err != nil {
-				w.log.WithField("msg-id", metadata.ID).WithError(err).Error("Failed to generate metadata")
-				return fmt.Errorf("failed to generate message metadata: %w", err)
-			}
+	_, span := tracing.StartLinked(ctx, "export.write.chunk", input.span, attribute.Int("messages", len(input.messages)))
 
-			if err := utils.WriteFileSafe(w.tempPath, metadataPath, metadataBytes, integrityChecker); err != nil {
-				w.log.WithField("msg-id", metadata.ID).WithError(err).Errorf("Failed to write %v", metadataPath)
-				return fmt.Errorf("failed to write '%v': %w", metadata, err)
+	var skipped atomic.Int64
+	var written atomic.Uint64
+
+	if err := parallel.DoContext(ctx, w.parallelWriters, len(input.messages), func(_ context.Context, i int) error {
+		n, err := w.writeMessage(input.messages[i])
+		written.Add(n)
+
+		if err != nil {
+			if errReporter.ReportMessageError(input.messages[i].GetMetadata().ID, FailureStageWrite, err) {
+				skipped.Add(1)
+				return nil
 			}
 
-			return input.messages[i].WriteMessage(w.dirPath, w.tempPath, w.log, integrityChecker)
-		}); err != nil {
-			errReporter.ReportStageError(err)
-			return
+			return err
 		}
 
-		w.progressReporter.OnProgress(len(input.messages))
+		return nil
+	}); err != nil {
+		tracing.End(span, err)
+		return 0, err
 	}
+
+	span.SetAttributes(
+		attribute.Int64("skipped", skipped.Load()),
+		attribute.Int64("bytes", int64(written.Load())), //nolint:gosec // we won't overflow.
+	)
+	tracing.End(span, nil)
+	w.metrics.StageFinished(string(ExportStageWrite), len(input.messages), written.Load(), start)
+
+	return int(skipped.Load()), nil
+}
+
+// writeMessage writes msg and its metadata and returns the number of bytes written.
+func (w *WriteStage) writeMessage(msg MessageWriter) (uint64, error) {
+	metadata := msg.GetMetadata()
+	metadataPath := filepath.Join(w.dirPath, getMetadataFileName(metadata.ID))
+
+	integrityChecker := &byteCountingChecker{IntegrityChecker: &utils.Sha256IntegrityChecker{}}
+
+	metadataBytes, err := metadata.toBytes()
+	if err != nil {
+		w.log.WithField("msg-id", metadata.ID).WithError(err).Error("Failed to generate metadata")
+		return 0, fmt.Errorf("failed to generate message metadata: %w", err)
+	}
+
+	if err := utils.WriteFileSafe(w.tempPath, metadataPath, metadataBytes, integrityChecker); err != nil {
+		w.log.WithField("msg-id", metadata.ID).WithError(err).Errorf("Failed to write %v", metadataPath)
+		return integrityChecker.bytes, fmt.Errorf("failed to write '%v': %w", metadata, err)
+	}
+
+	if err := msg.WriteMessage(w.dirPath, w.tempPath, w.log, integrityChecker); err != nil {
+		return integrityChecker.bytes, err
+	}
+
+	w.stats.messageWritten(metadata, integrityChecker.bytes)
+
+	if w.ledger != nil && metadata.WriterType != MessageWriterTypeFailedToAssemble {
+		w.ledger.Remove(metadata.ID)
+	}
+
+	if built, ok := msg.(*DecryptedAndBuiltMessageWriter); ok && w.searchIndex != nil {
+		if err := w.searchIndex.AddMessage(metadata.ID, getEMLFileName(metadata.ID), built.eml.Bytes()); err != nil {
+			w.log.WithField("msg-id", metadata.ID).WithError(err).Warn("Failed to index message")
+		}
+	}
+
+	if w.catalog != nil {
+		if err := w.catalog.AddMessage(metadata, getCatalogMessagePath(metadata)); err != nil {
+			w.log.WithField("msg-id", metadata.ID).WithError(err).Warn("Failed to add message to catalog")
+		}
+	}
+
+	return integrityChecker.bytes, nil
 }
 
 type MessageMetadata struct {
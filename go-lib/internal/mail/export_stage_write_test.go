@@ -19,16 +19,22 @@ package mail
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/proton-bridge/v3/pkg/message"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/exp/slices"
 )
 
 func TestAddrKeyRingMissingMessageWriter(t *testing.T) {
@@ -377,3 +383,59 @@ func getTestMessageMetadata() MessageMetadata {
 		WriterType: 0,
 	}
 }
+
+func TestWriteStage_CancelledRetryKeepsUnattemptedMessages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	errReporter := NewMockStageErrorReporter(mockCtrl)
+
+	exportDir := t.TempDir()
+	tmpDir := t.TempDir()
+
+	// The ledger of the retry starts with every message to retry.
+	ledger := NewFailureLedger()
+	ledger.Record("msg1", FailureStageDownload, errors.New("failed"))
+	ledger.Record("msg2", FailureStageDownload, errors.New("failed"))
+	ledger.Record("msg3", FailureStageWrite, errors.New("failed"))
+	ledger.Record("msg4", FailureStageBuild, errors.New("invalid mime"))
+
+	stage := NewWriteStage(tmpDir, exportDir, 2, logrus.WithField("test", "test"), NullProgressReporter{}, &async.NoopPanicHandler{}, nil, newExportStats(), nil, nil)
+	stage.setFailureLedger(ledger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	input := make(chan BuildStageOutput)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		stage.Run(ctx, input, errReporter)
+	}()
+
+	built := &DecryptedAndBuiltMessageWriter{msg: proton.FullMessage{Message: proton.Message{MessageMetadata: proton.MessageMetadata{ID: "msg1"}}}}
+	built.eml.WriteString("Subject: hello\r\n\r\nhello body")
+
+	assembleFailed := &AssembleFailedMessageWriter{
+		decrypted: message.DecryptedMessage{
+			Msg:     proton.Message{MessageMetadata: proton.MessageMetadata{ID: "msg4"}, Body: "hello body"},
+			BodyErr: fmt.Errorf("failed to decrypt body"),
+		},
+	}
+
+	// msg1 is written in full and msg4 in parts again, then the retry is cancelled before msg2 and msg3 are attempted.
+	input <- BuildStageOutput{messages: []MessageWriter{built, assembleFailed}}
+
+	require.Eventually(t, func() bool {
+		return !slices.Contains(ledger.MessageIDs(), "msg1")
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	close(input)
+	<-done
+
+	require.NoError(t, ledger.Save(tmpDir, exportDir))
+
+	loaded, err := LoadFailureLedger(exportDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"msg2", "msg3", "msg4"}, loaded.MessageIDs())
+}
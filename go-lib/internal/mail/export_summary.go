@@ -0,0 +1,387 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"golang.org/x/exp/slices"
+)
+
+const ExportSummaryVersion = 1
+
+type ExportStageName string
+
+const (
+	ExportStageMetadata ExportStageName = "metadata"
+	ExportStageDownload ExportStageName = "download"
+	ExportStageBuild    ExportStageName = "build"
+	ExportStageWrite    ExportStageName = "write"
+)
+
+type ExportStageSummary struct {
+	Name            ExportStageName
+	DurationSeconds float64
+}
+
+type ExportLabelSummary struct {
+	ID       string
+	Name     string
+	Messages uint64
+}
+
+// ExportSummary describes the outcome of an export. It is written into the export folder as summary.json and
+// summary.txt once the export finishes.
+type ExportSummary struct {
+	StartTime       int64
+	EndTime         int64
+	DurationSeconds float64
+
+	TotalMessages          uint64
+	ExportedMessages       uint64
+	BuiltMessages          uint64
+	AssembleFailedMessages uint64
+	NoAddressKeyMessages   uint64
+	Skipped422Messages     uint64
+	GoneMessages           uint64
+	FailedMessages         uint64
+
+	BytesWritten      uint64
+	MessagesPerSecond float64
+	BytesPerSecond    float64
+
+	Stages []ExportStageSummary
+	Labels []ExportLabelSummary
+}
+
+// exportStats collects the numbers of an ongoing export.
+type exportStats struct {
+	lock          sync.Mutex
+	startTime     time.Time
+	totalMessages uint64
+	byWriterType  map[MessageWriterType]uint64
+	byLabel       map[string]uint64
+	bytesWritten  uint64
+	stages        map[ExportStageName]time.Duration
+
+	// Messages of a retried export which were written in parts before and are already counted in its summary.
+	assembleFailedIDs map[string]struct{}
+	rewritten         uint64
+}
+
+func newExportStats() *exportStats {
+	return &exportStats{
+		startTime:    time.Now(),
+		byWriterType: make(map[MessageWriterType]uint64),
+		byLabel:      make(map[string]uint64),
+		stages:       make(map[ExportStageName]time.Duration),
+	}
+}
+
+func (s *exportStats) setTotalMessages(total uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.totalMessages = total
+}
+
+func (s *exportStats) messageWritten(metadata MessageMetadata, size uint64) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.byWriterType[metadata.WriterType]++
+	s.bytesWritten += size
+
+	if _, ok := s.assembleFailedIDs[metadata.ID]; ok {
+		s.rewritten++
+		return
+	}
+
+	for _, labelID := range metadata.LabelIDs {
+		s.byLabel[labelID]++
+	}
+}
+
+// setAssembleFailedIDs marks the messages of a retried export which were written in parts by the export it completes.
+func (s *exportStats) setAssembleFailedIDs(ids []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.assembleFailedIDs = make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		s.assembleFailedIDs[id] = struct{}{}
+	}
+}
+
+// timeStage returns a function which records the time elapsed since timeStage was called for the given stage.
+func (s *exportStats) timeStage(name ExportStageName) func() {
+	start := time.Now()
+
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		s.stages[name] = time.Since(start)
+	}
+}
+
+func (s *exportStats) summary(ledger *FailureLedger, labels []proton.Label) *ExportSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	endTime := time.Now()
+	duration := endTime.Sub(s.startTime)
+
+	summary := &ExportSummary{
+		StartTime:              s.startTime.Unix(),
+		EndTime:                endTime.Unix(),
+		DurationSeconds:        duration.Seconds(),
+		TotalMessages:          s.totalMessages,
+		BuiltMessages:          s.byWriterType[MessageWriterTypeDecryptedAndBuilt],
+		AssembleFailedMessages: s.byWriterType[MessageWriterTypeFailedToAssemble],
+		NoAddressKeyMessages:   s.byWriterType[MessageWriterTypeNoAddrKey],
+		BytesWritten:           s.bytesWritten,
+	}
+
+	for _, n := range s.byWriterType {
+		summary.ExportedMessages += n
+	}
+
+	for _, r := range ledger.Records() {
+		switch {
+		case r.Stage == FailureStageBuild:
+			// Already counted in AssembleFailedMessages.
+		case r.Stage == FailureStageDownload && r.HTTPStatus == 422:
+			summary.Skipped422Messages++
+		case r.ErrorClass == FailureErrorClassGone:
+			summary.GoneMessages++
+		default:
+			summary.FailedMessages++
+		}
+	}
+
+	if seconds := duration.Seconds(); seconds > 0 {
+		summary.MessagesPerSecond = float64(summary.ExportedMessages) / seconds
+		summary.BytesPerSecond = float64(summary.BytesWritten) / seconds
+	}
+
+	for _, name := range []ExportStageName{ExportStageMetadata, ExportStageDownload, ExportStageBuild, ExportStageWrite} {
+		if d, ok := s.stages[name]; ok {
+			summary.Stages = append(summary.Stages, ExportStageSummary{Name: name, DurationSeconds: d.Seconds()})
+		}
+	}
+
+	labelNames := make(map[string]string, len(labels))
+	for _, l := range labels {
+		labelNames[l.ID] = l.Name
+	}
+
+	for id, n := range s.byLabel {
+		summary.Labels = append(summary.Labels, ExportLabelSummary{ID: id, Name: labelNames[id], Messages: n})
+	}
+
+	slices.SortFunc(summary.Labels, func(lhs, rhs ExportLabelSummary) bool {
+		if lhs.Messages != rhs.Messages {
+			return lhs.Messages > rhs.Messages
+		}
+
+		return lhs.ID < rhs.ID
+	})
+
+	return summary
+}
+
+// retrySummary merges the numbers of a retried export into the summary of the export it completes. The failures are
+// taken from the retry only, as its ledger holds every failure left in the backup. The messages which no longer exist
+// on the server are not kept in the ledger and add up instead.
+func (s *exportStats) retrySummary(previous *ExportSummary, ledger *FailureLedger, labels []proton.Label) *ExportSummary {
+	retry := s.summary(ledger, labels)
+
+	s.lock.Lock()
+	rewritten := s.rewritten
+	s.lock.Unlock()
+
+	merged := &ExportSummary{
+		StartTime:              previous.StartTime,
+		EndTime:                retry.EndTime,
+		DurationSeconds:        previous.DurationSeconds + retry.DurationSeconds,
+		TotalMessages:          previous.TotalMessages,
+		ExportedMessages:       previous.ExportedMessages + retry.ExportedMessages - rewritten,
+		BuiltMessages:          previous.BuiltMessages + retry.BuiltMessages,
+		AssembleFailedMessages: previous.AssembleFailedMessages + retry.AssembleFailedMessages - rewritten,
+		NoAddressKeyMessages:   previous.NoAddressKeyMessages + retry.NoAddressKeyMessages,
+		Skipped422Messages:     retry.Skipped422Messages,
+		GoneMessages:           previous.GoneMessages + retry.GoneMessages,
+		FailedMessages:         retry.FailedMessages,
+		BytesWritten:           previous.BytesWritten + retry.BytesWritten,
+	}
+
+	if merged.DurationSeconds > 0 {
+		merged.MessagesPerSecond = float64(merged.ExportedMessages) / merged.DurationSeconds
+		merged.BytesPerSecond = float64(merged.BytesWritten) / merged.DurationSeconds
+	}
+
+	stages := make(map[ExportStageName]float64)
+	for _, stage := range append(previous.Stages, retry.Stages...) {
+		stages[stage.Name] += stage.DurationSeconds
+	}
+
+	for _, name := range []ExportStageName{ExportStageMetadata, ExportStageDownload, ExportStageBuild, ExportStageWrite} {
+		if d, ok := stages[name]; ok {
+			merged.Stages = append(merged.Stages, ExportStageSummary{Name: name, DurationSeconds: d})
+		}
+	}
+
+	labelIndex := make(map[string]int)
+	for _, label := range append(previous.Labels, retry.Labels...) {
+		if idx, ok := labelIndex[label.ID]; ok {
+			merged.Labels[idx].Messages += label.Messages
+			if merged.Labels[idx].Name == "" {
+				merged.Labels[idx].Name = label.Name
+			}
+
+			continue
+		}
+
+		labelIndex[label.ID] = len(merged.Labels)
+		merged.Labels = append(merged.Labels, label)
+	}
+
+	slices.SortFunc(merged.Labels, func(lhs, rhs ExportLabelSummary) bool {
+		if lhs.Messages != rhs.Messages {
+			return lhs.Messages > rhs.Messages
+		}
+
+		return lhs.ID < rhs.ID
+	})
+
+	return merged
+}
+
+// loadExportSummary reads the summary stored in exportDir. Returns nil if the file does not exist.
+func loadExportSummary(exportDir string) (*ExportSummary, error) {
+	b, err := os.ReadFile(filepath.Join(exportDir, getSummaryFileName())) //nolint:gosec
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to read export summary: %w", err)
+	}
+
+	v, err := utils.NewVersionedJSON[ExportSummary](ExportSummaryVersion, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse export summary: %w", err)
+	}
+
+	return &v.Payload, nil
+}
+
+func (s *ExportSummary) ToJSON() ([]byte, error) {
+	return utils.GenerateVersionedJSON(ExportSummaryVersion, s)
+}
+
+func (s *ExportSummary) ToText() string {
+	var buffer bytes.Buffer
+
+	w := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Export Summary\n")
+	fmt.Fprintf(w, "  Started:\t%v\n", time.Unix(s.StartTime, 0).Format(time.RFC3339))
+	fmt.Fprintf(w, "  Duration:\t%v\n", time.Duration(s.DurationSeconds*float64(time.Second)).Round(time.Second))
+	fmt.Fprintf(w, "  Total messages:\t%v\n", s.TotalMessages)
+	fmt.Fprintf(w, "  Exported messages:\t%v\n", s.ExportedMessages)
+	fmt.Fprintf(w, "    Built:\t%v\n", s.BuiltMessages)
+	fmt.Fprintf(w, "    Assemble failed:\t%v\n", s.AssembleFailedMessages)
+	fmt.Fprintf(w, "    No address key:\t%v\n", s.NoAddressKeyMessages)
+	fmt.Fprintf(w, "  Skipped (422):\t%v\n", s.Skipped422Messages)
+	fmt.Fprintf(w, "  Gone from server:\t%v\n", s.GoneMessages)
+	fmt.Fprintf(w, "  Failed messages:\t%v\n", s.FailedMessages)
+	fmt.Fprintf(w, "  Bytes written:\t%v MB\n", toMB(s.BytesWritten))
+	fmt.Fprintf(w, "  Throughput:\t%.1f msg/s, %.1f MB/s\n", s.MessagesPerSecond, s.BytesPerSecond/MB)
+
+	if len(s.Stages) != 0 {
+		fmt.Fprintf(w, "Stages\n")
+		for _, stage := range s.Stages {
+			fmt.Fprintf(w, "  %v:\t%v\n", stage.Name, time.Duration(stage.DurationSeconds*float64(time.Second)).Round(time.Millisecond))
+		}
+	}
+
+	if len(s.Labels) != 0 {
+		fmt.Fprintf(w, "Labels\n")
+		for _, label := range s.Labels {
+			name := label.Name
+			if name == "" {
+				name = label.ID
+			}
+
+			fmt.Fprintf(w, "  %v:\t%v\n", name, label.Messages)
+		}
+	}
+
+	_ = w.Flush()
+
+	return buffer.String()
+}
+
+// Write stores the summary in exportDir as both json and text.
+func (s *ExportSummary) Write(tmpDir, exportDir string) error {
+	data, err := s.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to json encode summary: %w", err)
+	}
+
+	if err := utils.WriteFileSafe(tmpDir, filepath.Join(exportDir, getSummaryFileName()), data, &utils.Sha256IntegrityChecker{}); err != nil {
+		return err
+	}
+
+	return utils.WriteFileSafe(tmpDir, filepath.Join(exportDir, getSummaryTextFileName()), []byte(s.ToText()), &utils.Sha256IntegrityChecker{})
+}
+
+// byteCountingChecker wraps an IntegrityChecker and keeps track of the number of bytes it has been initialized with.
+type byteCountingChecker struct {
+	utils.IntegrityChecker
+	bytes uint64
+}
+
+func (b *byteCountingChecker) Initialize(data []byte) {
+	b.bytes += uint64(len(data))
+	b.IntegrityChecker.Initialize(data)
+}
+
+func getSummaryFileName() string {
+	return "summary.json"
+}
+
+func getSummaryTextFileName() string {
+	return "summary.txt"
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMetadata(writerType MessageWriterType, labelIDs ...string) MessageMetadata {
+	return MessageMetadata{
+		MessageMetadata: proton.MessageMetadata{LabelIDs: labelIDs},
+		WriterType:      writerType,
+	}
+}
+
+func TestExportStats_Summary(t *testing.T) {
+	stats := newExportStats()
+	stats.setTotalMessages(6)
+
+	stats.messageWritten(newTestMetadata(MessageWriterTypeDecryptedAndBuilt, proton.InboxLabel, proton.AllMailLabel), 100)
+	stats.messageWritten(newTestMetadata(MessageWriterTypeDecryptedAndBuilt, proton.InboxLabel, proton.AllMailLabel), 200)
+	stats.messageWritten(newTestMetadata(MessageWriterTypeFailedToAssemble, "custom", proton.AllMailLabel), 50)
+	stats.messageWritten(newTestMetadata(MessageWriterTypeNoAddrKey, proton.AllMailLabel), 25)
+	stats.timeStage(ExportStageDownload)()
+
+	ledger := NewFailureLedger()
+	ledger.Record("msg5", FailureStageDownload, &proton.APIError{Status: 422})
+	ledger.Record("msg6", FailureStageWrite, errors.New("disk full"))
+	ledger.Record("msg3", FailureStageBuild, errors.New("invalid mime"))
+	ledger.Record("msg7", FailureStageMetadata, ErrMessageGone)
+
+	summary := stats.summary(ledger, []proton.Label{{ID: "custom", Name: "Custom"}})
+
+	require.Equal(t, uint64(6), summary.TotalMessages)
+	require.Equal(t, uint64(4), summary.ExportedMessages)
+	require.Equal(t, uint64(2), summary.BuiltMessages)
+	require.Equal(t, uint64(1), summary.AssembleFailedMessages)
+	require.Equal(t, uint64(1), summary.NoAddressKeyMessages)
+	require.Equal(t, uint64(1), summary.Skipped422Messages)
+	require.Equal(t, uint64(1), summary.GoneMessages)
+	require.Equal(t, uint64(1), summary.FailedMessages)
+	require.Equal(t, uint64(375), summary.BytesWritten)
+
+	require.Len(t, summary.Stages, 1)
+	require.Equal(t, ExportStageDownload, summary.Stages[0].Name)
+
+	require.Equal(t, []ExportLabelSummary{
+		{ID: proton.AllMailLabel, Messages: 4},
+		{ID: proton.InboxLabel, Messages: 2},
+		{ID: "custom", Name: "Custom", Messages: 1},
+	}, summary.Labels)
+
+	text := summary.ToText()
+	require.Contains(t, text, "Skipped (422):")
+	require.Contains(t, text, "Custom:")
+}
+
+func TestExportSummary_Write(t *testing.T) {
+	exportDir := t.TempDir()
+	tmpDir := t.TempDir()
+
+	summary := newExportStats().summary(NewFailureLedger(), nil)
+	require.NoError(t, summary.Write(tmpDir, exportDir))
+
+	data, err := os.ReadFile(filepath.Join(exportDir, getSummaryFileName()))
+	require.NoError(t, err)
+
+	loaded, err := utils.NewVersionedJSON[ExportSummary](ExportSummaryVersion, data)
+	require.NoError(t, err)
+	require.Equal(t, *summary, loaded.Payload)
+
+	require.FileExists(t, filepath.Join(exportDir, getSummaryTextFileName()))
+}
+
+func TestExportStats_RetrySummary(t *testing.T) {
+	exportDir := t.TempDir()
+
+	previous := &ExportSummary{
+		StartTime:              100,
+		DurationSeconds:        10,
+		TotalMessages:          5,
+		ExportedMessages:       3,
+		BuiltMessages:          2,
+		AssembleFailedMessages: 1,
+		GoneMessages:           1,
+		FailedMessages:         2,
+		BytesWritten:           300,
+		Stages:                 []ExportStageSummary{{Name: ExportStageDownload, DurationSeconds: 4}},
+		Labels:                 []ExportLabelSummary{{ID: proton.InboxLabel, Messages: 3}},
+	}
+	require.NoError(t, previous.Write(t.TempDir(), exportDir))
+
+	loaded, err := loadExportSummary(exportDir)
+	require.NoError(t, err)
+
+	// msg3 was written in parts by the previous export, msg4 failed to download and msg5 fails again.
+	stats := newExportStats()
+	stats.setTotalMessages(3)
+	stats.setAssembleFailedIDs([]string{"msg3"})
+
+	rebuilt := newTestMetadata(MessageWriterTypeDecryptedAndBuilt, proton.InboxLabel)
+	rebuilt.ID = "msg3"
+	stats.messageWritten(rebuilt, 50)
+
+	retried := newTestMetadata(MessageWriterTypeDecryptedAndBuilt, proton.InboxLabel, "custom")
+	retried.ID = "msg4"
+	stats.messageWritten(retried, 100)
+	stats.timeStage(ExportStageDownload)()
+
+	ledger := NewFailureLedger()
+	ledger.Record("msg5", FailureStageWrite, errors.New("disk full"))
+	ledger.Record("msg6", FailureStageMetadata, ErrMessageGone)
+
+	summary := stats.retrySummary(loaded, ledger, []proton.Label{{ID: "custom", Name: "Custom"}})
+
+	require.Equal(t, int64(100), summary.StartTime)
+	require.Equal(t, uint64(5), summary.TotalMessages)
+	require.Equal(t, uint64(4), summary.ExportedMessages)
+	require.Equal(t, uint64(4), summary.BuiltMessages)
+	require.Equal(t, uint64(0), summary.AssembleFailedMessages)
+	require.Equal(t, uint64(2), summary.GoneMessages)
+	require.Equal(t, uint64(1), summary.FailedMessages)
+	require.Equal(t, uint64(450), summary.BytesWritten)
+
+	require.Len(t, summary.Stages, 1)
+	require.GreaterOrEqual(t, summary.Stages[0].DurationSeconds, 4.0)
+
+	require.Equal(t, []ExportLabelSummary{
+		{ID: proton.InboxLabel, Messages: 4},
+		{ID: "custom", Name: "Custom", Messages: 1},
+	}, summary.Labels)
+}
+
+func TestLoadExportSummary_Missing(t *testing.T) {
+	summary, err := loadExportSummary(t.TempDir())
+	require.NoError(t, err)
+	require.Nil(t, summary)
+}
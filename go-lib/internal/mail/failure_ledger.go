@@ -0,0 +1,275 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+const FailureLedgerVersion = 1
+
+// FailurePolicy determines how the export pipeline reacts when a single message cannot be exported.
+type FailurePolicy int
+
+const (
+	// FailurePolicyAbort cancels the whole export on the first message failure. Messages rejected with a 422 are
+	// always skipped.
+	FailurePolicyAbort FailurePolicy = iota
+	// FailurePolicyContinue records the failure in the ledger and carries on with the remaining messages.
+	FailurePolicyContinue
+)
+
+type FailureStage string
+
+const (
+	FailureStageMetadata FailureStage = "metadata"
+	FailureStageDownload FailureStage = "download"
+	// FailureStageBuild is recorded for the messages which could not be assembled into an EML file. Their body and
+	// attachments are still written, so they are not counted as failed in the export summary.
+	FailureStageBuild FailureStage = "build"
+	FailureStageWrite FailureStage = "write"
+
+	// Stages of the restore pipeline.
+	FailureStageRead   FailureStage = "read"
+	FailureStageParse  FailureStage = "parse"
+	FailureStageImport FailureStage = "import"
+)
+
+type FailureErrorClass string
+
+const (
+	FailureErrorClassAPI       FailureErrorClass = "api"
+	FailureErrorClassNetwork   FailureErrorClass = "network"
+	FailureErrorClassIntegrity FailureErrorClass = "integrity"
+	FailureErrorClassIO        FailureErrorClass = "io"
+	FailureErrorClassGone      FailureErrorClass = "gone"
+	FailureErrorClassUnknown   FailureErrorClass = "unknown"
+)
+
+// ErrMessageGone is recorded for the messages of a retried export which no longer exist on the server.
+var ErrMessageGone = errors.New("message no longer exists on the server")
+
+type FailureRecord struct {
+	MessageID  string
+	Stage      FailureStage
+	ErrorClass FailureErrorClass
+	HTTPStatus int `json:",omitempty"`
+	Error      string
+	Attempts   int
+	LastFailed int64
+}
+
+// FailureLedger keeps track of the messages that could not be exported. It is persisted in the export folder so that
+// the failed messages can be retried later into the same backup.
+type FailureLedger struct {
+	lock    sync.Mutex
+	records map[string]FailureRecord
+}
+
+func NewFailureLedger() *FailureLedger {
+	return &FailureLedger{records: make(map[string]FailureRecord)}
+}
+
+// LoadFailureLedger reads the ledger stored in exportDir. An empty ledger is returned if the file does not exist.
+func LoadFailureLedger(exportDir string) (*FailureLedger, error) {
+	ledger := NewFailureLedger()
+
+	b, err := os.ReadFile(filepath.Join(exportDir, getFailureLedgerFileName())) //nolint:gosec
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ledger, nil
+		}
+
+		return nil, fmt.Errorf("failed to read failure ledger: %w", err)
+	}
+
+	v, err := utils.NewVersionedJSON[[]FailureRecord](FailureLedgerVersion, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse failure ledger: %w", err)
+	}
+
+	for _, r := range v.Payload {
+		ledger.records[r.MessageID] = r
+	}
+
+	return ledger, nil
+}
+
+// Record adds a failure for msgID, incrementing the attempt counter if the message already failed before.
+func (l *FailureLedger) Record(msgID string, stage FailureStage, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	class, status := classifyFailure(err)
+
+	record := l.records[msgID]
+	record.MessageID = msgID
+	record.Stage = stage
+	record.ErrorClass = class
+	record.HTTPStatus = status
+	record.Error = err.Error()
+	record.Attempts++
+	record.LastFailed = time.Now().Unix()
+
+	l.records[msgID] = record
+}
+
+// Remove drops msgID from the ledger, e.g. once it has been successfully exported.
+func (l *FailureLedger) Remove(msgID string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	delete(l.records, msgID)
+}
+
+func (l *FailureLedger) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return len(l.records)
+}
+
+// MessageIDs returns the sorted list of message IDs present in the ledger.
+func (l *FailureLedger) MessageIDs() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	ids := maps.Keys(l.records)
+	slices.Sort(ids)
+
+	return ids
+}
+
+// messageIDsForStage returns the IDs of the messages which failed in the given stage.
+func (l *FailureLedger) messageIDsForStage(stage FailureStage) []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var ids []string
+
+	for msgID, record := range l.records {
+		if record.Stage == stage {
+			ids = append(ids, msgID)
+		}
+	}
+
+	return ids
+}
+
+func (l *FailureLedger) Records() []FailureRecord {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	records := maps.Values(l.records)
+	slices.SortFunc(records, func(lhs, rhs FailureRecord) bool { return lhs.MessageID < rhs.MessageID })
+
+	return records
+}
+
+// Save writes the retryable messages of the ledger into exportDir. The messages which no longer exist on the server are
+// left out, they are only reported in the export summary. If no message is left, any previously written ledger file is
+// removed.
+func (l *FailureLedger) Save(tmpDir, exportDir string) error {
+	ledgerPath := filepath.Join(exportDir, getFailureLedgerFileName())
+
+	records := l.retryable().Records()
+	if len(records) == 0 {
+		if err := os.Remove(ledgerPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove failure ledger: %w", err)
+		}
+
+		return nil
+	}
+
+	data, err := utils.GenerateVersionedJSON(FailureLedgerVersion, records)
+	if err != nil {
+		return fmt.Errorf("failed to json encode failure ledger: %w", err)
+	}
+
+	return utils.WriteFileSafe(tmpDir, ledgerPath, data, &utils.Sha256IntegrityChecker{})
+}
+
+// retryable returns a copy of the ledger without the messages which no longer exist on the server, retrying them can
+// only fail again.
+func (l *FailureLedger) retryable() *FailureLedger {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	ledger := NewFailureLedger()
+
+	for msgID, record := range l.records {
+		if record.ErrorClass != FailureErrorClassGone {
+			ledger.records[msgID] = record
+		}
+	}
+
+	return ledger
+}
+
+func classifyFailure(err error) (FailureErrorClass, int) {
+	if errors.Is(err, ErrMessageGone) {
+		return FailureErrorClassGone, 0
+	}
+
+	if apiErr := new(proton.APIError); errors.As(err, &apiErr) {
+		return FailureErrorClassAPI, apiErr.Status
+	}
+
+	if netErr := new(proton.NetError); errors.As(err, &netErr) {
+		return FailureErrorClassNetwork, 0
+	}
+
+	if netErr := new(net.OpError); errors.As(err, &netErr) {
+		return FailureErrorClassNetwork, 0
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return FailureErrorClassNetwork, 0
+	}
+
+	if errors.Is(err, utils.ErrIntegrityCheckFailed) {
+		return FailureErrorClassIntegrity, 0
+	}
+
+	if pathErr := new(fs.PathError); errors.As(err, &pathErr) {
+		return FailureErrorClassIO, 0
+	}
+
+	if linkErr := new(os.LinkError); errors.As(err, &linkErr) {
+		return FailureErrorClassIO, 0
+	}
+
+	return FailureErrorClassUnknown, 0
+}
+
+func getFailureLedgerFileName() string {
+	return "failures.json"
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureLedger_SaveAndLoad(t *testing.T) {
+	exportDir := t.TempDir()
+	tmpDir := t.TempDir()
+
+	ledger := NewFailureLedger()
+	ledger.Record("msg2", FailureStageWrite, utils.ErrIntegrityCheckFailed)
+	ledger.Record("msg1", FailureStageDownload, &proton.APIError{Status: 500})
+	ledger.Record("msg1", FailureStageDownload, &proton.APIError{Status: 503})
+	ledger.Record("msg3", FailureStageMetadata, ErrMessageGone)
+
+	require.NoError(t, ledger.Save(tmpDir, exportDir))
+
+	// msg3 no longer exists on the server, it cannot be retried.
+	loaded, err := LoadFailureLedger(exportDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"msg1", "msg2"}, loaded.MessageIDs())
+
+	records := loaded.Records()
+	require.Equal(t, FailureErrorClassAPI, records[0].ErrorClass)
+	require.Equal(t, 503, records[0].HTTPStatus)
+	require.Equal(t, 2, records[0].Attempts)
+	require.Equal(t, FailureStageWrite, records[1].Stage)
+	require.Equal(t, FailureErrorClassIntegrity, records[1].ErrorClass)
+	require.Equal(t, 1, records[1].Attempts)
+}
+
+func TestFailureLedger_SaveEmptyRemovesFile(t *testing.T) {
+	exportDir := t.TempDir()
+	tmpDir := t.TempDir()
+
+	ledger := NewFailureLedger()
+	ledger.Record("msg1", FailureStageDownload, errors.New("failed"))
+	require.NoError(t, ledger.Save(tmpDir, exportDir))
+	require.FileExists(t, filepath.Join(exportDir, getFailureLedgerFileName()))
+
+	ledger.Remove("msg1")
+	require.NoError(t, ledger.Save(tmpDir, exportDir))
+	require.NoFileExists(t, filepath.Join(exportDir, getFailureLedgerFileName()))
+
+	loaded, err := LoadFailureLedger(exportDir)
+	require.NoError(t, err)
+	require.Zero(t, loaded.Len())
+}
+
+func TestFailureLedger_Retryable(t *testing.T) {
+	previous := NewFailureLedger()
+	previous.Record("msg1", FailureStageDownload, errors.New("failed"))
+	previous.Record("msg1", FailureStageDownload, errors.New("failed"))
+	previous.Record("msg2", FailureStageMetadata, ErrMessageGone)
+
+	ledger := previous.retryable()
+	require.Equal(t, []string{"msg1"}, ledger.MessageIDs())
+
+	// A message failing again keeps the attempts of the previous runs.
+	ledger.Record("msg1", FailureStageWrite, errors.New("failed again"))
+
+	records := ledger.Records()
+	require.Len(t, records, 1)
+	require.Equal(t, FailureStageWrite, records[0].Stage)
+	require.Equal(t, 3, records[0].Attempts)
+	require.Equal(t, 2, previous.Len())
+}
+
+func TestFindFailedBackupDir(t *testing.T) {
+	root := t.TempDir()
+
+	_, err := findFailedBackupDir(root)
+	require.ErrorIs(t, err, ErrNoFailedMessages)
+
+	backupDir := filepath.Join(root, "mail_20240101_000000")
+	require.NoError(t, os.MkdirAll(backupDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(backupDir, getFailureLedgerFileName()), []byte("{}"), 0o600))
+
+	dir, err := findFailedBackupDir(root)
+	require.NoError(t, err)
+	require.Equal(t, backupDir, dir)
+
+	dir, err = findFailedBackupDir(backupDir)
+	require.NoError(t, err)
+	require.Equal(t, backupDir, dir)
+}
@@ -75,6 +75,14 @@ func (f *Filter) IsEmpty() bool {
 		f.Subject == ""
 }
 
+// withoutLabels returns a copy of the filter with the label criteria removed.
+func (f *Filter) withoutLabels() *Filter {
+	c := *f
+	c.LabelIDs = nil
+
+	return &c
+}
+
 // Validate checks if the filter configuration is valid.
 func (f *Filter) Validate() error {
 	if f.After != nil && f.Before != nil && f.After.After(*f.Before) {
@@ -3,27 +3,22 @@ package mail
 import (
 	"context"
 	"net/mail"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ProtonMail/export-tool/internal/apiclient"
 	"github.com/ProtonMail/go-proton-api"
+	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
+	"golang.org/x/exp/slices"
 )
 
 // TestMetadataStage_WithFilter tests the metadata stage with various filters
 func TestMetadataStage_WithFilter(t *testing.T) {
-	mockCtrl := gomock.NewController(t)
-	defer mockCtrl.Finish()
-
-	client := apiclient.NewMockClient(mockCtrl)
-	errReporter := NewMockStageErrorReporter(mockCtrl)
-	fileChecker := NewMockMetadataFileChecker(mockCtrl)
-	reporter := NewMockReporter(mockCtrl)
-
 	const pageSize = 2
 
 	// Create test messages with different properties
@@ -101,19 +96,32 @@ func TestMetadataStage_WithFilter(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Setup expectations
-			client.EXPECT().GetMessageMetadataPage(gomock.Any(), gomock.Eq(0), gomock.Eq(pageSize), gomock.Any()).
-				Return(testMessages, nil).Times(1)
+			mockCtrl := gomock.NewController(t)
 
-			// Empty result on next call to stop pagination
+			client := apiclient.NewMockClient(mockCtrl)
+			errReporter := NewMockStageErrorReporter(mockCtrl)
+			fileChecker := NewMockMetadataFileChecker(mockCtrl)
+			reporter := NewMockReporter(mockCtrl)
+
+			// Setup expectations, the server applies the label and subject filters. The second page is empty to
+			// stop pagination.
 			client.EXPECT().GetMessageMetadataPage(gomock.Any(), gomock.Eq(0), gomock.Eq(pageSize), gomock.Any()).
-				Return([]proton.MessageMetadata{}, nil).AnyTimes()
+				DoAndReturn(func(_ context.Context, _, _ int, filter proton.MessageFilter) ([]proton.MessageMetadata, error) {
+					if filter.EndID != "" {
+						return []proton.MessageMetadata{}, nil
+					}
+
+					return xslices.Filter(testMessages, func(m proton.MessageMetadata) bool {
+						return (filter.LabelID == "" || slices.Contains(m.LabelIDs, filter.LabelID)) &&
+							(filter.Subject == "" || strings.Contains(strings.ToLower(m.Subject), strings.ToLower(filter.Subject)))
+					}), nil
+				}).MinTimes(1)
 
 			fileChecker.EXPECT().HasMessage(gomock.Any()).Return(false, nil).AnyTimes()
 			reporter.EXPECT().OnProgress(gomock.Any()).AnyTimes()
 
 			// Create metadata stage with filter
-			metadata := NewMetadataStage(client, logrus.WithField("test", "test"), pageSize, 1, tt.filter)
+			metadata := NewMetadataStage(client, logrus.WithField("test", "test"), pageSize, 1, tt.filter, nil, nil)
 
 			// Run metadata stage
 			go func() {
@@ -160,9 +168,11 @@ func TestFilter_Integration(t *testing.T) {
 	assert.NotNil(t, filter.After)
 	assert.NotNil(t, filter.Before)
 
-	// Verify server-side filter is not created (multiple labels)
+	// Verify server-side filter only holds the subject (multiple labels)
 	serverFilter := filter.ToServerFilter()
-	assert.Nil(t, serverFilter, "Server-side filter should be nil for multiple labels")
+	require.NotNil(t, serverFilter)
+	assert.Empty(t, serverFilter.LabelID, "Server-side filter should not filter multiple labels")
+	assert.Equal(t, "important", serverFilter.Subject)
 
 	// Verify client-side filtering is needed
 	assert.True(t, filter.NeedsClientFiltering())
@@ -175,6 +185,9 @@ func TestFilter_Integration(t *testing.T) {
 		ToList: []*mail.Address{
 			{Address: "recipient@test.com"},
 		},
+		CCList: []*mail.Address{
+			{Address: "colleague@work.com"},
+		},
 		Time:    time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC).Unix(),
 		Subject: "This is an important message",
 	}
@@ -0,0 +1,138 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/stretchr/testify/require"
+)
+
+func writeIMAPTestMessage(t *testing.T, dir, id string, labelIDs []string, unread bool, literal string) {
+	metadata := MessageMetadata{
+		MessageMetadata: proton.MessageMetadata{
+			ID:       id,
+			LabelIDs: labelIDs,
+			Flags:    proton.MessageFlagReceived,
+			Unread:   proton.Bool(unread),
+			Time:     time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC).Unix(),
+		},
+	}
+
+	data, err := metadata.toBytes()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, getMetadataFileName(id)), data, 0o600))
+
+	if len(literal) != 0 {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, getEMLFileName(id)), []byte(literal), 0o600))
+	} else {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, id), 0o700))
+	}
+}
+
+func TestBackupIMAPServer(t *testing.T) {
+	dir := t.TempDir()
+
+	labels, err := utils.GenerateVersionedJSON(LabelMetadataVersion, []proton.Label{
+		{ID: "folder-1", Name: "Work", Path: []string{"Work"}, Type: proton.LabelTypeFolder},
+		{ID: "label-1", Name: "Important", Path: []string{"Important"}, Type: proton.LabelTypeLabel},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, getLabelFileName()), labels, 0o600))
+
+	writeIMAPTestMessage(t, dir, "msg-1", []string{proton.InboxLabel, proton.StarredLabel, "label-1"}, false, searchTestPlainMessage)
+	writeIMAPTestMessage(t, dir, "msg-2", []string{"folder-1"}, true, searchTestMultipartMessage)
+	writeIMAPTestMessage(t, dir, "msg-3", []string{proton.InboxLabel}, false, "")
+
+	ctx := context.Background()
+
+	server, err := NewBackupIMAPServer(ctx, dir, "user", []byte("pass"), &async.NoopPanicHandler{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, server.Close(ctx)) }()
+
+	require.Equal(t, 2, server.GetMessageCount())
+	require.Equal(t, 1, server.GetSkippedCount())
+
+	_, err = server.Serve(ctx, "0.0.0.0:0")
+	require.ErrorIs(t, err, utils.ErrNonLocalAddress)
+
+	addr, err := server.Serve(ctx, "127.0.0.1:0")
+	require.NoError(t, err)
+
+	c, err := client.Dial(addr.String())
+	require.NoError(t, err)
+	defer func() { _ = c.Logout() }()
+
+	require.Error(t, c.Login("user", "wrong"))
+	require.NoError(t, c.Login("user", "pass"))
+
+	mailboxCh := make(chan *imap.MailboxInfo, 32)
+	require.NoError(t, c.List("", "*", mailboxCh))
+	names := xslices.Map(channelToSlice(mailboxCh), func(info *imap.MailboxInfo) string { return info.Name })
+	require.Subset(t, names, []string{"INBOX", "All Mail", "Starred", "Folders", "Folders/Work", "Labels", "Labels/Important"})
+
+	status, err := c.Select("INBOX", false)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), status.Messages)
+
+	first := new(imap.SeqSet)
+	first.AddNum(1)
+
+	messageCh := make(chan *imap.Message, 1)
+	section := &imap.BodySectionName{}
+	require.NoError(t, c.Fetch(first, []imap.FetchItem{imap.FetchFlags, section.FetchItem()}, messageCh))
+	message := <-messageCh
+	require.Subset(t, message.Flags, []string{imap.SeenFlag, imap.FlaggedFlag})
+	literal, err := io.ReadAll(message.GetBody(section))
+	require.NoError(t, err)
+	require.Contains(t, string(literal), "Subject: Quarterly report")
+
+	status, err = c.Select("All Mail", false)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), status.Messages)
+
+	status, err = c.Select("Folders/Work", false)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), status.Messages)
+
+	// Flags can be changed for the session, the backup cannot be modified.
+	require.NoError(t, c.Store(first, imap.FormatFlagsOp(imap.AddFlags, true), []any{imap.SeenFlag}, nil))
+	require.Error(t, c.Create("New"))
+	require.Error(t, c.Copy(first, "INBOX"))
+	require.Error(t, c.Append("INBOX", nil, time.Now(), imap.Literal(nil)))
+}
+
+func channelToSlice[T any](ch <-chan T) []T {
+	var result []T
+	for v := range ch {
+		result = append(result, v)
+	}
+
+	return result
+}
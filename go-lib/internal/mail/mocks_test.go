@@ -39,6 +39,20 @@ func (m *MockStageErrorReporter) EXPECT() *MockStageErrorReporterMockRecorder {
 	return m.recorder
 }
 
+// ReportMessageError mocks base method.
+func (m *MockStageErrorReporter) ReportMessageError(msgID string, stage FailureStage, err error) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReportMessageError", msgID, stage, err)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// ReportMessageError indicates an expected call of ReportMessageError.
+func (mr *MockStageErrorReporterMockRecorder) ReportMessageError(msgID, stage, err any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportMessageError", reflect.TypeOf((*MockStageErrorReporter)(nil).ReportMessageError), msgID, stage, err)
+}
+
 // ReportStageError mocks base method.
 func (m *MockStageErrorReporter) ReportStageError(err error) {
 	m.ctrl.T.Helper()
@@ -114,6 +128,18 @@ func (m *MockReporter) EXPECT() *MockReporterMockRecorder {
 	return m.recorder
 }
 
+// OnPauseStateChanged mocks base method.
+func (m *MockReporter) OnPauseStateChanged(paused bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnPauseStateChanged", paused)
+}
+
+// OnPauseStateChanged indicates an expected call of OnPauseStateChanged.
+func (mr *MockReporterMockRecorder) OnPauseStateChanged(paused any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnPauseStateChanged", reflect.TypeOf((*MockReporter)(nil).OnPauseStateChanged), paused)
+}
+
 // OnProgress mocks base method.
 func (m *MockReporter) OnProgress(delta int) {
 	m.ctrl.T.Helper()
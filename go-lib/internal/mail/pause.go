@@ -0,0 +1,131 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// PauseController suspends the pipeline stages of a task at chunk boundaries. Unlike cancellation, the task
+// context and async group are left untouched, so the work can be picked up again with Resume.
+// A nil *PauseController is valid and never pauses.
+type PauseController struct {
+	lock     sync.Mutex
+	paused   bool
+	resumeCh chan struct{}
+	observer PauseStateReporter
+}
+
+func NewPauseController() *PauseController {
+	return &PauseController{}
+}
+
+// Pause requests the stages to stop at their next chunk boundary. Returns false if already paused.
+func (p *PauseController) Pause() bool {
+	if p == nil {
+		return false
+	}
+
+	p.lock.Lock()
+	if p.paused {
+		p.lock.Unlock()
+		return false
+	}
+
+	p.paused = true
+	p.resumeCh = make(chan struct{})
+	observer := p.observer
+	p.lock.Unlock()
+
+	if observer != nil {
+		observer.OnPauseStateChanged(true)
+	}
+
+	return true
+}
+
+// Resume releases all the stages waiting on the controller. Returns false if not paused.
+func (p *PauseController) Resume() bool {
+	if p == nil {
+		return false
+	}
+
+	p.lock.Lock()
+	if !p.paused {
+		p.lock.Unlock()
+		return false
+	}
+
+	p.paused = false
+	close(p.resumeCh)
+	observer := p.observer
+	p.lock.Unlock()
+
+	if observer != nil {
+		observer.OnPauseStateChanged(false)
+	}
+
+	return true
+}
+
+func (p *PauseController) IsPaused() bool {
+	if p == nil {
+		return false
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.paused
+}
+
+// Wait blocks for as long as the controller is paused. It returns early with the context error if ctx is cancelled.
+func (p *PauseController) Wait(ctx context.Context) error {
+	if p == nil {
+		return ctx.Err()
+	}
+
+	for {
+		p.lock.Lock()
+		if !p.paused {
+			p.lock.Unlock()
+			return ctx.Err()
+		}
+		resumeCh := p.resumeCh
+		p.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resumeCh:
+		}
+	}
+}
+
+// setObserver registers the reporter that should be notified of pause state changes.
+func (p *PauseController) setObserver(observer PauseStateReporter) {
+	if p == nil {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.observer = observer
+}
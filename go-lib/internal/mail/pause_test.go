@@ -0,0 +1,82 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPauseController_PauseResume(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	reporter := NewMockReporter(mockCtrl)
+
+	p := NewPauseController()
+	p.setObserver(reporter)
+
+	gomock.InOrder(
+		reporter.EXPECT().OnPauseStateChanged(true),
+		reporter.EXPECT().OnPauseStateChanged(false),
+	)
+
+	require.False(t, p.IsPaused())
+	require.False(t, p.Resume())
+
+	require.True(t, p.Pause())
+	require.False(t, p.Pause())
+	require.True(t, p.IsPaused())
+
+	waitDone := make(chan error)
+	go func() {
+		waitDone <- p.Wait(context.Background())
+	}()
+
+	select {
+	case <-waitDone:
+		require.Fail(t, "wait should block while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.True(t, p.Resume())
+	require.NoError(t, <-waitDone)
+	require.False(t, p.IsPaused())
+}
+
+func TestPauseController_WaitCancelled(t *testing.T) {
+	p := NewPauseController()
+	require.True(t, p.Pause())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.ErrorIs(t, p.Wait(ctx), context.Canceled)
+}
+
+func TestPauseController_Nil(t *testing.T) {
+	var p *PauseController
+
+	p.setObserver(nil)
+	require.False(t, p.Pause())
+	require.False(t, p.IsPaused())
+	require.False(t, p.Resume())
+	require.NoError(t, p.Wait(context.Background()))
+}
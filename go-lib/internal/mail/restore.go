@@ -19,33 +19,53 @@ package mail
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"path/filepath"
 	"regexp"
+	"sync/atomic"
 	"time"
 
-	"github.com/ProtonMail/export-tool/internal/apiclient"
 	"github.com/ProtonMail/export-tool/internal/session"
-	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gluon/async"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
 )
 
 var mailFolderRegExp = regexp.MustCompile(`^mail_\d{8}_\d{6}$`)
 
 type RestoreTask struct {
-	ctx             context.Context
-	startTime       time.Time
-	ctxCancel       func()
-	backupDir       string
-	session         *session.Session
-	log             *logrus.Entry
-	labelMapping    map[string]string // map of [backup labelIDs] to remoteLabelIDs
-	importLabelID   string
-	importableCount int64
-	importedCount   int64
-	failedCount     int64
-	cancelledByUser bool
+	ctx                 context.Context
+	startTime           time.Time
+	ctxCancel           func()
+	backupDir           string
+	sourcePath          string // Path given by the user, names the journal if it is kept outside of the restored folder.
+	session             *session.Session
+	log                 *logrus.Entry
+	labelMapping        map[string]string // map of [backup labelIDs] to remoteLabelIDs
+	importLabelID       string
+	importableCount     int64
+	importedCount       atomic.Int64
+	failedCount         atomic.Int64
+	duplicateCount      atomic.Int64
+	cancelledByUser     bool
+	pause               *PauseController
+	dryRun              bool
+	group               *async.Group
+	parallelImports     int
+	remoteIndex         *remoteMessageIndex // nil if dedupe is disabled.
+	skipDedupe          bool
+	journal             *RestoreJournal
+	dryRunReport        *RestoreDryRunReport
+	targetAddress       string
+	addressMapping      map[string]string
+	sourceFormat        RestoreSourceFormat
+	labelMappingFile    string
+	importLabel         RestoreImportLabelOptions
+	source              restoreSource
+	filter              *Filter
+	filteredLabelIDs    map[string]struct{} // Labels of the messages matching the filter, nil if the restore is not filtered.
+	backupFolders       []string
+	encryptedMessageIDs []string
+	restoreSettings     bool
 }
 
 func NewRestoreTask(ctx context.Context, backupDir string, session *session.Session) (*RestoreTask, error) {
@@ -59,12 +79,22 @@ func NewRestoreTask(ctx context.Context, backupDir string, session *session.Sess
 	ctx, cancel := context.WithCancel(ctx)
 
 	return &RestoreTask{
-		ctx:          ctx,
-		ctxCancel:    cancel,
-		backupDir:    absPath,
-		session:      session,
-		log:          log,
-		labelMapping: make(map[string]string),
+		ctx:             ctx,
+		ctxCancel:       cancel,
+		backupDir:       absPath,
+		sourcePath:      absPath,
+		session:         session,
+		log:             log,
+		labelMapping:    make(map[string]string),
+		pause:           NewPauseController(),
+		group:           async.NewGroup(ctx, session.GetPanicHandler()),
+		parallelImports: DefaultParallelImports,
+		sourceFormat:    RestoreSourceBackup,
+		importLabel: RestoreImportLabelOptions{
+			Mode:         RestoreImportLabelCreate,
+			NameTemplate: DefaultImportLabelNameTemplate,
+			Color:        DefaultImportLabelColor,
+		},
 	}, nil
 }
 
@@ -73,27 +103,69 @@ func (r *RestoreTask) Run(reporter Reporter) error {
 	defer func() { r.log.WithField("duration", time.Since(r.startTime)).Info("Finished") }()
 	r.log.WithField("backupDir", r.backupDir).Info("Starting")
 
-	messageInfoList, err := r.validateBackupDir(reporter)
+	r.pause.setObserver(reporter)
+	defer r.pause.setObserver(nil)
+
+	messageInfoList, err := r.openSource(reporter)
 	if err != nil {
 		return err
 	}
 	r.log.WithField("messageCount", len(messageInfoList)).Info("Found messages to import")
 
+	if r.dryRun {
+		r.log.Info("Dry-run, the account will not be modified")
+
+		if err := r.runDryRun(messageInfoList, reporter); err != nil {
+			return err
+		}
+
+		r.log.WithFields(logrus.Fields{
+			"importable": r.dryRunReport.ImportableMessages,
+			"failing":    r.dryRunReport.FailedMessages,
+		}).Info("Dry-run report")
+
+		return nil
+	}
+
+	r.openJournal()
+	defer r.closeJournal()
+
 	if err := r.restoreLabels(); err != nil {
 		return err
 	}
 
+	if r.restoreSettings {
+		if err := r.restoreAccountSettings(); err != nil {
+			return err
+		}
+	}
+
 	if err := r.createImportLabel(); err != nil {
 		return err
 	}
 
+	if r.journal != nil {
+		if err := r.journal.SetLabels(r.importLabelID, r.labelMapping); err != nil {
+			r.log.WithError(err).Warn("Failed to write restore journal, the restore will not be resumable")
+			r.closeJournal()
+		}
+	}
+
 	err = r.importMails(messageInfoList, reporter)
 
+	if err == nil && r.journal != nil {
+		if err := r.journal.Remove(); err != nil {
+			r.log.WithError(err).Warn("Failed to remove restore journal")
+		}
+	}
+
 	r.log.WithFields(logrus.Fields{
 		"importable": r.GetImportableCount(),
 		"imported":   r.GetImportedCount(),
 		"failed":     r.GetFailedCount(),
 		"skipped":    r.GetSkippedCount(),
+		"duplicates": r.GetDuplicateCount(),
+		"encrypted":  r.GetEncryptedCount(),
 	}).Info("Report")
 
 	return err
@@ -104,8 +176,92 @@ func (r *RestoreTask) Cancel() {
 	r.ctxCancel()
 }
 
+// Pause suspends the restore once the batch being imported has completed. Returns false if already paused.
+func (r *RestoreTask) Pause() bool {
+	if !r.pause.Pause() {
+		return false
+	}
+
+	r.log.Info("Restore paused")
+
+	return true
+}
+
+// Resume continues a paused restore. Returns false if the restore was not paused.
+func (r *RestoreTask) Resume() bool {
+	if !r.pause.Resume() {
+		return false
+	}
+
+	r.log.Info("Restore resumed")
+
+	return true
+}
+
+func (r *RestoreTask) IsPaused() bool {
+	return r.pause.IsPaused()
+}
+
+// SetDryRun makes Run validate the backup and report what the restore would do without modifying the account. Must be
+// called before Run.
+func (r *RestoreTask) SetDryRun(dryRun bool) {
+	r.dryRun = dryRun
+}
+
+func (r *RestoreTask) IsDryRun() bool {
+	return r.dryRun
+}
+
+// GetDryRunReport returns the report of the last dry-run or nil if no dry-run has completed.
+func (r *RestoreTask) GetDryRunReport() *RestoreDryRunReport {
+	return r.dryRunReport
+}
+
+// SetParallelImports sets the number of message batches imported concurrently. Must be called before Run.
+func (r *RestoreTask) SetParallelImports(n int) {
+	if n < 1 {
+		n = DefaultParallelImports
+	}
+
+	r.parallelImports = n
+}
+
+// SetTargetAddress makes the restore import every message into the address of the account with the given email instead
+// of the address the message was originally delivered to. Must be called before Run.
+func (r *RestoreTask) SetTargetAddress(email string) {
+	r.targetAddress = email
+}
+
+// SetSourceFormat sets the layout of the folder messages are restored from, to import mail exported by other
+// providers. Must be called before Run.
+func (r *RestoreTask) SetSourceFormat(format RestoreSourceFormat) {
+	r.sourceFormat = format
+}
+
+// SetAddressMapping maps the emails or address IDs of a backup made from another account to the emails of the account
+// addresses the messages are restored into. Must be called before Run.
+func (r *RestoreTask) SetAddressMapping(mapping map[string]string) {
+	r.addressMapping = mapping
+}
+
+// SetFilter restricts the restore to the messages of the backup matching the filter, e.g. a single folder or a date
+// range. Only the labels of these messages are restored. Must be called before Run.
+func (r *RestoreTask) SetFilter(filter *Filter) {
+	r.filter = filter
+}
+
+// SetBackupFolders selects the backup sub-folders restored when the backup folder contains several backups, as
+// returned by ListBackupFolders. All of them are restored if names is empty. Must be called before Run.
+func (r *RestoreTask) SetBackupFolders(names []string) {
+	r.backupFolders = names
+}
+
+func (r *RestoreTask) isFiltered() bool {
+	return r.filter != nil && !r.filter.IsEmpty()
+}
+
 func (r *RestoreTask) Close() {
-	// Nothing to do so far.
+	r.group.CancelAndWait()
 }
 
 func (r *RestoreTask) GetBackupPath() string {
@@ -117,62 +273,117 @@ func (r *RestoreTask) GetImportableCount() int64 {
 }
 
 func (r *RestoreTask) GetImportedCount() int64 {
-	return r.importedCount
+	return r.importedCount.Load()
 }
 
 func (r *RestoreTask) GetFailedCount() int64 {
-	return r.failedCount
+	return r.failedCount.Load()
+}
+
+// GetDuplicateCount returns the number of messages which were not imported as they are already present on the account,
+// including the messages imported by an interrupted run of the same restore.
+func (r *RestoreTask) GetDuplicateCount() int64 {
+	return r.duplicateCount.Load()
+}
+
+// GetEncryptedCount returns the number of messages of the backup which were not restored as some of their parts could
+// not be decrypted during the export.
+func (r *RestoreTask) GetEncryptedCount() int64 {
+	return int64(len(r.encryptedMessageIDs))
 }
 
 func (r *RestoreTask) GetSkippedCount() int64 {
-	return r.importableCount - r.importedCount - r.failedCount
+	return r.importableCount - r.GetImportedCount() - r.GetFailedCount() - r.GetDuplicateCount()
 }
 
 func (r *RestoreTask) GetOperationCancelledByUser() bool {
 	return r.cancelledByUser
 }
 
-func (r *RestoreTask) withAddrKR(fn func(addrID string, addrKR *crypto.KeyRing) error) error {
-	client := r.session.GetClient()
-	addresses, err := client.GetAddresses(r.ctx)
-	if err != nil {
-		return err
+// journalScope returns the scope of the restore. The path of the restored folder is only part of it for the journals
+// kept outside of that folder, so that a backup moved elsewhere can still be resumed.
+func (r *RestoreTask) journalScope(outside bool) RestoreJournalScope {
+	scope := RestoreJournalScope{
+		SourceFormat:   r.sourceFormat,
+		BackupFolders:  slices.Clone(r.backupFolders),
+		TargetAddress:  r.targetAddress,
+		AddressMapping: r.addressMapping,
+	}
+
+	slices.Sort(scope.BackupFolders)
+
+	if r.isFiltered() {
+		scope.Filter = r.filter
 	}
 
-	if len(addresses) == 0 {
-		return errors.New("address list is empty")
+	if outside {
+		scope.SourcePath = r.sourcePath
 	}
 
-	addrID := addresses[0].ID
-	user := r.session.GetUser()
-	salts := r.session.GetUserSalts()
+	return scope
+}
 
-	saltedKeyPass, err := salts.SaltForKey(r.session.GetMailboxPassword(), user.Keys.Primary().ID)
+// readJournalHeader returns the header of the journal of an interrupted run of the restore, nil if there is none.
+func (r *RestoreTask) readJournalHeader() (*restoreJournalHeader, error) {
+	header, err := readRestoreJournalHeader(r.backupDir, r.journalScope(false))
+	if err != nil || header != nil {
+		return header, err
+	}
+
+	fallbackDir, err := FallbackRestoreJournalDir()
 	if err != nil {
-		return fmt.Errorf("failed to salt key password: %w", err)
+		return nil, nil //nolint:nilnil
 	}
 
-	if userKR, err := user.Keys.Unlock(saltedKeyPass, nil); err != nil {
-		return fmt.Errorf("failed to unlock user keys: %w", err)
-	} else if userKR.CountDecryptionEntities() == 0 {
-		return fmt.Errorf("failed to unlock user keys")
+	return readRestoreJournalHeader(fallbackDir, r.journalScope(true))
+}
+
+// openJournal opens the journal of the restore in the restored folder, or in the cache folder of the user if the
+// restored folder is read-only. A restore can still run without a journal, but it will not be resumable.
+func (r *RestoreTask) openJournal() {
+	userID := r.session.GetUser().ID
+
+	journal, err := OpenRestoreJournal(r.backupDir, r.journalScope(false), userID)
+	if err != nil && isReadOnlyError(err) {
+		r.log.WithError(err).Info("The restored folder is read-only, the restore journal is kept in the cache folder")
+
+		var fallbackDir string
+		if fallbackDir, err = FallbackRestoreJournalDir(); err == nil {
+			journal, err = OpenRestoreJournal(fallbackDir, r.journalScope(true), userID)
+		}
 	}
 
-	unlockedKR, err := apiclient.NewUnlockedKeyRing(user, addresses, saltedKeyPass)
 	if err != nil {
-		return fmt.Errorf("failed to unlock user keyring:%w", err)
+		r.log.WithError(err).Warn("Failed to open restore journal, the restore will not be resumable")
+		return
 	}
-	defer unlockedKR.Close()
 
-	addrKR, ok := unlockedKR.GetAddrKeyRing(addresses[0].ID)
-	if !ok {
-		return fmt.Errorf("failed to get primary address keyring")
+	if journal.IsResumed() {
+		r.log.WithField("importedCount", journal.ImportedCount()).Info("Resuming interrupted restore")
 	}
 
-	primaryKR, err := addrKR.FirstKey()
-	if err != nil {
-		return fmt.Errorf("failed to get primary key: %w", err)
+	r.journal = journal
+}
+
+func (r *RestoreTask) closeJournal() {
+	if r.journal == nil {
+		return
 	}
 
-	return fn(addrID, primaryKR)
+	if err := r.journal.Close(); err != nil {
+		r.log.WithError(err).Warn("Failed to close restore journal")
+	}
+
+	r.journal = nil
+}
+
+// journalImported records messages of the backup as imported in the journal.
+func (r *RestoreTask) journalImported(messageIDs ...string) {
+	if r.journal == nil {
+		return
+	}
+
+	if err := r.journal.AddImported(messageIDs...); err != nil {
+		r.log.WithError(err).Warn("Failed to update restore journal")
+	}
 }
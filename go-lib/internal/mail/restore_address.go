@@ -0,0 +1,272 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+var ErrUnknownTargetAddress = errors.New("the target address does not belong to the account")
+
+// restoreAddressResolver picks the address of the account each message of the backup is restored into.
+type restoreAddressResolver struct {
+	primaryID string
+	targetID  string
+	emails    map[string]string // map of account address IDs to emails
+	byEmail   map[string]string // map of normalized account emails to address IDs
+	mapping   map[string]string // map of normalized backup emails or backup address IDs to account address IDs
+}
+
+// newRestoreAddressResolver creates a resolver over the usable addresses of the account, the first one being the
+// primary address. targetEmail and the values of mapping must be emails of these addresses.
+func newRestoreAddressResolver(
+	addresses []proton.Address,
+	targetEmail string,
+	mapping map[string]string,
+) (*restoreAddressResolver, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("address list is empty")
+	}
+
+	resolver := &restoreAddressResolver{
+		primaryID: addresses[0].ID,
+		emails:    make(map[string]string, len(addresses)),
+		byEmail:   make(map[string]string, len(addresses)),
+		mapping:   make(map[string]string, len(mapping)),
+	}
+
+	for _, address := range addresses {
+		resolver.emails[address.ID] = address.Email
+		resolver.byEmail[normalizeEmail(address.Email)] = address.ID
+	}
+
+	if len(targetEmail) != 0 {
+		targetID, ok := resolver.byEmail[normalizeEmail(targetEmail)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %v", ErrUnknownTargetAddress, targetEmail)
+		}
+
+		resolver.targetID = targetID
+	}
+
+	for from, to := range mapping {
+		addrID, ok := resolver.byEmail[normalizeEmail(to)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %v", ErrUnknownTargetAddress, to)
+		}
+
+		resolver.mapping[normalizeEmail(from)] = addrID
+	}
+
+	return resolver, nil
+}
+
+// resolve returns the ID of the address the message is restored into: the target address if one is set, otherwise
+// the address the message was delivered to or sent from, and the primary address if none of these is on the account.
+func (a *restoreAddressResolver) resolve(metadata proton.MessageMetadata) string {
+	if len(a.targetID) != 0 {
+		return a.targetID
+	}
+
+	if addrID, ok := a.mapping[normalizeEmail(metadata.AddressID)]; ok {
+		return addrID
+	}
+
+	if _, ok := a.emails[metadata.AddressID]; ok {
+		return metadata.AddressID
+	}
+
+	for _, email := range messageAddressEmails(metadata) {
+		if addrID, ok := a.mapping[email]; ok {
+			return addrID
+		}
+
+		if addrID, ok := a.byEmail[email]; ok {
+			return addrID
+		}
+	}
+
+	return a.primaryID
+}
+
+func (a *restoreAddressResolver) email(addrID string) string {
+	return a.emails[addrID]
+}
+
+// messageAddressEmails returns the normalized emails the message may belong to, the sender first for sent messages
+// and the recipients first otherwise.
+func messageAddressEmails(metadata proton.MessageMetadata) []string {
+	var emails []string
+
+	if metadata.Sender != nil && metadata.Flags.Has(proton.MessageFlagSent) {
+		emails = append(emails, normalizeEmail(metadata.Sender.Address))
+	}
+
+	for _, list := range [][]*mail.Address{metadata.ToList, metadata.CCList, metadata.BCCList} {
+		for _, address := range list {
+			if address != nil {
+				emails = append(emails, normalizeEmail(address.Address))
+			}
+		}
+	}
+
+	return emails
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoadAddressMapping parses a mapping of backup addresses to account addresses. value is either a comma separated list
+// of `backup=account` pairs or the path of a file containing one pair per line. The backup side is an email or the ID
+// of the address in the backup. Empty lines and lines starting with '#' are ignored.
+func LoadAddressMapping(value string) (map[string]string, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	if strings.Contains(value, "=") {
+		return parseAddressMappingEntries(strings.Split(value, ","))
+	}
+
+	file, err := os.Open(value) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to open address mapping file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var lines []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read address mapping file: %w", err)
+	}
+
+	return parseAddressMappingEntries(lines)
+}
+
+func parseAddressMappingEntries(entries []string) (map[string]string, error) {
+	mapping := make(map[string]string, len(entries))
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		from, to, ok := strings.Cut(entry, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+
+		if !ok || len(from) == 0 || len(to) == 0 {
+			return nil, fmt.Errorf("invalid address mapping '%v', expected 'backup=account'", entry)
+		}
+
+		mapping[from] = to
+	}
+
+	return mapping, nil
+}
+
+// withAddrKRs unlocks the keys of the enabled addresses of the account and calls fn with the resolver of the target
+// address of each message and the keyring of each address.
+func (r *RestoreTask) withAddrKRs(fn func(resolver *restoreAddressResolver, addrKRs map[string]*crypto.KeyRing) error) error {
+	client := r.session.GetClient()
+	addresses, err := client.GetAddresses(r.ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(addresses) == 0 {
+		return errors.New("address list is empty")
+	}
+
+	user := r.session.GetUser()
+	salts := r.session.GetUserSalts()
+
+	saltedKeyPass, err := salts.SaltForKey(r.session.GetMailboxPassword(), user.Keys.Primary().ID)
+	if err != nil {
+		return fmt.Errorf("failed to salt key password: %w", err)
+	}
+
+	if userKR, err := user.Keys.Unlock(saltedKeyPass, nil); err != nil {
+		return fmt.Errorf("failed to unlock user keys: %w", err)
+	} else if userKR.CountDecryptionEntities() == 0 {
+		return fmt.Errorf("failed to unlock user keys")
+	}
+
+	unlockedKR, err := apiclient.NewUnlockedKeyRing(user, addresses, saltedKeyPass)
+	if err != nil {
+		return fmt.Errorf("failed to unlock user keyring:%w", err)
+	}
+	defer unlockedKR.Close()
+
+	usable := make([]proton.Address, 0, len(addresses))
+	addrKRs := make(map[string]*crypto.KeyRing, len(addresses))
+
+	for i, address := range addresses {
+		// The first address remains the fallback even if disabled, as it was before addresses could be chosen.
+		if i != 0 && address.Status != proton.AddressStatusEnabled {
+			continue
+		}
+
+		addrKR, ok := unlockedKR.GetAddrKeyRing(address.ID)
+		if !ok {
+			if i == 0 {
+				return fmt.Errorf("failed to get primary address keyring")
+			}
+
+			r.log.WithField("addrID", address.ID).Warn("Address has no key ring, messages will not be restored into it")
+
+			continue
+		}
+
+		primaryKR, err := addrKR.FirstKey()
+		if err != nil {
+			if i == 0 {
+				return fmt.Errorf("failed to get primary key: %w", err)
+			}
+
+			r.log.WithField("addrID", address.ID).WithError(err).Warn("Failed to get address primary key")
+
+			continue
+		}
+
+		usable = append(usable, address)
+		addrKRs[address.ID] = primaryKR
+	}
+
+	resolver, err := newRestoreAddressResolver(usable, r.targetAddress, r.addressMapping)
+	if err != nil {
+		return err
+	}
+
+	return fn(resolver, addrKRs)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreAddressResolver(t *testing.T) {
+	addresses := []proton.Address{
+		{ID: "primary", Email: "primary@proton.me"},
+		{ID: "work", Email: "Work@proton.me"},
+		{ID: "alias", Email: "alias@proton.me"},
+	}
+
+	resolver, err := newRestoreAddressResolver(addresses, "", map[string]string{
+		"old@other.me":   "alias@proton.me",
+		"old-address-id": "work@proton.me",
+	})
+	require.NoError(t, err)
+
+	// The original address is on the account.
+	require.Equal(t, "work", resolver.resolve(proton.MessageMetadata{AddressID: "work"}))
+
+	// The address ID of the backup is mapped.
+	require.Equal(t, "work", resolver.resolve(proton.MessageMetadata{AddressID: "old-address-id"}))
+
+	// A recipient is an address of the account.
+	require.Equal(t, "work", resolver.resolve(proton.MessageMetadata{
+		AddressID: "unknown",
+		ToList:    []*mail.Address{{Address: "someone@example.com"}},
+		CCList:    []*mail.Address{{Address: "WORK@proton.me"}},
+	}))
+
+	// A recipient is mapped.
+	require.Equal(t, "alias", resolver.resolve(proton.MessageMetadata{
+		AddressID: "unknown",
+		ToList:    []*mail.Address{{Address: "old@other.me"}},
+	}))
+
+	// The sender of a sent message takes precedence over its recipients.
+	require.Equal(t, "alias", resolver.resolve(proton.MessageMetadata{
+		AddressID: "unknown",
+		Flags:     proton.MessageFlagSent,
+		Sender:    &mail.Address{Address: "alias@proton.me"},
+		ToList:    []*mail.Address{{Address: "work@proton.me"}},
+	}))
+
+	// Nothing matches.
+	require.Equal(t, "primary", resolver.resolve(proton.MessageMetadata{
+		AddressID: "unknown",
+		ToList:    []*mail.Address{{Address: "someone@example.com"}},
+	}))
+	require.Equal(t, "Work@proton.me", resolver.email("work"))
+
+	// The target address wins over everything else.
+	resolver, err = newRestoreAddressResolver(addresses, "alias@proton.me", nil)
+	require.NoError(t, err)
+	require.Equal(t, "alias", resolver.resolve(proton.MessageMetadata{AddressID: "work"}))
+
+	_, err = newRestoreAddressResolver(addresses, "unknown@proton.me", nil)
+	require.ErrorIs(t, err, ErrUnknownTargetAddress)
+
+	_, err = newRestoreAddressResolver(addresses, "", map[string]string{"old@other.me": "unknown@proton.me"})
+	require.ErrorIs(t, err, ErrUnknownTargetAddress)
+}
+
+func TestLoadAddressMapping(t *testing.T) {
+	mapping, err := LoadAddressMapping("")
+	require.NoError(t, err)
+	require.Empty(t, mapping)
+
+	mapping, err = LoadAddressMapping("old@other.me=new@proton.me, old2@other.me = new2@proton.me")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"old@other.me": "new@proton.me", "old2@other.me": "new2@proton.me"}, mapping)
+
+	_, err = LoadAddressMapping("old@other.me=,=new@proton.me")
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "addresses.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# backup=account\nold@other.me=new@proton.me\n\nold-address-id=new@proton.me\n"), 0o600))
+
+	mapping, err = LoadAddressMapping(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"old@other.me": "new@proton.me", "old-address-id": "new@proton.me"}, mapping)
+
+	_, err = LoadAddressMapping(filepath.Join(t.TempDir(), "missing.txt"))
+	require.Error(t, err)
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/go-proton-api"
+	"golang.org/x/exp/slices"
+)
+
+// ErrMessageStillEncrypted is returned for the messages of a backup which could not be decrypted during the export.
+var ErrMessageStillEncrypted = errors.New("message is still encrypted")
+
+// splitMessageContentFields are the header fields of the original message replaced when a split message is
+// reassembled.
+var splitMessageContentFields = []string{ //nolint:gochecknoglobals
+	"content-type",
+	"content-transfer-encoding",
+	"content-disposition",
+	"mime-version",
+}
+
+const base64LineLength = 76
+
+// encryptedParts returns the name of the encrypted parts of a message written in its own folder by
+// AssembleFailedMessageWriter or AddrKeyRingMissingMessageWriter. Such messages can only be restored once every part
+// has been decrypted.
+func encryptedParts(messageDir string) ([]string, error) {
+	entries, err := os.ReadDir(messageDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []string
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".pgp") {
+			parts = append(parts, entry.Name())
+		}
+	}
+
+	return parts, nil
+}
+
+// assembleSplitMessage rebuilds the RFC822 literal of a message written in its own folder by
+// AssembleFailedMessageWriter, from the headers found in its metadata and its decrypted body and attachments.
+func assembleSplitMessage(messageDir string, metadata MessageMetadata) ([]byte, error) {
+	if parts, err := encryptedParts(messageDir); err != nil {
+		return nil, err
+	} else if len(parts) != 0 {
+		return nil, fmt.Errorf("%w: %v", ErrMessageStillEncrypted, strings.Join(parts, ", "))
+	}
+
+	body, err := os.ReadFile(filepath.Join(messageDir, bodyFileName())) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("could not read body: %w", err)
+	}
+
+	attachments := make([][]byte, len(metadata.Attachments))
+	for i, attachment := range metadata.Attachments {
+		if attachments[i], err = os.ReadFile(filepath.Join(messageDir, attachmentFileName(attachment.ID, attachment.Name))); err != nil { //nolint:gosec
+			return nil, fmt.Errorf("could not read attachment %v: %w", attachment.ID, err)
+		}
+	}
+
+	var buffer bytes.Buffer
+
+	buffer.Write(splitMessageHeader(metadata))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(attachments) == 0 {
+		if err := writeSplitMessageBody(&buffer, metadata.MIMEType, body); err != nil {
+			return nil, err
+		}
+
+		return buffer.Bytes(), nil
+	}
+
+	hash := sha256.Sum256([]byte(metadata.ID))
+	boundary := fmt.Sprintf("%x", hash[:16])
+
+	fmt.Fprintf(&buffer, "Content-Type: multipart/mixed; boundary=\"%v\"\r\n\r\n", boundary)
+
+	writer := rfc822.NewMultipartWriter(&buffer, boundary)
+
+	if err := writer.AddPart(func(w io.Writer) error { return writeSplitMessageBody(w, metadata.MIMEType, body) }); err != nil {
+		return nil, err
+	}
+
+	for i, attachment := range metadata.Attachments {
+		if err := writer.AddPart(func(w io.Writer) error { return writeSplitMessageAttachment(w, attachment, attachments[i]) }); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Done(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// splitMessageHeader returns the header fields of the original message, without its content fields. The header is
+// rebuilt from the metadata if the original one cannot be parsed.
+func splitMessageHeader(metadata MessageMetadata) []byte {
+	var buffer bytes.Buffer
+
+	if len(strings.TrimSpace(metadata.Headers)) != 0 {
+		if header, err := rfc822.NewHeader([]byte(strings.TrimRight(metadata.Headers, "\r\n") + "\r\n\r\n")); err == nil {
+			header.Entries(func(key, val string) {
+				if !slices.Contains(splitMessageContentFields, strings.ToLower(key)) {
+					fmt.Fprintf(&buffer, "%v: %v\r\n", key, val)
+				}
+			})
+		}
+	}
+
+	if buffer.Len() != 0 {
+		return buffer.Bytes()
+	}
+
+	fmt.Fprintf(&buffer, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", metadata.Subject))
+	if metadata.Sender != nil {
+		fmt.Fprintf(&buffer, "From: %v\r\n", metadata.Sender.String())
+	}
+
+	for _, field := range []struct {
+		name      string
+		addresses []*mail.Address
+	}{{"To", metadata.ToList}, {"Cc", metadata.CCList}, {"Bcc", metadata.BCCList}} {
+		if len(field.addresses) != 0 {
+			fmt.Fprintf(&buffer, "%v: %v\r\n", field.name, formatAddressList(field.addresses))
+		}
+	}
+
+	fmt.Fprintf(&buffer, "Date: %v\r\n", time.Unix(metadata.Time, 0).UTC().Format(time.RFC1123Z))
+	if len(metadata.ExternalID) != 0 {
+		fmt.Fprintf(&buffer, "Message-Id: <%v>\r\n", metadata.ExternalID)
+	}
+
+	return buffer.Bytes()
+}
+
+func formatAddressList(addresses []*mail.Address) string {
+	result := make([]string, 0, len(addresses))
+
+	for _, address := range addresses {
+		if address != nil {
+			result = append(result, address.String())
+		}
+	}
+
+	return strings.Join(result, ", ")
+}
+
+// writeSplitMessageBody writes the content fields and the body of a message.
+func writeSplitMessageBody(w io.Writer, mimeType rfc822.MIMEType, body []byte) error {
+	// The decrypted body of a PGP/MIME message is a MIME entity with its own content fields.
+	if mimeType == rfc822.MultipartMixed {
+		_, err := w.Write(body)
+		return err
+	}
+
+	if len(mimeType) == 0 {
+		mimeType = rfc822.TextPlain
+	}
+
+	if _, err := fmt.Fprintf(w, "Content-Type: %v; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\n", mimeType); err != nil {
+		return err
+	}
+
+	return writeBase64(w, body)
+}
+
+func writeSplitMessageAttachment(w io.Writer, attachment proton.Attachment, data []byte) error {
+	contentType := mime.FormatMediaType(string(attachment.MIMEType), map[string]string{"name": attachment.Name})
+	if len(contentType) == 0 {
+		contentType = mime.FormatMediaType("application/octet-stream", map[string]string{"name": attachment.Name})
+	}
+
+	disposition := string(attachment.Disposition)
+	if len(disposition) == 0 {
+		disposition = string(proton.AttachmentDisposition)
+	}
+
+	if _, err := fmt.Fprintf(
+		w,
+		"Content-Type: %v\r\nContent-Disposition: %v\r\nContent-Transfer-Encoding: base64\r\n",
+		contentType,
+		mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}),
+	); err != nil {
+		return err
+	}
+
+	for key, values := range attachment.Headers.Values {
+		if strings.EqualFold(key, "content-id") && len(values) != 0 {
+			if _, err := fmt.Fprintf(w, "Content-Id: %v\r\n", values[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+
+	return writeBase64(w, data)
+}
+
+// writeBase64 writes data encoded in base64, in lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	for len(encoded) > 0 {
+		n := min(len(encoded), base64LineLength)
+
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+
+		encoded = encoded[n:]
+	}
+
+	return nil
+}
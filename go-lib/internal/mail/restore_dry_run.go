@@ -0,0 +1,229 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+const RestoreDryRunReportVersion = 1
+
+// dryRunLabelPrefix marks the remote label IDs of labels that would be created by the restore.
+const dryRunLabelPrefix = "dry-run:"
+
+var ErrNoDryRunReport = errors.New("dry-run report is not available before a dry-run has completed")
+
+type RestoreDryRunFailure struct {
+	MessageID string
+	Reason    string
+}
+
+// RestoreDryRunReport describes what a restore would do to the account without modifying it.
+type RestoreDryRunReport struct {
+	ImportLabelName string
+	Labels          []RestoreLabelPlan
+
+	TotalMessages      int64
+	ImportableMessages int64
+	DuplicateMessages  int64
+	FailedMessages     int64
+	Failures           []RestoreDryRunFailure
+
+	// EncryptedMessages lists the messages which cannot be restored as parts of them are still encrypted.
+	EncryptedMessages []string
+
+	// Addresses maps the email of each account address to the number of messages which would be restored into it.
+	Addresses map[string]int64
+}
+
+// runDryRun resolves the label mapping and prepares every message for import, without creating labels or importing
+// messages.
+func (r *RestoreTask) runDryRun(messageInfoList []messageInfo, reporter Reporter) error {
+	// The labels created by an interrupted restore would be reused.
+	var knownMapping map[string]string
+	if header, err := r.readJournalHeader(); err != nil {
+		r.log.WithError(err).Warn("Failed to read restore journal")
+	} else if header != nil && header.UserID == r.session.GetUser().ID {
+		knownMapping = header.LabelMapping
+	}
+
+	plans, err := r.planLabels(knownMapping)
+	if err != nil {
+		return err
+	}
+
+	r.labelMapping = dryRunLabelMapping(plans)
+	var importLabelName string
+	if r.importLabel.Mode != RestoreImportLabelNone {
+		r.importLabelID = dryRunLabelPrefix + "import"
+		importLabelName = r.importLabel.importLabelName(r.startTime)
+	}
+
+	report := &RestoreDryRunReport{
+		ImportLabelName: importLabelName,
+		Labels:          plans,
+		TotalMessages:   int64(len(messageInfoList)),
+		Addresses:       make(map[string]int64),
+	}
+
+	if err := r.initRemoteIndex(); err != nil {
+		return err
+	}
+
+	errReporter := newRestoreErrReporter(r)
+
+	if err := r.withAddrKRs(func(resolver *restoreAddressResolver, _ map[string]*crypto.KeyRing) error {
+		parseStage := r.startReadAndParse(messageInfoList, resolver, reporter, errReporter)
+
+		// The messages which could be imported are counted instead.
+		r.group.Once(func(ctx context.Context) {
+			for items := range parseStage.outputCh {
+				for _, item := range items {
+					report.Addresses[resolver.email(item.req.Metadata.AddressID)]++
+				}
+
+				report.ImportableMessages += int64(len(items))
+				reporter.OnProgress(len(items))
+			}
+		})
+
+		r.group.WaitToFinish()
+
+		return errReporter.err(r.ctx)
+	}); err != nil {
+		return err
+	}
+
+	report.Failures = errReporter.getFailures()
+	report.FailedMessages = int64(len(report.Failures))
+	report.DuplicateMessages = r.GetDuplicateCount()
+	report.EncryptedMessages = r.encryptedMessageIDs
+	r.dryRunReport = report
+
+	return nil
+}
+
+// dryRunLabelMapping maps the labels of the backup to their remote ID, or to a placeholder ID for the labels the
+// restore would create.
+func dryRunLabelMapping(plans []RestoreLabelPlan) map[string]string {
+	mapping := make(map[string]string, len(plans))
+
+	for _, plan := range plans {
+		switch plan.Action {
+		case RestoreLabelActionSystem, RestoreLabelActionExisting:
+			mapping[plan.BackupID] = plan.RemoteID
+		case RestoreLabelActionCreate, RestoreLabelActionRename:
+			mapping[plan.BackupID] = dryRunLabelPrefix + plan.BackupID
+		case RestoreLabelActionDrop:
+			mapping[plan.BackupID] = ""
+		}
+	}
+
+	return mapping
+}
+
+func (r *RestoreDryRunReport) ToJSON() ([]byte, error) {
+	return utils.GenerateVersionedJSON(RestoreDryRunReportVersion, r)
+}
+
+func (r *RestoreDryRunReport) ToText() string {
+	var buffer bytes.Buffer
+
+	w := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Restore Dry-Run\n")
+	if len(r.ImportLabelName) != 0 {
+		fmt.Fprintf(w, "  Import label:\t%v\n", r.ImportLabelName)
+	} else {
+		fmt.Fprintf(w, "  Import label:\tnone\n")
+	}
+	fmt.Fprintf(w, "  Total messages:\t%v\n", r.TotalMessages)
+	fmt.Fprintf(w, "  Importable messages:\t%v\n", r.ImportableMessages)
+	fmt.Fprintf(w, "  Already on the account:\t%v\n", r.DuplicateMessages)
+	fmt.Fprintf(w, "  Failing messages:\t%v\n", r.FailedMessages)
+	fmt.Fprintf(w, "  Still encrypted messages:\t%v\n", len(r.EncryptedMessages))
+
+	var changes []RestoreLabelPlan
+	for _, plan := range r.Labels {
+		if plan.Action == RestoreLabelActionCreate || plan.Action == RestoreLabelActionRename {
+			changes = append(changes, plan)
+		}
+	}
+
+	if len(changes) != 0 {
+		fmt.Fprintf(w, "Labels to create\n")
+		for _, plan := range changes {
+			if plan.Action == RestoreLabelActionRename {
+				fmt.Fprintf(w, "  %v:\trenamed to '%v'\n", plan.Name, plan.NewName)
+			} else {
+				fmt.Fprintf(w, "  %v:\tcreated\n", plan.Name)
+			}
+		}
+	}
+
+	var dropped []string
+	for _, plan := range r.Labels {
+		if plan.Action == RestoreLabelActionDrop {
+			dropped = append(dropped, plan.Name)
+		}
+	}
+
+	if len(dropped) != 0 {
+		fmt.Fprintf(w, "Labels to drop\n")
+		for _, name := range dropped {
+			fmt.Fprintf(w, "  %v\n", name)
+		}
+	}
+
+	if len(r.Addresses) != 0 {
+		fmt.Fprintf(w, "Target addresses\n")
+		emails := maps.Keys(r.Addresses)
+		slices.Sort(emails)
+
+		for _, email := range emails {
+			fmt.Fprintf(w, "  %v:\t%v\n", email, r.Addresses[email])
+		}
+	}
+
+	if len(r.EncryptedMessages) != 0 {
+		fmt.Fprintf(w, "Still encrypted messages\n")
+		for _, messageID := range r.EncryptedMessages {
+			fmt.Fprintf(w, "  %v\n", messageID)
+		}
+	}
+
+	if len(r.Failures) != 0 {
+		fmt.Fprintf(w, "Failing messages\n")
+		for _, failure := range r.Failures {
+			fmt.Fprintf(w, "  %v:\t%v\n", failure.MessageID, failure.Reason)
+		}
+	}
+
+	_ = w.Flush()
+
+	return buffer.String()
+}
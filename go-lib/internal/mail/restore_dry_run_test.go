@@ -0,0 +1,96 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunLabelMapping(t *testing.T) {
+	plans := []RestoreLabelPlan{
+		{BackupID: proton.InboxLabel, Action: RestoreLabelActionSystem, RemoteID: proton.InboxLabel},
+		{BackupID: "a", Action: RestoreLabelActionExisting, RemoteID: "remote-a"},
+		{BackupID: "b", Action: RestoreLabelActionCreate},
+		{BackupID: "c", Action: RestoreLabelActionRename, NewName: "C 1"},
+	}
+
+	require.Equal(t, map[string]string{
+		proton.InboxLabel: proton.InboxLabel,
+		"a":               "remote-a",
+		"b":               dryRunLabelPrefix + "b",
+		"c":               dryRunLabelPrefix + "c",
+	}, dryRunLabelMapping(plans))
+}
+
+func TestRestoreTask_PrepareImportRequest(t *testing.T) {
+	r := &RestoreTask{
+		labelMapping:  map[string]string{"a": "remote-a"},
+		importLabelID: "import",
+	}
+
+	literal := []byte("From: a@b.c\r\nTo: d@e.f\r\nSubject: hi\r\nContent-Type: text/plain\r\n\r\nbody\r\n")
+
+	req, err := r.prepareImportRequest("addr", Message{
+		literal:  literal,
+		metadata: proton.MessageMetadata{ID: "1", LabelIDs: []string{proton.AllMailLabel, "a"}, Unread: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "addr", req.Metadata.AddressID)
+	require.Equal(t, []string{"import", "remote-a"}, req.Metadata.LabelIDs)
+	require.True(t, bool(req.Metadata.Unread))
+
+	_, err = r.prepareImportRequest("addr", Message{
+		literal:  literal,
+		metadata: proton.MessageMetadata{ID: "2", LabelIDs: []string{"unknown"}},
+	})
+	require.Error(t, err)
+}
+
+func TestRestoreDryRunReport(t *testing.T) {
+	report := &RestoreDryRunReport{
+		ImportLabelName: "Import 2024-01-01 00:00:00",
+		Labels: []RestoreLabelPlan{
+			{BackupID: "a", Name: "Existing", Action: RestoreLabelActionExisting, RemoteID: "remote-a"},
+			{BackupID: "b", Name: "New", Action: RestoreLabelActionCreate},
+			{BackupID: "c", Name: "Taken", Action: RestoreLabelActionRename, NewName: "Taken 1"},
+		},
+		TotalMessages:      3,
+		ImportableMessages: 2,
+		FailedMessages:     1,
+		Failures:           []RestoreDryRunFailure{{MessageID: "msg", Reason: "failed to parse literal"}},
+	}
+
+	text := report.ToText()
+	require.Contains(t, text, "Import 2024-01-01 00:00:00")
+	require.Contains(t, text, "New:")
+	require.Contains(t, text, "renamed to 'Taken 1'")
+	require.Contains(t, text, "msg:")
+	require.NotContains(t, text, "Existing")
+
+	data, err := report.ToJSON()
+	require.NoError(t, err)
+
+	decoded, err := utils.NewVersionedJSON[RestoreDryRunReport](RestoreDryRunReportVersion, data)
+	require.NoError(t, err)
+	require.Equal(t, report.Failures, decoded.Payload.Failures)
+	require.Equal(t, RestoreLabelActionRename, decoded.Payload.Labels[2].Action)
+}
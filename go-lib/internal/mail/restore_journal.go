@@ -0,0 +1,295 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+)
+
+const RestoreJournalVersion = 1
+
+// RestoreJournalDirName is the name of the folder of the user cache holding the journals of the restored folders which
+// are read-only.
+const RestoreJournalDirName = "restore_journals"
+
+// RestoreJournalScope describes which messages a restore imports and where to. The restores of a folder with another
+// scope, e.g. another filter, keep their own journal so that they don't skip messages they have not imported.
+type RestoreJournalScope struct {
+	SourcePath     string `json:",omitempty"` // Only set for the journals kept outside of the restored folder.
+	SourceFormat   RestoreSourceFormat
+	Filter         *Filter           `json:",omitempty"`
+	BackupFolders  []string          `json:",omitempty"`
+	TargetAddress  string            `json:",omitempty"`
+	AddressMapping map[string]string `json:",omitempty"`
+}
+
+// key identifies the journal of the scope.
+func (s RestoreJournalScope) key() string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		// The scope only holds plain values, this cannot happen.
+		panic(err)
+	}
+
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+type restoreJournalHeader struct {
+	Scope         RestoreJournalScope
+	UserID        string
+	ImportLabelID string
+	LabelMapping  map[string]string
+}
+
+// RestoreJournal records the progress of a restore, so that an interrupted restore can be resumed into the same
+// account. The journal is kept in the restored folder and named after the scope of the restore. The import label and
+// the label mapping are stored in a json file, while the IDs of the imported messages are appended to a log file as
+// they are imported.
+type RestoreJournal struct {
+	lock       sync.Mutex
+	journalDir string
+	key        string
+	header     restoreJournalHeader
+	imported   map[string]struct{}
+	log        *os.File
+}
+
+// OpenRestoreJournal loads from journalDir the journal of a previous restore with the same scope into the account of
+// userID. The journal is reset if it was written for another account.
+func OpenRestoreJournal(journalDir string, scope RestoreJournalScope, userID string) (*RestoreJournal, error) {
+	if err := os.MkdirAll(journalDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create restore journal folder: %w", err)
+	}
+
+	j := &RestoreJournal{
+		journalDir: journalDir,
+		key:        scope.key(),
+		header:     restoreJournalHeader{Scope: scope, UserID: userID, LabelMapping: make(map[string]string)},
+		imported:   make(map[string]struct{}),
+	}
+
+	header, err := readRestoreJournalHeader(journalDir, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if header != nil && header.UserID == userID {
+		j.header = *header
+		if j.header.LabelMapping == nil {
+			j.header.LabelMapping = make(map[string]string)
+		}
+
+		if err := j.readImported(); err != nil {
+			return nil, err
+		}
+	} else if err := j.Remove(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(j.logPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to open restore journal: %w", err)
+	}
+
+	j.log = file
+
+	return j, nil
+}
+
+// IsResumed returns true if the journal contains the progress of a previous restore.
+func (j *RestoreJournal) IsResumed() bool {
+	return len(j.header.ImportLabelID) != 0 || len(j.imported) != 0
+}
+
+func (j *RestoreJournal) ImportLabelID() string {
+	return j.header.ImportLabelID
+}
+
+func (j *RestoreJournal) LabelMapping() map[string]string {
+	return j.header.LabelMapping
+}
+
+func (j *RestoreJournal) ImportedCount() int {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return len(j.imported)
+}
+
+func (j *RestoreJournal) IsImported(messageID string) bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	_, ok := j.imported[messageID]
+	return ok
+}
+
+// SetLabels stores the import label and the label mapping of the restore.
+func (j *RestoreJournal) SetLabels(importLabelID string, labelMapping map[string]string) error {
+	j.header.ImportLabelID = importLabelID
+	j.header.LabelMapping = labelMapping
+
+	data, err := utils.GenerateVersionedJSON(RestoreJournalVersion, j.header)
+	if err != nil {
+		return fmt.Errorf("failed to json encode restore journal: %w", err)
+	}
+
+	return utils.WriteFileSafe(j.journalDir, j.headerPath(), data, &utils.Sha256IntegrityChecker{})
+}
+
+// AddImported records that the given messages of the backup have been imported.
+func (j *RestoreJournal) AddImported(messageIDs ...string) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	var builder strings.Builder
+	for _, id := range messageIDs {
+		j.imported[id] = struct{}{}
+		builder.WriteString(id)
+		builder.WriteByte('\n')
+	}
+
+	if _, err := j.log.WriteString(builder.String()); err != nil {
+		return fmt.Errorf("failed to write restore journal: %w", err)
+	}
+
+	return j.log.Sync()
+}
+
+func (j *RestoreJournal) Close() error {
+	if j.log == nil {
+		return nil
+	}
+
+	err := j.log.Close()
+	j.log = nil
+
+	return err
+}
+
+// Remove deletes the journal files, e.g. once the restore has completed.
+func (j *RestoreJournal) Remove() error {
+	if err := j.Close(); err != nil {
+		return err
+	}
+
+	for _, path := range []string{j.headerPath(), j.logPath()} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove restore journal: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (j *RestoreJournal) readImported() error {
+	file, err := os.Open(j.logPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to read restore journal: %w", err)
+	}
+	defer file.Close() //nolint:errcheck
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// An incomplete last line is ignored, the message will be found by the deduplication.
+		if id := strings.TrimSpace(scanner.Text()); len(id) != 0 {
+			j.imported[id] = struct{}{}
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (j *RestoreJournal) headerPath() string {
+	return filepath.Join(j.journalDir, getRestoreJournalFileName(j.key))
+}
+
+func (j *RestoreJournal) logPath() string {
+	return filepath.Join(j.journalDir, getRestoreJournalLogFileName(j.key))
+}
+
+// readRestoreJournalHeader returns the header of the journal of scope in journalDir, nil if there is none.
+func readRestoreJournalHeader(journalDir string, scope RestoreJournalScope) (*restoreJournalHeader, error) {
+	b, err := os.ReadFile(filepath.Join(journalDir, getRestoreJournalFileName(scope.key()))) //nolint:gosec
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil //nolint:nilnil
+		}
+
+		return nil, fmt.Errorf("failed to read restore journal: %w", err)
+	}
+
+	v, err := utils.NewVersionedJSON[restoreJournalHeader](RestoreJournalVersion, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse restore journal: %w", err)
+	}
+
+	// A journal with the same name but another scope is not reused.
+	if v.Payload.Scope.key() != scope.key() {
+		return nil, nil //nolint:nilnil
+	}
+
+	return &v.Payload, nil
+}
+
+// FallbackRestoreJournalDir returns the folder where the journals of the restored folders which are read-only are
+// kept, in the cache folder of the user.
+func FallbackRestoreJournalDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cacheDir, "proton-mail-export", RestoreJournalDirName), nil
+}
+
+// isReadOnlyError returns true if err was caused by a folder which cannot be written to.
+func isReadOnlyError(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
+
+func getRestoreJournalFileName(key string) string {
+	return "restore_journal_" + key + ".json"
+}
+
+func getRestoreJournalLogFileName(key string) string {
+	return "restore_journal_" + key + ".log"
+}
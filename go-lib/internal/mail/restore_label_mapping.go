@@ -0,0 +1,327 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"golang.org/x/exp/slices"
+)
+
+const RestoreLabelMappingVersion = 1
+
+const labelMappingTemplateFileName = "label_mapping.json"
+
+var ErrInvalidLabelMapping = errors.New("invalid label mapping")
+
+// RestoreLabelMappingAction is what the user wants to happen to a backup label during a restore.
+type RestoreLabelMappingAction string
+
+const (
+	// RestoreLabelMappingAuto maps the label as if it was not in the mapping file.
+	RestoreLabelMappingAuto RestoreLabelMappingAction = "auto"
+	// RestoreLabelMappingMap maps the label to the existing remote label or folder whose path, name or ID is Target.
+	RestoreLabelMappingMap RestoreLabelMappingAction = "map"
+	// RestoreLabelMappingCreate creates the label, named Target if set. A label or folder of the same type already at
+	// this path, e.g. created by a previous restore, is used instead.
+	RestoreLabelMappingCreate RestoreLabelMappingAction = "create"
+	// RestoreLabelMappingDrop restores the messages without the label.
+	RestoreLabelMappingDrop RestoreLabelMappingAction = "drop"
+)
+
+// RestoreLabelMappingEntry is an entry of the label mapping file. The backup label is identified by its ID or, if the
+// ID is empty, by its path.
+type RestoreLabelMappingEntry struct {
+	BackupID   string
+	BackupPath string
+	Type       string `json:",omitempty"` // Informative only.
+	Action     RestoreLabelMappingAction
+	Target     string `json:",omitempty"`
+}
+
+// SetLabelMappingFile sets the label mapping file applied by the restore. Must be called before Run.
+func (r *RestoreTask) SetLabelMappingFile(path string) {
+	r.labelMappingFile = path
+}
+
+// WriteLabelMappingTemplate writes a label mapping file describing how the labels of the backup would be restored into
+// the account, for the user to edit. The file is written to path, or to the backup folder if path is empty. Returns
+// the path of the written file.
+func (r *RestoreTask) WriteLabelMappingTemplate(path string) (string, error) {
+	if _, err := r.openSource(NullProgressReporter{}); err != nil {
+		return "", err
+	}
+
+	remoteLabels, err := r.getRemoteLabels()
+	if err != nil {
+		return "", err
+	}
+
+	plans, err := r.planLabelsWithRemote(nil, nil, remoteLabels)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := utils.GenerateVersionedJSON(RestoreLabelMappingVersion, labelMappingTemplate(plans, remoteLabels))
+	if err != nil {
+		return "", err
+	}
+
+	if len(path) == 0 {
+		path = filepath.Join(r.backupDir, labelMappingTemplateFileName)
+	}
+
+	if err := utils.WriteFileSafe(filepath.Dir(path), path, data, &utils.Sha256IntegrityChecker{}); err != nil {
+		return "", err
+	}
+
+	r.log.WithField("path", path).Info("Label mapping template written")
+
+	return path, nil
+}
+
+func LoadRestoreLabelMapping(path string) ([]RestoreLabelMappingEntry, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to read label mapping file: %w", err)
+	}
+
+	versioned, err := utils.NewVersionedJSON[[]RestoreLabelMappingEntry](RestoreLabelMappingVersion, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLabelMapping, err)
+	}
+
+	return versioned.Payload, nil
+}
+
+// labelMappingTemplate returns the mapping file entries matching the plan of every backup label.
+func labelMappingTemplate(plans []RestoreLabelPlan, remoteLabels []proton.Label) []RestoreLabelMappingEntry {
+	entries := make([]RestoreLabelMappingEntry, 0, len(plans))
+
+	for _, plan := range plans {
+		entry := RestoreLabelMappingEntry{
+			BackupID:   plan.BackupID,
+			BackupPath: labelPath(plan.Label),
+			Type:       labelTypeName(plan.Type),
+		}
+
+		switch plan.Action {
+		case RestoreLabelActionSystem, RestoreLabelActionExisting:
+			entry.Action = RestoreLabelMappingMap
+			entry.Target = plan.RemoteID
+
+			if index := slices.IndexFunc(remoteLabels, func(label proton.Label) bool { return label.ID == plan.RemoteID }); index != -1 {
+				entry.Target = labelPath(remoteLabels[index])
+			}
+		case RestoreLabelActionCreate:
+			entry.Action = RestoreLabelMappingCreate
+			entry.Target = plan.Name
+		case RestoreLabelActionRename:
+			entry.Action = RestoreLabelMappingCreate
+			entry.Target = plan.NewName
+		case RestoreLabelActionDrop:
+			entry.Action = RestoreLabelMappingDrop
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// resolveLabelMapping matches the entries of the mapping file with the backup labels and checks that they can be
+// applied to the account. All the problems found are reported at once.
+func resolveLabelMapping(
+	entries []RestoreLabelMappingEntry,
+	backupLabels []proton.Label,
+	remoteLabels []proton.Label,
+) (map[string]RestoreLabelMappingEntry, error) {
+	result := make(map[string]RestoreLabelMappingEntry, len(entries))
+
+	var errs []error
+
+	for i, entry := range entries {
+		index := slices.IndexFunc(backupLabels, func(label proton.Label) bool {
+			if len(entry.BackupID) != 0 {
+				return label.ID == entry.BackupID
+			}
+
+			return strings.EqualFold(labelPath(label), entry.BackupPath)
+		})
+
+		if index == -1 {
+			errs = append(errs, fmt.Errorf("entry %v: no backup label matches '%v'", i+1, entryName(entry)))
+			continue
+		}
+
+		backupID := backupLabels[index].ID
+		if _, ok := result[backupID]; ok {
+			errs = append(errs, fmt.Errorf("entry %v: label '%v' is mapped more than once", i+1, entryName(entry)))
+			continue
+		}
+
+		switch entry.Action {
+		case RestoreLabelMappingAuto, RestoreLabelMappingDrop:
+		case RestoreLabelMappingMap:
+			if _, ok := findRemoteLabel(entry.Target, remoteLabels); !ok {
+				errs = append(errs, fmt.Errorf("entry %v: the account has no label or folder '%v'", i+1, entry.Target))
+				continue
+			}
+		case RestoreLabelMappingCreate:
+			path := createTargetPath(backupLabels[index], entry.Target)
+
+			if remoteLabel, ok := findRemoteLabelByPath(path, remoteLabels); ok && remoteLabel.Type != backupLabels[index].Type {
+				errs = append(errs, fmt.Errorf("entry %v: the account already has a label or folder named '%v'", i+1, path))
+				continue
+			}
+		default:
+			errs = append(errs, fmt.Errorf("entry %v: unknown action '%v', expected auto, map, create or drop", i+1, entry.Action))
+			continue
+		}
+
+		result[backupID] = entry
+	}
+
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLabelMapping, errors.Join(errs...))
+	}
+
+	return result, nil
+}
+
+// applyLabelMapping changes the plan of a backup label according to its entry of the mapping file.
+func applyLabelMapping(plan *RestoreLabelPlan, entry RestoreLabelMappingEntry, remoteLabels []proton.Label) {
+	if entry.Action == RestoreLabelMappingAuto {
+		return
+	}
+
+	plan.RemoteID = ""
+	plan.NewName = ""
+
+	switch entry.Action {
+	case RestoreLabelMappingAuto:
+	case RestoreLabelMappingMap:
+		remoteLabel, _ := findRemoteLabel(entry.Target, remoteLabels)
+
+		plan.Action = RestoreLabelActionExisting
+		if isSystemLabel(remoteLabel.ID) {
+			plan.Action = RestoreLabelActionSystem
+		}
+
+		plan.RemoteID = remoteLabel.ID
+	case RestoreLabelMappingCreate:
+		// The label was already created, e.g. by a previous run with the same mapping file.
+		if remoteLabel, ok := findRemoteLabelByPath(createTargetPath(plan.Label, entry.Target), remoteLabels); ok {
+			plan.Action = RestoreLabelActionExisting
+			plan.RemoteID = remoteLabel.ID
+
+			return
+		}
+
+		plan.Action = RestoreLabelActionCreate
+		if len(entry.Target) != 0 && entry.Target != plan.Name {
+			plan.Action = RestoreLabelActionRename
+			plan.NewName = entry.Target
+		}
+	case RestoreLabelMappingDrop:
+		plan.Action = RestoreLabelActionDrop
+	}
+}
+
+// findRemoteLabel finds the label of the account with the given ID, path or name, in that order.
+func findRemoteLabel(target string, remoteLabels []proton.Label) (proton.Label, bool) {
+	if len(target) == 0 {
+		return proton.Label{}, false
+	}
+
+	matchers := []func(label proton.Label) bool{
+		func(label proton.Label) bool { return label.ID == target },
+		func(label proton.Label) bool { return strings.EqualFold(labelPath(label), target) },
+		func(label proton.Label) bool { return strings.EqualFold(label.Name, target) },
+	}
+
+	for _, matcher := range matchers {
+		if index := slices.IndexFunc(remoteLabels, matcher); index != -1 {
+			return remoteLabels[index], true
+		}
+	}
+
+	return proton.Label{}, false
+}
+
+// findRemoteLabelByPath finds the label of the account with the given full path.
+func findRemoteLabelByPath(path string, remoteLabels []proton.Label) (proton.Label, bool) {
+	index := slices.IndexFunc(remoteLabels, func(label proton.Label) bool { return strings.EqualFold(labelPath(label), path) })
+	if index == -1 {
+		return proton.Label{}, false
+	}
+
+	return remoteLabels[index], true
+}
+
+// createTargetPath returns the full path of the label created for a backup label by a create entry named name, under
+// the same parent folder as in the backup.
+func createTargetPath(label proton.Label, name string) string {
+	if len(name) == 0 {
+		name = label.Name
+	}
+
+	if len(label.Path) < 2 {
+		return name
+	}
+
+	return strings.Join(append(slices.Clone(label.Path[:len(label.Path)-1]), name), "/")
+}
+
+// labelPath returns the full path of a folder, or the name of a label.
+func labelPath(label proton.Label) string {
+	if len(label.Path) != 0 {
+		return strings.Join(label.Path, "/")
+	}
+
+	return label.Name
+}
+
+func labelTypeName(labelType proton.LabelType) string {
+	switch labelType {
+	case proton.LabelTypeFolder:
+		return "folder"
+	case proton.LabelTypeLabel:
+		return "label"
+	case proton.LabelTypeSystem:
+		return "system"
+	case proton.LabelTypeContactGroup:
+		return "contact group"
+	default:
+		return ""
+	}
+}
+
+func entryName(entry RestoreLabelMappingEntry) string {
+	if len(entry.BackupID) != 0 {
+		return entry.BackupID
+	}
+
+	return entry.BackupPath
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+type testLabelSource struct {
+	backupLabels []proton.Label
+}
+
+func (s testLabelSource) labels() ([]proton.Label, error) {
+	return s.backupLabels, nil
+}
+
+func (s testLabelSource) loadMessage(_ string) (Message, error) {
+	return Message{}, os.ErrNotExist
+}
+
+func TestRestoreLabelMapping(t *testing.T) {
+	backupLabels := []proton.Label{
+		{ID: proton.InboxLabel, Name: "Inbox", Type: proton.LabelTypeSystem},
+		{ID: "work", Name: "Work", Path: []string{"Work"}, Type: proton.LabelTypeFolder},
+		{ID: "projects", ParentID: "work", Name: "Projects", Path: []string{"Work", "Projects"}, Type: proton.LabelTypeFolder},
+		{ID: "travel", Name: "Travel", Type: proton.LabelTypeLabel},
+		{ID: "news", Name: "News", Type: proton.LabelTypeLabel},
+	}
+	remoteLabels := []proton.Label{
+		{ID: proton.InboxLabel, Name: "Inbox", Type: proton.LabelTypeSystem},
+		{ID: proton.ArchiveLabel, Name: "Archive", Type: proton.LabelTypeSystem},
+		{ID: "remote-jobs", Name: "Jobs", Path: []string{"Jobs"}, Type: proton.LabelTypeFolder},
+		{ID: "remote-travel", Name: "Travel", Type: proton.LabelTypeLabel},
+	}
+
+	task := &RestoreTask{source: testLabelSource{backupLabels: backupLabels}}
+
+	// Without mapping file.
+	plans, err := task.planLabelsWithRemote(nil, nil, remoteLabels)
+	require.NoError(t, err)
+
+	template := labelMappingTemplate(plans, remoteLabels)
+	require.Equal(t, []RestoreLabelMappingEntry{
+		{BackupID: proton.InboxLabel, BackupPath: "Inbox", Type: "system", Action: RestoreLabelMappingMap, Target: "Inbox"},
+		{BackupID: "work", BackupPath: "Work", Type: "folder", Action: RestoreLabelMappingCreate, Target: "Work"},
+		{BackupID: "projects", BackupPath: "Work/Projects", Type: "folder", Action: RestoreLabelMappingCreate, Target: "Projects"},
+		{BackupID: "travel", BackupPath: "Travel", Type: "label", Action: RestoreLabelMappingMap, Target: "Travel"},
+		{BackupID: "news", BackupPath: "News", Type: "label", Action: RestoreLabelMappingCreate, Target: "News"},
+	}, template)
+
+	// The template applies cleanly.
+	_, err = task.planLabelsWithRemote(nil, template, remoteLabels)
+	require.NoError(t, err)
+
+	// Reorganized account.
+	plans, err = task.planLabelsWithRemote(nil, []RestoreLabelMappingEntry{
+		{BackupID: proton.InboxLabel, Action: RestoreLabelMappingMap, Target: proton.ArchiveLabel},
+		{BackupPath: "work", Action: RestoreLabelMappingMap, Target: "jobs"},
+		{BackupID: "travel", Action: RestoreLabelMappingDrop},
+		{BackupID: "news", Action: RestoreLabelMappingCreate, Target: "Newsletters"},
+		{BackupID: "projects", Action: RestoreLabelMappingAuto},
+	}, remoteLabels)
+	require.NoError(t, err)
+
+	byID := make(map[string]RestoreLabelPlan)
+	for _, plan := range plans {
+		byID[plan.BackupID] = plan
+	}
+
+	require.Equal(t, RestoreLabelActionSystem, byID[proton.InboxLabel].Action)
+	require.Equal(t, proton.ArchiveLabel, byID[proton.InboxLabel].RemoteID)
+	require.Equal(t, RestoreLabelActionExisting, byID["work"].Action)
+	require.Equal(t, "remote-jobs", byID["work"].RemoteID)
+	require.Equal(t, RestoreLabelActionDrop, byID["travel"].Action)
+	require.Equal(t, RestoreLabelActionRename, byID["news"].Action)
+	require.Equal(t, "Newsletters", byID["news"].NewName)
+	require.Equal(t, RestoreLabelActionCreate, byID["projects"].Action)
+
+	// A rerun with the same mapping file uses the labels created by the first run. A folder of the same name under
+	// another parent is not a match.
+	rerunLabels := append(slices.Clone(remoteLabels),
+		proton.Label{ID: "remote-work", Name: "Work", Path: []string{"Work"}, Type: proton.LabelTypeFolder},
+		proton.Label{ID: "remote-jobs-projects", ParentID: "remote-jobs", Name: "Projects", Path: []string{"Jobs", "Projects"}, Type: proton.LabelTypeFolder},
+		proton.Label{ID: "remote-news", Name: "News", Type: proton.LabelTypeLabel},
+	)
+
+	plans, err = task.planLabelsWithRemote(nil, template, rerunLabels)
+	require.NoError(t, err)
+
+	byID = make(map[string]RestoreLabelPlan)
+	for _, plan := range plans {
+		byID[plan.BackupID] = plan
+	}
+
+	require.Equal(t, RestoreLabelActionExisting, byID["work"].Action)
+	require.Equal(t, "remote-work", byID["work"].RemoteID)
+	require.Equal(t, RestoreLabelActionCreate, byID["projects"].Action)
+	require.Equal(t, RestoreLabelActionExisting, byID["news"].Action)
+	require.Equal(t, "remote-news", byID["news"].RemoteID)
+
+	// Every problem is reported.
+	_, err = task.planLabelsWithRemote(nil, []RestoreLabelMappingEntry{
+		{BackupID: "unknown", Action: RestoreLabelMappingDrop},
+		{BackupID: "work", Action: RestoreLabelMappingMap, Target: "Nowhere"},
+		{BackupID: "news", Action: RestoreLabelMappingCreate, Target: "jobs"},
+		{BackupID: "travel", Action: "move"},
+		{BackupID: "projects", Action: RestoreLabelMappingDrop},
+		{BackupPath: "Work/Projects", Action: RestoreLabelMappingDrop},
+	}, remoteLabels)
+	require.ErrorIs(t, err, ErrInvalidLabelMapping)
+	require.ErrorContains(t, err, "entry 1: no backup label matches 'unknown'")
+	require.ErrorContains(t, err, "entry 2: the account has no label or folder 'Nowhere'")
+	require.ErrorContains(t, err, "entry 3: the account already has a label or folder named 'jobs'")
+	require.ErrorContains(t, err, "entry 4: unknown action 'move'")
+	require.ErrorContains(t, err, "entry 6: label 'Work/Projects' is mapped more than once")
+}
+
+func TestLoadRestoreLabelMapping(t *testing.T) {
+	entries := []RestoreLabelMappingEntry{{BackupID: "work", BackupPath: "Work", Action: RestoreLabelMappingDrop}}
+
+	data, err := utils.GenerateVersionedJSON(RestoreLabelMappingVersion, entries)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), labelMappingTemplateFileName)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	loaded, err := LoadRestoreLabelMapping(path)
+	require.NoError(t, err)
+	require.Equal(t, entries, loaded)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"Version": 2, "Payload": []}`), 0o600))
+	_, err = LoadRestoreLabelMapping(path)
+	require.ErrorIs(t, err, ErrInvalidLabelMapping)
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ProtonMail/export-tool/internal/metrics"
+	"github.com/ProtonMail/go-proton-api"
+)
+
+const NumParallelRestoreReaders = 4
+const NumParallelRestoreParsers = 4
+const DefaultParallelImports = 4
+const MaxRestoreMemMB = 256 * MB
+
+// restoreReadChunkSize is the maximum number of messages read from the backup at once.
+const restoreReadChunkSize = 50
+
+type RestoreStageName string
+
+const (
+	RestoreStageRead   RestoreStageName = "restore_read"
+	RestoreStageParse  RestoreStageName = "restore_parse"
+	RestoreStageImport RestoreStageName = "restore_import"
+)
+
+// startReadAndParse starts the stages reading and parsing the messages of the backup. The import requests are
+// available on the output channel of the returned stage.
+func (r *RestoreTask) startReadAndParse(
+	messageInfoList []messageInfo,
+	resolver *restoreAddressResolver,
+	reporter Reporter,
+	errReporter *restoreErrReporter,
+) *RestoreParseStage {
+	stageMetrics := r.session.GetMetrics()
+
+	readStage := NewRestoreReadStage(
+		r.source.loadMessage,
+		NumParallelRestoreReaders,
+		r.log,
+		MaxRestoreMemMB,
+		r.session.GetPanicHandler(),
+		reporter,
+		r,
+		r.pause,
+		stageMetrics,
+	)
+
+	parseStage := NewRestoreParseStage(
+		NumParallelRestoreParsers,
+		r.log,
+		r.session.GetPanicHandler(),
+		reporter,
+		func(message Message) (proton.ImportReq, error) {
+			return r.prepareImportRequest(resolver.resolve(message.metadata), message)
+		},
+		r.pause,
+		stageMetrics,
+	)
+
+	r.group.Once(func(ctx context.Context) {
+		readStage.Run(ctx, messageInfoList, errReporter)
+	})
+	r.group.Once(func(ctx context.Context) {
+		parseStage.Run(ctx, readStage.outputCh, errReporter)
+	})
+
+	return parseStage
+}
+
+func (r *RestoreTask) skipMessageID(messageID string) bool {
+	if r.journal == nil || !r.journal.IsImported(messageID) {
+		return false
+	}
+
+	r.duplicateCount.Add(1)
+
+	return true
+}
+
+func (r *RestoreTask) skipMessage(message Message) bool {
+	if r.remoteIndex == nil || !r.remoteIndex.contains(message) {
+		return false
+	}
+
+	r.log.WithField("messageID", message.metadata.ID).Debug("Message is already present on the account. Skipping.")
+	r.duplicateCount.Add(1)
+
+	return true
+}
+
+func (r *RestoreTask) onImported(messageIDs ...string) {
+	r.importedCount.Add(int64(len(messageIDs)))
+	r.journalImported(messageIDs...)
+}
+
+// restoreErrReporter counts the messages which fail to restore and cancels the restore on stage errors.
+type restoreErrReporter struct {
+	task     *RestoreTask
+	lock     sync.Mutex
+	errors   []error
+	failures []RestoreDryRunFailure
+	metrics  *metrics.Metrics
+}
+
+func newRestoreErrReporter(task *RestoreTask) *restoreErrReporter {
+	return &restoreErrReporter{task: task, metrics: task.session.GetMetrics()}
+}
+
+// ReportMessageError always lets the restore carry on with the other messages.
+func (e *restoreErrReporter) ReportMessageError(msgID string, stage FailureStage, err error) bool {
+	e.task.failedCount.Add(1)
+	e.metrics.MessageFailed(string(stage))
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.failures = append(e.failures, RestoreDryRunFailure{MessageID: msgID, Reason: err.Error()})
+
+	return true
+}
+
+func (e *restoreErrReporter) ReportStageError(err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if len(e.errors) == 0 {
+		e.task.log.Debug("Cancelling context due to error")
+		e.task.group.Cancel()
+	}
+	e.errors = append(e.errors, err)
+}
+
+// err returns the first stage error, or the error of ctx if the restore was cancelled.
+func (e *restoreErrReporter) err(ctx context.Context) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if len(e.errors) == 0 {
+		return ctx.Err()
+	}
+
+	e.task.log.Error("Restore task ran into the following errors")
+	for i, err := range e.errors {
+		e.task.log.WithError(err).Errorf("Error %v", i)
+	}
+
+	return e.errors[0]
+}
+
+func (e *restoreErrReporter) getFailures() []RestoreDryRunFailure {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.failures
+}
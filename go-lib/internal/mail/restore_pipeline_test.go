@@ -0,0 +1,209 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/bradenaw/juniper/iterator"
+	"github.com/bradenaw/juniper/stream"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type testRestoreFilter struct {
+	skipIDs map[string]bool
+}
+
+func (f testRestoreFilter) skipMessageID(messageID string) bool {
+	return f.skipIDs[messageID]
+}
+
+func (f testRestoreFilter) skipMessage(message Message) bool {
+	return message.metadata.Subject == "skip"
+}
+
+func writeBackupMessage(t *testing.T, dir, id, subject string) {
+	literal := []byte("Subject: " + subject + "\r\nContent-Type: text/plain\r\n\r\nbody\r\n")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, id+emlExtension), literal, 0o600))
+
+	data, err := utils.GenerateVersionedJSON(MessageMetadataVersion, MessageMetadata{
+		MessageMetadata: proton.MessageMetadata{ID: id, Subject: subject, Size: len(literal)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(emlToMetadataFilename(filepath.Join(dir, id+emlExtension)), data, 0o600))
+}
+
+func TestRestoreReadStage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	errReporter := NewMockStageErrorReporter(mockCtrl)
+
+	dir := t.TempDir()
+	writeBackupMessage(t, dir, "1", "one")
+	writeBackupMessage(t, dir, "2", "skip")
+	writeBackupMessage(t, dir, "3", "three")
+	writeBackupMessage(t, dir, "4", "four")
+
+	errReporter.EXPECT().ReportMessageError(gomock.Eq("missing"), gomock.Eq(FailureStageRead), gomock.Any()).Return(true)
+
+	stage := NewRestoreReadStage(
+		func(messageID string) (Message, error) { return loadBackupMessage(dir, messageID) },
+		2,
+		logrus.WithField("test", "test"),
+		MaxRestoreMemMB,
+		&async.NoopPanicHandler{},
+		NullProgressReporter{},
+		testRestoreFilter{skipIDs: map[string]bool{"4": true}},
+		nil,
+		nil,
+	)
+
+	input := []messageInfo{{messageID: "1"}, {messageID: "2"}, {messageID: "missing"}, {messageID: "3"}, {messageID: "4"}}
+
+	go stage.Run(context.Background(), input, errReporter)
+
+	var ids []string
+	for messages := range stage.outputCh {
+		for _, m := range messages {
+			ids = append(ids, m.metadata.ID)
+		}
+	}
+
+	require.Equal(t, []string{"1", "3"}, ids)
+}
+
+func TestRestoreParseStage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	errReporter := NewMockStageErrorReporter(mockCtrl)
+
+	errReporter.EXPECT().ReportMessageError(gomock.Eq("2"), gomock.Eq(FailureStageParse), gomock.Any()).Return(true)
+
+	stage := NewRestoreParseStage(
+		2,
+		logrus.WithField("test", "test"),
+		&async.NoopPanicHandler{},
+		NullProgressReporter{},
+		func(m Message) (proton.ImportReq, error) {
+			if m.metadata.ID == "2" {
+				return proton.ImportReq{}, errors.New("failed to parse literal")
+			}
+
+			return proton.ImportReq{Message: m.literal}, nil
+		},
+		nil,
+		nil,
+	)
+
+	input := make(chan []Message, 1)
+	input <- []Message{{metadata: proton.MessageMetadata{ID: "1"}}, {metadata: proton.MessageMetadata{ID: "2"}}}
+	close(input)
+
+	go stage.Run(context.Background(), input, errReporter)
+
+	var ids []string
+	for items := range stage.outputCh {
+		for _, item := range items {
+			ids = append(ids, item.messageID)
+		}
+	}
+
+	require.Equal(t, []string{"1"}, ids)
+}
+
+func TestRestoreImportStage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	client := apiclient.NewMockClient(mockCtrl)
+	errReporter := NewMockStageErrorReporter(mockCtrl)
+
+	addrKRs := map[string]*crypto.KeyRing{"addr-1": {}, "addr-2": {}}
+
+	// The messages alternate between two addresses.
+	items := make([]restoreImportItem, 0, 2*messageBatchSize)
+	for i := 0; i < 2*messageBatchSize; i++ {
+		items = append(items, restoreImportItem{
+			messageID: string(rune('a' + i)),
+			req: proton.ImportReq{
+				Metadata: proton.ImportMetadata{AddressID: fmt.Sprintf("addr-%v", i%2+1)},
+				Message:  []byte{byte(i)},
+			},
+		})
+	}
+
+	client.EXPECT().ImportMessages(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, addrKR *crypto.KeyRing, _, _ int, reqs ...proton.ImportReq) (proton.ImportResStream, error) {
+			results := make([]proton.ImportRes, len(reqs))
+			for i, req := range reqs {
+				require.Equal(t, reqs[0].Metadata.AddressID, req.Metadata.AddressID)
+				require.Same(t, addrKRs[req.Metadata.AddressID], addrKR)
+
+				results[i].Code = proton.SuccessCode
+				// The first message fails.
+				if req.Message[0] == 0 {
+					results[i].Code = 2000
+				}
+			}
+
+			return stream.FromIterator(iterator.Slice(results)), nil
+		},
+	).Times(2)
+
+	errReporter.EXPECT().ReportMessageError(gomock.Eq("a"), gomock.Eq(FailureStageImport), gomock.Any()).Return(true)
+
+	var lock sync.Mutex
+	var imported []string
+
+	stage := NewRestoreImportStage(
+		client,
+		addrKRs,
+		2,
+		logrus.WithField("test", "test"),
+		&async.NoopPanicHandler{},
+		NullProgressReporter{},
+		func(ids ...string) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			imported = append(imported, ids...)
+		},
+		nil,
+		nil,
+	)
+
+	input := make(chan []restoreImportItem, 1)
+	input <- items
+	close(input)
+
+	stage.Run(context.Background(), input, errReporter)
+
+	sort.Strings(imported)
+	require.Len(t, imported, 2*messageBatchSize-1)
+	require.Equal(t, "b", imported[0])
+}
@@ -0,0 +1,522 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// RestoreSourceFormat is the layout of the folder a restore reads its messages from.
+type RestoreSourceFormat string
+
+const (
+	// RestoreSourceBackup is a backup made by this tool.
+	RestoreSourceBackup RestoreSourceFormat = "backup"
+	// RestoreSourceMbox is a folder of mbox files, e.g. a Gmail Takeout or a Thunderbird profile, or a single mbox file.
+	RestoreSourceMbox RestoreSourceFormat = "mbox"
+	// RestoreSourceMaildir is a tree of Maildir folders.
+	RestoreSourceMaildir RestoreSourceFormat = "maildir"
+	// RestoreSourceEML is a tree of folders of EML files without metadata.
+	RestoreSourceEML RestoreSourceFormat = "eml"
+)
+
+var ErrRestoreFilterUnsupported = errors.New("filters can only be applied when restoring a backup made by this tool")
+
+var ErrInvalidRestoreSourceFormat = errors.New("invalid import format, expected backup, mbox, maildir or eml")
+
+func ParseRestoreSourceFormat(value string) (RestoreSourceFormat, error) {
+	switch format := RestoreSourceFormat(strings.ToLower(strings.TrimSpace(value))); format {
+	case "":
+		return RestoreSourceBackup, nil
+	case RestoreSourceBackup, RestoreSourceMbox, RestoreSourceMaildir, RestoreSourceEML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: '%v'", ErrInvalidRestoreSourceFormat, value)
+	}
+}
+
+// restoreSource provides the labels and messages restored into the account.
+type restoreSource interface {
+	labels() ([]proton.Label, error)
+	loadMessage(messageID string) (Message, error)
+}
+
+// openSource lists the messages to restore, from a backup or from a foreign source.
+func (r *RestoreTask) openSource(reporter Reporter) ([]messageInfo, error) {
+	if r.sourceFormat == RestoreSourceBackup {
+		return r.validateBackupDir(reporter)
+	}
+
+	if r.isFiltered() {
+		return nil, ErrRestoreFilterUnsupported
+	}
+
+	r.log.WithField("format", r.sourceFormat).Info("Listing messages to import")
+
+	source, messageInfoList, err := openForeignSource(r.sourceFormat, r.backupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	r.source = source
+	r.backupDir = source.rootDir
+
+	messageCount := len(messageInfoList)
+	reporter.SetMessageTotal(uint64(messageCount))
+	reporter.SetMessageProcessed(0)
+	r.importableCount = int64(messageCount)
+	r.log.WithField("messageCount", messageCount).Info("Found importable messages")
+
+	return messageInfoList, nil
+}
+
+// backupSource reads a backup made by this tool.
+type backupSource struct {
+	backupDir string
+}
+
+func (s backupSource) labels() ([]proton.Label, error) {
+	return readBackupLabelFile(s.backupDir)
+}
+
+func (s backupSource) loadMessage(messageID string) (Message, error) {
+	return loadBackupMessage(s.backupDir, messageID)
+}
+
+// backupChainSource reads several backups made by this tool, oldest first. A label found in several backups is
+// restored as found in the most recent one.
+type backupChainSource struct {
+	backupDirs  []string
+	messageDirs map[string]string // Backup folder of each message.
+}
+
+func (s backupChainSource) labels() ([]proton.Label, error) {
+	var labels []proton.Label
+
+	for _, dir := range s.backupDirs {
+		dirLabels, err := readBackupLabelFile(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, label := range dirLabels {
+			if index := slices.IndexFunc(labels, func(l proton.Label) bool { return l.ID == label.ID }); index >= 0 {
+				labels[index] = label
+			} else {
+				labels = append(labels, label)
+			}
+		}
+	}
+
+	return labels, nil
+}
+
+func (s backupChainSource) loadMessage(messageID string) (Message, error) {
+	dir, ok := s.messageDirs[messageID]
+	if !ok {
+		return Message{}, fmt.Errorf("message %v is not part of the backups", messageID)
+	}
+
+	return loadBackupMessage(dir, messageID)
+}
+
+// foreignMessage locates a message of a foreign source.
+type foreignMessage struct {
+	path      string
+	offset    int64 // Offset of the message in an mbox file.
+	length    int64 // Length of the message in an mbox file, -1 for a whole file.
+	labelIDs  []string
+	flags     proton.MessageFlag
+	unread    bool
+	timestamp int64
+}
+
+// foreignSource holds the messages and labels found in mbox files, Maildir folders or EML files. The labels of a
+// message are derived from the folder it is stored in, or from its X-Gmail-Labels header.
+type foreignSource struct {
+	rootDir  string
+	lock     sync.Mutex
+	messages map[string]foreignMessage
+	labelMap map[string]proton.Label
+}
+
+func newForeignSource(rootDir string) *foreignSource {
+	return &foreignSource{
+		rootDir:  rootDir,
+		messages: make(map[string]foreignMessage),
+		labelMap: make(map[string]proton.Label),
+	}
+}
+
+// openForeignSource lists the messages of a foreign source. The IDs of the messages are derived from their path relative
+// to the root directory of the source, i.e. the folder containing the file if path is a single mbox file.
+func openForeignSource(format RestoreSourceFormat, path string) (*foreignSource, []messageInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rootDir := path
+	if !info.IsDir() {
+		if format != RestoreSourceMbox {
+			return nil, nil, fmt.Errorf("the %v import format requires a folder", format)
+		}
+
+		rootDir = filepath.Dir(path)
+	}
+
+	source := newForeignSource(rootDir)
+
+	switch format {
+	case RestoreSourceMbox:
+		err = source.addMboxTree(path)
+	case RestoreSourceMaildir:
+		err = source.addMaildirTree(path)
+	case RestoreSourceEML:
+		err = source.addEMLTree(path)
+	case RestoreSourceBackup:
+		err = fmt.Errorf("backups are not a foreign source")
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(source.messages) == 0 {
+		return nil, nil, errors.New("no importable mail found")
+	}
+
+	infos := make([]messageInfo, 0, len(source.messages))
+	for id, message := range source.messages {
+		size := message.length
+		if size < 0 {
+			if info, err := os.Stat(message.path); err == nil {
+				size = info.Size()
+			}
+		}
+
+		infos = append(infos, messageInfo{messageID: id, timestamp: message.timestamp, size: int(size)})
+	}
+
+	slices.SortFunc(infos, func(lhs, rhs messageInfo) bool {
+		if lhs.timestamp == rhs.timestamp {
+			return lhs.messageID < rhs.messageID
+		}
+
+		return lhs.timestamp < rhs.timestamp
+	})
+
+	return source, infos, nil
+}
+
+func (s *foreignSource) labels() ([]proton.Label, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	labels := make([]proton.Label, 0, len(s.labelMap))
+	for _, label := range s.labelMap {
+		labels = append(labels, label)
+	}
+
+	slices.SortFunc(labels, func(lhs, rhs proton.Label) bool { return lhs.ID < rhs.ID })
+
+	return labels, nil
+}
+
+func (s *foreignSource) loadMessage(messageID string) (Message, error) {
+	s.lock.Lock()
+	message, ok := s.messages[messageID]
+	s.lock.Unlock()
+
+	if !ok {
+		return Message{}, fmt.Errorf("unknown message %v", messageID)
+	}
+
+	literal, err := message.read()
+	if err != nil {
+		return Message{}, err
+	}
+
+	header, err := readForeignHeader(bytes.NewReader(literal))
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to parse message header: %w", err)
+	}
+
+	metadata := foreignMetadata(header)
+	metadata.ID = messageID
+	metadata.LabelIDs = message.labelIDs
+	metadata.Flags = message.flags
+	metadata.Unread = proton.Bool(message.unread)
+	metadata.Size = len(literal)
+
+	if metadata.Time == 0 {
+		metadata.Time = message.timestamp
+	}
+
+	return Message{literal: literal, metadata: metadata}, nil
+}
+
+func (m foreignMessage) read() ([]byte, error) {
+	if m.length < 0 {
+		return os.ReadFile(m.path)
+	}
+
+	file, err := os.Open(m.path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	literal := make([]byte, m.length)
+	if _, err := file.ReadAt(literal, m.offset); err != nil {
+		return nil, fmt.Errorf("failed to read message from mbox: %w", err)
+	}
+
+	return unescapeMboxFromLines(literal), nil
+}
+
+// add registers a message of the source, stored in the given folder. path identifies the message along with offset.
+func (s *foreignSource) add(path string, offset, length int64, folder []string, header mail.Header, unread, starred bool) {
+	relPath, err := filepath.Rel(s.rootDir, path)
+	if err != nil {
+		relPath = path
+	}
+
+	hash := sha256.Sum256([]byte(filepath.ToSlash(relPath) + ":" + strconv.FormatInt(offset, 10)))
+	messageID := "import-" + hex.EncodeToString(hash[:16])
+
+	var labelIDs []string
+	var flags proton.MessageFlag
+
+	if gmailLabels := header.Get("X-Gmail-Labels"); len(gmailLabels) != 0 {
+		labelIDs, flags, unread = s.gmailLabelIDs(gmailLabels)
+	} else {
+		labelIDs, flags = s.folderLabelIDs(folder)
+	}
+
+	if starred && !slices.Contains(labelIDs, proton.StarredLabel) {
+		labelIDs = append(labelIDs, proton.StarredLabel)
+	}
+
+	var timestamp int64
+	if date, err := header.Date(); err == nil {
+		timestamp = date.Unix()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.messages[messageID] = foreignMessage{
+		path:      path,
+		offset:    offset,
+		length:    length,
+		labelIDs:  labelIDs,
+		flags:     flags,
+		unread:    unread,
+		timestamp: timestamp,
+	}
+}
+
+// systemFolders maps the usual names of folders of other providers to the system labels.
+var systemFolders = map[string]string{ //nolint:gochecknoglobals
+	"inbox":            proton.InboxLabel,
+	"sent":             proton.SentLabel,
+	"sent mail":        proton.SentLabel,
+	"sent items":       proton.SentLabel,
+	"sent messages":    proton.SentLabel,
+	"draft":            proton.DraftsLabel,
+	"drafts":           proton.DraftsLabel,
+	"trash":            proton.TrashLabel,
+	"bin":              proton.TrashLabel,
+	"deleted items":    proton.TrashLabel,
+	"deleted messages": proton.TrashLabel,
+	"spam":             proton.SpamLabel,
+	"junk":             proton.SpamLabel,
+	"junk e-mail":      proton.SpamLabel,
+	"junk email":       proton.SpamLabel,
+	"archive":          proton.ArchiveLabel,
+	"archives":         proton.ArchiveLabel,
+	"all mail":         proton.ArchiveLabel,
+	"starred":          proton.StarredLabel,
+	"flagged":          proton.StarredLabel,
+}
+
+// ignoredGmailLabels are Gmail labels which have no equivalent on the account.
+var ignoredGmailLabels = []string{"important", "opened", "unread", "chat", "archived"} //nolint:gochecknoglobals
+
+// folderLabelIDs returns the labels of a message stored in the given folder. Messages outside any folder go to the
+// inbox.
+func (s *foreignSource) folderLabelIDs(folder []string) ([]string, proton.MessageFlag) {
+	if len(folder) == 0 {
+		return []string{proton.InboxLabel}, proton.MessageFlagReceived
+	}
+
+	if len(folder) == 1 {
+		if labelID, ok := systemFolders[strings.ToLower(folder[0])]; ok {
+			return []string{labelID}, systemFolderFlags(labelID)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return []string{s.addLabel(folder, proton.LabelTypeFolder)}, proton.MessageFlagReceived
+}
+
+// gmailLabelIDs returns the labels, flags and unread state of a message from the X-Gmail-Labels header of a Gmail
+// Takeout. Messages outside the inbox, sent, drafts, spam and trash are archived, as they are in Gmail.
+func (s *foreignSource) gmailLabelIDs(header string) ([]string, proton.MessageFlag, bool) {
+	var labelIDs []string
+
+	folderID := proton.ArchiveLabel
+	unread := false
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, name := range strings.Split(header, ",") {
+		name = strings.TrimSpace(decodeHeader(name))
+		name = strings.TrimPrefix(name, "[Gmail]/")
+		lowerName := strings.ToLower(name)
+
+		switch {
+		case len(name) == 0:
+			continue
+		case lowerName == "unread":
+			unread = true
+		case slices.Contains(ignoredGmailLabels, lowerName), strings.HasPrefix(lowerName, "category "):
+			continue
+		case lowerName == "starred":
+			labelIDs = append(labelIDs, proton.StarredLabel)
+		default:
+			if labelID, ok := systemFolders[lowerName]; ok {
+				// The inbox and sent win over the other folders when a message has several.
+				if folderID == proton.ArchiveLabel || labelID == proton.InboxLabel || labelID == proton.SentLabel {
+					folderID = labelID
+				}
+
+				continue
+			}
+
+			labelIDs = append(labelIDs, s.addLabel([]string{name}, proton.LabelTypeLabel))
+		}
+	}
+
+	return append([]string{folderID}, labelIDs...), systemFolderFlags(folderID), unread
+}
+
+// addLabel registers the folder or label with the given path, and its parent folders, and returns its ID. The caller
+// must hold the lock.
+func (s *foreignSource) addLabel(path []string, labelType proton.LabelType) string {
+	prefix := "label:"
+	if labelType == proton.LabelTypeFolder {
+		prefix = "folder:"
+	}
+
+	labelID := prefix + strings.Join(path, "/")
+	if _, ok := s.labelMap[labelID]; ok {
+		return labelID
+	}
+
+	label := proton.Label{ID: labelID, Name: path[len(path)-1], Path: path, Type: labelType}
+	if len(path) > 1 {
+		label.ParentID = s.addLabel(path[:len(path)-1], labelType)
+	}
+
+	s.labelMap[labelID] = label
+
+	return labelID
+}
+
+func systemFolderFlags(labelID string) proton.MessageFlag {
+	switch labelID {
+	case proton.SentLabel:
+		return proton.MessageFlagSent
+	case proton.DraftsLabel:
+		return 0
+	default:
+		return proton.MessageFlagReceived
+	}
+}
+
+// readForeignHeader reads the header of a message, tolerating messages without body.
+func readForeignHeader(r io.Reader) (mail.Header, error) {
+	message, err := mail.ReadMessage(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+
+	return message.Header, nil
+}
+
+// foreignMetadata fills the metadata the import relies on from the header of a message.
+func foreignMetadata(header mail.Header) proton.MessageMetadata {
+	metadata := proton.MessageMetadata{
+		Subject:    decodeHeader(header.Get("Subject")),
+		ExternalID: normalizeExternalID(header.Get("Message-Id")),
+	}
+
+	if date, err := header.Date(); err == nil {
+		metadata.Time = date.Unix()
+	}
+
+	if from, err := header.AddressList("From"); err == nil && len(from) != 0 {
+		metadata.Sender = from[0]
+	}
+
+	metadata.ToList = headerAddressList(header, "To")
+	metadata.CCList = headerAddressList(header, "Cc")
+	metadata.BCCList = headerAddressList(header, "Bcc")
+
+	return metadata
+}
+
+func headerAddressList(header mail.Header, key string) []*mail.Address {
+	addresses, err := header.AddressList(key)
+	if err != nil && !errors.Is(err, mail.ErrHeaderNotPresent) {
+		logrus.WithError(err).WithField("header", key).Debug("Failed to parse address list")
+	}
+
+	return addresses
+}
+
+func decodeHeader(value string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+
+	return decoded
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bufio"
+	"io/fs"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maildirCur = "cur"
+	maildirNew = "new"
+	maildirTmp = "tmp"
+)
+
+// addMaildirTree adds the messages of every Maildir folder found under root. Subfolders can use either the Maildir++
+// layout (.Work.Projects) or nested directories (Work/Projects). The Maildir at the root is the inbox.
+func (s *foreignSource) addMaildirTree(root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Cannot inspect path. Skipping.")
+			return nil
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		switch entry.Name() {
+		case maildirCur, maildirNew, maildirTmp:
+			if isMaildir(filepath.Dir(path)) {
+				return filepath.SkipDir
+			}
+		}
+
+		if !isMaildir(path) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		folder := maildirFolder(relPath)
+
+		if err := s.addMaildirMessages(filepath.Join(path, maildirNew), folder, true); err != nil {
+			return err
+		}
+
+		return s.addMaildirMessages(filepath.Join(path, maildirCur), folder, false)
+	})
+}
+
+func isMaildir(path string) bool {
+	info, err := os.Stat(filepath.Join(path, maildirCur))
+	return err == nil && info.IsDir()
+}
+
+func maildirFolder(relPath string) []string {
+	var folder []string
+
+	for _, name := range strings.Split(filepath.ToSlash(relPath), "/") {
+		if name == "." || len(name) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(name, ".") {
+			folder = append(folder, strings.Split(strings.TrimPrefix(name, "."), ".")...)
+		} else {
+			folder = append(folder, name)
+		}
+	}
+
+	return folder
+}
+
+// addMaildirMessages adds the messages of the new or cur directory of a Maildir. The messages of new have not been
+// seen yet; the read, flagged and trashed state of the messages of cur is part of their file name.
+func (s *foreignSource) addMaildirMessages(dir string, folder []string, isNew bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		unread, starred := isNew, false
+
+		if _, flags, ok := strings.Cut(entry.Name(), ":2,"); ok && !isNew {
+			if strings.ContainsRune(flags, 'T') {
+				continue // Marked for deletion.
+			}
+
+			unread = !strings.ContainsRune(flags, 'S')
+			starred = strings.ContainsRune(flags, 'F')
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		s.add(path, 0, -1, folder, readForeignFileHeader(path), unread, starred)
+	}
+
+	return nil
+}
+
+// addEMLTree adds every EML file found under root, in the folder matching the directory it is stored in. The files
+// at the root go to the inbox.
+func (s *foreignSource) addEMLTree(root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Cannot inspect path. Skipping.")
+			return nil
+		}
+
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(path), emlExtension) {
+			return nil
+		}
+
+		relDir, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+
+		var folder []string
+		if relDir != "." {
+			folder = strings.Split(filepath.ToSlash(relDir), "/")
+		}
+
+		s.add(path, 0, -1, folder, readForeignFileHeader(path), false, false)
+
+		return nil
+	})
+}
+
+// readForeignFileHeader reads the header of a message file, or returns an empty header if it cannot be parsed.
+func readForeignFileHeader(path string) mail.Header {
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		logrus.WithError(err).WithField("path", path).Warn("Failed to open message")
+		return mail.Header{}
+	}
+	defer func() { _ = file.Close() }()
+
+	header, err := readForeignHeader(bufio.NewReader(file))
+	if err != nil {
+		logrus.WithError(err).WithField("path", path).Warn("Failed to parse message header")
+		return mail.Header{}
+	}
+
+	return header
+}
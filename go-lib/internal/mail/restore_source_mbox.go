@@ -0,0 +1,226 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const mboxExtension = ".mbox"
+
+// Thunderbird keeps the subfolders of a folder in a directory named after the folder with this extension.
+const thunderbirdSubFolderExtension = ".sbd"
+
+// Thunderbird only removes deleted messages from the mbox file when the folder is compacted.
+const mozillaStatusExpunged = 0x0008
+
+const mozillaStatusRead = 0x0001
+
+var mboxFromLine = []byte("From ") //nolint:gochecknoglobals
+
+// addMboxTree adds the messages of an mbox file, or of every mbox file found in a folder. Files are considered mbox
+// files if their extension is .mbox or, as Thunderbird names them after the folder, if they have no extension and
+// start with a From line.
+func (s *foreignSource) addMboxTree(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return s.addMboxFile(path, mboxFolder(filepath.Base(path)))
+	}
+
+	return filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			logrus.WithError(err).WithField("path", filePath).Warn("Cannot inspect path. Skipping.")
+			return nil
+		}
+
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !isMboxFile(filePath) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
+		}
+
+		return s.addMboxFile(filePath, mboxFolder(relPath))
+	})
+}
+
+func isMboxFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case mboxExtension:
+		return true
+	case "":
+	default:
+		return false
+	}
+
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return false
+	}
+	defer func() { _ = file.Close() }()
+
+	prefix := make([]byte, len(mboxFromLine))
+	if _, err := io.ReadFull(file, prefix); err != nil {
+		return false
+	}
+
+	return bytes.Equal(prefix, mboxFromLine)
+}
+
+// mboxFolder returns the folder of an mbox file from its path relative to the root of the source.
+func mboxFolder(relPath string) []string {
+	var folder []string
+
+	for _, name := range strings.Split(filepath.ToSlash(relPath), "/") {
+		name = strings.TrimSuffix(name, thunderbirdSubFolderExtension)
+		if strings.EqualFold(filepath.Ext(name), mboxExtension) {
+			name = name[:len(name)-len(mboxExtension)]
+		}
+
+		if len(name) != 0 && name != "." {
+			folder = append(folder, name)
+		}
+	}
+
+	return folder
+}
+
+// addMboxFile adds every message of an mbox file. A message starts after a From line which follows an empty line, and
+// ends before the empty line preceding the next From line.
+func (s *foreignSource) addMboxFile(path string, folder []string) error {
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+
+	var offset, start, prevLineLen int64
+	var header bytes.Buffer
+
+	start = -1
+	prevBlank := true
+	inHeader := false
+
+	finish := func(end int64) {
+		if start < 0 {
+			return
+		}
+
+		// The empty line preceding the next From line is part of the mbox format.
+		if prevBlank {
+			end -= prevLineLen
+		}
+
+		if end > start {
+			s.addMboxMessage(path, start, end-start, folder, header.Bytes())
+		}
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) != 0 {
+			if prevBlank && bytes.HasPrefix(line, mboxFromLine) {
+				finish(offset)
+
+				start = offset + int64(len(line))
+				inHeader = true
+				header.Reset()
+			} else if inHeader {
+				header.Write(line)
+				inHeader = !isBlankLine(line)
+			}
+
+			prevBlank = isBlankLine(line)
+			prevLineLen = int64(len(line))
+			offset += int64(len(line))
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	finish(offset)
+
+	return nil
+}
+
+func (s *foreignSource) addMboxMessage(path string, offset, length int64, folder []string, rawHeader []byte) {
+	header, err := readForeignHeader(bytes.NewReader(rawHeader))
+	if err != nil {
+		logrus.WithError(err).WithField("path", path).WithField("offset", offset).Warn("Failed to parse message header")
+		header = mail.Header{}
+	}
+
+	unread := false
+
+	if status := header.Get("X-Mozilla-Status"); len(status) != 0 {
+		if flags, err := strconv.ParseUint(strings.TrimSpace(status), 16, 32); err == nil {
+			if flags&mozillaStatusExpunged != 0 {
+				return
+			}
+
+			unread = flags&mozillaStatusRead == 0
+		}
+	} else if status, ok := header["Status"]; ok {
+		unread = !strings.Contains(strings.Join(status, ""), "R")
+	}
+
+	s.add(path, offset, length, folder, header, unread, false)
+}
+
+func isBlankLine(line []byte) bool {
+	return len(bytes.TrimRight(line, "\r\n")) == 0
+}
+
+// unescapeMboxFromLines removes the '>' added in front of the lines of the message starting with From.
+func unescapeMboxFromLines(literal []byte) []byte {
+	if !bytes.Contains(literal, []byte(">From ")) {
+		return literal
+	}
+
+	lines := bytes.SplitAfter(literal, []byte("\n"))
+	for i, line := range lines {
+		if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) != len(line) && bytes.HasPrefix(unquoted, mboxFromLine) {
+			lines[i] = line[1:]
+		}
+	}
+
+	return bytes.Join(lines, nil)
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func loadForeignMessages(t *testing.T, source *foreignSource, infos []messageInfo) []Message {
+	messages := make([]Message, 0, len(infos))
+	for _, info := range infos {
+		message, err := source.loadMessage(info.messageID)
+		require.NoError(t, err)
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+func TestParseRestoreSourceFormat(t *testing.T) {
+	format, err := ParseRestoreSourceFormat("")
+	require.NoError(t, err)
+	require.Equal(t, RestoreSourceBackup, format)
+
+	format, err = ParseRestoreSourceFormat(" MBOX ")
+	require.NoError(t, err)
+	require.Equal(t, RestoreSourceMbox, format)
+
+	_, err = ParseRestoreSourceFormat("pst")
+	require.ErrorIs(t, err, ErrInvalidRestoreSourceFormat)
+}
+
+func TestForeignSource_GmailTakeout(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "Takeout", "Mail", "All mail Including Spam and Trash.mbox"), ""+
+		"From 1 at xxx Mon Jan 01 00:00:00 +0000 2024\n"+
+		"X-Gmail-Labels: Inbox,Unread,Travel,Category Updates\n"+
+		"Message-ID: <one@example.com>\n"+
+		"Date: Mon, 01 Jan 2024 10:00:00 +0000\n"+
+		"From: alice@example.com\n"+
+		"To: me@proton.me\n"+
+		"Subject: first\n"+
+		"\n"+
+		"Hello\n"+
+		">From the start\n"+
+		"\n"+
+		"From 2 at xxx Tue Jan 02 00:00:00 +0000 2024\n"+
+		"X-Gmail-Labels: Sent,Starred\n"+
+		"Date: Tue, 02 Jan 2024 10:00:00 +0000\n"+
+		"From: me@proton.me\n"+
+		"To: alice@example.com\n"+
+		"Subject: second\n"+
+		"\n"+
+		"Bye\n"+
+		"\n"+
+		"From 3 at xxx Wed Jan 03 00:00:00 +0000 2024\n"+
+		"X-Gmail-Labels: Travel\n"+
+		"Date: Wed, 03 Jan 2024 10:00:00 +0000\n"+
+		"Subject: third\n"+
+		"\n"+
+		"Archived\n")
+
+	source, infos, err := openForeignSource(RestoreSourceMbox, dir)
+	require.NoError(t, err)
+	require.Len(t, infos, 3)
+
+	messages := loadForeignMessages(t, source, infos)
+
+	require.Equal(t, "first", messages[0].metadata.Subject)
+	require.Equal(t, "one@example.com", messages[0].metadata.ExternalID)
+	require.Equal(t, []string{proton.InboxLabel, "label:Travel"}, messages[0].metadata.LabelIDs)
+	require.True(t, bool(messages[0].metadata.Unread))
+	require.Equal(t, proton.MessageFlagReceived, messages[0].metadata.Flags)
+	require.Contains(t, string(messages[0].literal), "Hello\nFrom the start")
+	require.NotContains(t, string(messages[0].literal), "From 2")
+
+	require.Equal(t, []string{proton.SentLabel, proton.StarredLabel}, messages[1].metadata.LabelIDs)
+	require.Equal(t, proton.MessageFlagSent, messages[1].metadata.Flags)
+	require.False(t, bool(messages[1].metadata.Unread))
+	require.Equal(t, "me@proton.me", messages[1].metadata.Sender.Address)
+	require.Equal(t, "Bye\n", string(messages[1].literal[len(messages[1].literal)-4:]))
+
+	require.Equal(t, []string{proton.ArchiveLabel, "label:Travel"}, messages[2].metadata.LabelIDs)
+
+	labels, err := source.labels()
+	require.NoError(t, err)
+	require.Equal(t, []proton.Label{{ID: "label:Travel", Name: "Travel", Path: []string{"Travel"}, Type: proton.LabelTypeLabel}}, labels)
+}
+
+func TestForeignSource_Thunderbird(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "Inbox"), ""+
+		"From - Mon Jan 01 00:00:00 2024\n"+
+		"X-Mozilla-Status: 0001\n"+
+		"Subject: read\n"+
+		"\n"+
+		"Body\n"+
+		"\n"+
+		"From - Mon Jan 01 00:00:00 2024\n"+
+		"X-Mozilla-Status: 0009\n"+
+		"Subject: deleted\n"+
+		"\n"+
+		"Body\n")
+	writeTestFile(t, filepath.Join(dir, "Inbox.msf"), "// mork index\n")
+	writeTestFile(t, filepath.Join(dir, "Work.sbd", "Projects"), ""+
+		"From - Mon Jan 01 00:00:00 2024\n"+
+		"X-Mozilla-Status: 0000\n"+
+		"Subject: unread\n"+
+		"\n"+
+		"Body\n")
+
+	source, infos, err := openForeignSource(RestoreSourceMbox, dir)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+
+	bySubject := make(map[string]Message)
+	for _, message := range loadForeignMessages(t, source, infos) {
+		bySubject[message.metadata.Subject] = message
+	}
+
+	require.Equal(t, []string{proton.InboxLabel}, bySubject["read"].metadata.LabelIDs)
+	require.False(t, bool(bySubject["read"].metadata.Unread))
+	require.Equal(t, []string{"folder:Work/Projects"}, bySubject["unread"].metadata.LabelIDs)
+	require.True(t, bool(bySubject["unread"].metadata.Unread))
+
+	labels, err := source.labels()
+	require.NoError(t, err)
+	require.Equal(t, []proton.Label{
+		{ID: "folder:Work", Name: "Work", Path: []string{"Work"}, Type: proton.LabelTypeFolder},
+		{ID: "folder:Work/Projects", ParentID: "folder:Work", Name: "Projects", Path: []string{"Work", "Projects"}, Type: proton.LabelTypeFolder},
+	}, labels)
+
+	// A single file is imported into the folder it is named after.
+	source, infos, err = openForeignSource(RestoreSourceMbox, filepath.Join(dir, "Work.sbd", "Projects"))
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.Equal(t, filepath.Join(dir, "Work.sbd"), source.rootDir)
+	require.Equal(t, []string{"folder:Projects"}, loadForeignMessages(t, source, infos)[0].metadata.LabelIDs)
+}
+
+func TestForeignSource_Maildir(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "new", "1.host"), "Subject: new\n\nBody\n")
+	writeTestFile(t, filepath.Join(dir, "cur", "2.host:2,S"), "Subject: seen\n\nBody\n")
+	writeTestFile(t, filepath.Join(dir, "cur", "3.host:2,ST"), "Subject: trashed\n\nBody\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tmp"), 0o700))
+	writeTestFile(t, filepath.Join(dir, ".Sent", "cur", "4.host:2,S"), "Subject: sent\n\nBody\n")
+	writeTestFile(t, filepath.Join(dir, ".Work.Projects", "cur", "5.host:2,FS"), "Subject: flagged\nDate: Mon, 01 Jan 2024 10:00:00 +0000\n\nBody\n")
+
+	source, infos, err := openForeignSource(RestoreSourceMaildir, dir)
+	require.NoError(t, err)
+	require.Len(t, infos, 4)
+
+	bySubject := make(map[string]Message)
+	for _, message := range loadForeignMessages(t, source, infos) {
+		bySubject[message.metadata.Subject] = message
+	}
+
+	require.Equal(t, []string{proton.InboxLabel}, bySubject["new"].metadata.LabelIDs)
+	require.True(t, bool(bySubject["new"].metadata.Unread))
+	require.False(t, bool(bySubject["seen"].metadata.Unread))
+	require.Equal(t, []string{proton.SentLabel}, bySubject["sent"].metadata.LabelIDs)
+	require.Equal(t, proton.MessageFlagSent, bySubject["sent"].metadata.Flags)
+	require.Equal(t, []string{"folder:Work/Projects", proton.StarredLabel}, bySubject["flagged"].metadata.LabelIDs)
+
+	// Messages are sorted by date, those without one first.
+	require.Equal(t, bySubject["flagged"].metadata.ID, infos[len(infos)-1].messageID)
+}
+
+func TestForeignSource_EML(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "root.eml"), "Subject: root\n\nBody\n")
+	writeTestFile(t, filepath.Join(dir, "Trash", "deleted.EML"), "Subject: deleted\n\nBody\n")
+	writeTestFile(t, filepath.Join(dir, "Trash", "notes.txt"), "not a message")
+
+	source, infos, err := openForeignSource(RestoreSourceEML, dir)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+
+	bySubject := make(map[string]Message)
+	for _, message := range loadForeignMessages(t, source, infos) {
+		bySubject[message.metadata.Subject] = message
+	}
+
+	require.Equal(t, []string{proton.InboxLabel}, bySubject["root"].metadata.LabelIDs)
+	require.Equal(t, []string{proton.TrashLabel}, bySubject["deleted"].metadata.LabelIDs)
+
+	// The IDs only depend on the location of the messages, so that an interrupted import can be resumed.
+	_, again, err := openForeignSource(RestoreSourceEML, dir)
+	require.NoError(t, err)
+	require.ElementsMatch(t, infos, again)
+
+	_, _, err = openForeignSource(RestoreSourceEML, t.TempDir())
+	require.Error(t, err)
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/ProtonMail/go-proton-api"
+)
+
+const remoteIndexPageSize = 150
+
+// remoteMessageIndex holds the internal IDs of the messages already present on the account, and the dates of these
+// messages for each external ID.
+type remoteMessageIndex struct {
+	internalIDs map[string]struct{}
+	externalIDs map[string][]int64
+}
+
+func newRemoteMessageIndex() *remoteMessageIndex {
+	return &remoteMessageIndex{
+		internalIDs: make(map[string]struct{}),
+		externalIDs: make(map[string][]int64),
+	}
+}
+
+func (idx *remoteMessageIndex) add(metadata proton.MessageMetadata) {
+	idx.internalIDs[metadata.ID] = struct{}{}
+
+	if externalID := normalizeExternalID(metadata.ExternalID); len(externalID) != 0 {
+		idx.externalIDs[externalID] = append(idx.externalIDs[externalID], metadata.Time)
+	}
+}
+
+// contains returns true if the message of the backup is already present on the account. A message matches if it has
+// the same internal ID as a message of the account, or the same external ID and date. The external ID alone is not
+// enough as drafts, resent messages and mailing list copies can share the Message-Id of another message.
+func (idx *remoteMessageIndex) contains(message Message) bool {
+	keys := messageDedupeKeys(message)
+
+	if _, ok := idx.internalIDs[keys.internalID]; ok && len(keys.internalID) != 0 {
+		return true
+	}
+
+	if len(keys.externalID) == 0 || keys.time == 0 {
+		return false
+	}
+
+	for _, t := range idx.externalIDs[keys.externalID] {
+		if t == keys.time {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetDedupe controls whether messages already present on the account are skipped. Enabled by default, disabling it
+// avoids listing every message of the account before the import. Must be called before Run.
+func (r *RestoreTask) SetDedupe(enabled bool) {
+	r.skipDedupe = !enabled
+}
+
+// initRemoteIndex lists the messages of the account used to skip duplicates, unless dedupe was disabled.
+func (r *RestoreTask) initRemoteIndex() error {
+	if r.skipDedupe {
+		r.log.Info("Dedupe disabled, messages already present on the account will be imported again")
+		return nil
+	}
+
+	remoteIndex, err := r.loadRemoteMessageIndex()
+	if err != nil {
+		return err
+	}
+
+	r.remoteIndex = remoteIndex
+
+	return nil
+}
+
+// loadRemoteMessageIndex lists the metadata of every message of the account.
+func (r *RestoreTask) loadRemoteMessageIndex() (*remoteMessageIndex, error) {
+	client := r.session.GetClient()
+	idx := newRemoteMessageIndex()
+
+	var lastMessageID string
+
+	for {
+		if err := r.pause.Wait(r.ctx); err != nil {
+			return nil, err
+		}
+
+		metadata, err := client.GetMessageMetadataPage(r.ctx, 0, remoteIndexPageSize, proton.MessageFilter{
+			Desc:  true,
+			EndID: lastMessageID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// The message matching EndID is included in the page.
+		if lastMessageID != "" && len(metadata) != 0 && metadata[0].ID == lastMessageID {
+			metadata = metadata[1:]
+		}
+
+		if len(metadata) == 0 {
+			break
+		}
+
+		for _, m := range metadata {
+			idx.add(m)
+		}
+
+		lastMessageID = metadata[len(metadata)-1].ID
+	}
+
+	r.log.WithField("messageCount", len(idx.internalIDs)).Info("Listed messages already present on the account")
+
+	return idx, nil
+}
+
+type dedupeKeys struct {
+	internalID string
+	externalID string
+	time       int64 // Unix time of the message, 0 if unknown.
+}
+
+// messageDedupeKeys returns the internal ID, external ID and date of a message of the backup. The values from the
+// metadata file are preferred, the X-Pm-Internal-Id, X-Pm-External-Id, Message-Id and Date headers are used otherwise.
+func messageDedupeKeys(message Message) dedupeKeys {
+	keys := dedupeKeys{
+		internalID: message.metadata.ID,
+		externalID: normalizeExternalID(message.metadata.ExternalID),
+		time:       message.metadata.Time,
+	}
+
+	if len(keys.internalID) != 0 && len(keys.externalID) != 0 && keys.time != 0 {
+		return keys
+	}
+
+	header, err := rfc822.Parse(message.literal).ParseHeader()
+	if err != nil {
+		return keys
+	}
+
+	if len(keys.internalID) == 0 {
+		keys.internalID = strings.TrimSpace(header.Get("X-Pm-Internal-Id"))
+	}
+
+	if len(keys.externalID) == 0 {
+		keys.externalID = normalizeExternalID(header.Get("X-Pm-External-Id"))
+	}
+
+	if len(keys.externalID) == 0 {
+		keys.externalID = normalizeExternalID(header.Get("Message-Id"))
+	}
+
+	if keys.time == 0 {
+		if date, err := mail.ParseDate(header.Get("Date")); err == nil {
+			keys.time = date.Unix()
+		}
+	}
+
+	return keys
+}
+
+func normalizeExternalID(id string) string {
+	return strings.Trim(strings.TrimSpace(id), "<>")
+}
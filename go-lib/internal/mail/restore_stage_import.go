@@ -19,15 +19,24 @@ package mail
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/metrics"
+	"github.com/ProtonMail/export-tool/internal/tracing"
+	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/proton-bridge/v3/pkg/message/parser"
+	"github.com/bradenaw/juniper/parallel"
 	"github.com/bradenaw/juniper/stream"
+	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/exp/slices"
 )
 
@@ -39,141 +48,292 @@ type Message struct {
 const messageBatchSize = 10 // max batch size supported by go-proton-api (larger batches will be split).
 
 func (r *RestoreTask) importMails(messageInfoList []messageInfo, reporter Reporter) error {
-	return r.withAddrKR(func(addrID string, addrKR *crypto.KeyRing) error {
-		messages := make([]Message, 0, messageBatchSize)
-		for _, info := range messageInfoList {
-			emlPath := filepath.Join(r.backupDir, info.messageID+emlExtension)
-			literal, err := os.ReadFile(emlPath) //nolint:gosec
-			if err != nil {
-				logrus.WithField("path", emlPath).Error("Could not read EML file. Skipping.")
-				reporter.OnProgress(1)
-				continue
-			}
-
-			metadataPath := emlToMetadataFilename(emlPath)
-			metadata, err := loadMetadataFile(metadataPath)
-			if err != nil {
-				logrus.WithField("path", metadataPath).Error("Could not load metadata file. Skipping.")
-				reporter.OnProgress(1)
-			}
-
-			messages = append(messages, Message{literal: literal, metadata: metadata.MessageMetadata})
-			if len(messages) >= messageBatchSize {
-				if err := r.importMailBatch(addrID, addrKR, messages, reporter); err != nil {
-					return err
-				}
-				messages = messages[:0]
-			}
-		}
+	if err := r.initRemoteIndex(); err != nil {
+		return err
+	}
 
-		if len(messages) > 0 {
-			if err := r.importMailBatch(addrID, addrKR, messages, reporter); err != nil {
-				return err
-			}
-		}
-		return nil
+	return r.withAddrKRs(func(resolver *restoreAddressResolver, addrKRs map[string]*crypto.KeyRing) error {
+		errReporter := newRestoreErrReporter(r)
+
+		parseStage := r.startReadAndParse(messageInfoList, resolver, reporter, errReporter)
+
+		importStage := NewRestoreImportStage(
+			r.session.GetClient(),
+			addrKRs,
+			r.parallelImports,
+			r.log,
+			r.session.GetPanicHandler(),
+			reporter,
+			r.onImported,
+			r.pause,
+			r.session.GetMetrics(),
+		)
+
+		r.group.Once(func(ctx context.Context) {
+			importStage.Run(ctx, parseStage.outputCh, errReporter)
+		})
+
+		r.group.WaitToFinish()
+
+		return errReporter.err(r.ctx)
 	})
 }
 
-func (r *RestoreTask) importMailBatch(addrID string, addrKR *crypto.KeyRing, messages []Message, reporter Reporter) error {
-	defer reporter.OnProgress(len(messages))
+// RestoreImportStage imports the messages into the account, several batches at a time. Each batch holds messages of
+// a single address, which are encrypted with the keyring of that address.
+type RestoreImportStage struct {
+	client          apiclient.Client
+	addrKRs         map[string]*crypto.KeyRing
+	log             *logrus.Entry
+	parallelImports int
+	panicHandler    async.PanicHandler
+	reporter        Reporter
+	onImported      func(messageIDs ...string)
+	pause           *PauseController
+	metrics         *metrics.Metrics
+}
 
-	reqs := make([]proton.ImportReq, 0, len(messages))
-	for _, message := range messages {
-		log := r.log.WithField("messageID", message.metadata.AddressID)
-		labelIDs, err := r.getLabelList(message.metadata.LabelIDs)
-		if err != nil {
-			log.WithField("messageID", message.metadata.ID).WithError(err).Error("Could not map label to remote labels.")
-			r.failedCount++
-			continue
-		}
+func NewRestoreImportStage(
+	client apiclient.Client,
+	addrKRs map[string]*crypto.KeyRing,
+	parallelImports int,
+	log *logrus.Entry,
+	panicHandler async.PanicHandler,
+	reporter Reporter,
+	onImported func(messageIDs ...string),
+	pause *PauseController,
+	metrics *metrics.Metrics,
+) *RestoreImportStage {
+	return &RestoreImportStage{
+		client:          client,
+		addrKRs:         addrKRs,
+		log:             log.WithField("stage", "import"),
+		parallelImports: parallelImports,
+		panicHandler:    panicHandler,
+		reporter:        reporter,
+		onImported:      onImported,
+		pause:           pause,
+		metrics:         metrics,
+	}
+}
 
-		msgParser, err := parser.New(bytes.NewReader(message.literal))
-		if err != nil {
-			log.WithField(message.metadata.ID, message.metadata).WithError(err).Error("Failed to parse literal for message.")
-			r.failedCount++
-			continue
+func (s *RestoreImportStage) Run(ctx context.Context, input <-chan []restoreImportItem, errReporter StageErrorReporter) {
+	s.log.Debug("Starting")
+	defer s.log.Debug("Exiting")
+
+	for chunk := range input {
+		if err := s.pause.Wait(ctx); err != nil {
+			return
 		}
 
-		// multipart body requires at least one text part to be properly encrypted.
-		if msgParser.AttachEmptyTextPartIfNoneExists() {
-			buf := new(bytes.Buffer)
-			if err := msgParser.NewWriter().Write(buf); err != nil {
-				log.WithError(err).Error("failed to add an empty text body.")
-				continue
-			}
-			message.literal = buf.Bytes()
+		if err := s.importChunk(ctx, chunk, errReporter); err != nil {
+			errReporter.ReportStageError(err)
+			return
 		}
 
-		reqs = append(reqs, proton.ImportReq{
-			Metadata: proton.ImportMetadata{
-				AddressID: addrID,
-				LabelIDs:  labelIDs,
-				Unread:    message.metadata.Unread,
-				Flags:     message.metadata.Flags,
-			},
-			Message: message.literal,
-		})
+		if ctx.Err() != nil {
+			return
+		}
 	}
+}
+
+// importChunk imports the messages of chunk, grouped in batches of messages of the same address.
+func (s *RestoreImportStage) importChunk(ctx context.Context, chunk []restoreImportItem, errReporter StageErrorReporter) error {
+	start := time.Now()
+	s.metrics.StageStarted(string(RestoreStageImport), len(chunk))
+	defer s.metrics.StageDone(string(RestoreStageImport), len(chunk))
+
+	chunkCtx, span := tracing.Start(ctx, "restore.import.chunk", attribute.Int("messages", len(chunk)))
+
+	batches := importBatches(chunk)
+
+	if err := parallel.DoContext(chunkCtx, s.parallelImports, len(batches), func(ctx context.Context, i int) error {
+		defer async.HandlePanic(s.panicHandler)
+		defer s.reporter.OnProgress(len(batches[i]))
+
+		s.importBatch(ctx, batches[i], errReporter)
 
-	if len(reqs) == 0 {
 		return nil
+	}); err != nil {
+		tracing.End(span, err)
+		return err
+	}
+
+	var size uint64
+	for _, item := range chunk {
+		size += uint64(len(item.req.Message))
+	}
+
+	tracing.End(span, nil)
+	s.metrics.StageFinished(string(RestoreStageImport), len(chunk), size, start)
+
+	return nil
+}
+
+// importBatches splits the chunk into batches of messages of the same address.
+func importBatches(chunk []restoreImportItem) [][]restoreImportItem {
+	var addrIDs []string
+
+	byAddress := make(map[string][]restoreImportItem)
+
+	for _, item := range chunk {
+		addrID := item.req.Metadata.AddressID
+		if _, ok := byAddress[addrID]; !ok {
+			addrIDs = append(addrIDs, addrID)
+		}
+
+		byAddress[addrID] = append(byAddress[addrID], item)
+	}
+
+	var batches [][]restoreImportItem
+	for _, addrID := range addrIDs {
+		batches = append(batches, xslices.Chunk(byAddress[addrID], messageBatchSize)...)
+	}
+
+	return batches
+}
+
+func (s *RestoreImportStage) importBatch(ctx context.Context, batch []restoreImportItem, errReporter StageErrorReporter) {
+	addrID := batch[0].req.Metadata.AddressID
+
+	addrKR, ok := s.addrKRs[addrID]
+	if !ok {
+		for _, item := range batch {
+			s.log.WithField("messageID", item.messageID).WithField("addrID", addrID).Error("Address has no key ring")
+			errReporter.ReportMessageError(item.messageID, FailureStageImport, ErrBuildNoAddrKey)
+		}
+
+		return
 	}
 
-	str, err := r.session.GetClient().ImportMessages(r.ctx, addrKR, -1, -1, reqs...)
+	reqs := xslices.Map(batch, func(item restoreImportItem) proton.ImportReq { return item.req })
+
+	str, err := s.client.ImportMessages(ctx, addrKR, 1, 1, reqs...)
 	if err != nil {
-		r.log.WithError(err).Error("Failed to prepare message batch for import. Retrying one by one.")
-		r.importOneByOne(reqs, messages, addrKR)
-		return nil
+		s.log.WithError(err).Error("Failed to prepare message batch for import. Retrying one by one.")
+		s.importOneByOne(ctx, addrKR, batch, errReporter)
+		return
 	}
 
-	results, err := stream.Collect(r.ctx, stream.Stream[proton.ImportRes](str))
+	results, err := stream.Collect(ctx, stream.Stream[proton.ImportRes](str))
 	if err != nil {
-		r.log.WithError(err).Error("An error occurred while importing a batch of messages. Retrying one by one.")
-		r.importOneByOne(reqs, messages, addrKR)
-		return nil
+		s.log.WithError(err).Error("An error occurred while importing a batch of messages. Retrying one by one.")
+		s.importOneByOne(ctx, addrKR, batch, errReporter)
+		return
 	}
 
+	imported := make([]string, 0, len(results))
 	for i, result := range results {
-		if result.Code != 1000 {
-			r.log.WithField("messageID", messages[i].metadata.ID).WithError(result.APIError).Error("Failed to import message")
-			r.failedCount++
+		if result.Code != proton.SuccessCode {
+			s.log.WithField("messageID", batch[i].messageID).WithError(result.APIError).Error("Failed to import message")
+			errReporter.ReportMessageError(batch[i].messageID, FailureStageImport, result.APIError)
 		} else {
-			r.importedCount++
+			imported = append(imported, batch[i].messageID)
 		}
 	}
 
-	return nil
+	s.onImported(imported...)
 }
 
-func (r *RestoreTask) importOneByOne(requests []proton.ImportReq, messages []Message, addrKR *crypto.KeyRing) {
-	for i, request := range requests {
-		resultStream, err := r.session.GetClient().ImportMessages(r.ctx, addrKR, -1, -1, request)
+func (s *RestoreImportStage) importOneByOne(
+	ctx context.Context,
+	addrKR *crypto.KeyRing,
+	batch []restoreImportItem,
+	errReporter StageErrorReporter,
+) {
+	for _, item := range batch {
+		resultStream, err := s.client.ImportMessages(ctx, addrKR, 1, 1, item.req)
 		if err != nil {
-			r.log.WithError(err).WithField("messageID", messages[i].metadata.ID).Error("Failed to import message")
-			r.failedCount++
+			s.log.WithError(err).WithField("messageID", item.messageID).Error("Failed to import message")
+			errReporter.ReportMessageError(item.messageID, FailureStageImport, err)
 			continue
 		}
 
-		results, err := stream.Collect(r.ctx, stream.Stream[proton.ImportRes](resultStream))
+		results, err := stream.Collect(ctx, stream.Stream[proton.ImportRes](resultStream))
 		if err != nil {
-			r.log.WithError(err).WithField("messageID", messages[i].metadata.ID).Error("Failed to import message")
-			r.failedCount++
+			s.log.WithError(err).WithField("messageID", item.messageID).Error("Failed to import message")
+			errReporter.ReportMessageError(item.messageID, FailureStageImport, err)
 			continue
 		}
 
-		if results[0].Code != 1000 {
-			r.log.WithField("messageID", messages[i].metadata.ID).WithError(results[0].APIError).Error("Failed to import message")
-			r.failedCount++
+		if results[0].Code != proton.SuccessCode {
+			s.log.WithField("messageID", item.messageID).WithError(results[0].APIError).Error("Failed to import message")
+			errReporter.ReportMessageError(item.messageID, FailureStageImport, results[0].APIError)
 		} else {
-			r.importedCount++
+			s.onImported(item.messageID)
+		}
+	}
+}
+
+// loadBackupMessage reads the EML and metadata files of a message from the backup. Messages which could not be
+// assembled during the export are reassembled from their parts.
+func loadBackupMessage(backupDir, messageID string) (Message, error) {
+	emlPath := filepath.Join(backupDir, getEMLFileName(messageID))
+	metadataPath := emlToMetadataFilename(emlPath)
+	metadata, err := loadMetadataFile(metadataPath)
+	if err != nil {
+		logrus.WithField("path", metadataPath).Error("Could not load metadata file. Skipping.")
+		return Message{}, fmt.Errorf("could not load metadata file: %w", err)
+	}
+
+	if metadata.WriterType != MessageWriterTypeDecryptedAndBuilt {
+		messageDir := filepath.Join(backupDir, messageID)
+		literal, err := assembleSplitMessage(messageDir, metadata)
+		if err != nil {
+			logrus.WithField("path", messageDir).WithError(err).Error("Could not reassemble message. Skipping.")
+			return Message{}, fmt.Errorf("could not reassemble message: %w", err)
 		}
+
+		return Message{literal: literal, metadata: metadata.MessageMetadata}, nil
+	}
+
+	literal, err := os.ReadFile(emlPath) //nolint:gosec
+	if err != nil {
+		logrus.WithField("path", emlPath).Error("Could not read EML file. Skipping.")
+		return Message{}, fmt.Errorf("could not read EML file: %w", err)
+	}
+
+	return Message{literal: literal, metadata: metadata.MessageMetadata}, nil
+}
+
+// prepareImportRequest maps the labels of the message to the remote labels and makes sure the literal can be
+// encrypted by the API.
+func (r *RestoreTask) prepareImportRequest(addrID string, message Message) (proton.ImportReq, error) {
+	labelIDs, err := r.getLabelList(message.metadata.LabelIDs)
+	if err != nil {
+		return proton.ImportReq{}, fmt.Errorf("could not map label to remote labels: %w", err)
+	}
+
+	msgParser, err := parser.New(bytes.NewReader(message.literal))
+	if err != nil {
+		return proton.ImportReq{}, fmt.Errorf("failed to parse literal: %w", err)
+	}
+
+	// multipart body requires at least one text part to be properly encrypted.
+	if msgParser.AttachEmptyTextPartIfNoneExists() {
+		buf := new(bytes.Buffer)
+		if err := msgParser.NewWriter().Write(buf); err != nil {
+			return proton.ImportReq{}, fmt.Errorf("failed to add an empty text body: %w", err)
+		}
+		message.literal = buf.Bytes()
 	}
+
+	return proton.ImportReq{
+		Metadata: proton.ImportMetadata{
+			AddressID: addrID,
+			LabelIDs:  labelIDs,
+			Unread:    message.metadata.Unread,
+			Flags:     message.metadata.Flags,
+		},
+		Message: message.literal,
+	}, nil
 }
 
 func (r *RestoreTask) getLabelList(labels []string) ([]string, error) {
 	var result = make([]string, 0, len(labels)+1)
-	result = append(result, r.importLabelID)
+	if len(r.importLabelID) != 0 {
+		result = append(result, r.importLabelID)
+	}
 
 	for _, label := range labels {
 		if !IsAcceptableLabel(label) {
@@ -184,6 +344,11 @@ func (r *RestoreTask) getLabelList(labels []string) ([]string, error) {
 			return nil, fmt.Errorf("could not find a remote label matching backup label %v", label)
 		}
 
+		// The label is dropped by the label mapping file.
+		if len(remoteLabel) == 0 {
+			continue
+		}
+
 		result = append(result, remoteLabel)
 	}
 
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -33,37 +34,182 @@ import (
 
 var errCircularLabelReference = errors.New("unable to sort labels because of a circular reference")
 
-func (r *RestoreTask) restoreLabels() error {
-	backupLabels, err := r.readLabelFile()
+// RestoreLabelAction describes what happens to a backup label on the account during a restore.
+type RestoreLabelAction string
+
+const (
+	// RestoreLabelActionSystem maps the label to the system label with the same ID.
+	RestoreLabelActionSystem RestoreLabelAction = "system"
+	// RestoreLabelActionExisting maps the label to an existing label of the same name and type.
+	RestoreLabelActionExisting RestoreLabelAction = "existing"
+	// RestoreLabelActionCreate creates the label under its backup name.
+	RestoreLabelActionCreate RestoreLabelAction = "create"
+	// RestoreLabelActionRename creates the label under a new name as the backup name is taken by a label of another type.
+	RestoreLabelActionRename RestoreLabelAction = "rename"
+	// RestoreLabelActionDrop restores the messages without the label, as requested by the label mapping file.
+	RestoreLabelActionDrop RestoreLabelAction = "drop"
+)
+
+// RestoreLabelPlan describes how a label of the backup is mapped to the account.
+type RestoreLabelPlan struct {
+	Label    proton.Label `json:"-"`
+	BackupID string
+	Name     string
+	Type     proton.LabelType
+	Action   RestoreLabelAction
+	RemoteID string `json:",omitempty"` // Set for system and existing labels.
+	NewName  string `json:",omitempty"` // Set for renamed labels.
+}
+
+// planLabels resolves how every label of the backup maps to the labels of the account, parents before children. The
+// labels found in knownMapping, e.g. created by an interrupted restore, are mapped to the same remote label if it still
+// exists. The label mapping file, if set, is validated and takes precedence.
+func (r *RestoreTask) planLabels(knownMapping map[string]string) ([]RestoreLabelPlan, error) {
+	remoteLabels, err := r.getRemoteLabels()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var mappingEntries []RestoreLabelMappingEntry
+	if len(r.labelMappingFile) != 0 {
+		if mappingEntries, err = LoadRestoreLabelMapping(r.labelMappingFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.planLabelsWithRemote(knownMapping, mappingEntries, remoteLabels)
+}
+
+func (r *RestoreTask) getRemoteLabels() ([]proton.Label, error) {
+	return r.session.GetClient().GetLabels(r.ctx, proton.LabelTypeFolder, proton.LabelTypeLabel, proton.LabelTypeSystem)
+}
+
+// planLabelsWithRemote resolves how the labels of the backup map to the given labels of the account, applying the
+// entries of the label mapping file.
+func (r *RestoreTask) planLabelsWithRemote(
+	knownMapping map[string]string,
+	mappingEntries []RestoreLabelMappingEntry,
+	remoteLabels []proton.Label,
+) ([]RestoreLabelPlan, error) {
+	backupLabels, err := r.source.labels()
+	if err != nil {
+		return nil, err
 	}
 
 	backupLabels, err = sortLabels(backupLabels)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	remoteLabels, err := r.session.GetClient().GetLabels(r.ctx, proton.LabelTypeFolder, proton.LabelTypeLabel, proton.LabelTypeSystem)
+	mapping, err := resolveLabelMapping(mappingEntries, backupLabels, remoteLabels)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	plans := make([]RestoreLabelPlan, 0, len(backupLabels))
+	inUse := labelsInUse(backupLabels, r.filteredLabelIDs)
+
 	for _, label := range backupLabels {
+		if inUse != nil {
+			if _, ok := inUse[label.ID]; !ok {
+				continue
+			}
+		}
+
+		plan := RestoreLabelPlan{Label: label, BackupID: label.ID, Name: label.Name, Type: label.Type}
+
+		labelID, name := matchLocalLabelWithRemote(label, remoteLabels)
+
+		knownID, known := knownMapping[label.ID]
+		if known {
+			known = slices.ContainsFunc(remoteLabels, func(remoteLabel proton.Label) bool { return remoteLabel.ID == knownID })
+		}
+
+		switch {
+		case isSystemLabel(label.ID):
+			plan.Action = RestoreLabelActionSystem
+			plan.RemoteID = labelID
+		case known:
+			plan.Action = RestoreLabelActionExisting
+			plan.RemoteID = knownID
+		case len(labelID) > 0:
+			plan.Action = RestoreLabelActionExisting
+			plan.RemoteID = labelID
+		case name != label.Name:
+			plan.Action = RestoreLabelActionRename
+			plan.NewName = name
+		default:
+			plan.Action = RestoreLabelActionCreate
+		}
+
+		if entry, ok := mapping[label.ID]; ok {
+			applyLabelMapping(&plan, entry, remoteLabels)
+		}
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// labelsInUse returns the IDs of the given labels and of their parents, or nil if labelIDs is nil.
+func labelsInUse(labels []proton.Label, labelIDs map[string]struct{}) map[string]struct{} {
+	if labelIDs == nil {
+		return nil
+	}
+
+	parents := make(map[string]string, len(labels))
+	for _, label := range labels {
+		parents[label.ID] = label.ParentID
+	}
+
+	result := make(map[string]struct{}, len(labelIDs))
+
+	for labelID := range labelIDs {
+		for len(labelID) != 0 {
+			if _, ok := result[labelID]; ok {
+				break
+			}
+
+			result[labelID] = struct{}{}
+			labelID = parents[labelID]
+		}
+	}
+
+	return result
+}
+
+func (r *RestoreTask) restoreLabels() error {
+	var knownMapping map[string]string
+	if r.journal != nil {
+		knownMapping = r.journal.LabelMapping()
+	}
+
+	plans, err := r.planLabels(knownMapping)
+	if err != nil {
+		return err
+	}
+
+	for _, plan := range plans {
 		select {
 		case <-r.ctx.Done():
 			return r.ctx.Err()
 		default:
 		}
 
-		labelID, name := matchLocalLabelWithRemote(label, remoteLabels)
-		if len(labelID) > 0 {
-			r.labelMapping[label.ID] = labelID
+		switch plan.Action {
+		case RestoreLabelActionSystem, RestoreLabelActionExisting:
+			r.labelMapping[plan.BackupID] = plan.RemoteID
+			continue
+		case RestoreLabelActionDrop:
+			r.labelMapping[plan.BackupID] = ""
 			continue
+		case RestoreLabelActionRename:
+			plan.Label.Name = plan.NewName
+		case RestoreLabelActionCreate:
 		}
 
-		label.Name = name
-		if err = r.createAndMapLabel(label); err != nil {
+		if err = r.createAndMapLabel(plan.Label); err != nil {
 			return err
 		}
 	}
@@ -98,8 +244,8 @@ func matchLocalLabelWithRemote(label proton.Label, remoteLabels []proton.Label)
 	return "", findFirstAvailableLabelIncrementalName(label.Name, remoteLabels)
 }
 
-func (r *RestoreTask) readLabelFile() ([]proton.Label, error) {
-	data, err := os.ReadFile(filepath.Join(r.backupDir, getLabelFileName()))
+func readBackupLabelFile(backupDir string) ([]proton.Label, error) {
+	data, err := os.ReadFile(filepath.Join(backupDir, getLabelFileName())) //nolint:gosec
 	if err != nil {
 		return nil, err
 	}
@@ -142,12 +288,122 @@ func (r *RestoreTask) createAndMapLabel(label proton.Label) error {
 	return nil
 }
 
+// RestoreImportLabelMode selects the label applied to every restored message.
+type RestoreImportLabelMode int
+
+const (
+	// RestoreImportLabelCreate creates a new label, named after the name template.
+	RestoreImportLabelCreate RestoreImportLabelMode = iota
+	// RestoreImportLabelExisting applies the label of the account with the given name, which is created if missing.
+	RestoreImportLabelExisting
+	// RestoreImportLabelNone applies no label.
+	RestoreImportLabelNone
+)
+
+// DefaultImportLabelNameTemplate is the name of the import label. {date} and {time} are replaced by the date and time
+// the restore started.
+const DefaultImportLabelNameTemplate = "Import {date} {time}"
+
+const DefaultImportLabelColor = "#f66"
+
+var ErrInvalidImportLabelOptions = errors.New("invalid import label options")
+
+// ParseRestoreImportLabelMode parses the create, existing and none values of the CLI.
+func ParseRestoreImportLabelMode(value string) (RestoreImportLabelMode, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "create":
+		return RestoreImportLabelCreate, nil
+	case "existing":
+		return RestoreImportLabelExisting, nil
+	case "none":
+		return RestoreImportLabelNone, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown mode '%v', expected create, existing or none", ErrInvalidImportLabelOptions, value)
+	}
+}
+
+var importLabelColorRegExp = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+type RestoreImportLabelOptions struct {
+	Mode         RestoreImportLabelMode
+	NameTemplate string // Defaults to DefaultImportLabelNameTemplate.
+	Color        string // Defaults to DefaultImportLabelColor.
+}
+
+// SetImportLabelOptions selects the label applied to every restored message. Must be called before Run.
+func (r *RestoreTask) SetImportLabelOptions(options RestoreImportLabelOptions) error {
+	switch options.Mode {
+	case RestoreImportLabelCreate, RestoreImportLabelNone:
+	case RestoreImportLabelExisting:
+		if len(strings.TrimSpace(options.NameTemplate)) == 0 {
+			return fmt.Errorf("%w: the name of the existing label is missing", ErrInvalidImportLabelOptions)
+		}
+	default:
+		return fmt.Errorf("%w: unknown mode %v", ErrInvalidImportLabelOptions, options.Mode)
+	}
+
+	if len(options.NameTemplate) == 0 {
+		options.NameTemplate = DefaultImportLabelNameTemplate
+	}
+
+	if len(options.Color) == 0 {
+		options.Color = DefaultImportLabelColor
+	} else if !importLabelColorRegExp.MatchString(options.Color) {
+		return fmt.Errorf("%w: '%v' is not a colour of the form #RRGGBB", ErrInvalidImportLabelOptions, options.Color)
+	}
+
+	r.importLabel = options
+
+	return nil
+}
+
+// importLabelName returns the name of the import label of a restore started at the given time.
+func (o RestoreImportLabelOptions) importLabelName(startTime time.Time) string {
+	return strings.NewReplacer(
+		"{date}", startTime.Format("2006-01-02"),
+		"{time}", startTime.Format("15:04:05"),
+	).Replace(o.NameTemplate)
+}
+
 func (r *RestoreTask) createImportLabel() error {
+	if r.importLabel.Mode == RestoreImportLabelNone {
+		r.log.Info("No import label is applied to the restored messages")
+		return nil
+	}
+
+	name := r.importLabel.importLabelName(r.startTime)
+
+	if r.importLabel.Mode == RestoreImportLabelExisting {
+		labels, err := r.session.GetClient().GetLabels(r.ctx, proton.LabelTypeLabel)
+		if err != nil {
+			return err
+		}
+
+		if index := slices.IndexFunc(labels, func(label proton.Label) bool { return strings.EqualFold(label.Name, name) }); index != -1 {
+			r.importLabelID = labels[index].ID
+			r.log.WithField("labelID", r.importLabelID).Info("Reusing existing import label")
+
+			return nil
+		}
+	} else if r.journal != nil && len(r.journal.ImportLabelID()) != 0 {
+		labels, err := r.session.GetClient().GetLabels(r.ctx, proton.LabelTypeLabel)
+		if err != nil {
+			return err
+		}
+
+		if slices.ContainsFunc(labels, func(label proton.Label) bool { return label.ID == r.journal.ImportLabelID() }) {
+			r.importLabelID = r.journal.ImportLabelID()
+			r.log.WithField("labelID", r.importLabelID).Info("Reusing the import label of the interrupted restore")
+
+			return nil
+		}
+	}
+
 	label, err := r.session.GetClient().CreateLabel(
 		r.ctx,
 		proton.CreateLabelReq{
-			Name:     "Import " + time.Now().Format("2006-01-02 15:04:05"),
-			Color:    "#f66",
+			Name:     name,
+			Color:    r.importLabel.Color,
 			Type:     proton.LabelTypeLabel,
 			ParentID: "",
 		},
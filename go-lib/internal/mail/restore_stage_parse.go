@@ -0,0 +1,145 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProtonMail/export-tool/internal/metrics"
+	"github.com/ProtonMail/export-tool/internal/tracing"
+	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/bradenaw/juniper/parallel"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type restoreImportItem struct {
+	messageID string
+	req       proton.ImportReq
+}
+
+// RestoreParseStage parses the messages read from the backup and turns them into import requests.
+type RestoreParseStage struct {
+	log             *logrus.Entry
+	outputCh        chan []restoreImportItem
+	parallelWorkers int
+	panicHandler    async.PanicHandler
+	reporter        Reporter
+	prepare         func(Message) (proton.ImportReq, error)
+	pause           *PauseController
+	metrics         *metrics.Metrics
+}
+
+func NewRestoreParseStage(
+	parallelWorkers int,
+	log *logrus.Entry,
+	panicHandler async.PanicHandler,
+	reporter Reporter,
+	prepare func(Message) (proton.ImportReq, error),
+	pause *PauseController,
+	metrics *metrics.Metrics,
+) *RestoreParseStage {
+	return &RestoreParseStage{
+		log:             log.WithField("stage", "parse"),
+		outputCh:        make(chan []restoreImportItem),
+		parallelWorkers: parallelWorkers,
+		panicHandler:    panicHandler,
+		reporter:        reporter,
+		prepare:         prepare,
+		pause:           pause,
+		metrics:         metrics,
+	}
+}
+
+func (s *RestoreParseStage) Run(ctx context.Context, input <-chan []Message, errReporter StageErrorReporter) {
+	s.log.Debug("Starting")
+	defer s.log.Debug("Exiting")
+	defer close(s.outputCh)
+
+	for chunk := range input {
+		if err := s.pause.Wait(ctx); err != nil {
+			return
+		}
+
+		result, err := s.parseChunk(ctx, chunk, errReporter)
+		if err != nil {
+			errReporter.ReportStageError(err)
+			return
+		}
+
+		if len(result) == 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case s.outputCh <- result:
+		}
+	}
+}
+
+// parseChunk prepares the import requests of chunk. The messages which could not be prepared are left out.
+func (s *RestoreParseStage) parseChunk(ctx context.Context, chunk []Message, errReporter StageErrorReporter) ([]restoreImportItem, error) {
+	start := time.Now()
+	s.metrics.StageStarted(string(RestoreStageParse), len(chunk))
+	defer s.metrics.StageDone(string(RestoreStageParse), len(chunk))
+
+	chunkCtx, span := tracing.Start(ctx, "restore.parse.chunk", attribute.Int("messages", len(chunk)))
+
+	items := make([]restoreImportItem, len(chunk))
+
+	if err := parallel.DoContext(chunkCtx, s.parallelWorkers, len(chunk), func(_ context.Context, i int) error {
+		defer async.HandlePanic(s.panicHandler)
+
+		req, err := s.prepare(chunk[i])
+		if err != nil {
+			s.log.WithField("messageID", chunk[i].metadata.ID).WithError(err).Error("Could not prepare message for import.")
+			if errReporter.ReportMessageError(chunk[i].metadata.ID, FailureStageParse, err) {
+				s.reporter.OnProgress(1)
+				return nil
+			}
+
+			return err
+		}
+
+		items[i] = restoreImportItem{messageID: chunk[i].metadata.ID, req: req}
+
+		return nil
+	}); err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+
+	result := make([]restoreImportItem, 0, len(items))
+	var size uint64
+	for _, item := range items {
+		if len(item.messageID) != 0 {
+			result = append(result, item)
+			size += uint64(len(item.req.Message))
+		}
+	}
+
+	span.SetAttributes(attribute.Int("failed", len(chunk)-len(result)))
+	tracing.End(span, nil)
+	s.metrics.StageFinished(string(RestoreStageParse), len(chunk), size, start)
+
+	return result, nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProtonMail/export-tool/internal/metrics"
+	"github.com/ProtonMail/export-tool/internal/tracing"
+	"github.com/ProtonMail/gluon/async"
+	"github.com/bradenaw/juniper/parallel"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// restoreMessageFilter decides which messages of the backup are skipped by the restore.
+type restoreMessageFilter interface {
+	// skipMessageID is called before the message is read from the backup.
+	skipMessageID(messageID string) bool
+	// skipMessage is called once the message has been read.
+	skipMessage(message Message) bool
+}
+
+// RestoreReadStage reads the messages of the backup in memory bounded chunks.
+type RestoreReadStage struct {
+	loadMessage     func(messageID string) (Message, error)
+	log             *logrus.Entry
+	outputCh        chan []Message
+	parallelWorkers int
+	maxReadMemMB    uint64
+	panicHandler    async.PanicHandler
+	reporter        Reporter
+	filter          restoreMessageFilter
+	pause           *PauseController
+	metrics         *metrics.Metrics
+}
+
+func NewRestoreReadStage(
+	loadMessage func(messageID string) (Message, error),
+	parallelWorkers int,
+	log *logrus.Entry,
+	maxReadMemMB uint64,
+	panicHandler async.PanicHandler,
+	reporter Reporter,
+	filter restoreMessageFilter,
+	pause *PauseController,
+	metrics *metrics.Metrics,
+) *RestoreReadStage {
+	return &RestoreReadStage{
+		loadMessage:     loadMessage,
+		log:             log.WithField("stage", "read"),
+		outputCh:        make(chan []Message),
+		parallelWorkers: parallelWorkers,
+		maxReadMemMB:    maxReadMemMB,
+		panicHandler:    panicHandler,
+		reporter:        reporter,
+		filter:          filter,
+		pause:           pause,
+		metrics:         metrics,
+	}
+}
+
+func (s *RestoreReadStage) Run(ctx context.Context, input []messageInfo, errReporter StageErrorReporter) {
+	s.log.Debug("Starting")
+	defer s.log.Debug("Exiting")
+	defer close(s.outputCh)
+
+	input = xslices.Filter(input, func(info messageInfo) bool {
+		if s.filter.skipMessageID(info.messageID) {
+			s.reporter.OnProgress(1)
+			return false
+		}
+
+		return true
+	})
+
+	for _, infos := range xslices.Chunk(input, restoreReadChunkSize) {
+		for _, chunk := range chunkMemLimitMessageInfo(infos, s.maxReadMemMB) {
+			if len(chunk) == 0 {
+				continue
+			}
+
+			if err := s.pause.Wait(ctx); err != nil {
+				return
+			}
+
+			result, err := s.readChunk(ctx, chunk, errReporter)
+			if err != nil {
+				errReporter.ReportStageError(err)
+				return
+			}
+
+			if len(result) == 0 {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case s.outputCh <- result:
+			}
+		}
+	}
+}
+
+// readChunk loads the messages of chunk. The messages which could not be loaded or are filtered out are left out.
+func (s *RestoreReadStage) readChunk(ctx context.Context, chunk []messageInfo, errReporter StageErrorReporter) ([]Message, error) {
+	start := time.Now()
+	s.metrics.StageStarted(string(RestoreStageRead), len(chunk))
+	defer s.metrics.StageDone(string(RestoreStageRead), len(chunk))
+
+	chunkCtx, span := tracing.Start(ctx, "restore.read.chunk", attribute.Int("messages", len(chunk)))
+
+	messages := make([]Message, len(chunk))
+	keep := make([]bool, len(chunk))
+
+	if err := parallel.DoContext(chunkCtx, s.parallelWorkers, len(chunk), func(_ context.Context, i int) error {
+		defer async.HandlePanic(s.panicHandler)
+
+		message, err := s.loadMessage(chunk[i].messageID)
+		if err != nil {
+			if errReporter.ReportMessageError(chunk[i].messageID, FailureStageRead, err) {
+				s.reporter.OnProgress(1)
+				return nil
+			}
+
+			return err
+		}
+
+		if s.filter.skipMessage(message) {
+			s.reporter.OnProgress(1)
+			return nil
+		}
+
+		messages[i] = message
+		keep[i] = true
+
+		return nil
+	}); err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+
+	result := make([]Message, 0, len(chunk))
+	var size uint64
+	for i, message := range messages {
+		if keep[i] {
+			result = append(result, message)
+			size += uint64(len(message.literal))
+		}
+	}
+
+	span.SetAttributes(attribute.Int("skipped", len(chunk)-len(result)), attribute.Int64("bytes", int64(size))) //nolint:gosec
+	tracing.End(span, nil)
+	s.metrics.StageFinished(string(RestoreStageRead), len(chunk), size, start)
+
+	return result, nil
+}
+
+func chunkMemLimitMessageInfo(batch []messageInfo, maxMemory uint64) [][]messageInfo {
+	// Messages are alive for the 3 stages of the restore, the import also keeps an encrypted copy.
+	const stageMultiplier = 4
+
+	return chunkMemLimit(batch, maxMemory, stageMultiplier, func(info messageInfo) uint64 {
+		return uint64(info.size) //nolint:gosec // no potential of overflowing.
+	})
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/sirupsen/logrus"
+)
+
+// SetSettingsRestore controls whether the mail settings saved in the backup are applied to the account. The display
+// names of the addresses cannot be changed through the API client and are left untouched.
+func (r *RestoreTask) SetSettingsRestore(enabled bool) {
+	r.restoreSettings = enabled
+}
+
+// restoreAccountSettings applies the mail settings of the most recent backup folder holding a settings file.
+func (r *RestoreTask) restoreAccountSettings() error {
+	path, ok := r.findBackupSettingsFile()
+	if !ok {
+		r.log.Warn("The backup holds no account settings, they are not restored")
+		return nil
+	}
+
+	settings, err := readBackupAccountSettings(path)
+	if err != nil {
+		return fmt.Errorf("failed to read account settings: %w", err)
+	}
+
+	return restoreMailSettings(r.ctx, r.session.GetClient(), settings.MailSettings, r.log)
+}
+
+// restoreMailSettings changes the mail settings of the account which differ from backup. A setting which cannot be
+// changed is logged and the others are still restored.
+func restoreMailSettings(ctx context.Context, client apiclient.Client, backup proton.MailSettings, log *logrus.Entry) error {
+	current, err := client.GetMailSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve mail settings: %w", err)
+	}
+
+	type settingUpdate struct {
+		name  string
+		apply func() (proton.MailSettings, error)
+	}
+
+	var updates []settingUpdate
+
+	if backup.DisplayName != current.DisplayName {
+		updates = append(updates, settingUpdate{"display name", func() (proton.MailSettings, error) {
+			return client.SetDisplayName(ctx, proton.SetDisplayNameReq{DisplayName: backup.DisplayName})
+		}})
+	}
+
+	if backup.Signature != current.Signature {
+		updates = append(updates, settingUpdate{"signature", func() (proton.MailSettings, error) {
+			return client.SetSignature(ctx, proton.SetSignatureReq{Signature: backup.Signature})
+		}})
+	}
+
+	if len(backup.DraftMIMEType) != 0 && backup.DraftMIMEType != current.DraftMIMEType {
+		updates = append(updates, settingUpdate{"draft type", func() (proton.MailSettings, error) {
+			return client.SetDraftMIMEType(ctx, proton.SetDraftMIMETypeReq{MIMEType: backup.DraftMIMEType})
+		}})
+	}
+
+	if backup.AttachPublicKey != current.AttachPublicKey {
+		updates = append(updates, settingUpdate{"attach public key", func() (proton.MailSettings, error) {
+			return client.SetAttachPublicKey(ctx, proton.SetAttachPublicKeyReq{AttachPublicKey: backup.AttachPublicKey})
+		}})
+	}
+
+	if backup.Sign != current.Sign {
+		updates = append(updates, settingUpdate{"sign external messages", func() (proton.MailSettings, error) {
+			return client.SetSignExternalMessages(ctx, proton.SetSignExternalMessagesReq{Sign: backup.Sign})
+		}})
+	}
+
+	if backup.PGPScheme != 0 && backup.PGPScheme != current.PGPScheme {
+		updates = append(updates, settingUpdate{"PGP scheme", func() (proton.MailSettings, error) {
+			return client.SetDefaultPGPScheme(ctx, proton.SetDefaultPGPSchemeReq{PGPScheme: backup.PGPScheme})
+		}})
+	}
+
+	for _, update := range updates {
+		if _, err := update.apply(); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+
+			log.WithError(err).WithField("setting", update.name).Warn("Failed to restore mail setting")
+
+			continue
+		}
+
+		log.WithField("setting", update.name).Info("Restored mail setting")
+	}
+
+	return nil
+}
+
+// findBackupSettingsFile returns the path of the settings file of the most recent backup folder holding one.
+func (r *RestoreTask) findBackupSettingsFile() (string, bool) {
+	var dirs []string
+
+	switch source := r.source.(type) {
+	case backupSource:
+		dirs = []string{source.backupDir}
+	case backupChainSource:
+		dirs = source.backupDirs
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path := filepath.Join(dirs[i], getAccountSettingsFileName())
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+func readBackupAccountSettings(path string) (ExportedAccountSettings, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return ExportedAccountSettings{}, err
+	}
+
+	versionedSettings, err := utils.NewVersionedJSON[ExportedAccountSettings](AccountSettingsVersion, data)
+	if err != nil {
+		return ExportedAccountSettings{}, err
+	}
+
+	return versionedSettings.Payload, nil
+}
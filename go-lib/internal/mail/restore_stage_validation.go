@@ -23,64 +23,224 @@ import (
 	"os"
 	"path/filepath"
 
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
 
+var ErrNoMessageMatchesFilter = errors.New("no message of the backup matches the filter")
+
 type messageInfo struct {
 	messageID string
 	timestamp int64
+	size      int
+}
+
+// backupMessage is a message found in a backup folder.
+type backupMessage struct {
+	info      messageInfo
+	dir       string
+	matches   bool     // Whether the message matches the filter of the restore.
+	labelIDs  []string // Only set for the messages matching the filter of a filtered restore.
+	encrypted bool     // Whether parts of the message could not be decrypted during the export.
 }
 
 func (r *RestoreTask) validateBackupDir(reporter Reporter) ([]messageInfo, error) {
 	r.log.Info("Verifying backup folder")
 
-	messageList := make([]messageInfo, 0)
-	err := r.walkBackupDir(func(path string) {
+	messages, err := r.scanBackupDir(r.backupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) > 0 {
+		r.source = backupSource{backupDir: r.backupDir}
+
+		return r.selectBackupMessages(messages, reporter)
+	}
+
+	subDirs, err := r.getTimestampedBackupDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	subDirs, err = r.selectBackupFolders(subDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subDirs) == 0 {
+		return nil, errors.New("no importable mail found")
+	}
+
+	if len(subDirs) > 1 {
+		return r.validateBackupChain(subDirs, reporter)
+	}
+
+	r.log.WithField("folderName", subDirs[0]).Info("A potential backup sub-folder has been found and will be inspected")
+	r.backupDir = subDirs[0]
+
+	return r.validateBackupDir(reporter)
+}
+
+// validateBackupChain restores several backups of the same folder together, e.g. a full backup followed by more
+// recent ones. A message found in several backups is restored once, from the most recent backup.
+func (r *RestoreTask) validateBackupChain(backupDirs []string, reporter Reporter) ([]messageInfo, error) {
+	// The name of the sub-folders holds the time of the backup.
+	slices.Sort(backupDirs)
+
+	r.log.WithField("folderCount", len(backupDirs)).Info("Several backup sub-folders have been found and will be merged")
+
+	byID := make(map[string]backupMessage)
+	duplicateCount := 0
+
+	for _, dir := range backupDirs {
+		messages, err := r.scanBackupDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(messages) == 0 {
+			r.log.WithField("folderName", dir).Warn("Backup sub-folder contains no message. Skipping.")
+			continue
+		}
+
+		for _, message := range messages {
+			if _, ok := byID[message.info.messageID]; ok {
+				duplicateCount++
+			}
+
+			byID[message.info.messageID] = message
+		}
+	}
+
+	if len(byID) == 0 {
+		return nil, errors.New("no importable mail found")
+	}
+
+	r.log.WithField("duplicateCount", duplicateCount).Info("Messages found in several backups are restored once")
+
+	messages := maps.Values(byID)
+	messageDirs := make(map[string]string, len(messages))
+
+	for _, message := range messages {
+		messageDirs[message.info.messageID] = message.dir
+	}
+
+	r.source = backupChainSource{backupDirs: backupDirs, messageDirs: messageDirs}
+
+	return r.selectBackupMessages(messages, reporter)
+}
+
+// scanBackupDir lists the messages of a backup folder.
+func (r *RestoreTask) scanBackupDir(dir string) ([]backupMessage, error) {
+	filtered := r.isFiltered()
+
+	var messages []backupMessage
+
+	err := r.walkBackupDir(dir, func(path string) {
 		metadata, err := loadMetadataFile(emlToMetadataFilename(path))
-		if err == nil {
-			messageList = append(messageList, messageInfo{
+		if err != nil {
+			return
+		}
+
+		message := backupMessage{
+			info: messageInfo{
 				messageID: metadata.ID,
 				timestamp: metadata.Time,
-			})
+				size:      metadata.Size,
+			},
+			dir:     dir,
+			matches: true,
 		}
+
+		if filtered {
+			message.matches = r.filter.MatchesMetadata(metadata.MessageMetadata)
+			if message.matches {
+				message.labelIDs = metadata.LabelIDs
+			}
+		}
+
+		if metadata.WriterType != MessageWriterTypeDecryptedAndBuilt {
+			parts, err := encryptedParts(filepath.Join(dir, metadata.ID))
+			if err != nil {
+				r.log.WithField("messageID", metadata.ID).WithError(err).Warn("Failed to list the parts of the message")
+			}
+
+			message.encrypted = len(parts) != 0
+		}
+
+		messages = append(messages, message)
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	messageCount := len(messageList)
-	if messageCount > 0 {
+	if len(messages) > 0 {
 		labelsFilename := getLabelFileName()
-		if _, err := os.Stat(filepath.Join(r.backupDir, labelsFilename)); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(filepath.Join(dir, labelsFilename)); errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("the labels file '%v' could not be found", labelsFilename)
 		}
+	}
 
-		reporter.SetMessageTotal(uint64(messageCount))
-		reporter.SetMessageProcessed(0)
-		r.importableCount = int64(messageCount)
-		r.log.WithField("messageCount", messageCount).Info("Found importable messages")
+	return messages, nil
+}
+
+// selectBackupMessages returns the messages to restore, oldest first.
+func (r *RestoreTask) selectBackupMessages(messages []backupMessage, reporter Reporter) ([]messageInfo, error) {
+	filtered := r.isFiltered()
+	if filtered {
+		r.filteredLabelIDs = make(map[string]struct{})
+	}
 
-		slices.SortFunc(messageList, func(lhs, rhs messageInfo) bool { return lhs.timestamp < rhs.timestamp })
+	messageList := make([]messageInfo, 0, len(messages))
+	r.encryptedMessageIDs = nil
 
-		return messageList, nil
+	for _, message := range messages {
+		if !message.matches {
+			continue
+		}
+
+		if message.encrypted {
+			r.log.WithField("messageID", message.info.messageID).Warn("Message is still encrypted and cannot be restored. Skipping.")
+			r.encryptedMessageIDs = append(r.encryptedMessageIDs, message.info.messageID)
+
+			continue
+		}
+
+		for _, labelID := range message.labelIDs {
+			r.filteredLabelIDs[labelID] = struct{}{}
+		}
+
+		messageList = append(messageList, message.info)
 	}
 
-	subDirs, err := r.getTimestampedBackupDirs()
-	if err != nil {
-		return nil, err
+	messageCount := len(messageList)
+
+	encryptedCount := len(r.encryptedMessageIDs)
+
+	if filtered {
+		r.log.WithField("filteredOutCount", len(messages)-messageCount-encryptedCount).Info("Messages not matching the filter are not restored")
 	}
 
-	if len(subDirs) == 0 {
-		return nil, errors.New("no importable mail found")
+	if encryptedCount != 0 {
+		r.log.WithField("encryptedCount", encryptedCount).Warn("Messages which are still encrypted are not restored")
 	}
 
-	if len(subDirs) > 1 {
-		return nil, errors.New("the specified folder contains more than one backup sub-folder")
+	if messageCount == 0 {
+		if encryptedCount != 0 {
+			return nil, fmt.Errorf("%w: every message of the backup is encrypted", ErrMessageStillEncrypted)
+		}
+
+		return nil, ErrNoMessageMatchesFilter
 	}
 
-	r.log.WithField("folderName", subDirs[0]).Info("A potential backup sub-folder has been found and will be inspected")
-	r.backupDir = subDirs[0]
+	reporter.SetMessageTotal(uint64(messageCount))
+	reporter.SetMessageProcessed(0)
+	r.importableCount = int64(messageCount)
+	r.log.WithField("messageCount", messageCount).Info("Found importable messages")
 
-	return r.validateBackupDir(reporter)
+	slices.SortFunc(messageList, func(lhs, rhs messageInfo) bool { return lhs.timestamp < rhs.timestamp })
+
+	return messageList, nil
 }
@@ -1,9 +1,17 @@
 package mail
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gluon/rfc822"
 	"github.com/ProtonMail/go-proton-api"
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 )
 
@@ -136,3 +144,289 @@ func TestMatchLocalLabelWithRemote(t *testing.T) {
 	require.Len(t, labelID, 0)
 	require.Equal(t, newName, "l1 (1)")
 }
+
+func TestRemoteMessageIndex(t *testing.T) {
+	idx := newRemoteMessageIndex()
+	idx.add(proton.MessageMetadata{ID: "remote1", ExternalID: "<ext1@proton.me>", Time: 1700000000})
+	idx.add(proton.MessageMetadata{ID: "remote2"})
+
+	// Same internal ID.
+	require.True(t, idx.contains(Message{metadata: proton.MessageMetadata{ID: "remote2"}}))
+
+	// Same external ID and date, brackets are ignored.
+	require.True(t, idx.contains(Message{metadata: proton.MessageMetadata{ID: "local", ExternalID: "ext1@proton.me", Time: 1700000000}}))
+
+	// Same external ID but another date, e.g. a resent message.
+	require.False(t, idx.contains(Message{metadata: proton.MessageMetadata{ID: "local", ExternalID: "ext1@proton.me", Time: 1700000001}}))
+
+	// Same external ID without a known date.
+	require.False(t, idx.contains(Message{metadata: proton.MessageMetadata{ID: "local", ExternalID: "ext1@proton.me"}}))
+
+	// External ID and date from the headers.
+	require.True(t, idx.contains(Message{
+		literal: []byte("X-Pm-Internal-Id: local\r\nMessage-Id: <ext1@proton.me>\r\nDate: Tue, 14 Nov 2023 22:13:20 +0000\r\nSubject: a\r\n\r\nbody\r\n"),
+	}))
+
+	require.False(t, idx.contains(Message{
+		literal:  []byte("Message-Id: <ext2@proton.me>\r\nSubject: a\r\n\r\nbody\r\n"),
+		metadata: proton.MessageMetadata{ID: "local", Time: 1700000000},
+	}))
+	require.False(t, idx.contains(Message{literal: []byte("Subject: a\r\n\r\nbody\r\n")}))
+}
+
+func TestMessageDedupeKeys(t *testing.T) {
+	literal := []byte("X-Pm-Internal-Id: header-id\r\nX-Pm-External-Id: <header-ext>\r\nMessage-Id: <msg-id>\r\nDate: Tue, 14 Nov 2023 22:13:20 +0000\r\n\r\nbody\r\n")
+
+	keys := messageDedupeKeys(Message{literal: literal})
+	require.Equal(t, "header-id", keys.internalID)
+	require.Equal(t, "header-ext", keys.externalID)
+	require.Equal(t, int64(1700000000), keys.time)
+
+	keys = messageDedupeKeys(Message{
+		literal:  literal,
+		metadata: proton.MessageMetadata{ID: "meta-id", ExternalID: "meta-ext", Time: 1600000000},
+	})
+	require.Equal(t, "meta-id", keys.internalID)
+	require.Equal(t, "meta-ext", keys.externalID)
+	require.Equal(t, int64(1600000000), keys.time)
+}
+
+func TestRestoreJournal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backup")
+	require.NoError(t, os.Mkdir(dir, 0o700))
+
+	scope := RestoreJournalScope{SourceFormat: RestoreSourceBackup, BackupFolders: []string{"mail_20240101_120000"}}
+
+	journal, err := OpenRestoreJournal(dir, scope, "user")
+	require.NoError(t, err)
+	require.False(t, journal.IsResumed())
+	require.NoError(t, journal.SetLabels("import", map[string]string{"local": "remote"}))
+	require.NoError(t, journal.AddImported("1", "2"))
+	require.NoError(t, journal.AddImported("3"))
+	require.NoError(t, journal.Close())
+	require.FileExists(t, filepath.Join(dir, getRestoreJournalFileName(scope.key())))
+
+	// Resume into the same account, the journal moves along with the backup.
+	moved := filepath.Join(t.TempDir(), "moved")
+	require.NoError(t, os.Rename(dir, moved))
+	dir = moved
+
+	journal, err = OpenRestoreJournal(dir, scope, "user")
+	require.NoError(t, err)
+	require.True(t, journal.IsResumed())
+	require.Equal(t, "import", journal.ImportLabelID())
+	require.Equal(t, map[string]string{"local": "remote"}, journal.LabelMapping())
+	require.Equal(t, 3, journal.ImportedCount())
+	require.True(t, journal.IsImported("2"))
+	require.False(t, journal.IsImported("4"))
+	require.NoError(t, journal.Close())
+
+	// A restore of the same folder with another filter, backup folders or target address has its own journal.
+	for _, other := range []RestoreJournalScope{
+		{SourceFormat: RestoreSourceBackup, BackupFolders: scope.BackupFolders, Filter: &Filter{Subject: "report"}},
+		{SourceFormat: RestoreSourceBackup, BackupFolders: []string{"mail_20240201_120000"}},
+		{SourceFormat: RestoreSourceBackup, BackupFolders: scope.BackupFolders, TargetAddress: "other@proton.me"},
+	} {
+		journal, err = OpenRestoreJournal(dir, other, "user")
+		require.NoError(t, err)
+		require.False(t, journal.IsResumed())
+		require.False(t, journal.IsImported("1"))
+		require.NoError(t, journal.Remove())
+		require.FileExists(t, filepath.Join(dir, getRestoreJournalFileName(scope.key())))
+	}
+
+	// Another account starts from scratch.
+	journal, err = OpenRestoreJournal(dir, scope, "other")
+	require.NoError(t, err)
+	require.False(t, journal.IsResumed())
+	require.False(t, journal.IsImported("1"))
+
+	require.NoError(t, journal.Remove())
+	require.NoFileExists(t, filepath.Join(dir, getRestoreJournalFileName(scope.key())))
+	require.NoFileExists(t, filepath.Join(dir, getRestoreJournalLogFileName(scope.key())))
+}
+
+func TestRestoreImportLabelOptions(t *testing.T) {
+	task := &RestoreTask{labelMapping: map[string]string{proton.InboxLabel: proton.InboxLabel}}
+
+	require.NoError(t, task.SetImportLabelOptions(RestoreImportLabelOptions{}))
+	require.Equal(t, DefaultImportLabelColor, task.importLabel.Color)
+
+	startTime := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	require.Equal(t, "Import 2024-03-01 09:30:00", task.importLabel.importLabelName(startTime))
+
+	require.NoError(t, task.SetImportLabelOptions(RestoreImportLabelOptions{NameTemplate: "Restored on {date}", Color: "#00AA55"}))
+	require.Equal(t, "Restored on 2024-03-01", task.importLabel.importLabelName(startTime))
+	require.Equal(t, "#00AA55", task.importLabel.Color)
+
+	err := task.SetImportLabelOptions(RestoreImportLabelOptions{Color: "red"})
+	require.ErrorIs(t, err, ErrInvalidImportLabelOptions)
+
+	err = task.SetImportLabelOptions(RestoreImportLabelOptions{Mode: RestoreImportLabelExisting})
+	require.ErrorIs(t, err, ErrInvalidImportLabelOptions)
+
+	err = task.SetImportLabelOptions(RestoreImportLabelOptions{Mode: RestoreImportLabelMode(42)})
+	require.ErrorIs(t, err, ErrInvalidImportLabelOptions)
+
+	// Without import label, messages only get their own labels.
+	labelIDs, err := task.getLabelList([]string{proton.InboxLabel})
+	require.NoError(t, err)
+	require.Equal(t, []string{proton.InboxLabel}, labelIDs)
+
+	task.importLabelID = "import"
+	labelIDs, err = task.getLabelList([]string{proton.InboxLabel})
+	require.NoError(t, err)
+	require.Equal(t, []string{"import", proton.InboxLabel}, labelIDs)
+}
+
+func TestRestoreFilter(t *testing.T) {
+	dir := t.TempDir()
+	writeBackupMessage(t, dir, "1", "Invoice March")
+	writeBackupMessage(t, dir, "2", "Holidays")
+	writeBackupMessage(t, dir, "3", "Invoice April")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, getLabelFileName()), []byte("{}"), 0o600))
+
+	task := &RestoreTask{ctx: context.Background(), backupDir: dir, log: logrus.WithField("test", "test")}
+	task.SetFilter(&Filter{Subject: "invoice"})
+
+	infos, err := task.validateBackupDir(NullProgressReporter{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"1", "3"}, xslices.Map(infos, func(info messageInfo) string { return info.messageID }))
+	require.Equal(t, int64(2), task.GetImportableCount())
+
+	task.SetFilter(&Filter{Subject: "tax"})
+	_, err = task.validateBackupDir(NullProgressReporter{})
+	require.ErrorIs(t, err, ErrNoMessageMatchesFilter)
+
+	// Only the labels of the matching messages and their parents are restored.
+	task.source = testLabelSource{backupLabels: []proton.Label{
+		{ID: proton.InboxLabel, Name: "Inbox", Type: proton.LabelTypeSystem},
+		{ID: "work", Name: "Work", Type: proton.LabelTypeFolder},
+		{ID: "projects", ParentID: "work", Name: "Projects", Type: proton.LabelTypeFolder},
+		{ID: "news", Name: "News", Type: proton.LabelTypeLabel},
+	}}
+	task.filteredLabelIDs = map[string]struct{}{proton.InboxLabel: {}, "projects": {}}
+
+	plans, err := task.planLabelsWithRemote(nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{proton.InboxLabel, "work", "projects"}, xslices.Map(plans, func(plan RestoreLabelPlan) string { return plan.BackupID }))
+}
+
+func writeBackupLabels(t *testing.T, dir string, labels []proton.Label) {
+	data, err := utils.GenerateVersionedJSON(LabelMetadataVersion, labels)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, getLabelFileName()), data, 0o600))
+}
+
+func TestRestoreBackupChain(t *testing.T) {
+	dir := t.TempDir()
+	older := filepath.Join(dir, "mail_20240101_120000")
+	newer := filepath.Join(dir, "mail_20240201_120000")
+	require.NoError(t, os.Mkdir(older, 0o700))
+	require.NoError(t, os.Mkdir(newer, 0o700))
+
+	writeBackupMessage(t, older, "1", "one")
+	writeBackupMessage(t, older, "2", "two")
+	writeBackupLabels(t, older, []proton.Label{{ID: "work", Name: "Work"}, {ID: "news", Name: "News"}})
+	writeBackupMessage(t, newer, "2", "two, updated")
+	writeBackupMessage(t, newer, "3", "three")
+	writeBackupLabels(t, newer, []proton.Label{{ID: "work", Name: "Job"}, {ID: "travel", Name: "Travel"}})
+
+	newTask := func() *RestoreTask {
+		return &RestoreTask{ctx: context.Background(), backupDir: dir, log: logrus.WithField("test", "test")}
+	}
+
+	task := newTask()
+	folders, err := task.ListBackupFolders()
+	require.NoError(t, err)
+	require.Equal(t, []string{"mail_20240101_120000", "mail_20240201_120000"}, folders)
+
+	// All backups are merged, messages present in several backups are read from the most recent one.
+	infos, err := task.validateBackupDir(NullProgressReporter{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"1", "2", "3"}, xslices.Map(infos, func(info messageInfo) string { return info.messageID }))
+	require.Equal(t, dir, task.GetBackupPath())
+
+	message, err := task.source.loadMessage("2")
+	require.NoError(t, err)
+	require.Equal(t, "two, updated", message.metadata.Subject)
+
+	labels, err := task.source.labels()
+	require.NoError(t, err)
+	require.Equal(t, []string{"Job", "News", "Travel"}, xslices.Map(labels, func(label proton.Label) string { return label.Name }))
+
+	// A single backup can be selected.
+	task = newTask()
+	task.SetBackupFolders([]string{"mail_20240101_120000"})
+	infos, err = task.validateBackupDir(NullProgressReporter{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"1", "2"}, xslices.Map(infos, func(info messageInfo) string { return info.messageID }))
+	require.Equal(t, older, task.GetBackupPath())
+
+	task = newTask()
+	task.SetBackupFolders([]string{"mail_20240301_120000"})
+	_, err = task.validateBackupDir(NullProgressReporter{})
+	require.ErrorIs(t, err, ErrUnknownBackupFolder)
+}
+
+func writeSplitBackupMessage(t *testing.T, dir, id string, encrypted bool) {
+	messageDir := filepath.Join(dir, id)
+	require.NoError(t, os.Mkdir(messageDir, 0o700))
+
+	attachment := proton.Attachment{ID: "att", Name: "notes.txt", MIMEType: "text/plain"}
+	require.NoError(t, os.WriteFile(filepath.Join(messageDir, attachmentFileName(attachment.ID, attachment.Name)), []byte("notes"), 0o600))
+
+	if encrypted {
+		require.NoError(t, os.WriteFile(filepath.Join(messageDir, bodyFileNameEncrypted()), []byte("encrypted"), 0o600))
+	} else {
+		require.NoError(t, os.WriteFile(filepath.Join(messageDir, bodyFileName()), []byte("hello"), 0o600))
+	}
+
+	data, err := utils.GenerateVersionedJSON(MessageMetadataVersion, MessageMetadata{
+		MessageMetadata: proton.MessageMetadata{ID: id, Subject: "split " + id},
+		Attachments:     []proton.Attachment{attachment},
+		MIMEType:        rfc822.TextPlain,
+		Headers:         "Subject: split " + id + "\r\nFrom: sender@proton.me\r\nContent-Type: text/plain\r\n",
+		WriterType:      MessageWriterTypeFailedToAssemble,
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, getMetadataFileName(id)), data, 0o600))
+}
+
+func TestRestoreSplitMessages(t *testing.T) {
+	dir := t.TempDir()
+	writeBackupMessage(t, dir, "1", "one")
+	writeSplitBackupMessage(t, dir, "2", false)
+	writeSplitBackupMessage(t, dir, "3", true)
+	writeBackupLabels(t, dir, nil)
+
+	task := &RestoreTask{ctx: context.Background(), backupDir: dir, log: logrus.WithField("test", "test")}
+	infos, err := task.validateBackupDir(NullProgressReporter{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"1", "2"}, xslices.Map(infos, func(info messageInfo) string { return info.messageID }))
+	require.Equal(t, int64(1), task.GetEncryptedCount())
+
+	message, err := task.source.loadMessage("2")
+	require.NoError(t, err)
+
+	section := rfc822.Parse(message.literal)
+	header, err := section.ParseHeader()
+	require.NoError(t, err)
+	require.Equal(t, "split 2", header.Get("Subject"))
+	require.Equal(t, "sender@proton.me", header.Get("From"))
+
+	children, err := section.Children()
+	require.NoError(t, err)
+	require.Len(t, children, 2)
+
+	body, err := children[0].DecodedBody()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(body))
+
+	attachment, err := children[1].DecodedBody()
+	require.NoError(t, err)
+	require.Equal(t, "notes", string(attachment))
+
+	_, err = assembleSplitMessage(filepath.Join(dir, "3"), MessageMetadata{})
+	require.ErrorIs(t, err, ErrMessageStillEncrypted)
+}
@@ -1,20 +1,31 @@
 package mail
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/bradenaw/juniper/xslices"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
 )
 
-func (r *RestoreTask) walkBackupDir(fn func(emlPath string)) error {
-	return filepath.Walk(r.backupDir, func(path string, info fs.FileInfo, err error) error {
+var ErrUnknownBackupFolder = errors.New("backup sub-folder not found")
+
+func (r *RestoreTask) walkBackupDir(dir string, fn func(emlPath string)) error {
+	return walkBackupDir(r.ctx, dir, fn)
+}
+
+// walkBackupDir calls fn with the path of the EML file of every message of the backup folder dir.
+func walkBackupDir(ctx context.Context, dir string, fn func(emlPath string)) error {
+	return filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
 		select {
-		case <-r.ctx.Done():
-			return r.ctx.Err()
+		case <-ctx.Done():
+			return ctx.Err()
 		default:
 		}
 
@@ -23,14 +34,21 @@ func (r *RestoreTask) walkBackupDir(fn func(emlPath string)) error {
 			return nil
 		}
 
-		// Skip subdirectories - backup structure is flat (all .eml files in r.backupDir).
-		// If backup is in a timestamped subdirectory (mail_YYYYMMDD_HHMMSS), the validation
-		// logic updates r.backupDir to point to that subdirectory before calling this function.
-		if info.IsDir() && (path != r.backupDir) {
+		// Skip subdirectories - backup structure is flat (all .eml files in dir).
+		// Backups in timestamped subdirectories (mail_YYYYMMDD_HHMMSS) are walked one
+		// by one by the validation logic. A subdirectory with a metadata file holds the
+		// parts of a message which could not be assembled, it is reported with the path
+		// of its missing EML file.
+		if info.IsDir() && (path != dir) {
+			emlPath := filepath.Join(dir, getEMLFileName(info.Name()))
+			if _, err := os.Stat(emlToMetadataFilename(emlPath)); err == nil {
+				fn(emlPath)
+			}
+
 			return filepath.SkipDir
 		}
 
-		emlPath := filepath.Join(r.backupDir, info.Name())
+		emlPath := filepath.Join(dir, info.Name())
 		if !strings.HasSuffix(emlPath, emlExtension) {
 			return nil
 		}
@@ -77,3 +95,38 @@ func (r *RestoreTask) getTimestampedBackupDirs() ([]string, error) {
 
 	return result, nil
 }
+
+// ListBackupFolders returns the names of the backup sub-folders of the backup folder, oldest first.
+func (r *RestoreTask) ListBackupFolders() ([]string, error) {
+	dirs, err := r.getTimestampedBackupDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	names := xslices.Map(dirs, filepath.Base)
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// selectBackupFolders returns the backup sub-folders selected by SetBackupFolders.
+func (r *RestoreTask) selectBackupFolders(dirs []string) ([]string, error) {
+	if len(r.backupFolders) == 0 {
+		return dirs, nil
+	}
+
+	result := make([]string, 0, len(r.backupFolders))
+
+	for _, name := range r.backupFolders {
+		index := slices.IndexFunc(dirs, func(dir string) bool { return filepath.Base(dir) == strings.TrimSpace(name) })
+		if index < 0 {
+			return nil, fmt.Errorf("%w: '%v'", ErrUnknownBackupFolder, name)
+		}
+
+		if !slices.Contains(result, dirs[index]) {
+			result = append(result, dirs[index])
+		}
+	}
+
+	return result, nil
+}
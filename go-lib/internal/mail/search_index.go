@@ -0,0 +1,392 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gluon/rfc822"
+	"github.com/emersion/go-message/charset"
+	"github.com/sirupsen/logrus"
+)
+
+const SearchIndexVersion = 1
+
+// maxSearchTermLength is the length, in runes, above which a word is not indexed. Longer words are most likely
+// encoded data rather than text.
+const maxSearchTermLength = 64
+
+// SearchField is the part of a message a search term is matched against.
+type SearchField string
+
+const (
+	SearchFieldFrom       SearchField = "from"       // From, Sender and Reply-To headers.
+	SearchFieldTo         SearchField = "to"         // To, Cc and Bcc headers.
+	SearchFieldSubject    SearchField = "subject"    // Subject header.
+	SearchFieldBody       SearchField = "body"       // Decoded text and HTML bodies.
+	SearchFieldAttachment SearchField = "attachment" // File names of the attachments.
+)
+
+//nolint:gochecknoglobals
+var searchFields = []SearchField{SearchFieldFrom, SearchFieldTo, SearchFieldSubject, SearchFieldBody, SearchFieldAttachment}
+
+// SearchDocument is a message of the search index.
+type SearchDocument struct {
+	ID      string
+	Path    string // Path of the EML file, relative to the folder of the index.
+	Subject string
+	From    string
+	Date    int64 // Unix time of the Date header, 0 if unknown.
+}
+
+// SearchIndex is a full-text index of the EML files of an export folder. Only the messages saved as EML files are
+// indexed, the messages saved in parts are not.
+type SearchIndex struct {
+	lock      sync.RWMutex
+	documents []SearchDocument
+	terms     map[SearchField]map[string][]int // Sorted indices of the documents holding each term of each field.
+	ids       map[string]struct{}
+}
+
+type searchIndexData struct {
+	Documents []SearchDocument
+	Terms     map[SearchField]map[string][]int
+}
+
+// SetSearchIndex controls whether the messages are added to a search index of the export while they are written.
+func (e *ExportTask) SetSearchIndex(enabled bool) {
+	e.searchIndex = enabled
+}
+
+func NewSearchIndex() *SearchIndex {
+	index := &SearchIndex{
+		terms: make(map[SearchField]map[string][]int, len(searchFields)),
+		ids:   make(map[string]struct{}),
+	}
+
+	for _, field := range searchFields {
+		index.terms[field] = make(map[string][]int)
+	}
+
+	return index
+}
+
+// LoadSearchIndex reads the search index of the folder dir.
+func LoadSearchIndex(dir string) (*SearchIndex, error) {
+	data, err := os.ReadFile(filepath.Join(dir, getSearchIndexFileName())) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	versioned, err := utils.NewVersionedJSON[searchIndexData](SearchIndexVersion, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search index: %w", err)
+	}
+
+	index := NewSearchIndex()
+	index.documents = versioned.Payload.Documents
+
+	for field, terms := range versioned.Payload.Terms {
+		if terms != nil {
+			index.terms[field] = terms
+		}
+	}
+
+	for _, document := range index.documents {
+		index.ids[document.ID] = struct{}{}
+	}
+
+	return index, nil
+}
+
+// BuildSearchIndex indexes every EML file found in the folder dir and its sub-folders.
+func BuildSearchIndex(ctx context.Context, dir string) (*SearchIndex, error) {
+	index := NewSearchIndex()
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Cannot inspect path. Skipping.")
+			return nil
+		}
+
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), emlExtension) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		literal, err := os.ReadFile(path) //nolint:gosec
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Failed to read message, it is not indexed")
+			return nil
+		}
+
+		id := strings.TrimSuffix(entry.Name(), emlExtension)
+		if err := index.AddMessage(id, filepath.ToSlash(relPath), literal); err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Failed to index message")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// OpenSearchIndex returns the search index of the folder dir. The index is built and saved through tmpDir if the folder
+// has none or if rebuild is set.
+func OpenSearchIndex(ctx context.Context, dir, tmpDir string, rebuild bool) (*SearchIndex, error) {
+	if !rebuild {
+		index, err := LoadSearchIndex(dir)
+		if err == nil {
+			return index, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.WithError(err).Warn("Failed to load the search index, it is rebuilt")
+		}
+	}
+
+	logrus.WithField("dir", dir).Info("Building search index")
+
+	index, err := BuildSearchIndex(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := index.Save(tmpDir, dir); err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// Len returns the number of messages of the index.
+func (s *SearchIndex) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.documents)
+}
+
+// AddMessage indexes the headers, the text bodies and the attachment names of the EML message literal. A message
+// already part of the index is ignored.
+func (s *SearchIndex) AddMessage(id, path string, literal []byte) error {
+	section := rfc822.Parse(literal)
+
+	header, err := section.ParseHeader()
+	if err != nil {
+		return fmt.Errorf("failed to parse message header: %w", err)
+	}
+
+	document := SearchDocument{
+		ID:      id,
+		Path:    path,
+		Subject: decodeSearchHeader(header.Get("Subject")),
+		From:    decodeSearchHeader(header.Get("From")),
+	}
+
+	if date, err := mail.ParseDate(header.Get("Date")); err == nil {
+		document.Date = date.Unix()
+	}
+
+	terms := make(map[SearchField]map[string]struct{}, len(searchFields))
+	for _, field := range searchFields {
+		terms[field] = make(map[string]struct{})
+	}
+
+	addTerms := func(field SearchField, text string) {
+		for _, term := range tokenizeSearchText(text) {
+			terms[field][term] = struct{}{}
+		}
+	}
+
+	for _, key := range []string{"From", "Sender", "Reply-To"} {
+		addTerms(SearchFieldFrom, decodeSearchHeader(header.Get(key)))
+	}
+
+	for _, key := range []string{"To", "Cc", "Bcc"} {
+		addTerms(SearchFieldTo, decodeSearchHeader(header.Get(key)))
+	}
+
+	addTerms(SearchFieldSubject, document.Subject)
+
+	if err := section.Walk(func(part *rfc822.Section) error {
+		if name := searchPartFileName(part); len(name) != 0 {
+			addTerms(SearchFieldAttachment, name)
+			return nil
+		}
+
+		if text, ok := searchPartText(part); ok {
+			addTerms(SearchFieldBody, text)
+		}
+
+		return nil
+	}); err != nil {
+		logrus.WithError(err).WithField("msg-id", id).Warn("Failed to parse message body, only its headers are indexed")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.ids[id]; ok {
+		return nil
+	}
+
+	docIndex := len(s.documents)
+	s.documents = append(s.documents, document)
+	s.ids[id] = struct{}{}
+
+	for field, fieldTerms := range terms {
+		for term := range fieldTerms {
+			s.terms[field][term] = append(s.terms[field][term], docIndex)
+		}
+	}
+
+	return nil
+}
+
+// Save writes the index to the folder dir.
+func (s *SearchIndex) Save(tmpDir, dir string) error {
+	s.lock.RLock()
+	data, err := utils.GenerateVersionedJSON(SearchIndexVersion, searchIndexData{Documents: s.documents, Terms: s.terms})
+	s.lock.RUnlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to json encode search index: %w", err)
+	}
+
+	return utils.WriteFileSafe(tmpDir, filepath.Join(dir, getSearchIndexFileName()), data, &utils.Sha256IntegrityChecker{})
+}
+
+// searchPartFileName returns the file name of the part if it is an attachment.
+func searchPartFileName(part *rfc822.Section) string {
+	header, err := part.ParseHeader()
+	if err != nil {
+		return ""
+	}
+
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && len(params["filename"]) != 0 {
+		return decodeSearchHeader(params["filename"])
+	}
+
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil && len(params["name"]) != 0 {
+		return decodeSearchHeader(params["name"])
+	}
+
+	return ""
+}
+
+// searchPartText returns the decoded text of a text/plain or text/html part.
+func searchPartText(part *rfc822.Section) (string, bool) {
+	mimeType, params, err := part.ContentType()
+	if err != nil || (mimeType != rfc822.TextPlain && mimeType != rfc822.TextHTML) {
+		return "", false
+	}
+
+	body, err := part.DecodedBody()
+	if err != nil {
+		return "", false
+	}
+
+	text := string(body)
+
+	if charsetName := params["charset"]; len(charsetName) != 0 && !strings.EqualFold(charsetName, "utf-8") && !strings.EqualFold(charsetName, "us-ascii") {
+		if reader, err := charset.Reader(charsetName, strings.NewReader(text)); err == nil {
+			if decoded, err := io.ReadAll(reader); err == nil {
+				text = string(decoded)
+			}
+		}
+	}
+
+	if mimeType == rfc822.TextHTML {
+		text = stripHTML(text)
+	}
+
+	return text, true
+}
+
+//nolint:gochecknoglobals
+var (
+	htmlHiddenRegExp = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)\s*>`)
+	htmlTagRegExp    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// stripHTML returns the text of an HTML document.
+func stripHTML(text string) string {
+	text = htmlHiddenRegExp.ReplaceAllString(text, " ")
+	text = htmlTagRegExp.ReplaceAllString(text, " ")
+
+	return html.UnescapeString(text)
+}
+
+// decodeSearchHeader decodes the RFC 2047 encoded words of a header value.
+func decodeSearchHeader(value string) string {
+	decoder := mime.WordDecoder{CharsetReader: charset.Reader}
+
+	decoded, err := decoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+
+	return decoded
+}
+
+// tokenizeSearchText splits text into lower case words made of letters and digits.
+func tokenizeSearchText(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := words[:0]
+
+	for _, word := range words {
+		if len([]rune(word)) <= maxSearchTermLength {
+			terms = append(terms, word)
+		}
+	}
+
+	return terms
+}
+
+func getSearchIndexFileName() string {
+	return "search_index.json"
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bradenaw/juniper/xslices"
+	"github.com/stretchr/testify/require"
+)
+
+const searchTestPlainMessage = "From: Alice <alice@proton.me>\r\n" +
+	"To: Bob <bob@example.com>\r\n" +
+	"Subject: Quarterly report\r\n" +
+	"Date: Mon, 15 Jan 2024 10:00:00 +0000\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"The numbers are ready for the caf=E9 meeting.\r\n"
+
+const searchTestMultipartMessage = "From: Carol <carol@example.com>\r\n" +
+	"To: Alice <alice@proton.me>\r\n" +
+	"Cc: Dave <dave@example.com>\r\n" +
+	"Subject: =?UTF-8?B?SG9saWRheSBwaG90b3M=?=\r\n" +
+	"Date: Tue, 20 Feb 2024 10:00:00 +0000\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"PHN0eWxlPi5iZWFjaCB7fTwvc3R5bGU+PHA+TG9vayBhdCB0aGUgPGI+bW91bnRhaW5zPC9iPjwvcD4=\r\n" +
+	"--b\r\n" +
+	"Content-Type: image/jpeg\r\n" +
+	"Content-Disposition: attachment; filename=\"summit.jpg\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"AAAA\r\n" +
+	"--b--\r\n"
+
+func writeSearchTestMessages(t *testing.T) string {
+	dir := t.TempDir()
+	subDir := filepath.Join(dir, "mail_20240101_120000")
+	require.NoError(t, os.Mkdir(subDir, 0o700))
+
+	require.NoError(t, os.WriteFile(filepath.Join(subDir, getEMLFileName("plain")), []byte(searchTestPlainMessage), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(subDir, getEMLFileName("multipart")), []byte(searchTestMultipartMessage), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(subDir, getMetadataFileName("plain")), []byte("{}"), 0o600))
+
+	return dir
+}
+
+func searchTestIDs(t *testing.T, index *SearchIndex, query string) []string {
+	parsed, err := ParseSearchQuery(query)
+	require.NoError(t, err)
+
+	return xslices.Map(index.Search(parsed), func(document SearchDocument) string { return document.ID })
+}
+
+func TestSearchIndex(t *testing.T) {
+	dir := writeSearchTestMessages(t)
+
+	index, err := BuildSearchIndex(context.Background(), dir)
+	require.NoError(t, err)
+	require.Equal(t, 2, index.Len())
+
+	for query, expected := range map[string][]string{
+		"report":                       {"plain"},
+		"REPORT":                       {"plain"},
+		"café":                         {"plain"},
+		"mountains":                    {"multipart"},
+		"beach":                        {}, // Style sheets are not indexed.
+		"subject:holiday":              {"multipart"},
+		"body:holiday":                 {},
+		"attachment:summit":            {"multipart"},
+		"attachment:summit.jpg":        {"multipart"},
+		"from:alice@proton.me":         {"plain"},
+		"to:alice@proton.me":           {"multipart"},
+		"to:dave":                      {"multipart"},
+		"alice":                        {"multipart", "plain"},
+		`"quarterly report"`:           {"plain"},
+		`from:"carol example"`:         {"multipart"},
+		"quart*":                       {"plain"},
+		"numbers mountains":            {},
+		"numbers OR mountains":         {"multipart", "plain"},
+		"alice -report":                {"multipart"},
+		"alice NOT from:alice":         {"multipart"},
+		"(report OR photos) AND alice": {"multipart", "plain"},
+		"after:2024-02-01":             {"multipart"},
+		"before:2024-02-01":            {"plain"},
+	} {
+		require.Equal(t, expected, searchTestIDs(t, index, query), query)
+	}
+
+	// Paths are relative to the indexed folder, results are sorted most recent first.
+	parsed, err := ParseSearchQuery("alice")
+	require.NoError(t, err)
+	results := index.Search(parsed)
+	require.Equal(t, "mail_20240101_120000/multipart.eml", results[0].Path)
+	require.Equal(t, "Holiday photos", results[0].Subject)
+	require.Equal(t, "Carol <carol@example.com>", results[0].From)
+
+	// A message indexed twice is only listed once.
+	require.NoError(t, index.AddMessage("plain", "plain.eml", []byte(searchTestPlainMessage)))
+	require.Equal(t, 2, index.Len())
+}
+
+func TestOpenSearchIndex(t *testing.T) {
+	dir := writeSearchTestMessages(t)
+
+	tmpDir := t.TempDir()
+
+	index, err := OpenSearchIndex(context.Background(), dir, tmpDir, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, index.Len())
+	require.FileExists(t, filepath.Join(dir, getSearchIndexFileName()))
+
+	// The saved index is used as long as it is not rebuilt.
+	require.NoError(t, os.Remove(filepath.Join(dir, "mail_20240101_120000", getEMLFileName("plain"))))
+
+	index, err = OpenSearchIndex(context.Background(), dir, tmpDir, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"plain"}, searchTestIDs(t, index, "report"))
+
+	index, err = OpenSearchIndex(context.Background(), dir, tmpDir, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, index.Len())
+	require.Empty(t, searchTestIDs(t, index, "report"))
+}
+
+func TestParseSearchQuery_Invalid(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"   ",
+		"(report",
+		"report)",
+		`"report`,
+		"unknown:report",
+		"after:yesterday",
+		"report OR",
+		"-",
+		"from:...",
+	} {
+		_, err := ParseSearchQuery(query)
+		require.ErrorIs(t, err, ErrInvalidSearchQuery, query)
+	}
+}
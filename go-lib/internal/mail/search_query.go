@@ -0,0 +1,446 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+// SearchQuery is a parsed search query. The query syntax is:
+//
+//   - `word` matches the messages holding the word in any field, `word*` any word starting with it;
+//   - `"several words"` matches the messages holding all the words;
+//   - `from:`, `to:`, `subject:`, `body:` and `attachment:` restrict a word or a quoted text to a field;
+//   - `after:YYYY-MM-DD` and `before:YYYY-MM-DD` match the messages sent after or before a date;
+//   - terms separated by spaces must all match, `OR` matches either side, `-term` or `NOT term` excludes, and
+//     parentheses group terms.
+//
+// Matching is case-insensitive.
+type SearchQuery struct {
+	root searchNode
+}
+
+// searchNode is a node of the tree of a parsed query, it returns the documents of the index it matches.
+type searchNode interface {
+	match(index *SearchIndex) searchMatches
+}
+
+// searchMatches tells, for each document of the index, whether it matches.
+type searchMatches []bool
+
+func ParseSearchQuery(query string) (*SearchQuery, error) {
+	tokens, err := lexSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: the query is empty", ErrInvalidSearchQuery)
+	}
+
+	parser := searchQueryParser{tokens: tokens}
+
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !parser.done() {
+		return nil, fmt.Errorf("%w: unexpected '%v'", ErrInvalidSearchQuery, parser.peek().text)
+	}
+
+	return &SearchQuery{root: root}, nil
+}
+
+// Search returns the messages matching query, most recent first.
+func (s *SearchIndex) Search(query *SearchQuery) []SearchDocument {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	matches := query.root.match(s)
+
+	var result []SearchDocument
+
+	for i, matched := range matches {
+		if matched {
+			result = append(result, s.documents[i])
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Date > result[j].Date })
+
+	return result
+}
+
+type searchTokenKind int
+
+const (
+	searchTokenWord searchTokenKind = iota
+	searchTokenOpen
+	searchTokenClose
+	searchTokenNot
+)
+
+type searchToken struct {
+	kind   searchTokenKind
+	field  string // Field prefix of a word, empty for none.
+	text   string
+	quoted bool
+}
+
+// lexSearchQuery splits a query into words, quoted texts, parentheses and negations.
+func lexSearchQuery(query string) ([]searchToken, error) {
+	var tokens []searchToken
+
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, searchToken{kind: searchTokenOpen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, searchToken{kind: searchTokenClose, text: ")"})
+			i++
+		case r == '-':
+			tokens = append(tokens, searchToken{kind: searchTokenNot, text: "-"})
+			i++
+		default:
+			token := searchToken{kind: searchTokenWord}
+
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				if runes[i] == ':' && len(token.field) == 0 {
+					token.field = strings.ToLower(string(runes[start:i]))
+					start = i + 1
+				}
+				i++
+			}
+
+			token.text = string(runes[start:i])
+
+			if i < len(runes) && runes[i] == '"' {
+				if len(token.text) != 0 {
+					return nil, fmt.Errorf("%w: unexpected '\"' after '%v'", ErrInvalidSearchQuery, token.text)
+				}
+
+				end := i + 1
+				for end < len(runes) && runes[end] != '"' {
+					end++
+				}
+
+				if end == len(runes) {
+					return nil, fmt.Errorf("%w: missing closing '\"'", ErrInvalidSearchQuery)
+				}
+
+				token.text = string(runes[i+1 : end])
+				token.quoted = true
+				i = end + 1
+			}
+
+			if !token.quoted && len(token.field) == 0 && token.text == "NOT" {
+				token.kind = searchTokenNot
+			}
+
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens, nil
+}
+
+type searchQueryParser struct {
+	tokens []searchToken
+	pos    int
+}
+
+func (p *searchQueryParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *searchQueryParser) peek() searchToken {
+	return p.tokens[p.pos]
+}
+
+func (p *searchQueryParser) isWord(text string) bool {
+	return !p.done() && p.peek().kind == searchTokenWord && !p.peek().quoted && len(p.peek().field) == 0 && p.peek().text == text
+}
+
+// parseOr parses terms separated by OR.
+func (p *searchQueryParser) parseOr() (searchNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isWord("OR") {
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		node = searchOrNode{left: node, right: right}
+	}
+
+	return node, nil
+}
+
+// parseAnd parses terms which must all match, up to an OR or a closing parenthesis.
+func (p *searchQueryParser) parseAnd() (searchNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for !p.done() && p.peek().kind != searchTokenClose && !p.isWord("OR") {
+		if p.isWord("AND") {
+			p.pos++
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		node = searchAndNode{left: node, right: right}
+	}
+
+	return node, nil
+}
+
+func (p *searchQueryParser) parseUnary() (searchNode, error) {
+	if p.done() {
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrInvalidSearchQuery)
+	}
+
+	switch token := p.peek(); token.kind {
+	case searchTokenNot:
+		p.pos++
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return searchNotNode{node: node}, nil
+
+	case searchTokenOpen:
+		p.pos++
+
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.done() || p.peek().kind != searchTokenClose {
+			return nil, fmt.Errorf("%w: missing closing ')'", ErrInvalidSearchQuery)
+		}
+
+		p.pos++
+
+		return node, nil
+
+	case searchTokenClose:
+		return nil, fmt.Errorf("%w: unexpected ')'", ErrInvalidSearchQuery)
+
+	case searchTokenWord:
+		p.pos++
+
+		return newSearchTermNode(token)
+	}
+
+	return nil, fmt.Errorf("%w: unexpected '%v'", ErrInvalidSearchQuery, p.peek().text)
+}
+
+func newSearchTermNode(token searchToken) (searchNode, error) {
+	switch token.field {
+	case "after", "before":
+		date, err := FilterParser{}.ParseDate(token.text)
+		if err != nil || date == nil {
+			return nil, fmt.Errorf("%w: invalid date '%v'", ErrInvalidSearchQuery, token.text)
+		}
+
+		return searchDateNode{date: *date, after: token.field == "after"}, nil
+	}
+
+	node := searchTermNode{fields: searchFields}
+
+	if len(token.field) != 0 {
+		field := SearchField(token.field)
+		if !isSearchField(field) {
+			return nil, fmt.Errorf("%w: unknown field '%v'", ErrInvalidSearchQuery, token.field)
+		}
+
+		node.fields = []SearchField{field}
+	}
+
+	text := token.text
+	if !token.quoted && strings.HasSuffix(text, "*") {
+		text = strings.TrimSuffix(text, "*")
+		node.prefix = true
+	}
+
+	node.terms = tokenizeSearchText(text)
+	if len(node.terms) == 0 {
+		return nil, fmt.Errorf("%w: '%v' holds no word to search for", ErrInvalidSearchQuery, token.text)
+	}
+
+	return node, nil
+}
+
+func isSearchField(field SearchField) bool {
+	for _, f := range searchFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// searchTermNode matches the documents holding all its terms in one of its fields. With prefix, the last term
+// matches any word starting with it.
+type searchTermNode struct {
+	fields []SearchField
+	terms  []string
+	prefix bool
+}
+
+func (n searchTermNode) match(index *SearchIndex) searchMatches {
+	result := make(searchMatches, len(index.documents))
+
+	for _, field := range n.fields {
+		fieldMatches := allSearchMatches(len(index.documents))
+
+		for i, term := range n.terms {
+			termMatches := make(searchMatches, len(index.documents))
+
+			if n.prefix && i == len(n.terms)-1 {
+				for indexed, docs := range index.terms[field] {
+					if strings.HasPrefix(indexed, term) {
+						termMatches.set(docs)
+					}
+				}
+			} else {
+				termMatches.set(index.terms[field][term])
+			}
+
+			fieldMatches.and(termMatches)
+		}
+
+		result.or(fieldMatches)
+	}
+
+	return result
+}
+
+type searchDateNode struct {
+	date  time.Time
+	after bool
+}
+
+func (n searchDateNode) match(index *SearchIndex) searchMatches {
+	result := make(searchMatches, len(index.documents))
+
+	for i, document := range index.documents {
+		if document.Date == 0 {
+			continue
+		}
+
+		if n.after {
+			result[i] = document.Date >= n.date.Unix()
+		} else {
+			result[i] = document.Date < n.date.Unix()
+		}
+	}
+
+	return result
+}
+
+type searchAndNode struct {
+	left, right searchNode
+}
+
+func (n searchAndNode) match(index *SearchIndex) searchMatches {
+	result := n.left.match(index)
+	result.and(n.right.match(index))
+
+	return result
+}
+
+type searchOrNode struct {
+	left, right searchNode
+}
+
+func (n searchOrNode) match(index *SearchIndex) searchMatches {
+	result := n.left.match(index)
+	result.or(n.right.match(index))
+
+	return result
+}
+
+type searchNotNode struct {
+	node searchNode
+}
+
+func (n searchNotNode) match(index *SearchIndex) searchMatches {
+	result := n.node.match(index)
+	for i := range result {
+		result[i] = !result[i]
+	}
+
+	return result
+}
+
+func allSearchMatches(count int) searchMatches {
+	result := make(searchMatches, count)
+	for i := range result {
+		result[i] = true
+	}
+
+	return result
+}
+
+func (m searchMatches) set(docs []int) {
+	for _, doc := range docs {
+		m[doc] = true
+	}
+}
+
+func (m searchMatches) and(other searchMatches) {
+	for i := range m {
+		m[i] = m[i] && other[i]
+	}
+}
+
+func (m searchMatches) or(other searchMatches) {
+	for i := range m {
+		m[i] = m[i] || other[i]
+	}
+}
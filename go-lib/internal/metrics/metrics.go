@@ -0,0 +1,187 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package metrics collects local Prometheus metrics about the export pipeline and the API usage. These metrics are
+// never sent anywhere, they can only be scraped from the optional local endpoint. See the telemetry package for the
+// statistics reported to Proton.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "proton_export"
+
+// Metrics holds the collectors of one session. A nil *Metrics is valid and records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	stageMessages   *prometheus.CounterVec
+	stageBytes      *prometheus.CounterVec
+	stageQueueDepth *prometheus.GaugeVec
+	stageChunkTime  *prometheus.HistogramVec
+	stageFailures   *prometheus.CounterVec
+
+	apiLatency *prometheus.HistogramVec
+	apiRetries *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		stageMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stage_messages_total",
+			Help:      "Number of messages processed by a pipeline stage.",
+		}, []string{"stage"}),
+		stageBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stage_bytes_total",
+			Help:      "Number of bytes processed by a pipeline stage.",
+		}, []string{"stage"}),
+		stageQueueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "stage_queue_depth",
+			Help:      "Number of messages received by a pipeline stage which have not been passed on yet.",
+		}, []string{"stage"}),
+		stageChunkTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "stage_chunk_duration_seconds",
+			Help:      "Time needed by a pipeline stage to process one chunk of messages.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, []string{"stage"}),
+		stageFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stage_message_failures_total",
+			Help:      "Number of messages which failed in a pipeline stage.",
+		}, []string{"stage"}),
+		apiLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "api_request_duration_seconds",
+			Help:      "Latency of the API requests per route and result.",
+			Buckets:   prometheus.ExponentialBuckets(0.025, 2, 12),
+		}, []string{"route", "result"}),
+		apiRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_retries_total",
+			Help:      "Number of API requests which were retried per route.",
+		}, []string{"route"}),
+	}
+
+	m.registry.MustRegister(
+		m.stageMessages,
+		m.stageBytes,
+		m.stageQueueDepth,
+		m.stageChunkTime,
+		m.stageFailures,
+		m.apiLatency,
+		m.apiRetries,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler returns the http handler exposing the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// StageStarted records that a stage has received a chunk of messages. It must be balanced by StageDone once the chunk
+// leaves the stage, whether it was processed or not.
+func (m *Metrics) StageStarted(stage string, messages int) {
+	if m == nil {
+		return
+	}
+
+	m.stageQueueDepth.WithLabelValues(stage).Add(float64(messages))
+}
+
+// StageDone records that a chunk of messages received by StageStarted has left the stage.
+func (m *Metrics) StageDone(stage string, messages int) {
+	if m == nil {
+		return
+	}
+
+	m.stageQueueDepth.WithLabelValues(stage).Sub(float64(messages))
+}
+
+// StageFinished records that a stage has finished processing a chunk of messages started at start. It does not change
+// the queue depth, so that it can also be used by the stages producing messages.
+func (m *Metrics) StageFinished(stage string, messages int, bytes uint64, start time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.stageMessages.WithLabelValues(stage).Add(float64(messages))
+	m.stageBytes.WithLabelValues(stage).Add(float64(bytes))
+	m.stageChunkTime.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) MessageFailed(stage string) {
+	if m == nil {
+		return
+	}
+
+	m.stageFailures.WithLabelValues(stage).Inc()
+}
+
+func (m *Metrics) OnRequest(route string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.apiLatency.WithLabelValues(route, requestResult(err)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) OnRetry(route string, _ error) {
+	if m == nil {
+		return
+	}
+
+	m.apiRetries.WithLabelValues(route).Inc()
+}
+
+func requestResult(err error) string {
+	if err == nil {
+		return "ok"
+	}
+
+	if apiErr := new(proton.APIError); errors.As(err, &apiErr) {
+		return strconv.Itoa(apiErr.Status)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return "cancelled"
+	}
+
+	if netErr := new(proton.NetError); errors.As(err, &netErr) {
+		return "network"
+	}
+
+	return "error"
+}
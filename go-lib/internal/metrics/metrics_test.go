@@ -0,0 +1,112 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gluon/async"
+	"github.com/ProtonMail/go-proton-api"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, handler http.Handler) string {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	return rec.Body.String()
+}
+
+func TestMetrics_Stages(t *testing.T) {
+	m := New()
+
+	start := time.Now()
+	m.StageStarted("write", 10)
+	m.StageFinished("write", 10, 2048, start)
+	m.StageDone("write", 10)
+	m.StageStarted("write", 5)
+	m.StageFinished("metadata", 20, 0, start)
+	m.MessageFailed("download")
+
+	out := scrape(t, m.Handler())
+	require.Contains(t, out, `proton_export_stage_messages_total{stage="write"} 10`)
+	require.Contains(t, out, `proton_export_stage_bytes_total{stage="write"} 2048`)
+	require.Contains(t, out, `proton_export_stage_queue_depth{stage="write"} 5`)
+	require.Contains(t, out, `proton_export_stage_chunk_duration_seconds_count{stage="write"} 1`)
+	require.Contains(t, out, `proton_export_stage_message_failures_total{stage="download"} 1`)
+	require.Contains(t, out, `proton_export_stage_messages_total{stage="metadata"} 20`)
+	require.NotContains(t, out, `proton_export_stage_queue_depth{stage="metadata"}`)
+
+	m.StageDone("write", 5)
+	require.Contains(t, scrape(t, m.Handler()), `proton_export_stage_queue_depth{stage="write"} 0`)
+}
+
+func TestMetrics_Requests(t *testing.T) {
+	m := New()
+
+	m.OnRequest("GetMessage", time.Millisecond, nil)
+	m.OnRequest("GetMessage", time.Millisecond, &proton.APIError{Status: 429})
+	m.OnRequest("GetMessage", time.Millisecond, errors.New("failed"))
+	m.OnRetry("GetMessage", &proton.APIError{Status: 429})
+
+	out := scrape(t, m.Handler())
+	require.Contains(t, out, `proton_export_api_request_duration_seconds_count{result="ok",route="GetMessage"} 1`)
+	require.Contains(t, out, `proton_export_api_request_duration_seconds_count{result="429",route="GetMessage"} 1`)
+	require.Contains(t, out, `proton_export_api_request_duration_seconds_count{result="error",route="GetMessage"} 1`)
+	require.Contains(t, out, `proton_export_api_retries_total{route="GetMessage"} 1`)
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+
+	m.StageStarted("write", 1)
+	m.StageFinished("write", 1, 1, time.Now())
+	m.StageDone("write", 1)
+	m.MessageFailed("write")
+	m.OnRequest("GetMessage", time.Second, nil)
+	m.OnRetry("GetMessage", nil)
+}
+
+func TestServer(t *testing.T) {
+	m := New()
+	m.OnRequest("GetUser", time.Millisecond, nil)
+
+	server, err := StartServer("127.0.0.1:0", m, &async.NoopPanicHandler{})
+	require.NoError(t, err)
+	defer server.Close()
+
+	resp, err := http.Get("http://" + server.Addr() + "/metrics") //nolint:noctx
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `proton_export_api_request_duration_seconds_count{result="ok",route="GetUser"} 1`)
+}
+
+func TestServer_RejectsNonLocalAddress(t *testing.T) {
+	_, err := StartServer("0.0.0.0:0", New(), &async.NoopPanicHandler{})
+	require.ErrorIs(t, err, utils.ErrNonLocalAddress)
+}
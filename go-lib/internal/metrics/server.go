@@ -0,0 +1,95 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ProtonMail/export-tool/internal/utils"
+	"github.com/ProtonMail/gluon/async"
+	"github.com/sirupsen/logrus"
+)
+
+const serverShutdownTimeout = 5 * time.Second
+
+// Server serves the metrics on the /metrics path of a local http endpoint.
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+	done     chan struct{}
+}
+
+// StartServer starts serving m on addr, e.g. "127.0.0.1:9090". Use port 0 to pick a free port. The endpoint has no
+// authentication, so addr must be a loopback address; a missing host defaults to 127.0.0.1.
+func StartServer(addr string, m *Metrics, panicHandler async.PanicHandler) (*Server, error) {
+	addr, err := utils.LocalListenAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on '%v': %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+
+	s := &Server{
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		listener: listener,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer async.HandlePanic(panicHandler)
+		defer close(s.done)
+
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Error("Metrics server stopped")
+		}
+	}()
+
+	logrus.WithField("addr", s.Addr()).Info("Serving metrics")
+
+	return s, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		logrus.WithError(err).Error("Failed to shutdown metrics server")
+	}
+
+	<-s.done
+}
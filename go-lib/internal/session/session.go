@@ -24,16 +24,20 @@ import (
 	"strings"
 
 	"github.com/ProtonMail/export-tool/internal/apiclient"
+	"github.com/ProtonMail/export-tool/internal/metrics"
 	"github.com/ProtonMail/export-tool/internal/reporter"
 	"github.com/ProtonMail/export-tool/internal/telemetry"
+	"github.com/ProtonMail/export-tool/internal/tracing"
 	"github.com/ProtonMail/gluon/async"
 	"github.com/ProtonMail/go-proton-api"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type LoginState int
 
 var ErrInvalidLoginState = errors.New("invalid login state")
+var ErrMetricsServerRunning = errors.New("metrics server is already running")
 
 const (
 	LoginStateLoggedOut LoginState = iota
@@ -43,6 +47,23 @@ const (
 	LoginStateLoggedIn
 )
 
+func (l LoginState) String() string {
+	switch l {
+	case LoginStateLoggedOut:
+		return "logged-out"
+	case LoginStateAwaitingTOTP:
+		return "awaiting-totp"
+	case LoginStateAwaitingMailboxPassword:
+		return "awaiting-mailbox-password"
+	case LoginStateAwaitingHV:
+		return "awaiting-hv"
+	case LoginStateLoggedIn:
+		return "logged-in"
+	default:
+		return "unknown"
+	}
+}
+
 type Session struct {
 	panicHandler     async.PanicHandler
 	clientBuilder    apiclient.Builder
@@ -57,6 +78,8 @@ type Session struct {
 	user             proton.User
 	userSalts        proton.Salts
 	telemetryService *telemetry.Service
+	metrics          *metrics.Metrics
+	metricsServer    *metrics.Server
 }
 
 func NewSession(
@@ -75,6 +98,7 @@ func NewSession(
 		loginState:       LoginStateLoggedOut,
 		prevLoginState:   LoginStateLoggedOut,
 		telemetryService: telemetry.NewService(telemetryDisabled),
+		metrics:          metrics.New(),
 	}
 }
 
@@ -90,13 +114,17 @@ func (s *Session) Close(ctx context.Context) {
 	}
 	s.clientBuilder.Close()
 	s.setMailboxPassword(nil)
+	s.StopMetricsServer()
 }
 
-func (s *Session) Login(ctx context.Context, email string, password []byte) error {
+func (s *Session) Login(ctx context.Context, email string, password []byte) (err error) {
 	if email == "crash@bandicoot" {
 		panic("Crash Time")
 	}
 
+	ctx, endTrace := s.traceLoginStep(ctx, "Login")
+	defer func() { endTrace(err) }()
+
 	if s.loginState != LoginStateLoggedOut && s.loginState != LoginStateAwaitingHV {
 		return ErrInvalidLoginState
 	}
@@ -113,8 +141,9 @@ func (s *Session) Login(ctx context.Context, email string, password []byte) erro
 		return err
 	}
 
-	client = apiclient.NewAutoRetryClient(client, &apiclient.SleepRetryStrategyBuilder{})
-	s.client = client
+	retryClient := apiclient.NewAutoRetryClient(client, &apiclient.SleepRetryStrategyBuilder{})
+	retryClient.SetRequestObserver(s.metrics)
+	s.client = retryClient
 	s.setMailboxPassword(password)
 	s.passwordMode = auth.PasswordMode
 
@@ -142,7 +171,10 @@ func (s *Session) Login(ctx context.Context, email string, password []byte) erro
 	return nil
 }
 
-func (s *Session) Logout(ctx context.Context) error {
+func (s *Session) Logout(ctx context.Context) (err error) {
+	ctx, endTrace := s.traceLoginStep(ctx, "Logout")
+	defer func() { endTrace(err) }()
+
 	if s.loginState == LoginStateLoggedOut {
 		return ErrInvalidLoginState
 	}
@@ -161,7 +193,10 @@ func (s *Session) Logout(ctx context.Context) error {
 	return nil
 }
 
-func (s *Session) SubmitTOTP(ctx context.Context, totp string) error {
+func (s *Session) SubmitTOTP(ctx context.Context, totp string) (err error) {
+	ctx, endTrace := s.traceLoginStep(ctx, "SubmitTOTP")
+	defer func() { endTrace(err) }()
+
 	if s.loginState != LoginStateAwaitingTOTP {
 		return ErrInvalidLoginState
 	}
@@ -192,13 +227,15 @@ func (s *Session) SubmitTOTP(ctx context.Context, totp string) error {
 	return nil
 }
 
-func (s *Session) SubmitMailboxPassword(validator apiclient.MailboxPasswordValidator, password []byte) error {
+func (s *Session) SubmitMailboxPassword(validator apiclient.MailboxPasswordValidator, password []byte) (err error) {
+	_, endTrace := s.traceLoginStep(context.Background(), "SubmitMailboxPassword")
+	defer func() { endTrace(err) }()
+
 	if s.loginState != LoginStateAwaitingMailboxPassword {
 		return ErrInvalidLoginState
 	}
 	logrus.Debugf("Submitting Mailbox Password")
 
-	logrus.WithField("user", s.user).WithField("salts", s.userSalts).Info("...")
 	if !validator.IsValid(password) {
 		return fmt.Errorf("invalid mailbox password")
 	}
@@ -218,7 +255,10 @@ func (s *Session) GetHVSolveURL() (string, error) {
 		s.hvDetails.Token), nil
 }
 
-func (s *Session) MarkHVSolved(ctx context.Context) error {
+func (s *Session) MarkHVSolved(ctx context.Context) (err error) {
+	ctx, endTrace := s.traceLoginStep(ctx, "MarkHVSolved")
+	defer func() { endTrace(err) }()
+
 	if s.loginState != LoginStateAwaitingHV || s.hvDetails == nil {
 		return ErrInvalidLoginState
 	}
@@ -265,10 +305,50 @@ func (s *Session) GetTelemetryService() *telemetry.Service {
 	return s.telemetryService
 }
 
+func (s *Session) GetMetrics() *metrics.Metrics {
+	return s.metrics
+}
+
+// StartMetricsServer exposes the session metrics on addr and returns the address the server listens on.
+func (s *Session) StartMetricsServer(addr string) (string, error) {
+	if s.metricsServer != nil {
+		return "", ErrMetricsServerRunning
+	}
+
+	server, err := metrics.StartServer(addr, s.metrics, s.panicHandler)
+	if err != nil {
+		return "", err
+	}
+
+	s.metricsServer = server
+
+	return server.Addr(), nil
+}
+
+func (s *Session) StopMetricsServer() {
+	if s.metricsServer == nil {
+		return
+	}
+
+	s.metricsServer.Close()
+	s.metricsServer = nil
+}
+
 func (s *Session) SendUnauthTelemetry(ctx context.Context, telemetryData proton.SendStatsReq) error {
 	return s.clientBuilder.SendUnauthTelemetry(ctx, telemetryData)
 }
 
+// traceLoginStep starts a span for a step of the login flow. The returned function records the resulting login state
+// and the error of the step, if any.
+func (s *Session) traceLoginStep(ctx context.Context, step string) (context.Context, func(err error)) {
+	ctx, span := tracing.Start(ctx, "session."+step, attribute.String("login.state.from", s.loginState.String()))
+
+	return ctx, func(err error) {
+		span.SetAttributes(attribute.String("login.state.to", s.loginState.String()))
+		tracing.End(span, err)
+	}
+}
+
 func (s *Session) checkHVRequest(err error) bool {
 	if details := apiclient.GetHVData(err); details != nil {
 		s.prevLoginState = s.loginState
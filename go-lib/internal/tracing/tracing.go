@@ -0,0 +1,133 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package tracing provides optional OpenTelemetry tracing of the session, the export pipeline and the API calls.
+// Until Init is called, spans are recorded by the global no-op tracer provider and cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ProtonMail/export-tool/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName  = "github.com/ProtonMail/export-tool"
+	serviceName = "proton-mail-export"
+)
+
+var ErrNoTraceExporter = errors.New("either an OTLP endpoint or a trace file must be set")
+
+type Config struct {
+	// Endpoint is the URL of an OTLP/HTTP collector, e.g. http://localhost:4318.
+	Endpoint string
+	// File is the path of a file the spans are written to as JSON, one span per line.
+	File string
+}
+
+type ShutdownFn func(ctx context.Context) error
+
+// Init installs a global tracer provider exporting the spans as configured. The returned function flushes the
+// pending spans and must be called before the process exits.
+func Init(ctx context.Context, cfg Config) (ShutdownFn, error) {
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+
+	switch {
+	case cfg.Endpoint != "":
+		e, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+
+		exporter = e
+
+	case cfg.File != "":
+		file, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trace file: %w", err)
+		}
+
+		e, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+
+		exporter = e
+		closeFile = file.Close
+
+	default:
+		return nil, ErrNoTraceExporter
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(internal.ETVersionString),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+
+		if closeFile != nil {
+			err = errors.Join(err, closeFile())
+		}
+
+		return err
+	}, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Start starts a new span as a child of the span in ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartLinked starts a new span like Start and links it to the span of the previous pipeline stage.
+func StartLinked(ctx context.Context, name string, link trace.SpanContext, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...), trace.WithLinks(trace.Link{SpanContext: link}))
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil && span.IsRecording() {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestInit_File(t *testing.T) {
+	prevProvider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(prevProvider)
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+
+	shutdown, err := Init(context.Background(), Config{File: path})
+	require.NoError(t, err)
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child", attribute.Int("messages", 3))
+	End(child, errors.New("failed"))
+	End(parent, nil)
+
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	type exportedSpan struct {
+		Name   string
+		Parent struct{ SpanID string }
+		Status struct{ Code string }
+	}
+
+	var spans []exportedSpan
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var span exportedSpan
+		require.NoError(t, decoder.Decode(&span))
+		spans = append(spans, span)
+	}
+
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, "Error", spans[0].Status.Code)
+	require.Equal(t, "parent", spans[1].Name)
+}
+
+func TestInit_NoExporter(t *testing.T) {
+	_, err := Init(context.Background(), Config{})
+	require.ErrorIs(t, err, ErrNoTraceExporter)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var ErrNonLocalAddress = errors.New("only loopback addresses are allowed")
+
+// LocalListenAddr validates that addr only listens on the local machine. A missing host is replaced with 127.0.0.1,
+// any other host than localhost or a loopback IP is rejected with ErrNonLocalAddress.
+func LocalListenAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address '%v': %w", addr, err)
+	}
+
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+
+	if strings.EqualFold(host, "localhost") {
+		return addr, nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return addr, nil
+	}
+
+	return "", fmt.Errorf("%w: '%v'", ErrNonLocalAddress, addr)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2024 Proton AG
+//
+// This file is part of Proton Export Tool.
+//
+// Proton Export Tool is Free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Proton Export Tool is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Proton Export Tool.  If not, see <https://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalListenAddr(t *testing.T) {
+	for addr, expected := range map[string]string{
+		":9090":          "127.0.0.1:9090",
+		"127.0.0.1:0":    "127.0.0.1:0",
+		"127.0.0.2:1143": "127.0.0.2:1143",
+		"localhost:9090": "localhost:9090",
+		"[::1]:9090":     "[::1]:9090",
+		"LOCALHOST:1143": "LOCALHOST:1143",
+	} {
+		actual, err := LocalListenAddr(addr)
+		require.NoError(t, err, addr)
+		require.Equal(t, expected, actual)
+	}
+
+	for _, addr := range []string{"0.0.0.0:9090", "[::]:9090", "192.168.1.10:9090", "example.com:9090"} {
+		_, err := LocalListenAddr(addr)
+		require.ErrorIs(t, err, ErrNonLocalAddress, addr)
+	}
+
+	_, err := LocalListenAddr("9090")
+	require.Error(t, err)
+}
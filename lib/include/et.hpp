@@ -24,6 +24,9 @@ namespace etcpp {
 
 class GlobalScope final {
 public:
+    enum class LogFormat { Text, JSON };
+    enum class LogLevel { Error, Warn, Info, Debug };
+
     explicit GlobalScope(const std::filesystem::path& p, void (*onRecover)());
     ~GlobalScope();
 
@@ -32,8 +35,16 @@ public:
     GlobalScope& operator=(const GlobalScope&) = delete;
     GlobalScope operator=(GlobalScope&&) = delete;
 
+    // Returns the log file currently written, it changes once the log is rotated.
     std::optional<std::filesystem::path> getLogPath() const;
 
+    // Change the log format and level. A new log file is started once the current one exceeds maxFileSizeMB. If
+    // maxFiles is not 0, only the latest maxFiles log files are kept in the log folder.
+    void setLogOptions(LogFormat format, LogLevel level, int maxFileSizeMB, int maxFiles);
+
+    // Export OpenTelemetry traces to an OTLP/HTTP endpoint or, if endpoint is empty, as JSON to filePath.
+    void initTracing(const char* endpoint, const char* filePath);
+
     static void reportMessage(const char* tag, const char*);
     static void reportError(const char* tag, const char*);
 
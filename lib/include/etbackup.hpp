@@ -42,11 +42,29 @@ public:
     virtual ~BackupCallback() = default;
 
     virtual void onProgress(float progress) = 0;
+
+    virtual void onPauseStateChanged(bool /*paused*/) {}
 };
 
 class Backup final {
     friend class Session;
 
+public:
+    enum class FailurePolicy {
+        Abort,
+        Continue,
+    };
+
+    enum class LowDiskSpacePolicy {
+        Abort,
+        Pause,
+    };
+
+    enum class SummaryFormat {
+        JSON,
+        Text,
+    };
+
 private:
     const Session& mSession;
     etBackup* mPtr;
@@ -65,10 +83,43 @@ public:
 
     void cancel();
 
+    void pause();
+
+    void resume();
+
+    bool isPaused() const;
+
+    void setFailurePolicy(FailurePolicy policy);
+
+    std::uint64_t getFailedMessageCount() const;
+
+    std::string getSummary(SummaryFormat format) const;
+
     std::filesystem::path getExportPath() const;
 
     std::uint64_t getExpectedDiskUsage() const;
 
+    std::uint64_t getAvailableDiskSpace() const;
+
+    void setDiskSpaceCheck(bool enabled);
+
+    void setLowDiskSpacePolicy(LowDiskSpacePolicy policy);
+
+    // Write the passphrase-protected private keys of the account, and their public keys, to the backup.
+    void setKeyExport(bool enabled);
+
+    // Write the mail settings of the account and the settings of its addresses to the backup.
+    void setSettingsExport(bool enabled);
+
+    // Write the contacts of the account to the backup as vCard files.
+    void setContactsExport(bool enabled);
+
+    // Build a full-text search index of the messages while they are written.
+    void setSearchIndex(bool enabled);
+
+    // Write an SQLite catalog of the messages, updated while they are written.
+    void setCatalog(bool enabled);
+
 private:
     template<class F>
     void wrapCCall(F func);
@@ -20,6 +20,7 @@
 #include <exception>
 #include <filesystem>
 #include <string>
+#include <vector>
 
 #include "etexception.hpp"
 
@@ -42,11 +43,32 @@ public:
     virtual ~RestoreCallback() = default;
 
     virtual void onProgress(float progress) = 0;
+
+    virtual void onPauseStateChanged(bool /*paused*/) {}
 };
 
 class Restore final {
     friend class Session;
 
+public:
+    enum class ReportFormat {
+        JSON,
+        Text,
+    };
+
+    enum class ImportLabelMode {
+        Create,
+        Existing,
+        None,
+    };
+
+    enum class SourceFormat {
+        Backup,
+        Mbox,
+        Maildir,
+        EML,
+    };
+
 private:
     const Session& mSession;
     etRestore* mPtr;
@@ -65,11 +87,60 @@ public:
 
     void cancel();
 
+    void pause();
+
+    void resume();
+
+    bool isPaused() const;
+
+    void setDryRun(bool dryRun);
+
+    // Label applied to every restored message. The name is required in Existing mode, and may contain the {date} and
+    // {time} placeholders. The default name and colour are used if they are empty.
+    void setImportLabel(ImportLabelMode mode, const char* name = "", const char* color = "");
+
+    // Apply the mail settings saved in the backup to the account.
+    void setSettingsRestore(bool enabled);
+
+    // Skip the messages already present on the account, enabled by default.
+    void setDedupe(bool enabled);
+
+    void setParallelImports(int parallelImports);
+
+    void setSourceFormat(SourceFormat format);
+
+    void setLabelMappingFile(const std::filesystem::path& path);
+
+    std::filesystem::path writeLabelMappingTemplate(const std::filesystem::path& path) const;
+
+    void setTargetAddress(const char* email);
+
+    void setAddressMapping(const char* mapping);
+
+    // Restrict the restore to the messages of the backup matching the filter. Lists are comma separated and dates are
+    // in the YYYY-MM-DD format, empty values are ignored.
+    void setFilterLabelIDs(const char* labelIDs);
+    void setFilterSender(const char* sender);
+    void setFilterRecipient(const char* recipient);
+    void setFilterDomain(const char* domain);
+    void setFilterAfter(const char* after);
+    void setFilterBefore(const char* before);
+    void setFilterSubject(const char* subject);
+
+    // Comma separated names of the backup sub-folders to restore, all of them if empty.
+    void setBackupFolders(const char* folders);
+
+    std::vector<std::string> getBackupFolders() const;
+
+    std::string getDryRunReport(ReportFormat format) const;
+
     std::filesystem::path getBackupPath() const;
     int64_t getImportableCount() const;
     int64_t getImportedCount() const;
     int64_t getFailedCount() const;
     int64_t getSkippedCount() const;
+    int64_t getDuplicateCount() const;
+    int64_t getEncryptedCount() const;
 
 private:
     template<class F>
@@ -17,8 +17,10 @@
 
 #pragma once
 
+#include <cstdint>
 #include <memory>
 #include <string>
+#include <vector>
 
 #include "etbackup.hpp"
 #include "etexception.hpp"
@@ -55,6 +57,25 @@ private:
 public:
     enum class LoginState { LoggedOut, AwaitingTOTP, AwaitingHV, AwaitingMailboxPassword, LoggedIn };
 
+    struct DecryptResult {
+        int64_t decryptedCount = 0;
+        int64_t failedCount = 0;
+    };
+
+    struct IMAPServerInfo {
+        std::string addr;
+        int64_t messageCount = 0;
+        int64_t skippedCount = 0;
+    };
+
+    struct SearchResult {
+        std::string id;
+        std::string path;
+        std::string from;
+        std::string subject;
+        int64_t date = 0;
+    };
+
     inline explicit Session(const char* serverURL) : Session(serverURL, false, {}) {}
     explicit Session(const char* serverURL, const bool telemetryDisabled, const std::shared_ptr<SessionCallback>& mCallbacks);
     ~Session();
@@ -82,9 +103,35 @@ public:
         const char* before = "",
         const char* subject = ""
     ) const;
+    [[nodiscard]] Backup newRetryFailedBackup(const char* backupPath) const;
     [[nodiscard]] Restore newRestore(const char* backupPath) const;
     [[nodiscard]] std::string getLabels() const;
 
+    // Decrypt the message parts of the backup which were written encrypted and rebuild their EML files. The keys of the
+    // logged in account are used unless privateKeyPath points to an armored address private key.
+    [[nodiscard]] DecryptResult decryptBackup(const char* backupPath, const char* privateKeyPath = "",
+                                              std::string_view privateKeyPassword = {}) const;
+
+    // Search the messages of the backup with its local full-text index, which is built first if it is missing or when
+    // rebuild is set. Paths are relative to the backup folder. Does not require a logged in session.
+    [[nodiscard]] std::vector<SearchResult> searchBackup(const char* backupPath, const char* query, bool rebuild = false) const;
+
+    // Replace the SQLite catalog of the backup by one describing the messages found in the backup folder. Returns the
+    // number of cataloged messages. Does not require a logged in session.
+    int64_t rebuildCatalog(const char* backupPath) const;
+
+    // Serve the messages of the backup over IMAP on addr, read-only, until stopIMAPServer() is called. addr must be a
+    // loopback address as the server has no TLS. The messages saved in parts are not served. Does not require a logged
+    // in session.
+    [[nodiscard]] IMAPServerInfo startIMAPServer(const char* backupPath, const char* addr, const char* username,
+                                                 const char* password);
+    void stopIMAPServer();
+
+    // Serve the session metrics on http://<addr>/metrics. Only loopback addresses are accepted. Returns the address the
+    // server listens on.
+    std::string startMetricsServer(const char* addr);
+    void stopMetricsServer();
+
     void setUsingDefaultExportPath(const bool usingDefaultExportPath);
     void sendProcessStartTelemetry(bool etOperation, bool etDir, bool etUserPassword, bool etUserMailboxPassword, bool etTotpCode, bool etUserEmail);
     void cancel();
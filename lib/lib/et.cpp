@@ -46,6 +46,46 @@ std::optional<std::filesystem::path> GlobalScope::getLogPath() const {
     return std::filesystem::u8path(clogPath);
 }
 
+void GlobalScope::setLogOptions(LogFormat format, LogLevel level, int maxFileSizeMB, int maxFiles) {
+    const auto etFormat = format == LogFormat::JSON ? ET_LOG_FORMAT_JSON : ET_LOG_FORMAT_TEXT;
+
+    etLogLevel etLevel = ET_LOG_LEVEL_DEBUG;
+    switch (level) {
+    case LogLevel::Error:
+        etLevel = ET_LOG_LEVEL_ERROR;
+        break;
+    case LogLevel::Warn:
+        etLevel = ET_LOG_LEVEL_WARN;
+        break;
+    case LogLevel::Info:
+        etLevel = ET_LOG_LEVEL_INFO;
+        break;
+    case LogLevel::Debug:
+        etLevel = ET_LOG_LEVEL_DEBUG;
+        break;
+    }
+
+    if (etSetLogOptions(etFormat, etLevel, maxFileSizeMB, maxFiles) != 0) {
+        const char* lastErr = etGetLastError();
+        if (lastErr == nullptr) {
+            lastErr = "unknown error";
+        }
+
+        throw Exception(lastErr);
+    }
+}
+
+void GlobalScope::initTracing(const char* endpoint, const char* filePath) {
+    if (etInitTracing(endpoint, filePath) != 0) {
+        const char* lastErr = etGetLastError();
+        if (lastErr == nullptr) {
+            lastErr = "unknown error";
+        }
+
+        throw Exception(lastErr);
+    }
+}
+
 void GlobalScope::reportMessage(const char* tag, const char* msg) {
     etReportMessage(tag, msg);
 }
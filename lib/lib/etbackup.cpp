@@ -45,6 +45,7 @@ etBackupCallbacks makeETCallback(BackupCallback& cb) {
     auto r = etBackupCallbacks{};
     r.ptr = &cb;
     r.onProgress = [](void* p, float progress) { reinterpret_cast<BackupCallback*>(p)->onProgress(progress); };
+    r.onPauseStateChanged = [](void* p, int paused) { reinterpret_cast<BackupCallback*>(p)->onPauseStateChanged(paused != 0); };
 
     return r;
 }
@@ -66,6 +67,42 @@ void Backup::cancel() {
     wrapCCall([&](etBackup* ptr) { return etBackupCancel(ptr); });
 }
 
+void Backup::pause() {
+    wrapCCall([&](etBackup* ptr) { return etBackupPause(ptr); });
+}
+
+void Backup::resume() {
+    wrapCCall([&](etBackup* ptr) { return etBackupResume(ptr); });
+}
+
+bool Backup::isPaused() const {
+    int paused = 0;
+    wrapCCall([&](etBackup* ptr) { return etBackupIsPaused(ptr, &paused); });
+    return paused != 0;
+}
+
+void Backup::setFailurePolicy(FailurePolicy policy) {
+    const auto etPolicy = policy == FailurePolicy::Continue ? ET_BACKUP_FAILURE_POLICY_CONTINUE : ET_BACKUP_FAILURE_POLICY_ABORT;
+    wrapCCall([&](etBackup* ptr) { return etBackupSetFailurePolicy(ptr, etPolicy); });
+}
+
+std::uint64_t Backup::getFailedMessageCount() const {
+    std::uint64_t count = 0;
+    wrapCCall([&](etBackup* ptr) { return etBackupGetFailedMessageCount(ptr, &count); });
+    return count;
+}
+
+std::string Backup::getSummary(SummaryFormat format) const {
+    const auto etFormat = format == SummaryFormat::Text ? ET_BACKUP_SUMMARY_FORMAT_TEXT : ET_BACKUP_SUMMARY_FORMAT_JSON;
+    char* outSummary = nullptr;
+    wrapCCall([&](etBackup* ptr) { return etBackupGetSummary(ptr, etFormat, &outSummary); });
+
+    auto result = std::string(outSummary);
+    etFree(outSummary);
+
+    return result;
+}
+
 std::filesystem::path Backup::getExportPath() const {
     char* outPath = nullptr;
     wrapCCall([&](etBackup* ptr) { return etBackupGetExportPath(ptr, &outPath); });
@@ -82,6 +119,41 @@ std::uint64_t Backup::getExpectedDiskUsage() const {
     return usage;
 }
 
+std::uint64_t Backup::getAvailableDiskSpace() const {
+    std::uint64_t space = 0;
+    wrapCCall([&](etBackup* ptr) { return etBackupGetAvailableDiskSpace(ptr, &space); });
+    return space;
+}
+
+void Backup::setDiskSpaceCheck(bool enabled) {
+    wrapCCall([&](etBackup* ptr) { return etBackupSetDiskSpaceCheck(ptr, enabled ? 1 : 0); });
+}
+
+void Backup::setKeyExport(bool enabled) {
+    wrapCCall([&](etBackup* ptr) { return etBackupSetKeyExport(ptr, enabled ? 1 : 0); });
+}
+
+void Backup::setSettingsExport(bool enabled) {
+    wrapCCall([&](etBackup* ptr) { return etBackupSetSettingsExport(ptr, enabled ? 1 : 0); });
+}
+
+void Backup::setContactsExport(bool enabled) {
+    wrapCCall([&](etBackup* ptr) { return etBackupSetContactsExport(ptr, enabled ? 1 : 0); });
+}
+
+void Backup::setSearchIndex(bool enabled) {
+    wrapCCall([&](etBackup* ptr) { return etBackupSetSearchIndex(ptr, enabled ? 1 : 0); });
+}
+
+void Backup::setCatalog(bool enabled) {
+    wrapCCall([&](etBackup* ptr) { return etBackupSetCatalog(ptr, enabled ? 1 : 0); });
+}
+
+void Backup::setLowDiskSpacePolicy(LowDiskSpacePolicy policy) {
+    const auto etPolicy = policy == LowDiskSpacePolicy::Pause ? ET_BACKUP_LOW_DISK_SPACE_POLICY_PAUSE : ET_BACKUP_LOW_DISK_SPACE_POLICY_ABORT;
+    wrapCCall([&](etBackup* ptr) { return etBackupSetLowDiskSpacePolicy(ptr, etPolicy); });
+}
+
 template<class F>
 void Backup::wrapCCall(F func) {
     static_assert(std::is_invocable_r_v<etBackupStatus, F, etBackup*>, "invalid function/lambda signature");
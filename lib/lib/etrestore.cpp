@@ -18,6 +18,7 @@
 #include "etrestore.hpp"
 
 #include <proton-mail-export.h>
+#include <sstream>
 #include "etsession.hpp"
 
 namespace etcpp {
@@ -44,6 +45,7 @@ etRestoreCallbacks makeETRestoreCallback(RestoreCallback& cb) {
     auto r = etRestoreCallbacks{};
     r.ptr = &cb;
     r.onProgress = [](void* p, float progress) { reinterpret_cast<RestoreCallback*>(p)->onProgress(progress); };
+    r.onPauseStateChanged = [](void* p, int paused) { reinterpret_cast<RestoreCallback*>(p)->onPauseStateChanged(paused != 0); };
 
     return r;
 }
@@ -65,6 +67,155 @@ void Restore::cancel() {
     wrapCCall([&](etRestore* ptr) { return etRestoreCancel(ptr); });
 }
 
+void Restore::pause() {
+    wrapCCall([&](etRestore* ptr) { return etRestorePause(ptr); });
+}
+
+void Restore::resume() {
+    wrapCCall([&](etRestore* ptr) { return etRestoreResume(ptr); });
+}
+
+bool Restore::isPaused() const {
+    int paused = 0;
+    wrapCCall([&](etRestore* ptr) { return etRestoreIsPaused(ptr, &paused); });
+    return paused != 0;
+}
+
+void Restore::setDryRun(bool dryRun) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetDryRun(ptr, dryRun ? 1 : 0); });
+}
+
+void Restore::setImportLabel(ImportLabelMode mode, const char* name, const char* color) {
+    etRestoreImportLabelMode etMode = ET_RESTORE_IMPORT_LABEL_MODE_CREATE;
+    switch (mode) {
+    case ImportLabelMode::Create:
+        etMode = ET_RESTORE_IMPORT_LABEL_MODE_CREATE;
+        break;
+    case ImportLabelMode::Existing:
+        etMode = ET_RESTORE_IMPORT_LABEL_MODE_EXISTING;
+        break;
+    case ImportLabelMode::None:
+        etMode = ET_RESTORE_IMPORT_LABEL_MODE_NONE;
+        break;
+    }
+
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetImportLabel(ptr, etMode, name, color); });
+}
+
+void Restore::setSettingsRestore(bool enabled) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetSettingsRestore(ptr, enabled ? 1 : 0); });
+}
+
+void Restore::setDedupe(bool enabled) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetDedupe(ptr, enabled ? 1 : 0); });
+}
+
+void Restore::setParallelImports(int parallelImports) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetParallelImports(ptr, parallelImports); });
+}
+
+void Restore::setSourceFormat(SourceFormat format) {
+    etRestoreSourceFormat etFormat = ET_RESTORE_SOURCE_FORMAT_BACKUP;
+    switch (format) {
+    case SourceFormat::Backup:
+        etFormat = ET_RESTORE_SOURCE_FORMAT_BACKUP;
+        break;
+    case SourceFormat::Mbox:
+        etFormat = ET_RESTORE_SOURCE_FORMAT_MBOX;
+        break;
+    case SourceFormat::Maildir:
+        etFormat = ET_RESTORE_SOURCE_FORMAT_MAILDIR;
+        break;
+    case SourceFormat::EML:
+        etFormat = ET_RESTORE_SOURCE_FORMAT_EML;
+        break;
+    }
+
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetSourceFormat(ptr, etFormat); });
+}
+
+void Restore::setLabelMappingFile(const std::filesystem::path& path) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetLabelMappingFile(ptr, path.u8string().c_str()); });
+}
+
+std::filesystem::path Restore::writeLabelMappingTemplate(const std::filesystem::path& path) const {
+    char* outPath = nullptr;
+    wrapCCall([&](etRestore* ptr) { return etRestoreWriteLabelMappingTemplate(ptr, path.u8string().c_str(), &outPath); });
+
+    auto result = std::filesystem::u8path(outPath);
+    etFree(outPath);
+
+    return result;
+}
+
+void Restore::setTargetAddress(const char* email) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetTargetAddress(ptr, email); });
+}
+
+void Restore::setAddressMapping(const char* mapping) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetAddressMapping(ptr, mapping); });
+}
+
+void Restore::setFilterLabelIDs(const char* labelIDs) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetFilterLabelIDs(ptr, labelIDs); });
+}
+
+void Restore::setFilterSender(const char* sender) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetFilterSender(ptr, sender); });
+}
+
+void Restore::setFilterRecipient(const char* recipient) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetFilterRecipient(ptr, recipient); });
+}
+
+void Restore::setFilterDomain(const char* domain) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetFilterDomain(ptr, domain); });
+}
+
+void Restore::setFilterAfter(const char* after) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetFilterAfter(ptr, after); });
+}
+
+void Restore::setFilterBefore(const char* before) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetFilterBefore(ptr, before); });
+}
+
+void Restore::setFilterSubject(const char* subject) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetFilterSubject(ptr, subject); });
+}
+
+void Restore::setBackupFolders(const char* folders) {
+    wrapCCall([&](etRestore* ptr) { return etRestoreSetBackupFolders(ptr, folders); });
+}
+
+std::vector<std::string> Restore::getBackupFolders() const {
+    char* outFolders = nullptr;
+    wrapCCall([&](etRestore* ptr) { return etRestoreGetBackupFolders(ptr, &outFolders); });
+
+    std::vector<std::string> result;
+    std::istringstream stream(outFolders);
+    etFree(outFolders);
+
+    for (std::string folder; std::getline(stream, folder);) {
+        if (!folder.empty()) {
+            result.push_back(folder);
+        }
+    }
+
+    return result;
+}
+
+std::string Restore::getDryRunReport(ReportFormat format) const {
+    const auto etFormat = format == ReportFormat::Text ? ET_RESTORE_REPORT_FORMAT_TEXT : ET_RESTORE_REPORT_FORMAT_JSON;
+    char* outReport = nullptr;
+    wrapCCall([&](etRestore* ptr) { return etRestoreGetDryRunReport(ptr, etFormat, &outReport); });
+
+    auto result = std::string(outReport);
+    etFree(outReport);
+
+    return result;
+}
+
 std::filesystem::path Restore::getBackupPath() const {
     char* outPath = nullptr;
     wrapCCall([&](etRestore* ptr) { return etRestoreGetBackupPath(ptr, &outPath); });
@@ -103,6 +254,20 @@ int64_t Restore::getSkippedCount() const {
     return result;
 }
 
+int64_t Restore::getDuplicateCount() const {
+    int64_t result = 0;
+    wrapCCall([&](etRestore* ptr) { return etRestoreGetDuplicateCount(ptr, &result); });
+
+    return result;
+}
+
+int64_t Restore::getEncryptedCount() const {
+    int64_t result = 0;
+    wrapCCall([&](etRestore* ptr) { return etRestoreGetEncryptedCount(ptr, &result); });
+
+    return result;
+}
+
 template<class F>
 void Restore::wrapCCall(F func) {
     static_assert(std::is_invocable_r_v<etRestoreStatus, F, etRestore*>, "invalid function/lambda signature");
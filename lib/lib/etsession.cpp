@@ -18,6 +18,8 @@
 #include <etsession.hpp>
 #include <proton-mail-export.h>
 
+#include <sstream>
+
 namespace etcpp {
 
 const std::string killSwitchEnabledErrMsg = "killSwitchEnabled";
@@ -169,6 +171,13 @@ Backup Session::newBackup(
     return Backup(*this, exportPtr);
 }
 
+Backup Session::newRetryFailedBackup(const char* backupPath) const {
+    etBackup* exportPtr = nullptr;
+    wrapCCall([&](etSession* ptr) -> etSessionStatus { return etSessionNewRetryFailedBackup(ptr, backupPath, &exportPtr); });
+
+    return Backup(*this, exportPtr);
+}
+
 Restore Session::newRestore(const char* backupPath) const {
     etRestore* restorePtr = nullptr;
     wrapCCall([&](etSession* ptr) -> etSessionStatus { return etSessionNewRestore(ptr, backupPath, &restorePtr); });
@@ -186,6 +195,90 @@ std::string Session::getLabels() const {
     return result;
 }
 
+Session::DecryptResult Session::decryptBackup(const char* backupPath, const char* privateKeyPath,
+                                              std::string_view privateKeyPassword) const {
+    DecryptResult result;
+    wrapCCall([&](etSession* ptr) -> etSessionStatus {
+        return etSessionDecryptBackup(ptr, backupPath, privateKeyPath, privateKeyPassword.data(), int(privateKeyPassword.length()),
+                                      &result.decryptedCount, &result.failedCount);
+    });
+
+    return result;
+}
+
+std::vector<Session::SearchResult> Session::searchBackup(const char* backupPath, const char* query, bool rebuild) const {
+    char* outResults = nullptr;
+    wrapCCall([&](etSession* ptr) -> etSessionStatus {
+        return etSessionSearchBackup(ptr, backupPath, query, rebuild ? 1 : 0, &outResults);
+    });
+
+    std::vector<SearchResult> results;
+    std::istringstream lines(outResults);
+    etFree(outResults);
+
+    std::string line;
+    while (std::getline(lines, line)) {
+        std::vector<std::string> fields;
+        std::istringstream lineStream(line);
+        for (std::string field; std::getline(lineStream, field, '\t');) {
+            fields.push_back(field);
+        }
+
+        if (fields.size() < 5) {
+            continue;
+        }
+
+        SearchResult result;
+        result.id = fields[0];
+        result.path = fields[1];
+        result.date = std::stoll(fields[2]);
+        result.from = fields[3];
+        result.subject = fields[4];
+        results.push_back(std::move(result));
+    }
+
+    return results;
+}
+
+int64_t Session::rebuildCatalog(const char* backupPath) const {
+    int64_t count = 0;
+    wrapCCall([&](etSession* ptr) -> etSessionStatus { return etSessionRebuildCatalog(ptr, backupPath, &count); });
+
+    return count;
+}
+
+Session::IMAPServerInfo Session::startIMAPServer(const char* backupPath, const char* addr, const char* username,
+                                                 const char* password) {
+    IMAPServerInfo info;
+    char* outAddr = nullptr;
+    wrapCCall([&](etSession* ptr) -> etSessionStatus {
+        return etSessionStartIMAPServer(ptr, backupPath, addr, username, password, &outAddr, &info.messageCount, &info.skippedCount);
+    });
+
+    info.addr = std::string(outAddr);
+    etFree(outAddr);
+
+    return info;
+}
+
+void Session::stopIMAPServer() {
+    wrapCCall([](etSession* ptr) { return etSessionStopIMAPServer(ptr); });
+}
+
+std::string Session::startMetricsServer(const char* addr) {
+    char* outAddr = nullptr;
+    wrapCCall([&](etSession* ptr) -> etSessionStatus { return etSessionStartMetricsServer(ptr, addr, &outAddr); });
+
+    auto result = std::string(outAddr);
+    etFree(outAddr);
+
+    return result;
+}
+
+void Session::stopMetricsServer() {
+    wrapCCall([](etSession* ptr) { return etSessionStopMetricsServer(ptr); });
+}
+
 void Session::setUsingDefaultExportPath(const bool usingDefaultExportPath) {
     wrapCCall([&usingDefaultExportPath](etSession* ptr) { return etSessionSetUsingDefaultExportPath(ptr, usingDefaultExportPath); });
 }